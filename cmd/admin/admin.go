@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/CodisLabs/codis/pkg/models"
@@ -33,6 +35,8 @@ func (t *cmdAdmin) Main(d map[string]interface{}) {
 		t.handleConfigRestore(d)
 	case d["--dashboard-list"].(bool):
 		t.handleDashboardList(d)
+	case d["--config-migrate"].(bool):
+		t.handleConfigMigrate(d)
 	}
 }
 
@@ -58,6 +62,20 @@ func (t *cmdAdmin) newTopomClient(d map[string]interface{}) models.Client {
 			coordinator.auth = utils.ArgumentMust(d, "--etcd-auth")
 		}
 
+	case d["--etcdv3"] != nil:
+		coordinator.name = "etcdv3"
+		coordinator.addr = utils.ArgumentMust(d, "--etcdv3")
+		if d["--etcdv3-auth"] != nil {
+			coordinator.auth = utils.ArgumentMust(d, "--etcdv3-auth")
+		}
+
+	case d["--raft"] != nil:
+		coordinator.name = "raft"
+		coordinator.addr = utils.ArgumentMust(d, "--raft")
+		if d["--raft-auth"] != nil {
+			coordinator.auth = utils.ArgumentMust(d, "--raft-auth")
+		}
+
 	case d["--filesystem"] != nil:
 		coordinator.name = "filesystem"
 		coordinator.addr = utils.ArgumentMust(d, "--filesystem")
@@ -378,6 +396,9 @@ func (t *cmdAdmin) handleConfigRestore(d map[string]interface{}) {
 	if len(group) != 0 || len(proxy) != 0 {
 		log.Panicf("product %s is not empty", t.product)
 	}
+	if _, err := store.SlotMappings(); err != nil {
+		log.PanicErrorf(err, "load slots failed")
+	}
 
 	for _, s := range config.Slots {
 		if err := store.UpdateSlotMapping(s); err != nil {
@@ -434,3 +455,80 @@ func (t *cmdAdmin) handleDashboardList(d map[string]interface{}) {
 		fmt.Println(string(b))
 	}
 }
+
+func (t *cmdAdmin) handleConfigMigrate(d map[string]interface{}) {
+	store := t.newTopomStore(d)
+	defer store.Close()
+
+	var auth string
+	if d["--etcdv3-auth"] != nil {
+		auth = utils.ArgumentMust(d, "--etcdv3-auth")
+	}
+	addr := utils.ArgumentMust(d, "--etcdv3")
+	client, err := models.NewClient("etcdv3", addr, auth, time.Minute)
+	if err != nil {
+		log.PanicErrorf(err, "create 'etcdv3' client to '%s' failed", addr)
+	}
+	defer client.Close()
+
+	var nodes = make(map[string][]byte)
+	t.walkConfig(store.Client(), models.ProductDir(t.product), func(path string, data []byte) {
+		switch {
+		case path == store.LockPath():
+		case strings.HasPrefix(path, store.ElectionDir()+"/"):
+		default:
+			nodes[path] = data
+		}
+	})
+	if len(nodes) == 0 {
+		log.Panicf("cann't find product = %s [etcd]", t.product)
+	}
+
+	var paths []string
+	for path := range nodes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	if !d["--confirm"].(bool) {
+		for _, path := range paths {
+			fmt.Println(path)
+		}
+		return
+	}
+
+	if list, err := client.List(models.ProductDir(t.product), false); err != nil {
+		log.PanicErrorf(err, "list product failed [etcdv3]")
+	} else if len(list) != 0 {
+		log.Panicf("product %s is not empty [etcdv3]", t.product)
+	}
+
+	for _, path := range paths {
+		if err := client.Create(path, nodes[path]); err != nil {
+			log.PanicErrorf(err, "migrate %s failed", path)
+		}
+		log.Debugf("migrate %s OK", path)
+	}
+	log.Warnf("migrate product %s, %d nodes copied", t.product, len(paths))
+}
+
+func (t *cmdAdmin) walkConfig(client models.Client, path string, fn func(path string, data []byte)) {
+	files, err := client.List(path, false)
+	if err == nil && len(files) != 0 {
+		for _, path := range files {
+			t.walkConfig(client, path, fn)
+		}
+		return
+	}
+	b, rerr := client.Read(path, false)
+	switch {
+	case rerr == nil:
+		if b != nil {
+			fn(path, b)
+		}
+	case err == nil:
+		// empty directory
+	default:
+		log.PanicErrorf(rerr, "read file = %s failed", path)
+	}
+}
@@ -0,0 +1,524 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/CodisLabs/codis/pkg/models"
+	"github.com/CodisLabs/codis/pkg/topom"
+	"github.com/CodisLabs/codis/pkg/utils"
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+)
+
+// applySpec is the desired state of a product, e.g.
+//
+//	sentinels = ["127.0.0.1:26379"]
+//
+//	[[group]]
+//	id = 1
+//	  [[group.server]]
+//	  addr = "127.0.0.1:6379"
+//	  datacenter = "dc1"
+//	  [[group.server]]
+//	  addr = "127.0.0.1:6380"
+//	  replica_group = true
+//
+//	[[slots]]
+//	beg = 0
+//	end = 1023
+//	group = 1
+//
+// The first server of a group is the master. Groups & servers that are not
+// listed are removed, slots that are not listed are left as they are. If
+// sentinels or groups are omitted, they are left as they are.
+type applySpec struct {
+	Sentinels []string      `toml:"sentinels"`
+	Group     []*applyGroup `toml:"group"`
+	Slots     []*applySlots `toml:"slots"`
+}
+
+type applyGroup struct {
+	Id     int            `toml:"id"`
+	Server []*applyServer `toml:"server"`
+}
+
+type applyServer struct {
+	Addr         string `toml:"addr"`
+	DataCenter   string `toml:"datacenter"`
+	ReplicaGroup bool   `toml:"replica_group"`
+}
+
+type applySlots struct {
+	Beg     int `toml:"beg"`
+	End     int `toml:"end"`
+	GroupId int `toml:"group"`
+}
+
+func loadApplySpec(path string) (*applySpec, error) {
+	spec := &applySpec{}
+	if _, err := toml.DecodeFile(path, spec); err != nil {
+		return nil, errors.Trace(err)
+	}
+	var groups = make(map[int]*applyGroup)
+	var servers = make(map[string]bool)
+	for _, g := range spec.Group {
+		if g.Id <= 0 || g.Id > models.MaxGroupId {
+			return nil, errors.Errorf("invalid group id = %d, out of range", g.Id)
+		}
+		if groups[g.Id] != nil {
+			return nil, errors.Errorf("group-[%d] is duplicated", g.Id)
+		}
+		groups[g.Id] = g
+		for _, x := range g.Server {
+			if x.Addr == "" {
+				return nil, errors.Errorf("group-[%d] has invalid server address", g.Id)
+			}
+			if servers[x.Addr] {
+				return nil, errors.Errorf("server-[%s] is duplicated", x.Addr)
+			}
+			servers[x.Addr] = true
+		}
+	}
+	var slots = make(map[int]bool)
+	for _, r := range spec.Slots {
+		if !(r.Beg >= 0 && r.Beg <= r.End && r.End < models.MaxSlotNum) {
+			return nil, errors.Errorf("invalid slot range [%d,%d]", r.Beg, r.End)
+		}
+		if spec.Group != nil {
+			if g := groups[r.GroupId]; g == nil || len(g.Server) == 0 {
+				return nil, errors.Errorf("slot range [%d,%d] is assigned to group-[%d], which is missing or empty", r.Beg, r.End, r.GroupId)
+			}
+		}
+		for sid := r.Beg; sid <= r.End; sid++ {
+			if slots[sid] {
+				return nil, errors.Errorf("slot-[%d] is duplicated", sid)
+			}
+			slots[sid] = true
+		}
+	}
+	return spec, nil
+}
+
+type applyStep struct {
+	desc string
+	exec func(c *topom.ApiClient) error
+}
+
+type applyPlan struct {
+	steps []*applyStep
+}
+
+func (p *applyPlan) add(exec func(c *topom.ApiClient) error, format string, args ...interface{}) {
+	p.steps = append(p.steps, &applyStep{desc: fmt.Sprintf(format, args...), exec: exec})
+}
+
+func newApplyPlan(spec *applySpec, stats *topom.Stats) (*applyPlan, error) {
+	var plan = &applyPlan{}
+
+	var group = make(map[int]*models.Group)
+	var owner = make(map[string]*models.Group)
+	for _, g := range stats.Group.Models {
+		if g.Promoting.State != models.ActionNothing {
+			return nil, errors.Errorf("group-[%d] is promoting", g.Id)
+		}
+		group[g.Id] = g
+		for _, x := range g.Servers {
+			owner[x.Addr] = g
+		}
+	}
+
+	// slots are owned by the target group once the migration is done
+	var using = make(map[int]bool)
+	var migrate = make(map[int]int)
+	var waiting []int
+	var desired = make(map[int]int)
+	for _, r := range spec.Slots {
+		for sid := r.Beg; sid <= r.End; sid++ {
+			desired[sid] = r.GroupId
+		}
+	}
+	for _, m := range stats.Slots {
+		gid, ok := desired[m.Id]
+		switch {
+		case m.Action.State != models.ActionNothing:
+			if ok && m.Action.TargetId != gid {
+				return nil, errors.Errorf("slot-[%d] is being migrated to group-[%d]", m.Id, m.Action.TargetId)
+			}
+			using[m.Action.TargetId] = true
+			waiting = append(waiting, m.Id)
+		case ok && m.GroupId != gid:
+			if spec.Group == nil {
+				if g := group[gid]; g == nil || len(g.Servers) == 0 {
+					return nil, errors.Errorf("slot-[%d] can't be migrated to group-[%d], which is missing or empty", m.Id, gid)
+				}
+			}
+			using[gid] = true
+			migrate[m.Id] = gid
+			waiting = append(waiting, m.Id)
+		default:
+			using[m.GroupId] = true
+		}
+	}
+	if len(migrate) != 0 && stats.SlotAction.Disabled {
+		return nil, errors.Errorf("slot action is disabled")
+	}
+
+	var removed []*models.Group
+	var moved = make(map[string]bool)
+	var promoted []int
+	var syncing []string
+	var resync = make(map[int]bool)
+
+	if spec.Group != nil {
+		var wanted = make(map[int]*applyGroup)
+		for _, g := range spec.Group {
+			wanted[g.Id] = g
+		}
+		for _, g := range stats.Group.Models {
+			if wanted[g.Id] == nil {
+				if using[g.Id] {
+					return nil, errors.Errorf("group-[%d] isn't listed but still in use", g.Id)
+				}
+				removed = append(removed, g)
+			}
+		}
+
+		for _, w := range spec.Group {
+			gid := w.Id
+			if len(w.Server) == 0 && using[gid] {
+				return nil, errors.Errorf("group-[%d] has no server but still in use", gid)
+			}
+			for _, x := range w.Server {
+				g := owner[x.Addr]
+				if g == nil {
+					continue
+				}
+				index := groupIndex(g, x.Addr)
+				switch {
+				case g.Id != gid:
+					if index == 0 {
+						return nil, errors.Errorf("server-[%s] is master of group-[%d], can't be moved to group-[%d]", x.Addr, g.Id, gid)
+					}
+				case g.Servers[index].DataCenter != x.DataCenter:
+					if index == 0 {
+						return nil, errors.Errorf("server-[%s] is master of group-[%d], can't change datacenter", x.Addr, g.Id)
+					}
+				default:
+					continue
+				}
+				moved[x.Addr] = true
+				plan.add(groupDelServer(g.Id, x.Addr), "remove server-[%s] from group-[%d]", x.Addr, g.Id)
+			}
+		}
+
+		for _, w := range spec.Group {
+			gid := w.Id
+			g := group[gid]
+			if g == nil {
+				plan.add(func(c *topom.ApiClient) error {
+					return c.CreateGroup(gid)
+				}, "create group-[%d]", gid)
+			}
+
+			var servers []string
+			if g != nil {
+				for _, x := range g.Servers {
+					if !moved[x.Addr] {
+						servers = append(servers, x.Addr)
+					}
+				}
+			}
+			for _, x := range w.Server {
+				if owner[x.Addr] != nil && !moved[x.Addr] {
+					continue
+				}
+				addr, dc := x.Addr, x.DataCenter
+				plan.add(func(c *topom.ApiClient) error {
+					return c.GroupAddServer(gid, dc, addr)
+				}, "add server-[%s] to group-[%d], datacenter = %q", addr, gid, dc)
+				if len(servers) != 0 {
+					syncing = append(syncing, addr)
+				}
+				servers = append(servers, addr)
+			}
+			if len(w.Server) != 0 && servers[0] != w.Server[0].Addr {
+				promoted = append(promoted, gid)
+			}
+		}
+
+		for _, addr := range syncing {
+			plan.add(syncCreateAction(addr), "sync server-[%s]", addr)
+		}
+		if len(syncing) != 0 {
+			plan.add(waitSyncActions(syncing), "wait for %d servers to be synced", len(syncing))
+		}
+
+		if len(promoted) != 0 {
+			var others []string
+			for _, gid := range promoted {
+				w := wanted[gid]
+				master := w.Server[0].Addr
+				plan.add(func(c *topom.ApiClient) error {
+					return c.GroupPromoteServer(gid, master)
+				}, "promote server-[%s] of group-[%d]", master, gid)
+				for _, x := range w.Server[1:] {
+					others = append(others, x.Addr)
+				}
+			}
+			for _, addr := range others {
+				plan.add(syncCreateAction(addr), "sync server-[%s]", addr)
+			}
+			if len(others) != 0 {
+				plan.add(waitSyncActions(others), "wait for %d servers to be synced", len(others))
+			}
+		}
+
+		for _, w := range spec.Group {
+			g := group[w.Id]
+			if g == nil || len(w.Server) == 0 {
+				continue
+			}
+			var listed = make(map[string]bool)
+			for _, x := range w.Server {
+				listed[x.Addr] = true
+			}
+			for _, x := range g.Servers {
+				if !listed[x.Addr] && !moved[x.Addr] {
+					plan.add(groupDelServer(g.Id, x.Addr), "remove server-[%s] from group-[%d]", x.Addr, g.Id)
+				}
+			}
+		}
+
+		for _, w := range spec.Group {
+			for _, x := range w.Server {
+				var enabled bool
+				if g := owner[x.Addr]; g != nil && !moved[x.Addr] {
+					enabled = g.Servers[groupIndex(g, x.Addr)].ReplicaGroup
+				}
+				if enabled == x.ReplicaGroup {
+					continue
+				}
+				gid, addr, value := w.Id, x.Addr, x.ReplicaGroup
+				plan.add(func(c *topom.ApiClient) error {
+					return c.EnableReplicaGroups(gid, addr, value)
+				}, "set replica-groups of server-[%s] = %t", addr, value)
+				resync[gid] = true
+			}
+		}
+		for _, w := range spec.Group {
+			if gid := w.Id; resync[gid] {
+				plan.add(func(c *topom.ApiClient) error {
+					return c.ResyncGroup(gid)
+				}, "resync group-[%d]", gid)
+			}
+		}
+	}
+
+	var slotIds = make([]int, 0, len(migrate))
+	for sid := range migrate {
+		slotIds = append(slotIds, sid)
+	}
+	sort.Ints(slotIds)
+	for i := 0; i < len(slotIds); {
+		beg, gid := slotIds[i], migrate[slotIds[i]]
+		end := beg
+		for i++; i < len(slotIds) && slotIds[i] == end+1 && migrate[slotIds[i]] == gid; i++ {
+			end++
+		}
+		plan.add(func(c *topom.ApiClient) error {
+			return c.SlotCreateActionRange(beg, end, gid)
+		}, "migrate slots [%04d,%04d] to group-[%d]", beg, end, gid)
+	}
+	if len(waiting) != 0 {
+		plan.add(waitSlotActions(waiting), "wait for %d slots to be migrated", len(waiting))
+	}
+
+	if spec.Group != nil {
+		for _, w := range spec.Group {
+			if g := group[w.Id]; g != nil && len(w.Server) == 0 {
+				removed = append(removed, g)
+			}
+		}
+		for _, g := range removed {
+			for i := len(g.Servers) - 1; i >= 0; i-- {
+				addr := g.Servers[i].Addr
+				if moved[addr] {
+					continue
+				}
+				plan.add(groupDelServer(g.Id, addr), "remove server-[%s] from group-[%d]", addr, g.Id)
+			}
+			if wantedGroup(spec, g.Id) == nil {
+				gid := g.Id
+				plan.add(func(c *topom.ApiClient) error {
+					return c.RemoveGroup(gid)
+				}, "remove group-[%d]", gid)
+			}
+		}
+	}
+
+	if spec.Sentinels != nil {
+		var current = make(map[string]bool)
+		if p := stats.HA.Model; p != nil {
+			for _, addr := range p.Servers {
+				current[addr] = true
+			}
+		}
+		var listed = make(map[string]bool)
+		for _, addr := range spec.Sentinels {
+			listed[addr] = true
+			if !current[addr] {
+				addr := addr
+				plan.add(func(c *topom.ApiClient) error {
+					return c.AddSentinel(addr)
+				}, "add sentinel-[%s]", addr)
+			}
+		}
+		if p := stats.HA.Model; p != nil {
+			for _, addr := range p.Servers {
+				if !listed[addr] {
+					addr := addr
+					plan.add(func(c *topom.ApiClient) error {
+						return c.DelSentinel(addr, false)
+					}, "remove sentinel-[%s]", addr)
+				}
+			}
+		}
+	}
+	return plan, nil
+}
+
+func wantedGroup(spec *applySpec, gid int) *applyGroup {
+	for _, g := range spec.Group {
+		if g.Id == gid {
+			return g
+		}
+	}
+	return nil
+}
+
+func groupIndex(g *models.Group, addr string) int {
+	for i, x := range g.Servers {
+		if x.Addr == addr {
+			return i
+		}
+	}
+	return -1
+}
+
+func groupDelServer(gid int, addr string) func(c *topom.ApiClient) error {
+	return func(c *topom.ApiClient) error {
+		return c.GroupDelServer(gid, addr)
+	}
+}
+
+func syncCreateAction(addr string) func(c *topom.ApiClient) error {
+	return func(c *topom.ApiClient) error {
+		return c.SyncCreateAction(addr)
+	}
+}
+
+func waitSyncActions(addrs []string) func(c *topom.ApiClient) error {
+	return func(c *topom.ApiClient) error {
+		var wait = make(map[string]bool)
+		for _, addr := range addrs {
+			wait[addr] = true
+		}
+		for {
+			stats, err := c.Stats()
+			if err != nil {
+				return err
+			}
+			var pending int
+			for _, g := range stats.Group.Models {
+				for _, x := range g.Servers {
+					if !wait[x.Addr] {
+						continue
+					}
+					switch x.Action.State {
+					case models.ActionPending, models.ActionSyncing:
+						pending++
+					case "synced_failed":
+						return errors.Errorf("server-[%s] sync failed", x.Addr)
+					}
+				}
+			}
+			if pending == 0 {
+				return nil
+			}
+			log.Infof("wait for %d servers to be synced", pending)
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+func waitSlotActions(slots []int) func(c *topom.ApiClient) error {
+	return func(c *topom.ApiClient) error {
+		for {
+			stats, err := c.Stats()
+			if err != nil {
+				return err
+			}
+			if stats.SlotAction.Disabled {
+				return errors.Errorf("slot action is disabled")
+			}
+			var pending int
+			for _, sid := range slots {
+				if stats.Slots[sid].Action.State != models.ActionNothing {
+					pending++
+				}
+			}
+			if pending == 0 {
+				return nil
+			}
+			log.Infof("wait for %d slots to be migrated", pending)
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+func (t *cmdDashboard) handleApply(d map[string]interface{}) {
+	c := t.newTopomClient()
+
+	spec, err := loadApplySpec(utils.ArgumentMust(d, "--apply"))
+	if err != nil {
+		log.PanicErrorf(err, "load spec failed")
+	}
+
+	log.Debugf("call rpc stats to dashboard %s", t.addr)
+	stats, err := c.Stats()
+	if err != nil {
+		log.PanicErrorf(err, "call rpc stats to dashboard %s failed", t.addr)
+	}
+	log.Debugf("call rpc stats OK")
+
+	plan, err := newApplyPlan(spec, stats)
+	if err != nil {
+		log.PanicErrorf(err, "plan spec failed")
+	}
+	if len(plan.steps) == 0 {
+		fmt.Println("nothing changes")
+		return
+	}
+
+	if !d["--confirm"].(bool) {
+		for i, x := range plan.steps {
+			fmt.Printf("[%02d] %s\n", i+1, x.desc)
+		}
+		return
+	}
+
+	for i, x := range plan.steps {
+		fmt.Printf("[%02d] %s\n", i+1, x.desc)
+		if err := x.exec(c); err != nil {
+			log.PanicErrorf(err, "apply step [%02d] failed", i+1)
+		}
+	}
+	fmt.Println("done")
+}
@@ -0,0 +1,230 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/CodisLabs/codis/pkg/models"
+	"github.com/CodisLabs/codis/pkg/topom"
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+)
+
+func newApplyStats() *topom.Stats {
+	stats := &topom.Stats{}
+	stats.Group.Models = []*models.Group{
+		{Id: 1, Servers: []*models.GroupServer{
+			{Addr: "127.0.0.1:6379", DataCenter: "dc1"},
+			{Addr: "127.0.0.1:6380", DataCenter: "dc1"},
+		}},
+		{Id: 2, Servers: []*models.GroupServer{
+			{Addr: "127.0.0.1:6381", DataCenter: "dc1"},
+		}},
+	}
+	for i := 0; i < models.MaxSlotNum; i++ {
+		m := &models.SlotMapping{Id: i, GroupId: 1}
+		if i >= models.MaxSlotNum/2 {
+			m.GroupId = 2
+		}
+		stats.Slots = append(stats.Slots, m)
+	}
+	return stats
+}
+
+const applyGroups = `
+[[group]]
+id = 1
+  [[group.server]]
+  addr = "127.0.0.1:6379"
+  datacenter = "dc1"
+  [[group.server]]
+  addr = "127.0.0.1:6380"
+  datacenter = "dc1"
+
+[[group]]
+id = 2
+  [[group.server]]
+  addr = "127.0.0.1:6381"
+  datacenter = "dc1"
+`
+
+func TestApplyPlan(t *testing.T) {
+	var tests = []struct {
+		name  string
+		spec  string
+		steps []string
+		err   string
+	}{
+		{
+			name: "unchanged",
+			spec: applyGroups,
+		},
+		{
+			name: "add group",
+			spec: applyGroups + `
+[[group]]
+id = 3
+  [[group.server]]
+  addr = "127.0.0.1:6382"
+  datacenter = "dc2"
+`,
+			steps: []string{
+				`create group-[3]`,
+				`add server-[127.0.0.1:6382] to group-[3], datacenter = "dc2"`,
+			},
+		},
+		{
+			name: "move replica",
+			spec: `
+[[group]]
+id = 1
+  [[group.server]]
+  addr = "127.0.0.1:6379"
+  datacenter = "dc1"
+
+[[group]]
+id = 2
+  [[group.server]]
+  addr = "127.0.0.1:6381"
+  datacenter = "dc1"
+  [[group.server]]
+  addr = "127.0.0.1:6380"
+  datacenter = "dc1"
+`,
+			steps: []string{
+				`remove server-[127.0.0.1:6380] from group-[1]`,
+				`add server-[127.0.0.1:6380] to group-[2], datacenter = "dc1"`,
+				`sync server-[127.0.0.1:6380]`,
+				`wait for 1 servers to be synced`,
+			},
+		},
+		{
+			name: "move master",
+			spec: `
+[[group]]
+id = 1
+  [[group.server]]
+  addr = "127.0.0.1:6380"
+  datacenter = "dc1"
+
+[[group]]
+id = 2
+  [[group.server]]
+  addr = "127.0.0.1:6381"
+  datacenter = "dc1"
+  [[group.server]]
+  addr = "127.0.0.1:6379"
+  datacenter = "dc1"
+`,
+			err: "server-[127.0.0.1:6379] is master of group-[1], can't be moved to group-[2]",
+		},
+		{
+			name: "change master",
+			spec: `
+[[group]]
+id = 1
+  [[group.server]]
+  addr = "127.0.0.1:6380"
+  datacenter = "dc1"
+  [[group.server]]
+  addr = "127.0.0.1:6379"
+  datacenter = "dc1"
+
+[[group]]
+id = 2
+  [[group.server]]
+  addr = "127.0.0.1:6381"
+  datacenter = "dc1"
+`,
+			steps: []string{
+				`promote server-[127.0.0.1:6380] of group-[1]`,
+				`sync server-[127.0.0.1:6379]`,
+				`wait for 1 servers to be synced`,
+			},
+		},
+		{
+			name: "remove group in use",
+			spec: `
+[[group]]
+id = 1
+  [[group.server]]
+  addr = "127.0.0.1:6379"
+  datacenter = "dc1"
+  [[group.server]]
+  addr = "127.0.0.1:6380"
+  datacenter = "dc1"
+`,
+			err: "group-[2] isn't listed but still in use",
+		},
+		{
+			name: "remove group",
+			spec: `
+[[group]]
+id = 1
+  [[group.server]]
+  addr = "127.0.0.1:6379"
+  datacenter = "dc1"
+  [[group.server]]
+  addr = "127.0.0.1:6380"
+  datacenter = "dc1"
+
+[[slots]]
+beg = 0
+end = 1023
+group = 1
+`,
+			steps: []string{
+				`migrate slots [0512,1023] to group-[1]`,
+				`wait for 512 slots to be migrated`,
+				`remove server-[127.0.0.1:6381] from group-[2]`,
+				`remove group-[2]`,
+			},
+		},
+		{
+			name: "change datacenter",
+			spec: strings.Replace(applyGroups, `addr = "127.0.0.1:6380"
+  datacenter = "dc1"`, `addr = "127.0.0.1:6380"
+  datacenter = "dc2"`, 1),
+			steps: []string{
+				`remove server-[127.0.0.1:6380] from group-[1]`,
+				`add server-[127.0.0.1:6380] to group-[1], datacenter = "dc2"`,
+				`sync server-[127.0.0.1:6380]`,
+				`wait for 1 servers to be synced`,
+			},
+		},
+		{
+			name: "change datacenter of master",
+			spec: strings.Replace(applyGroups, `addr = "127.0.0.1:6379"
+  datacenter = "dc1"`, `addr = "127.0.0.1:6379"
+  datacenter = "dc2"`, 1),
+			err: "server-[127.0.0.1:6379] is master of group-[1], can't change datacenter",
+		},
+	}
+
+	for _, x := range tests {
+		spec := &applySpec{}
+		_, err := toml.Decode(x.spec, spec)
+		assert.MustNoError(err)
+
+		plan, err := newApplyPlan(spec, newApplyStats())
+		if x.err != "" {
+			if err == nil || !strings.Contains(err.Error(), x.err) {
+				t.Fatalf("%s: expect error %q, got %v", x.name, x.err, err)
+			}
+			continue
+		}
+		assert.MustNoError(err)
+
+		var steps []string
+		for _, s := range plan.steps {
+			steps = append(steps, s.desc)
+		}
+		if strings.Join(steps, "\n") != strings.Join(x.steps, "\n") {
+			t.Fatalf("%s: expect steps\n%s\ngot\n%s", x.name, strings.Join(x.steps, "\n"), strings.Join(steps, "\n"))
+		}
+	}
+}
@@ -0,0 +1,328 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/models"
+	"github.com/CodisLabs/codis/pkg/proxy"
+	"github.com/CodisLabs/codis/pkg/topom"
+	"github.com/CodisLabs/codis/pkg/utils"
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/CodisLabs/codis/pkg/utils/redis"
+)
+
+const backupManifestName = "manifest.json"
+
+// backupManifest ties RDB files to groups, Slots is the group id of each
+// slot when the backup was taken.
+type backupManifest struct {
+	Product  string         `json:"product"`
+	UnixTime int64          `json:"unixtime"`
+	Slots    []int          `json:"slots"`
+	Group    []*backupGroup `json:"group"`
+}
+
+type backupGroup struct {
+	Id     int    `json:"id"`
+	Server string `json:"server"`
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+}
+
+func (t *cmdDashboard) loadStats(c *topom.ApiClient) *topom.Stats {
+	log.Debugf("call rpc stats to dashboard %s", t.addr)
+	stats, err := c.Stats()
+	if err != nil {
+		log.PanicErrorf(err, "call rpc stats to dashboard %s failed", t.addr)
+	}
+	log.Debugf("call rpc stats OK")
+
+	for _, m := range stats.Slots {
+		if m.Action.State != models.ActionNothing {
+			log.Panicf("slot-[%d] is being migrated to group-[%d]", m.Id, m.Action.TargetId)
+		}
+	}
+	return stats
+}
+
+// backupServer prefers replicas that are in sync with the master.
+func backupServer(g *models.Group, stats map[string]*topom.RedisStats) string {
+	for _, x := range g.Servers[1:] {
+		s := stats[x.Addr]
+		if s == nil || s.Error != nil || s.Timeout {
+			continue
+		}
+		if s.Stats["master_link_status"] == "up" {
+			return x.Addr
+		}
+	}
+	log.Warnf("group-[%d] has no synced replica, fall back to master-[%s]", g.Id, g.Servers[0].Addr)
+	return g.Servers[0].Addr
+}
+
+// backupBgsave triggers BGSAVE on addr and waits until it's done.
+func backupBgsave(addr, auth string, timeout time.Duration) error {
+	c, err := redis.NewClient(addr, auth, timeout)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if _, err := c.Do("BGSAVE"); err != nil {
+		if !strings.Contains(err.Error(), "already in progress") {
+			return err
+		}
+	}
+	for {
+		info, err := c.Info()
+		if err != nil {
+			return err
+		}
+		if info["rdb_bgsave_in_progress"] == "0" {
+			if s := info["rdb_last_bgsave_status"]; s != "ok" {
+				return errors.Errorf("bgsave status = %s", s)
+			}
+			return nil
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func parseBackupTimeout(d map[string]interface{}) time.Duration {
+	if n, ok := utils.ArgumentInteger(d, "--timeout"); ok {
+		if n <= 0 {
+			log.Panicf("invalid --timeout = %d", n)
+		}
+		return time.Second * time.Duration(n)
+	}
+	return time.Second * 10
+}
+
+func (t *cmdDashboard) handleBackup(d map[string]interface{}) {
+	c := t.newTopomClient()
+
+	auth, _ := d["--auth"].(string)
+	dir := utils.ArgumentMust(d, "--backup")
+	timeout := parseBackupTimeout(d)
+
+	log.Debugf("call rpc model to dashboard %s", t.addr)
+	p, err := c.Model()
+	if err != nil {
+		log.PanicErrorf(err, "call rpc model to dashboard %s failed", t.addr)
+	}
+	log.Debugf("call rpc model OK")
+
+	stats := t.loadStats(c)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.PanicErrorf(err, "create backup %s failed", dir)
+	}
+	if _, err := os.Stat(filepath.Join(dir, backupManifestName)); err == nil {
+		log.Panicf("backup %s already exists", dir)
+	}
+
+	manifest := &backupManifest{
+		Product:  p.ProductName,
+		UnixTime: time.Now().Unix(),
+		Slots:    make([]int, len(stats.Slots)),
+	}
+	for i, m := range stats.Slots {
+		manifest.Slots[i] = m.GroupId
+	}
+
+	for _, g := range stats.Group.Models {
+		if len(g.Servers) == 0 {
+			continue
+		}
+		x := &backupGroup{
+			Id:     g.Id,
+			Server: backupServer(g, stats.Group.Stats),
+			File:   fmt.Sprintf("group-%04d.rdb", g.Id),
+		}
+		log.Infof("backup group-[%d] from server-[%s]", x.Id, x.Server)
+
+		if err := backupBgsave(x.Server, auth, timeout); err != nil {
+			log.PanicErrorf(err, "bgsave of server-[%s] failed", x.Server)
+		}
+
+		f, err := os.Create(filepath.Join(dir, x.File))
+		if err != nil {
+			log.PanicErrorf(err, "create file %s failed", x.File)
+		}
+		n, err := redis.SyncRdb(x.Server, auth, f, timeout)
+		if err != nil {
+			log.PanicErrorf(err, "sync rdb from server-[%s] failed", x.Server)
+		}
+		if err := f.Close(); err != nil {
+			log.PanicErrorf(err, "close file %s failed", x.File)
+		}
+		x.Size = n
+		manifest.Group = append(manifest.Group, x)
+	}
+
+	b, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		log.PanicErrorf(err, "json marshal failed")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, backupManifestName), b, 0644); err != nil {
+		log.PanicErrorf(err, "write manifest failed")
+	}
+	fmt.Println(string(b))
+}
+
+func (t *cmdDashboard) handleRestore(d map[string]interface{}) {
+	c := t.newTopomClient()
+
+	auth, _ := d["--auth"].(string)
+	dir := utils.ArgumentMust(d, "--restore")
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, backupManifestName))
+	if err != nil {
+		log.PanicErrorf(err, "read manifest failed")
+	}
+	manifest := &backupManifest{}
+	if err := json.Unmarshal(b, manifest); err != nil {
+		log.PanicErrorf(err, "json unmarshal failed")
+	}
+
+	stats := t.loadStats(c)
+
+	var group = make(map[int]*models.Group)
+	for _, g := range stats.Group.Models {
+		group[g.Id] = g
+	}
+	var master = make([]string, len(stats.Slots))
+	for i, m := range stats.Slots {
+		g := group[m.GroupId]
+		if g == nil || len(g.Servers) == 0 {
+			log.Panicf("slot-[%d] isn't assigned to any group", m.Id)
+		}
+		master[i] = g.Servers[0].Addr
+	}
+
+	var replace = d["--replace"].(bool)
+
+	var clients = make(map[string]*redis.Client)
+	defer func() {
+		for _, c := range clients {
+			c.Close()
+		}
+	}()
+	for _, addr := range master {
+		if clients[addr] != nil {
+			continue
+		}
+		c, err := redis.NewClient(addr, auth, time.Minute)
+		if err != nil {
+			log.PanicErrorf(err, "connect to server-[%s] failed", addr)
+		}
+		clients[addr] = c
+
+		if replace {
+			continue
+		}
+		keyspace, err := c.InfoKeySpace()
+		if err != nil {
+			log.PanicErrorf(err, "check keyspace of server-[%s] failed", addr)
+		}
+		for db, info := range keyspace {
+			log.Panicf("server-[%s] isn't empty, db%d:%s, use --replace to overwrite existing keys", addr, db, info)
+		}
+	}
+
+	if !d["--confirm"].(bool) {
+		fmt.Println(string(b))
+		return
+	}
+
+	var sending = make(map[*redis.Client][][]byte)
+	var failed int
+
+	var drain = func(c *redis.Client) {
+		keys := sending[c]
+		if len(keys) == 0 {
+			return
+		}
+		if err := c.Flush(); err != nil {
+			log.PanicErrorf(err, "restore keys to server-[%s] failed", c.Addr)
+		}
+		for _, key := range keys {
+			r, err := c.ReceiveReply()
+			if err != nil {
+				log.PanicErrorf(err, "restore keys to server-[%s] failed", c.Addr)
+			}
+			if err, ok := r.(error); ok {
+				log.Warnf("restore key %q to server-[%s] failed: %s", key, c.Addr, err)
+				failed++
+			}
+		}
+		sending[c] = keys[:0]
+	}
+
+	for _, x := range manifest.Group {
+		f, err := os.Open(filepath.Join(dir, x.File))
+		if err != nil {
+			log.PanicErrorf(err, "open file %s failed", x.File)
+		}
+		var restored, expired, before = 0, 0, failed
+		var l = redis.NewRdbLoader(f)
+		for {
+			e, err := l.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				log.PanicErrorf(err, "load file %s failed", x.File)
+			}
+			var ttl int64
+			if e.ExpireAt != 0 {
+				if ttl = e.ExpireAt - time.Now().UnixNano()/int64(time.Millisecond); ttl <= 0 {
+					expired++
+					continue
+				}
+			}
+			addr := master[proxy.Hash(e.Key)%uint32(len(master))]
+
+			c := clients[addr]
+			if c.Database != e.DB {
+				drain(c)
+				if err := c.Select(e.DB); err != nil {
+					log.PanicErrorf(err, "select db of server-[%s] failed", addr)
+				}
+			}
+			args := []interface{}{e.Key, ttl, e.DumpPayload()}
+			if replace {
+				args = append(args, "REPLACE")
+			}
+			if err := c.Send("RESTORE", args...); err != nil {
+				log.PanicErrorf(err, "restore keys to server-[%s] failed", addr)
+			}
+			sending[c] = append(sending[c], e.Key)
+			if len(sending[c]) >= 128 {
+				drain(c)
+			}
+			restored++
+		}
+		f.Close()
+
+		for _, c := range clients {
+			drain(c)
+		}
+		errs := failed - before
+		fmt.Printf("restore group-[%d] from %s, %d keys restored, %d keys failed, %d keys expired\n", x.Id, x.File, restored-errs, errs, expired)
+	}
+	if failed != 0 {
+		log.Panicf("restore %s finished, %d keys failed", dir, failed)
+	}
+}
@@ -6,6 +6,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"sort"
 	"strconv"
 
@@ -46,6 +47,8 @@ func (t *cmdDashboard) Main(d map[string]interface{}) {
 		fallthrough
 	case d["--remove-proxy"].(bool):
 		fallthrough
+	case d["--drain-proxy"].(bool):
+		fallthrough
 	case d["--reinit-proxy"].(bool):
 		fallthrough
 	case d["--proxy-status"].(bool):
@@ -75,6 +78,24 @@ func (t *cmdDashboard) Main(d map[string]interface{}) {
 	case d["--sentinel-resync"].(bool):
 		t.handleSentinelCommand(d)
 
+	case d["--policy-get"].(bool):
+		fallthrough
+	case d["--policy-set"] != nil:
+		t.handlePolicyCommand(d)
+
+	case d["--bigkeys"].(bool):
+		t.handleBigKeys(d)
+
+	case d["--keyspace"].(bool):
+		t.handleKeyspace(d)
+
+	case d["--history"].(bool):
+		fallthrough
+	case d["--history-diff"].(bool):
+		fallthrough
+	case d["--history-rollback"].(bool):
+		t.handleHistoryCommand(d)
+
 	case d["--sync-action"].(bool):
 		t.handleSyncActionCommand(d)
 
@@ -84,6 +105,14 @@ func (t *cmdDashboard) Main(d map[string]interface{}) {
 	case d["--rebalance"].(bool):
 		t.handleSlotRebalance(d)
 
+	case d["--apply"] != nil:
+		t.handleApply(d)
+
+	case d["--backup"] != nil:
+		t.handleBackup(d)
+	case d["--restore"] != nil:
+		t.handleRestore(d)
+
 	}
 }
 
@@ -392,6 +421,19 @@ func (t *cmdDashboard) handleProxyCommand(d map[string]interface{}) {
 			log.Debugf("call rpc remove-proxy OK")
 		}
 
+	case d["--drain-proxy"].(bool):
+
+		force := d["--force"].(bool)
+		timeout := parseDrainTimeout(d)
+
+		for _, token := range t.parseProxyTokens(d) {
+			log.Debugf("call rpc drain-proxy to dashboard %s", t.addr)
+			if err := c.DrainProxy(token, timeout, force); err != nil {
+				log.PanicErrorf(err, "call rpc drain-proxy to dashboard %s failed", t.addr)
+			}
+			log.Debugf("call rpc drain-proxy OK")
+		}
+
 	case d["--reinit-proxy"].(bool):
 
 		switch {
@@ -670,6 +712,169 @@ func (t *cmdDashboard) handleSentinelCommand(d map[string]interface{}) {
 	}
 }
 
+func (t *cmdDashboard) handlePolicyCommand(d map[string]interface{}) {
+	c := t.newTopomClient()
+
+	switch {
+
+	case d["--policy-get"].(bool):
+
+		log.Debugf("call rpc policy to dashboard %s", t.addr)
+		p, err := c.CommandPolicy()
+		if err != nil {
+			log.PanicErrorf(err, "call rpc policy to dashboard %s failed", t.addr)
+		}
+		log.Debugf("call rpc policy OK")
+
+		b, err := json.MarshalIndent(p, "", "    ")
+		if err != nil {
+			log.PanicErrorf(err, "json marshal failed")
+		}
+		fmt.Println(string(b))
+
+	case d["--policy-set"] != nil:
+
+		b, err := ioutil.ReadFile(utils.ArgumentMust(d, "--policy-set"))
+		if err != nil {
+			log.PanicErrorf(err, "load policy from file failed")
+		}
+		p := &models.CommandPolicy{}
+		if err := json.Unmarshal(b, p); err != nil {
+			log.PanicErrorf(err, "decode policy from json failed")
+		}
+		p.Normalize()
+		if err := p.Validate(); err != nil {
+			log.PanicErrorf(err, "validate policy failed")
+		}
+
+		log.Debugf("call rpc set-policy to dashboard %s", t.addr)
+		if err := c.SetCommandPolicy(p); err != nil {
+			log.PanicErrorf(err, "call rpc set-policy to dashboard %s failed", t.addr)
+		}
+		log.Debugf("call rpc set-policy OK")
+
+	}
+}
+
+func (t *cmdDashboard) handleBigKeys(d map[string]interface{}) {
+	c := t.newTopomClient()
+
+	var report *topom.BigKeyReport
+	var err error
+	if d["--scan"].(bool) {
+		log.Debugf("call rpc scan-bigkeys to dashboard %s", t.addr)
+		report, err = c.ScanBigKeys()
+		if err != nil {
+			log.PanicErrorf(err, "call rpc scan-bigkeys to dashboard %s failed", t.addr)
+		}
+		log.Debugf("call rpc scan-bigkeys OK")
+	} else {
+		log.Debugf("call rpc bigkeys to dashboard %s", t.addr)
+		report, err = c.BigKeys()
+		if err != nil {
+			log.PanicErrorf(err, "call rpc bigkeys to dashboard %s failed", t.addr)
+		}
+		log.Debugf("call rpc bigkeys OK")
+	}
+
+	b, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		log.PanicErrorf(err, "json marshal failed")
+	}
+	fmt.Println(string(b))
+}
+
+func (t *cmdDashboard) handleKeyspace(d map[string]interface{}) {
+	c := t.newTopomClient()
+
+	var report *models.KeyspaceReport
+	var err error
+	if d["--analyze"].(bool) {
+		log.Debugf("call rpc analyze-keyspace to dashboard %s", t.addr)
+		report, err = c.AnalyzeKeyspace()
+		if err != nil {
+			log.PanicErrorf(err, "call rpc analyze-keyspace to dashboard %s failed", t.addr)
+		}
+		log.Debugf("call rpc analyze-keyspace OK")
+	} else {
+		log.Debugf("call rpc keyspace to dashboard %s", t.addr)
+		report, err = c.KeyspaceReport()
+		if err != nil {
+			log.PanicErrorf(err, "call rpc keyspace to dashboard %s failed", t.addr)
+		}
+		log.Debugf("call rpc keyspace OK")
+	}
+
+	b, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		log.PanicErrorf(err, "json marshal failed")
+	}
+	fmt.Println(string(b))
+}
+
+func (t *cmdDashboard) handleHistoryCommand(d map[string]interface{}) {
+	c := t.newTopomClient()
+
+	var obj interface{}
+	switch {
+
+	case d["--history"].(bool):
+
+		if d["--epoch"] == nil {
+			log.Debugf("call rpc history to dashboard %s", t.addr)
+			epochs, err := c.History()
+			if err != nil {
+				log.PanicErrorf(err, "call rpc history to dashboard %s failed", t.addr)
+			}
+			log.Debugf("call rpc history OK")
+			obj = epochs
+		} else {
+			epoch := utils.ArgumentIntegerMust(d, "--epoch")
+
+			log.Debugf("call rpc history-topology to dashboard %s", t.addr)
+			topology, err := c.HistoryTopology(int64(epoch))
+			if err != nil {
+				log.PanicErrorf(err, "call rpc history-topology to dashboard %s failed", t.addr)
+			}
+			log.Debugf("call rpc history-topology OK")
+			obj = topology
+		}
+
+	case d["--history-diff"].(bool):
+
+		from := utils.ArgumentIntegerMust(d, "--from")
+		to := utils.ArgumentIntegerMust(d, "--to")
+
+		log.Debugf("call rpc history-diff to dashboard %s", t.addr)
+		diff, err := c.HistoryDiff(int64(from), int64(to))
+		if err != nil {
+			log.PanicErrorf(err, "call rpc history-diff to dashboard %s failed", t.addr)
+		}
+		log.Debugf("call rpc history-diff OK")
+		obj = diff
+
+	case d["--history-rollback"].(bool):
+
+		epoch := utils.ArgumentIntegerMust(d, "--epoch")
+		confirm := d["--confirm"].(bool)
+
+		log.Debugf("call rpc history-rollback to dashboard %s", t.addr)
+		plan, err := c.HistoryRollback(int64(epoch), confirm)
+		if err != nil {
+			log.PanicErrorf(err, "call rpc history-rollback to dashboard %s failed", t.addr)
+		}
+		log.Debugf("call rpc history-rollback OK")
+		obj = plan
+
+	}
+
+	b, err := json.MarshalIndent(obj, "", "    ")
+	if err != nil {
+		log.PanicErrorf(err, "json marshal failed")
+	}
+	fmt.Println(string(b))
+}
+
 func (t *cmdDashboard) handleSyncActionCommand(d map[string]interface{}) {
 	c := t.newTopomClient()
 
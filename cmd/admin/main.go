@@ -15,10 +15,14 @@ Usage:
 	codis-admin [-v] --proxy=ADDR [--auth=AUTH] [config|model|stats|slots]
 	codis-admin [-v] --proxy=ADDR [--auth=AUTH]  --start
 	codis-admin [-v] --proxy=ADDR [--auth=AUTH]  --shutdown
+	codis-admin [-v] --proxy=ADDR [--auth=AUTH]  --drain [--timeout=SECONDS]
 	codis-admin [-v] --proxy=ADDR [--auth=AUTH]  --log-level=LEVEL
 	codis-admin [-v] --proxy=ADDR [--auth=AUTH]  --fillslots=FILE [--locked]
 	codis-admin [-v] --proxy=ADDR [--auth=AUTH]  --reset-stats
 	codis-admin [-v] --proxy=ADDR [--auth=AUTH]  --forcegc
+	codis-admin [-v] --proxy=ADDR [--auth=AUTH]  --client-list
+	codis-admin [-v] --proxy=ADDR [--auth=AUTH]  --client-kill=ID
+	codis-admin [-v] --proxy=ADDR [--auth=AUTH]  --monitor [--cmd=LIST] [--prefix=PREFIX] [--client=ADDR] [--sample=RATIO]
 	codis-admin [-v] --dashboard=ADDR           [config|model|stats|slots|group|proxy]
 	codis-admin [-v] --dashboard=ADDR            --shutdown
 	codis-admin [-v] --dashboard=ADDR            --reload
@@ -29,6 +33,7 @@ Usage:
 	codis-admin [-v] --dashboard=ADDR            --create-proxy   --addr=ADDR
 	codis-admin [-v] --dashboard=ADDR            --online-proxy   --addr=ADDR
 	codis-admin [-v] --dashboard=ADDR            --remove-proxy  (--addr=ADDR|--token=TOKEN|--pid=ID)       [--force]
+	codis-admin [-v] --dashboard=ADDR            --drain-proxy   (--addr=ADDR|--token=TOKEN|--pid=ID)       [--timeout=SECONDS] [--force]
 	codis-admin [-v] --dashboard=ADDR            --reinit-proxy  (--addr=ADDR|--token=TOKEN|--pid=ID|--all) [--force]
 	codis-admin [-v] --dashboard=ADDR            --proxy-status
 	codis-admin [-v] --dashboard=ADDR            --list-group
@@ -52,11 +57,22 @@ Usage:
 	codis-admin [-v] --dashboard=ADDR            --sentinel-add   --addr=ADDR
 	codis-admin [-v] --dashboard=ADDR            --sentinel-del   --addr=ADDR [--force]
 	codis-admin [-v] --dashboard=ADDR            --sentinel-resync
-	codis-admin [-v] --remove-lock               --product=NAME (--zookeeper=ADDR [--zookeeper-auth=USR:PWD]|--etcd=ADDR [--etcd-auth=USR:PWD]|--filesystem=ROOT)
-	codis-admin [-v] --config-dump               --product=NAME (--zookeeper=ADDR [--zookeeper-auth=USR:PWD]|--etcd=ADDR [--etcd-auth=USR:PWD]|--filesystem=ROOT) [-1]
+	codis-admin [-v] --dashboard=ADDR            --policy-get
+	codis-admin [-v] --dashboard=ADDR            --bigkeys       [--scan]
+	codis-admin [-v] --dashboard=ADDR            --keyspace      [--analyze]
+	codis-admin [-v] --dashboard=ADDR            --history       [--epoch=N]
+	codis-admin [-v] --dashboard=ADDR            --history-diff   --from=N --to=N
+	codis-admin [-v] --dashboard=ADDR            --history-rollback --epoch=N [--confirm]
+	codis-admin [-v] --dashboard=ADDR            --policy-set=FILE
+	codis-admin [-v] --dashboard=ADDR            --apply=FILE    [--confirm]
+	codis-admin [-v] --dashboard=ADDR            --backup=DIR    [--auth=AUTH] [--timeout=SECONDS]
+	codis-admin [-v] --dashboard=ADDR            --restore=DIR   [--auth=AUTH] [--replace] [--confirm]
+	codis-admin [-v] --remove-lock               --product=NAME (--zookeeper=ADDR [--zookeeper-auth=USR:PWD]|--etcd=ADDR [--etcd-auth=USR:PWD]|--etcdv3=ADDR [--etcdv3-auth=USR:PWD]|--raft=ADDR [--raft-auth=AUTH]|--filesystem=ROOT)
+	codis-admin [-v] --config-dump               --product=NAME (--zookeeper=ADDR [--zookeeper-auth=USR:PWD]|--etcd=ADDR [--etcd-auth=USR:PWD]|--etcdv3=ADDR [--etcdv3-auth=USR:PWD]|--raft=ADDR [--raft-auth=AUTH]|--filesystem=ROOT) [-1]
 	codis-admin [-v] --config-convert=FILE
-	codis-admin [-v] --config-restore=FILE       --product=NAME (--zookeeper=ADDR [--zookeeper-auth=USR:PWD]|--etcd=ADDR [--etcd-auth=USR:PWD]|--filesystem=ROOT) [--confirm]
-	codis-admin [-v] --dashboard-list                           (--zookeeper=ADDR [--zookeeper-auth=USR:PWD]|--etcd=ADDR [--etcd-auth=USR:PWD]|--filesystem=ROOT)
+	codis-admin [-v] --config-restore=FILE       --product=NAME (--zookeeper=ADDR [--zookeeper-auth=USR:PWD]|--etcd=ADDR [--etcd-auth=USR:PWD]|--etcdv3=ADDR [--etcdv3-auth=USR:PWD]|--raft=ADDR [--raft-auth=AUTH]|--filesystem=ROOT) [--confirm]
+	codis-admin [-v] --dashboard-list                           (--zookeeper=ADDR [--zookeeper-auth=USR:PWD]|--etcd=ADDR [--etcd-auth=USR:PWD]|--etcdv3=ADDR [--etcdv3-auth=USR:PWD]|--raft=ADDR [--raft-auth=AUTH]|--filesystem=ROOT)
+	codis-admin [-v] --config-migrate            --product=NAME  --etcd=ADDR [--etcd-auth=USR:PWD] --etcdv3=ADDR [--etcdv3-auth=USR:PWD] [--confirm]
 
 Options:
 	-a AUTH, --auth=AUTH
@@ -4,9 +4,12 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/url"
+	"time"
 
 	"github.com/CodisLabs/codis/pkg/models"
 	"github.com/CodisLabs/codis/pkg/proxy"
@@ -30,6 +33,8 @@ func (t *cmdProxy) Main(d map[string]interface{}) {
 		t.handleStart(d)
 	case d["--shutdown"].(bool):
 		t.handleShutdown(d)
+	case d["--drain"].(bool):
+		t.handleDrain(d)
 	case d["--log-level"] != nil:
 		t.handleLogLevel(d)
 	case d["--fillslots"] != nil:
@@ -38,6 +43,12 @@ func (t *cmdProxy) Main(d map[string]interface{}) {
 		t.handleResetStats(d)
 	case d["--forcegc"].(bool):
 		t.handleForceGC(d)
+	case d["--monitor"].(bool):
+		t.handleMonitor(d)
+	case d["--client-list"].(bool):
+		t.handleClientList(d)
+	case d["--client-kill"] != nil:
+		t.handleClientKill(d)
 	}
 }
 
@@ -183,6 +194,97 @@ func (t *cmdProxy) handleForceGC(d map[string]interface{}) {
 	log.Debugf("call rpc forcegc OK")
 }
 
+func (t *cmdProxy) handleDrain(d map[string]interface{}) {
+	c := t.newProxyClient(true)
+
+	timeout := parseDrainTimeout(d)
+
+	log.Debugf("call rpc drain to proxy %s", t.addr)
+	if err := c.Drain(timeout); err != nil {
+		log.PanicErrorf(err, "call rpc drain to proxy %s failed", t.addr)
+	}
+	log.Debugf("call rpc drain OK")
+}
+
+func parseDrainTimeout(d map[string]interface{}) time.Duration {
+	if n, ok := utils.ArgumentInteger(d, "--timeout"); ok {
+		if n < 0 {
+			log.Panicf("invalid --timeout = %d", n)
+		}
+		return time.Second * time.Duration(n)
+	}
+	return time.Second * 30
+}
+
+func (t *cmdProxy) handleClientList(d map[string]interface{}) {
+	c := t.newProxyClient(true)
+
+	log.Debugf("call rpc clients to proxy %s", t.addr)
+	clients, err := c.Clients()
+	if err != nil {
+		log.PanicErrorf(err, "call rpc clients to proxy %s failed", t.addr)
+	}
+	log.Debugf("call rpc clients OK")
+
+	b, err := json.MarshalIndent(clients, "", "    ")
+	if err != nil {
+		log.PanicErrorf(err, "json marshal failed")
+	}
+	fmt.Println(string(b))
+}
+
+func (t *cmdProxy) handleClientKill(d map[string]interface{}) {
+	c := t.newProxyClient(true)
+
+	id, ok := utils.ArgumentInteger(d, "--client-kill")
+	if !ok || id <= 0 {
+		log.Panicf("invalid --client-kill = %v", d["--client-kill"])
+	}
+
+	log.Debugf("call rpc kill-client to proxy %s", t.addr)
+	if err := c.KillClient(int64(id)); err != nil {
+		log.PanicErrorf(err, "call rpc kill-client to proxy %s failed", t.addr)
+	}
+	log.Debugf("call rpc kill-client OK")
+}
+
+func (t *cmdProxy) handleMonitor(d map[string]interface{}) {
+	c := t.newProxyClient(true)
+
+	var q = url.Values{}
+	for _, key := range []string{"cmd", "prefix", "client", "sample"} {
+		if s, ok := d["--"+key].(string); ok {
+			q.Set(key, s)
+		}
+	}
+	f, err := proxy.DecodeMonitorFilter(q)
+	if err != nil {
+		log.PanicErrorf(err, "invalid monitor filter")
+	}
+
+	var dropped int64
+	log.Debugf("call rpc monitor to proxy %s", t.addr)
+	if err := c.Monitor(f, func(e *proxy.MonitorEvent) error {
+		if e.Dropped != dropped {
+			fmt.Printf("(%d events dropped)\n", e.Dropped-dropped)
+			dropped = e.Dropped
+		}
+		var args bytes.Buffer
+		for _, arg := range e.Args {
+			fmt.Fprintf(&args, " %q", arg)
+		}
+		status := e.Status
+		if e.Error != "" {
+			status = fmt.Sprintf("%s: %s", e.Status, e.Error)
+		}
+		fmt.Printf("%s [%d %s] %q%s -> %s (%dus)\n", e.Time, e.Database, e.Client, e.Command, args.String(), status, e.Duration)
+		return nil
+	}); err != nil {
+		log.PanicErrorf(err, "call rpc monitor to proxy %s failed", t.addr)
+	}
+	log.Debugf("call rpc monitor OK")
+}
+
 func (t *cmdProxy) handleShutdown(d map[string]interface{}) {
 	c := t.newProxyClient(true)
 
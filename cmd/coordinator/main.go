@@ -0,0 +1,138 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/docopt/docopt-go"
+
+	"github.com/CodisLabs/codis/pkg/coordinator"
+	"github.com/CodisLabs/codis/pkg/utils"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+)
+
+func main() {
+	const usage = `
+Usage:
+	codis-coordinator [--ncpu=N] [--config=CONF] [--log=FILE] [--log-level=LEVEL] [--admin-addr=ADDR] [--peers=ADDRS --member=ADDR] [--data-dir=DIR] [--pidfile=FILE]
+	codis-coordinator  --default-config
+	codis-coordinator  --version
+
+Options:
+	--ncpu=N                    set runtime.GOMAXPROCS to N, default is runtime.NumCPU().
+	-c CONF, --config=CONF      run with the specific configuration.
+	-l FILE, --log=FILE         set path/name of daliy rotated log file.
+	--log-level=LEVEL           set the log-level, should be INFO,WARN,DEBUG or ERROR, default is INFO.
+`
+
+	d, err := docopt.Parse(usage, nil, true, "", false)
+	if err != nil {
+		log.PanicError(err, "parse arguments failed")
+	}
+
+	switch {
+
+	case d["--default-config"]:
+		fmt.Print(coordinator.DefaultConfig)
+		return
+
+	case d["--version"].(bool):
+		fmt.Println("version:", utils.Version)
+		fmt.Println("compile:", utils.Compile)
+		return
+
+	}
+
+	if s, ok := utils.Argument(d, "--log"); ok {
+		w, err := log.NewRollingFile(s, log.DailyRolling)
+		if err != nil {
+			log.PanicErrorf(err, "open log file %s failed", s)
+		} else {
+			log.StdLog = log.New(w, "")
+		}
+	}
+	log.SetLevel(log.LevelInfo)
+
+	if s, ok := utils.Argument(d, "--log-level"); ok {
+		if !log.SetLevelString(s) {
+			log.Panicf("option --log-level = %s", s)
+		}
+	}
+
+	if n, ok := utils.ArgumentInteger(d, "--ncpu"); ok {
+		runtime.GOMAXPROCS(n)
+	} else {
+		runtime.GOMAXPROCS(runtime.NumCPU())
+	}
+	log.Warnf("set ncpu = %d", runtime.GOMAXPROCS(0))
+
+	config := coordinator.NewDefaultConfig()
+	if s, ok := utils.Argument(d, "--config"); ok {
+		if err := config.LoadFromFile(s); err != nil {
+			log.PanicErrorf(err, "load config %s failed", s)
+		}
+	}
+	if s, ok := utils.Argument(d, "--admin-addr"); ok {
+		config.AdminAddr = s
+		log.Warnf("option --admin-addr = %s", s)
+	}
+	if s, ok := utils.Argument(d, "--peers"); ok {
+		config.Peers = s
+		config.MemberAddr = utils.ArgumentMust(d, "--member")
+		log.Warnf("option --peers = %s, --member = %s", config.Peers, config.MemberAddr)
+	}
+	if s, ok := utils.Argument(d, "--data-dir"); ok {
+		config.DataDir = s
+		log.Warnf("option --data-dir = %s", s)
+	}
+
+	s, err := coordinator.New(config)
+	if err != nil {
+		log.PanicErrorf(err, "create coordinator with config file failed\n%s", config)
+	}
+	defer s.Close()
+
+	log.Warnf("create coordinator with config\n%s", config)
+
+	if s, ok := utils.Argument(d, "--pidfile"); ok {
+		if pidfile, err := filepath.Abs(s); err != nil {
+			log.WarnErrorf(err, "parse pidfile = '%s' failed", s)
+		} else if err := ioutil.WriteFile(pidfile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+			log.WarnErrorf(err, "write pidfile = '%s' failed", pidfile)
+		} else {
+			defer func() {
+				if err := os.Remove(pidfile); err != nil {
+					log.WarnErrorf(err, "remove pidfile = '%s' failed", pidfile)
+				}
+			}()
+			log.Warnf("option --pidfile = %s", pidfile)
+		}
+	}
+
+	go func() {
+		defer s.Close()
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGINT, syscall.SIGKILL, syscall.SIGTERM)
+
+		sig := <-c
+		log.Warnf("[%p] coordinator receive signal = '%v'", s, sig)
+	}()
+
+	log.Warnf("[%p] coordinator is working ...", s)
+
+	for !s.IsClosed() {
+		time.Sleep(time.Second)
+	}
+
+	log.Warnf("[%p] coordinator is exiting ...", s)
+}
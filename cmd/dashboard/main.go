@@ -165,7 +165,7 @@ Options:
 		log.Warnf("[%p] dashboard receive signal = '%v'", s, sig)
 	}()
 
-	for i := 0; !s.IsClosed() && !s.IsOnline(); i++ {
+	for i := 0; !s.IsClosed() && !s.IsOnline() && !s.IsStandby(); i++ {
 		if err := s.Start(true); err != nil {
 			if i <= 15 {
 				log.Warnf("[%p] dashboard online failed [%d]", s, i)
@@ -176,7 +176,11 @@ Options:
 		}
 	}
 
-	log.Warnf("[%p] dashboard is working ...", s)
+	if s.IsStandby() {
+		log.Warnf("[%p] dashboard is standby, waiting for leader election ...", s)
+	} else {
+		log.Warnf("[%p] dashboard is working ...", s)
+	}
 
 	for !s.IsClosed() {
 		time.Sleep(time.Second)
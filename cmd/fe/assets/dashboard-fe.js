@@ -449,6 +449,54 @@ function alertErrorResp(failedResp) {
     });
 }
 
+function processKeyspaceReport(report) {
+    if (!report) {
+        return null;
+    }
+    var percent = function (n) {
+        if (report.sampled == 0) {
+            return "0.00%";
+        }
+        return (n * 100 / report.sampled).toFixed(2) + "%";
+    }
+    var toArray = function (m) {
+        var array = [];
+        for (var k in m) {
+            array.push({name: k, keys: m[k], percent: percent(m[k])});
+        }
+        array.sort(function (a, b) {
+            return b.keys - a.keys;
+        });
+        return array;
+    }
+    var keyspace = {
+        keys: report.keys,
+        sampled: report.sampled,
+        memory: report.memory,
+        duration: report.duration_ms,
+        updated: new Date(report.unixtime * 1000).toLocaleString(),
+        types: toArray(report.types),
+        expires: toArray(report.expires),
+        prefixes: [],
+        groups: report.groups,
+    };
+    for (var i = 0; i < report.prefixes.length; i ++) {
+        var x = report.prefixes[i];
+        var types = [];
+        for (var t in x.types) {
+            types.push(t + ":" + x.types[t]);
+        }
+        keyspace.prefixes.push({
+            prefix: x.prefix == "" ? "(none)" : x.prefix,
+            keys: x.keys,
+            percent: percent(x.keys),
+            bytes: humanSize(x.bytes),
+            types: types.sort().join(" "),
+        });
+    }
+    return keyspace;
+}
+
 function isValidInput(text) {
     return text && text != "" && text != "NA";
 }
@@ -601,6 +649,7 @@ dashboard.controller('MainCodisCtrl', ['$scope', '$http', '$uibModal', '$timeout
             $scope.slots_action_remain = 0;
             $scope.sentinel_servers = [];
             $scope.sentinel_out_of_sync = false;
+            $scope.keyspace = null;
         }
         $scope.resetOverview();
 
@@ -624,6 +673,7 @@ dashboard.controller('MainCodisCtrl', ['$scope', '$http', '$uibModal', '$timeout
                 $scope.codis_coord_name = "[" + overview.config.coordinator_name.charAt(0).toUpperCase() + overview.config.coordinator_name.slice(1) + "]";
                 $scope.codis_coord_addr = overview.config.coordinator_addr;
                 $scope.updateStats(overview.stats);
+                $scope.refreshKeyspace();
             });
         }
 
@@ -742,6 +792,38 @@ dashboard.controller('MainCodisCtrl', ['$scope', '$http', '$uibModal', '$timeout
             }
         }
 
+        $scope.refreshKeyspace = function () {
+            var codis_name = $scope.codis_name;
+            if (isValidInput(codis_name)) {
+                var xauth = genXAuth(codis_name);
+                var url = concatUrl("/api/topom/keyspace/" + xauth, codis_name);
+                $http.get(url).then(function (resp) {
+                    if ($scope.codis_name != codis_name) {
+                        return;
+                    }
+                    $scope.keyspace = processKeyspaceReport(resp.data);
+                });
+            }
+        }
+
+        $scope.analyzeKeyspace = function () {
+            var codis_name = $scope.codis_name;
+            if (isValidInput(codis_name)) {
+                alertAction("Analyze Keyspace: sample keys of all slots on replicas, it may take a while.", function () {
+                    var xauth = genXAuth(codis_name);
+                    var url = concatUrl("/api/topom/keyspace/analyze/" + xauth, codis_name);
+                    $http.put(url).then(function (resp) {
+                        if ($scope.codis_name != codis_name) {
+                            return;
+                        }
+                        $scope.keyspace = processKeyspaceReport(resp.data);
+                    }, function (failedResp) {
+                        alertErrorResp(failedResp);
+                    });
+                });
+            }
+        }
+
         $scope.createProxy = function (proxy_addr) {
             var codis_name = $scope.codis_name;
             if (isValidInput(codis_name) && isValidInput(proxy_addr)) {
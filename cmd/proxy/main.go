@@ -199,6 +199,9 @@ Options:
 			log.WarnErrorf(err, "write pidfile = '%s' failed", pidfile)
 		} else {
 			defer func() {
+				if b, _ := ioutil.ReadFile(pidfile); string(b) != strconv.Itoa(os.Getpid()) {
+					return
+				}
 				if err := os.Remove(pidfile); err != nil {
 					log.WarnErrorf(err, "remove pidfile = '%s' failed", pidfile)
 				}
@@ -207,13 +210,38 @@ Options:
 		}
 	}
 
+	s.SetUnregister(func(timeout time.Duration) error {
+		var addr = dashboard
+		if coordinator.name != "" {
+			addr = LookupDashboard(coordinator.name, coordinator.addr, coordinator.auth, config.ProductName)
+		}
+		return UnregisterProxy(s, addr, timeout)
+	})
+
 	go func() {
-		defer s.Close()
 		c := make(chan os.Signal, 1)
-		signal.Notify(c, syscall.SIGINT, syscall.SIGKILL, syscall.SIGTERM)
+		signal.Notify(c, syscall.SIGINT, syscall.SIGKILL, syscall.SIGTERM, syscall.SIGUSR2)
 
-		sig := <-c
-		log.Warnf("[%p] proxy receive signal = '%v'", s, sig)
+		for sig := range c {
+			log.Warnf("[%p] proxy receive signal = '%v'", s, sig)
+
+			var timeout = config.ProxyDrainTimeout.Duration()
+			switch {
+			case sig == syscall.SIGUSR2:
+				if _, err := s.Handoff(timeout); err != nil {
+					log.WarnErrorf(err, "[%p] proxy handoff failed", s)
+					continue
+				}
+			case sig == syscall.SIGTERM && timeout != 0:
+				if err := s.Drain(timeout); err != nil {
+					log.WarnErrorf(err, "[%p] proxy drain failed", s)
+					s.Close()
+				}
+			default:
+				s.Close()
+			}
+			return
+		}
 	}()
 
 	switch {
@@ -344,3 +372,30 @@ func OnlineProxy(p *proxy.Proxy, dashboard string) bool {
 		return true
 	}
 }
+
+func LookupDashboard(name, addr, auth string, product string) string {
+	client, err := models.NewClient(name, addr, auth, time.Minute)
+	if err != nil {
+		log.WarnErrorf(err, "create '%s' client to '%s' failed", name, addr)
+		return ""
+	}
+	defer client.Close()
+	t, err := models.LoadTopom(client, product, false)
+	if err != nil {
+		log.WarnErrorf(err, "load & decode topom failed")
+		return ""
+	}
+	if t == nil {
+		return ""
+	}
+	return t.AdminAddr
+}
+
+func UnregisterProxy(p *proxy.Proxy, dashboard string, timeout time.Duration) error {
+	if dashboard == "" {
+		return nil
+	}
+	client := topom.NewApiClient(dashboard)
+	client.SetXAuth(p.Config().ProductName)
+	return client.DrainProxy(p.Model().Token, timeout, true)
+}
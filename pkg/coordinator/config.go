@@ -0,0 +1,126 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package coordinator
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/CodisLabs/codis/pkg/utils/timesize"
+)
+
+const DefaultConfig = `
+##################################################
+#                                                #
+#                Codis-Coordinator               #
+#                                                #
+##################################################
+
+# Set bind address for admin(rpc), tcp only, which serves both raft peers & codis clients.
+admin_addr = "0.0.0.0:19090"
+
+# Set members of the raft group, separated by comma, each member should be reachable by others,
+# and member_addr is the one of this member. Leave both empty for a single member.
+#   peers = "10.0.0.1:19090,10.0.0.2:19090,10.0.0.3:19090"
+#   member_addr = "10.0.0.1:19090"
+peers = ""
+member_addr = ""
+
+# Set auth for peers & clients, should be the same as coordinator_auth of dashboard & jodis_auth of proxy.
+auth = ""
+
+# Set directory of raft state, log & snapshot.
+data_dir = "/tmp/codis-coordinator"
+
+# Set raft timing, election_timeout should be several times of heartbeat_interval.
+heartbeat_interval = "100ms"
+election_timeout = "1s"
+
+# Set raft log compaction, a snapshot is taken every snapshot_entries applied entries.
+snapshot_entries = 10000
+`
+
+type Config struct {
+	AdminAddr  string `toml:"admin_addr" json:"admin_addr"`
+	Peers      string `toml:"peers" json:"peers"`
+	MemberAddr string `toml:"member_addr" json:"member_addr"`
+
+	Auth string `toml:"auth" json:"-"`
+
+	DataDir string `toml:"data_dir" json:"data_dir"`
+
+	HeartbeatInterval timesize.Duration `toml:"heartbeat_interval" json:"heartbeat_interval"`
+	ElectionTimeout   timesize.Duration `toml:"election_timeout" json:"election_timeout"`
+
+	SnapshotEntries int `toml:"snapshot_entries" json:"snapshot_entries"`
+}
+
+func NewDefaultConfig() *Config {
+	c := &Config{}
+	if _, err := toml.Decode(DefaultConfig, c); err != nil {
+		log.PanicErrorf(err, "decode toml failed")
+	}
+	if err := c.Validate(); err != nil {
+		log.PanicErrorf(err, "validate config failed")
+	}
+	return c
+}
+
+func (c *Config) LoadFromFile(path string) error {
+	_, err := toml.DecodeFile(path, c)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return c.Validate()
+}
+
+func (c *Config) String() string {
+	var b bytes.Buffer
+	e := toml.NewEncoder(&b)
+	e.Indent = "    "
+	e.Encode(c)
+	return b.String()
+}
+
+func (c *Config) PeerList() []string {
+	var peers []string
+	for _, s := range strings.Split(c.Peers, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			peers = append(peers, s)
+		}
+	}
+	return peers
+}
+
+func (c *Config) Validate() error {
+	if c.AdminAddr == "" {
+		return errors.New("invalid admin_addr")
+	}
+	if peers := c.PeerList(); len(peers) != 0 {
+		var found bool
+		for _, p := range peers {
+			found = found || p == c.MemberAddr
+		}
+		if !found {
+			return errors.New("invalid member_addr, should be one of peers")
+		}
+	}
+	if c.DataDir == "" {
+		return errors.New("invalid data_dir")
+	}
+	if c.HeartbeatInterval <= 0 {
+		return errors.New("invalid heartbeat_interval")
+	}
+	if c.ElectionTimeout <= c.HeartbeatInterval {
+		return errors.New("invalid election_timeout")
+	}
+	if c.SnapshotEntries <= 0 {
+		return errors.New("invalid snapshot_entries")
+	}
+	return nil
+}
@@ -0,0 +1,431 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package coordinator
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils"
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/CodisLabs/codis/pkg/utils/rpc"
+)
+
+var (
+	ErrClosedCoordinator = errors.New("use of closed coordinator")
+	ErrNoLeader          = errors.New("coordinator has no leader")
+	ErrNotLeader         = errors.New("coordinator is not leader")
+	ErrProposalLost      = errors.New("proposal is lost by leader change")
+	ErrProposalTimeout   = errors.New("proposal timeout")
+)
+
+const (
+	RoleFollower  = "follower"
+	RoleCandidate = "candidate"
+	RoleLeader    = "leader"
+)
+
+const watchTimeout = time.Second * 30
+
+type proposal struct {
+	term   int64
+	signal chan *Result
+}
+
+type Coordinator struct {
+	mu sync.Mutex
+
+	xauth  string
+	member string
+	peers  []string
+
+	exit struct {
+		C chan struct{}
+	}
+	ladmin net.Listener
+
+	config  *Config
+	storage *storage
+
+	tree    *tree
+	changed chan struct{}
+
+	raft struct {
+		role   string
+		term   int64
+		vote   string
+		leader string
+
+		log     []*Entry
+		commit  int64
+		applied int64
+
+		heard    time.Time
+		deadline time.Time
+		electAt  time.Time
+
+		next     map[string]int64
+		match    map[string]int64
+		acked    map[string]time.Time
+		inflight map[string]bool
+	}
+	waits map[int64]*proposal
+
+	sessions struct {
+		alive   map[int64]time.Time
+		closing map[int64]bool
+	}
+
+	closed bool
+}
+
+func New(config *Config) (*Coordinator, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	s := &Coordinator{config: config}
+	s.exit.C = make(chan struct{})
+	s.xauth = rpc.NewXAuth(config.Auth)
+	s.changed = make(chan struct{})
+	s.waits = make(map[int64]*proposal)
+	s.sessions.alive = make(map[int64]time.Time)
+	s.sessions.closing = make(map[int64]bool)
+
+	if err := s.setup(config); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	log.Warnf("create new coordinator, member = %s, peers = %v", s.member, s.peers)
+
+	go s.serveAdmin()
+	go s.runRaft()
+
+	return s, nil
+}
+
+func (s *Coordinator) setup(config *Config) error {
+	if l, err := net.Listen("tcp", config.AdminAddr); err != nil {
+		return errors.Trace(err)
+	} else {
+		s.ladmin = l
+
+		x, err := utils.ReplaceUnspecifiedIP("tcp", l.Addr().String(), "")
+		if err != nil {
+			return err
+		}
+		s.member = x
+	}
+	if peers := config.PeerList(); len(peers) != 0 {
+		s.member = config.MemberAddr
+		for _, p := range peers {
+			if p != s.member {
+				s.peers = append(s.peers, p)
+			}
+		}
+	}
+
+	if x, err := openStorage(config.DataDir); err != nil {
+		return err
+	} else {
+		s.storage = x
+	}
+	return s.restore()
+}
+
+func (s *Coordinator) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.exit.C)
+
+	if s.ladmin != nil {
+		s.ladmin.Close()
+	}
+	if s.storage != nil {
+		s.storage.Close()
+	}
+	return nil
+}
+
+func (s *Coordinator) IsClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *Coordinator) Member() string {
+	return s.member
+}
+
+func (s *Coordinator) Config() *Config {
+	return s.config
+}
+
+func (s *Coordinator) serveAdmin() {
+	if s.IsClosed() {
+		return
+	}
+	defer s.Close()
+
+	log.Warnf("admin start service on %s", s.ladmin.Addr())
+
+	h := http.NewServeMux()
+	h.Handle("/", newApiServer(s))
+	hs := &http.Server{Handler: h}
+
+	eh := make(chan error, 1)
+	go func(l net.Listener) {
+		eh <- hs.Serve(l)
+	}(s.ladmin)
+
+	select {
+	case <-s.exit.C:
+		log.Warnf("admin shutdown")
+		// peers keep alive connections, which would be served by the closed
+		// coordinator after it restarts on the same address.
+		hs.Close()
+	case err := <-eh:
+		log.ErrorErrorf(err, "admin exit on error")
+	}
+}
+
+type Overview struct {
+	Version string  `json:"version"`
+	Compile string  `json:"compile"`
+	Config  *Config `json:"config,omitempty"`
+
+	Member  string   `json:"member"`
+	Members []string `json:"members"`
+	Role    string   `json:"role"`
+	Term    int64    `json:"term"`
+	Leader  string   `json:"leader,omitempty"`
+
+	Commit  int64 `json:"commit"`
+	Applied int64 `json:"applied"`
+	Nodes   int   `json:"nodes"`
+}
+
+func (s *Coordinator) Overview() (*Overview, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrClosedCoordinator
+	}
+	return &Overview{
+		Version: utils.Version,
+		Compile: utils.Compile,
+		Config:  s.config,
+		Member:  s.member,
+		Members: append([]string{s.member}, s.peers...),
+		Role:    s.raft.role,
+		Term:    s.raft.term,
+		Leader:  s.raft.leader,
+		Commit:  s.raft.commit,
+		Applied: s.raft.applied,
+		Nodes:   len(s.tree.Nodes),
+	}, nil
+}
+
+// forward returns client of the leader, requests are forwarded at most once
+// to avoid loops between members with stale views.
+func (s *Coordinator) forward(forwarded bool) (*ApiClient, error) {
+	switch {
+	case forwarded:
+		return nil, ErrNotLeader
+	case s.raft.leader == "" || s.raft.leader == s.member:
+		return nil, ErrNoLeader
+	}
+	c := NewApiClient(s.raft.leader)
+	c.xauth = s.xauth
+	return c, nil
+}
+
+// Propose replicates the op and returns after it's applied.
+func (s *Coordinator) Propose(op *Op, forwarded bool) (*Result, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrClosedCoordinator
+	}
+	if s.raft.role != RoleLeader {
+		c, err := s.forward(forwarded)
+		s.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		return c.propose(op, true)
+	}
+	e, err := s.appendLeader(op)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	p := &proposal{term: e.Term, signal: make(chan *Result, 1)}
+	s.waits[e.Index] = p
+	s.advanceCommit()
+	s.broadcast()
+	s.mu.Unlock()
+
+	select {
+	case <-s.exit.C:
+		return nil, ErrClosedCoordinator
+	case r := <-p.signal:
+		if r == nil {
+			return nil, ErrProposalLost
+		}
+		return r, nil
+	case <-time.After(s.config.ElectionTimeout.Duration() * 5):
+		s.mu.Lock()
+		delete(s.waits, e.Index)
+		s.mu.Unlock()
+		return nil, ErrProposalTimeout
+	}
+}
+
+// waitReadable waits until the local tree is up to date, reads are served
+// by the leader that has committed an entry of its term & holds a quorum.
+func (s *Coordinator) waitReadable(forwarded bool) (*ApiClient, error) {
+	var deadline = time.Now().Add(s.config.ElectionTimeout.Duration())
+	for {
+		if s.closed {
+			return nil, ErrClosedCoordinator
+		}
+		switch {
+		case s.raft.role == RoleLeader:
+			if t, _ := s.termAt(s.raft.commit); t == s.raft.term && s.hasQuorum(time.Now()) {
+				return nil, nil
+			}
+		case s.raft.leader != "":
+			return s.forward(forwarded)
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrNoLeader
+		}
+		s.mu.Unlock()
+		time.Sleep(s.config.HeartbeatInterval.Duration())
+		s.mu.Lock()
+	}
+}
+
+type ReadReply struct {
+	Exists  bool   `json:"exists"`
+	Data    []byte `json:"data,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+func (s *Coordinator) Read(path string, forwarded bool) (*ReadReply, error) {
+	s.mu.Lock()
+	c, err := s.waitReadable(forwarded)
+	if c != nil || err != nil {
+		s.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		return c.read(path, true)
+	}
+	defer s.mu.Unlock()
+	if n := s.tree.Nodes[path]; n != nil {
+		return &ReadReply{Exists: true, Data: n.Data, Version: s.tree.version(path)}, nil
+	}
+	return &ReadReply{}, nil
+}
+
+type ListReply struct {
+	Exists   bool     `json:"exists"`
+	Paths    []string `json:"paths,omitempty"`
+	Revision int64    `json:"revision"`
+}
+
+func (s *Coordinator) List(path string, forwarded bool) (*ListReply, error) {
+	s.mu.Lock()
+	c, err := s.waitReadable(forwarded)
+	if c != nil || err != nil {
+		s.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		return c.list(path, true)
+	}
+	defer s.mu.Unlock()
+	paths, exists := s.tree.list(path)
+	return &ListReply{Exists: exists, Paths: paths, Revision: s.tree.Children[path]}, nil
+}
+
+// Watch returns the revision of children of path once it's greater than
+// the given revision, or the current one after watchTimeout. It's served by
+// the local tree, which is never ahead of the leader.
+func (s *Coordinator) Watch(path string, revision int64) (int64, error) {
+	var timeout = time.After(watchTimeout)
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return 0, ErrClosedCoordinator
+		}
+		current, changed := s.tree.Children[path], s.changed
+		s.mu.Unlock()
+		if current > revision {
+			return current, nil
+		}
+		select {
+		case <-s.exit.C:
+			return 0, ErrClosedCoordinator
+		case <-timeout:
+			return current, nil
+		case <-changed:
+		}
+	}
+}
+
+func (s *Coordinator) KeepAlive(session int64, forwarded bool) (*Result, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrClosedCoordinator
+	}
+	if s.raft.role != RoleLeader {
+		c, err := s.forward(forwarded)
+		s.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		return c.keepAlive(session, true)
+	}
+	defer s.mu.Unlock()
+	if _, ok := s.tree.Sessions[session]; !ok || s.sessions.closing[session] {
+		return &Result{Error: fmt.Sprintf("session %d is expired", session)}, nil
+	}
+	s.sessions.alive[session] = time.Now()
+	return &Result{Session: session}, nil
+}
+
+// expireSessions closes sessions that miss keepalives, since keepalives are
+// not replicated, a new leader gives all sessions a full ttl.
+func (s *Coordinator) expireSessions() {
+	var now = time.Now()
+	for id, ttl := range s.tree.Sessions {
+		last, ok := s.sessions.alive[id]
+		if !ok {
+			s.sessions.alive[id] = now
+			continue
+		}
+		if now.Sub(last) <= time.Duration(ttl)*time.Millisecond || s.sessions.closing[id] {
+			continue
+		}
+		log.Warnf("coordinator session-[%d] is expired", id)
+		if _, err := s.appendLeader(&Op{Type: OpCloseSession, Session: id}); err != nil {
+			log.ErrorErrorf(err, "coordinator expire session-[%d] failed", id)
+			return
+		}
+		s.sessions.closing[id] = true
+	}
+}
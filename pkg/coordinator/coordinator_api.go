@@ -0,0 +1,300 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package coordinator
+
+import (
+	"net/http"
+	"strings"
+
+	_ "net/http/pprof"
+
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/binding"
+	"github.com/martini-contrib/gzip"
+
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/CodisLabs/codis/pkg/utils/rpc"
+)
+
+type apiServer struct {
+	coordinator *Coordinator
+}
+
+func newApiServer(s *Coordinator) http.Handler {
+	m := martini.New()
+	m.Use(martini.Recovery())
+	m.Use(func(w http.ResponseWriter, req *http.Request, c martini.Context) {
+		path := req.URL.Path
+		if req.Method != "GET" && strings.HasPrefix(path, "/api/coordinator/") && !strings.HasPrefix(path, "/api/coordinator/raft/") {
+			log.Debugf("[%p] API call %s from %s", s, path, req.RemoteAddr)
+		}
+		c.Next()
+	})
+	m.Use(gzip.All())
+	m.Use(func(c martini.Context, w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	})
+
+	api := &apiServer{coordinator: s}
+
+	r := martini.NewRouter()
+
+	r.Any("/debug/**", func(w http.ResponseWriter, req *http.Request) {
+		http.DefaultServeMux.ServeHTTP(w, req)
+	})
+
+	r.Group("/coordinator", func(r martini.Router) {
+		r.Get("", api.Overview)
+	})
+	r.Group("/api/coordinator", func(r martini.Router) {
+		r.Put("/propose/:xauth", binding.Json(Request{}), api.Propose)
+		r.Put("/read/:xauth", binding.Json(Request{}), api.Read)
+		r.Put("/list/:xauth", binding.Json(Request{}), api.List)
+		r.Put("/watch/:xauth", binding.Json(Request{}), api.Watch)
+		r.Put("/session/keepalive/:xauth", binding.Json(Request{}), api.KeepAlive)
+		r.Group("/raft", func(r martini.Router) {
+			r.Put("/vote/:xauth", binding.Json(voteArgs{}), api.RequestVote)
+			r.Put("/append/:xauth", binding.Json(appendArgs{}), api.AppendEntries)
+			r.Put("/snapshot/:xauth", binding.Json(snapshotArgs{}), api.InstallSnapshot)
+		})
+	})
+
+	m.MapTo(r, (*martini.Routes)(nil))
+	m.Action(r.Handle)
+	return m
+}
+
+// Request of clients, Forwarded is set when a follower forwards it to the
+// leader, which won't be forwarded again.
+type Request struct {
+	Op        *Op    `json:"op,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Revision  int64  `json:"revision,omitempty"`
+	Session   int64  `json:"session,omitempty"`
+	Forwarded bool   `json:"forwarded,omitempty"`
+}
+
+func (s *apiServer) verifyXAuth(params martini.Params) error {
+	if s.coordinator.IsClosed() {
+		return ErrClosedCoordinator
+	}
+	xauth := params["xauth"]
+	if xauth == "" {
+		return errors.New("missing xauth, please check auth")
+	}
+	if xauth != s.coordinator.xauth {
+		return errors.New("invalid xauth, please check auth")
+	}
+	return nil
+}
+
+func (s *apiServer) Overview() (int, string) {
+	o, err := s.coordinator.Overview()
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(o)
+	}
+}
+
+func (s *apiServer) Propose(req Request, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if req.Op == nil {
+		return rpc.ApiResponseError(errors.New("missing op"))
+	}
+	if r, err := s.coordinator.Propose(req.Op, req.Forwarded); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(r)
+	}
+}
+
+func (s *apiServer) Read(req Request, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if r, err := s.coordinator.Read(req.Path, req.Forwarded); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(r)
+	}
+}
+
+func (s *apiServer) List(req Request, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if r, err := s.coordinator.List(req.Path, req.Forwarded); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(r)
+	}
+}
+
+func (s *apiServer) Watch(req Request, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if revision, err := s.coordinator.Watch(req.Path, req.Revision); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(revision)
+	}
+}
+
+func (s *apiServer) KeepAlive(req Request, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if r, err := s.coordinator.KeepAlive(req.Session, req.Forwarded); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(r)
+	}
+}
+
+func (s *apiServer) RequestVote(args voteArgs, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson(s.coordinator.handleVote(&args))
+}
+
+func (s *apiServer) AppendEntries(args appendArgs, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson(s.coordinator.handleAppend(&args))
+}
+
+func (s *apiServer) InstallSnapshot(args snapshotArgs, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if args.Snapshot == nil {
+		return rpc.ApiResponseError(errors.New("missing snapshot"))
+	}
+	return rpc.ApiResponseJson(s.coordinator.handleSnapshot(&args))
+}
+
+type ApiClient struct {
+	addr  string
+	xauth string
+}
+
+func NewApiClient(addr string) *ApiClient {
+	return &ApiClient{addr: addr}
+}
+
+func (c *ApiClient) SetXAuth(auth string) {
+	c.xauth = rpc.NewXAuth(auth)
+}
+
+func (s *Coordinator) peerClient(addr string) *ApiClient {
+	return &ApiClient{addr: addr, xauth: s.xauth}
+}
+
+func (c *ApiClient) encodeURL(format string, args ...interface{}) string {
+	return rpc.EncodeURL(c.addr, format, args...)
+}
+
+func (c *ApiClient) Overview() (*Overview, error) {
+	url := c.encodeURL("/coordinator")
+	var o = &Overview{}
+	if err := rpc.ApiGetJson(url, o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func (c *ApiClient) Propose(op *Op) (*Result, error) {
+	return c.propose(op, false)
+}
+
+func (c *ApiClient) propose(op *Op, forwarded bool) (*Result, error) {
+	url := c.encodeURL("/api/coordinator/propose/%s", c.xauth)
+	var r = &Result{}
+	if err := rpc.ApiPutJson(url, &Request{Op: op, Forwarded: forwarded}, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (c *ApiClient) Read(path string) (*ReadReply, error) {
+	return c.read(path, false)
+}
+
+func (c *ApiClient) read(path string, forwarded bool) (*ReadReply, error) {
+	url := c.encodeURL("/api/coordinator/read/%s", c.xauth)
+	var r = &ReadReply{}
+	if err := rpc.ApiPutJson(url, &Request{Path: path, Forwarded: forwarded}, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (c *ApiClient) List(path string) (*ListReply, error) {
+	return c.list(path, false)
+}
+
+func (c *ApiClient) list(path string, forwarded bool) (*ListReply, error) {
+	url := c.encodeURL("/api/coordinator/list/%s", c.xauth)
+	var r = &ListReply{}
+	if err := rpc.ApiPutJson(url, &Request{Path: path, Forwarded: forwarded}, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (c *ApiClient) Watch(path string, revision int64) (int64, error) {
+	url := c.encodeURL("/api/coordinator/watch/%s", c.xauth)
+	var r int64
+	if err := rpc.ApiPutJson(url, &Request{Path: path, Revision: revision}, &r); err != nil {
+		return 0, err
+	}
+	return r, nil
+}
+
+func (c *ApiClient) KeepAlive(session int64) (*Result, error) {
+	return c.keepAlive(session, false)
+}
+
+func (c *ApiClient) keepAlive(session int64, forwarded bool) (*Result, error) {
+	url := c.encodeURL("/api/coordinator/session/keepalive/%s", c.xauth)
+	var r = &Result{}
+	if err := rpc.ApiPutJson(url, &Request{Session: session, Forwarded: forwarded}, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (c *ApiClient) requestVote(args *voteArgs) (*voteReply, error) {
+	url := c.encodeURL("/api/coordinator/raft/vote/%s", c.xauth)
+	var r = &voteReply{}
+	if err := rpc.ApiPutJson(url, args, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (c *ApiClient) appendEntries(args *appendArgs) (*appendReply, error) {
+	url := c.encodeURL("/api/coordinator/raft/append/%s", c.xauth)
+	var r = &appendReply{}
+	if err := rpc.ApiPutJson(url, args, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (c *ApiClient) installSnapshot(args *snapshotArgs) (*snapshotReply, error) {
+	url := c.encodeURL("/api/coordinator/raft/snapshot/%s", c.xauth)
+	var r = &snapshotReply{}
+	if err := rpc.ApiPutJson(url, args, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
@@ -0,0 +1,276 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package coordinator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+)
+
+func init() {
+	log.SetLevel(log.LevelError)
+}
+
+const testAuth = "coordinator_auth"
+
+func newTestConfig(addr, peers, dir string) *Config {
+	config := NewDefaultConfig()
+	config.AdminAddr = addr
+	config.Peers = peers
+	config.MemberAddr = addr
+	config.Auth = testAuth
+	config.DataDir = dir
+	config.HeartbeatInterval.Set(time.Millisecond * 20)
+	config.ElectionTimeout.Set(time.Millisecond * 200)
+	config.SnapshotEntries = 16
+	return config
+}
+
+func newTestDir() string {
+	const TempDir = "gotest.tmp"
+	assert.MustNoError(os.MkdirAll(TempDir, 0755))
+	d, err := ioutil.TempDir(TempDir, "")
+	assert.MustNoError(err)
+	return d
+}
+
+func freeAddr() string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.MustNoError(err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func newTestClient(addr string) *ApiClient {
+	c := NewApiClient(addr)
+	c.SetXAuth(testAuth)
+	return c
+}
+
+func waitLeader(members []*Coordinator) *Coordinator {
+	for i := 0; i < 200; i++ {
+		for _, s := range members {
+			if s == nil {
+				continue
+			}
+			if o, err := s.Overview(); err == nil && o.Role == RoleLeader {
+				if s.readable() {
+					return s
+				}
+			}
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	assert.Must(false)
+	return nil
+}
+
+func (s *Coordinator) readable() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, _ := s.termAt(s.raft.commit)
+	return s.raft.role == RoleLeader && t == s.raft.term && s.hasQuorum(time.Now())
+}
+
+func TestTree(x *testing.T) {
+	t := newTree()
+	r := t.apply(1, &Op{Type: OpCreate, Path: "/codis3/demo/proxy/p1", Data: []byte("1")})
+	assert.Must(r.Error == "" && r.Version == "1")
+	r = t.apply(2, &Op{Type: OpCreate, Path: "/codis3/demo/proxy/p1"})
+	assert.Must(r.Error != "")
+	assert.Must(t.Children["/codis3/demo/proxy"] == 1)
+	assert.Must(t.Children["/codis3"] == 1)
+
+	r = t.apply(3, &Op{Type: OpUpdateVersion, Path: "/codis3/demo/proxy/p1", Data: []byte("2"), Version: "2"})
+	assert.Must(r.Error != "")
+	r = t.apply(4, &Op{Type: OpUpdateVersion, Path: "/codis3/demo/proxy/p1", Data: []byte("2"), Version: "1"})
+	assert.Must(r.Error == "" && r.Version == "4")
+	assert.Must(t.Children["/codis3/demo/proxy"] == 1)
+
+	r = t.apply(5, &Op{Type: OpOpenSession, TTL: 1000})
+	assert.Must(r.Session == 5)
+	for i := 1; i <= 2; i++ {
+		r = t.apply(int64(5+i), &Op{Type: OpCreate, Path: "/jodis/demo", Sequential: true, Session: 5})
+		assert.Must(r.Path == fmt.Sprintf("/jodis/demo/%010d", i))
+	}
+	r = t.apply(8, &Op{Type: OpCreate, Path: "/jodis/demo/x", Session: 100})
+	assert.Must(r.Error != "")
+
+	paths, exists := t.list("/jodis/demo")
+	assert.Must(exists && len(paths) == 2)
+	paths, exists = t.list("/codis3")
+	assert.Must(exists && len(paths) == 1 && paths[0] == "/codis3/demo")
+
+	t.apply(9, &Op{Type: OpCloseSession, Session: 5})
+	paths, exists = t.list("/jodis/demo")
+	assert.Must(!exists && len(paths) == 0)
+	assert.Must(t.Children["/jodis/demo"] == 9)
+
+	r = t.apply(10, &Op{Type: OpCommit,
+		Updates:  map[string][]byte{"/a/1": []byte("1"), "/codis3/demo/proxy/p1": nil},
+		Versions: map[string]string{"/a/1": "", "/codis3/demo/proxy/p1": "1"},
+	})
+	assert.Must(r.Error != "")
+	assert.Must(t.Nodes["/a/1"] == nil)
+	r = t.apply(11, &Op{Type: OpCommit,
+		Updates:  map[string][]byte{"/a/1": []byte("1"), "/codis3/demo/proxy/p1": nil},
+		Versions: map[string]string{"/a/1": "", "/codis3/demo/proxy/p1": "4"},
+	})
+	assert.Must(r.Error == "" && r.Versions["/a/1"] == "11" && r.Versions["/codis3/demo/proxy/p1"] == "")
+	assert.Must(t.Nodes["/codis3/demo/proxy/p1"] == nil)
+
+	b, err := t.encode()
+	assert.MustNoError(err)
+	d, err := decodeTree(b)
+	assert.MustNoError(err)
+	assert.Must(string(d.Nodes["/a/1"].Data) == "1" && d.Children["/a"] == 11)
+}
+
+func TestCoordinatorCluster(x *testing.T) {
+	var dirs, addrs []string
+	for i := 0; i < 3; i++ {
+		dirs = append(dirs, newTestDir())
+		addrs = append(addrs, freeAddr())
+	}
+	defer func() {
+		for _, d := range dirs {
+			os.RemoveAll(d)
+		}
+	}()
+	var peers = strings.Join(addrs, ",")
+
+	var members = make([]*Coordinator, 3)
+	for i := range members {
+		s, err := New(newTestConfig(addrs[i], peers, dirs[i]))
+		assert.MustNoError(err)
+		members[i] = s
+	}
+	defer func() {
+		for _, s := range members {
+			if s != nil {
+				s.Close()
+			}
+		}
+	}()
+
+	var leader = waitLeader(members)
+	var follower *Coordinator
+	for _, s := range members {
+		if s != leader {
+			follower = s
+		}
+	}
+
+	c := newTestClient(follower.Member())
+	r, err := c.Propose(&Op{Type: OpCreate, Path: "/codis3/demo/topom", Data: []byte("topom")})
+	assert.MustNoError(err)
+	assert.Must(r.Error == "" && r.Version != "")
+
+	l, err := c.List("/codis3/demo")
+	assert.MustNoError(err)
+	assert.Must(l.Exists && len(l.Paths) == 1)
+
+	watch := make(chan int64, 1)
+	go func() {
+		revision, err := newTestClient(leader.Member()).Watch("/codis3/demo", l.Revision)
+		assert.MustNoError(err)
+		watch <- revision
+	}()
+	time.Sleep(time.Millisecond * 50)
+
+	_, err = c.Propose(&Op{Type: OpCreate, Path: "/codis3/demo/proxy/p1", Data: []byte("p1")})
+	assert.MustNoError(err)
+	select {
+	case revision := <-watch:
+		assert.Must(revision > l.Revision)
+	case <-time.After(time.Second * 5):
+		assert.Must(false)
+	}
+
+	r, err = c.Propose(&Op{Type: OpOpenSession, TTL: 300})
+	assert.MustNoError(err)
+	var session = r.Session
+	r, err = c.Propose(&Op{Type: OpCreate, Path: "/jodis/demo", Sequential: true, Session: session})
+	assert.MustNoError(err)
+	var ephemeral = r.Path
+
+	for i := 0; i < 5; i++ {
+		r, err = c.KeepAlive(session)
+		assert.MustNoError(err)
+		assert.Must(r.Error == "")
+		time.Sleep(time.Millisecond * 100)
+	}
+	rr, err := c.Read(ephemeral)
+	assert.MustNoError(err)
+	assert.Must(rr.Exists)
+
+	for i := 0; i < 50; i++ {
+		if rr, err = c.Read(ephemeral); err == nil && !rr.Exists {
+			break
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	assert.Must(!rr.Exists)
+	r, err = c.KeepAlive(session)
+	assert.MustNoError(err)
+	assert.Must(r.Error != "")
+
+	for i, s := range members {
+		if s == leader {
+			s.Close()
+			members[i] = nil
+		}
+	}
+	leader = waitLeader(members)
+
+	for i := 0; i < 40; i++ {
+		_, err := newTestClient(leader.Member()).Propose(&Op{
+			Type: OpUpdate, Path: fmt.Sprintf("/codis3/demo/slots/slot-%04d", i), Data: []byte("{}"),
+		})
+		assert.MustNoError(err)
+	}
+
+	for i := range members {
+		if members[i] == nil {
+			s, err := New(newTestConfig(addrs[i], peers, dirs[i]))
+			assert.MustNoError(err)
+			members[i] = s
+		}
+	}
+
+	for _, s := range members {
+		c := newTestClient(s.Member())
+		rr, err := c.Read("/codis3/demo/topom")
+		assert.MustNoError(err)
+		assert.Must(rr.Exists && string(rr.Data) == "topom")
+		l, err := c.List("/codis3/demo/slots")
+		assert.MustNoError(err)
+		assert.Must(len(l.Paths) == 40)
+	}
+
+	o, err := leader.Overview()
+	assert.MustNoError(err)
+	for _, s := range members {
+		var ok bool
+		for i := 0; i < 100 && !ok; i++ {
+			p, err := s.Overview()
+			assert.MustNoError(err)
+			if ok = p.Applied >= o.Commit; !ok {
+				time.Sleep(time.Millisecond * 20)
+			}
+		}
+		assert.Must(ok)
+		s.mu.Lock()
+		assert.Must(len(s.tree.Nodes) == 42)
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,587 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package coordinator
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+)
+
+const maxAppendEntries = 256
+
+type voteArgs struct {
+	Term      int64  `json:"term"`
+	Candidate string `json:"candidate"`
+	LastIndex int64  `json:"last_index"`
+	LastTerm  int64  `json:"last_term"`
+}
+
+type voteReply struct {
+	Term    int64 `json:"term"`
+	Granted bool  `json:"granted"`
+}
+
+type appendArgs struct {
+	Term      int64    `json:"term"`
+	Leader    string   `json:"leader"`
+	PrevIndex int64    `json:"prev_index"`
+	PrevTerm  int64    `json:"prev_term"`
+	Entries   []*Entry `json:"entries,omitempty"`
+	Commit    int64    `json:"commit"`
+}
+
+type appendReply struct {
+	Term      int64 `json:"term"`
+	Success   bool  `json:"success"`
+	LastIndex int64 `json:"last_index"`
+}
+
+type snapshotArgs struct {
+	Term     int64     `json:"term"`
+	Leader   string    `json:"leader"`
+	Snapshot *snapshot `json:"snapshot"`
+}
+
+type snapshotReply struct {
+	Term int64 `json:"term"`
+}
+
+// restore loads the snapshot, log & hard state, log[0] always holds index
+// & term of the snapshot, which could be zero.
+func (s *Coordinator) restore() error {
+	snap, err := s.storage.loadSnapshot()
+	if err != nil {
+		return err
+	}
+	if s.tree, err = decodeTree(snap.Data); err != nil {
+		return err
+	}
+	s.raft.log = []*Entry{{Index: snap.Index, Term: snap.Term}}
+	s.raft.commit = snap.Index
+	s.raft.applied = snap.Index
+
+	entries, err := s.storage.loadLog()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Index <= snap.Index {
+			continue
+		}
+		if e.Index != s.lastIndex()+1 {
+			return errors.Errorf("raft log is broken, index = %d, expect = %d", e.Index, s.lastIndex()+1)
+		}
+		s.raft.log = append(s.raft.log, e)
+	}
+
+	st, err := s.storage.loadState()
+	if err != nil {
+		return err
+	}
+	s.raft.term, s.raft.vote = st.Term, st.Vote
+	s.raft.role = RoleFollower
+	s.resetDeadline()
+
+	log.Warnf("coordinator restore, term = %d, snapshot = %d, last = %d", s.raft.term, snap.Index, s.lastIndex())
+	return nil
+}
+
+func (s *Coordinator) lastIndex() int64 {
+	return s.raft.log[len(s.raft.log)-1].Index
+}
+
+func (s *Coordinator) lastTerm() int64 {
+	return s.raft.log[len(s.raft.log)-1].Term
+}
+
+func (s *Coordinator) termAt(index int64) (int64, bool) {
+	var first = s.raft.log[0].Index
+	if index < first || index > s.lastIndex() {
+		return 0, false
+	}
+	return s.raft.log[index-first].Term, true
+}
+
+func (s *Coordinator) entriesFrom(index int64) []*Entry {
+	var first = s.raft.log[0].Index
+	if index <= first || index > s.lastIndex() {
+		return nil
+	}
+	return s.raft.log[index-first:]
+}
+
+func (s *Coordinator) quorum() int {
+	return (len(s.peers)+1)/2 + 1
+}
+
+func (s *Coordinator) resetDeadline() {
+	var timeout = s.config.ElectionTimeout.Duration()
+	s.raft.deadline = time.Now().Add(timeout + time.Duration(rand.Int63n(int64(timeout))))
+}
+
+func (s *Coordinator) saveState() {
+	st := &hardState{Term: s.raft.term, Vote: s.raft.vote}
+	if err := s.storage.saveState(st); err != nil {
+		log.PanicErrorf(err, "coordinator save raft state failed")
+	}
+}
+
+// hasQuorum returns whether a majority has acked the leader recently, since
+// followers refuse to vote while they hear from a leader, no other leader
+// could be elected during that time.
+func (s *Coordinator) hasQuorum(now time.Time) bool {
+	var acks = 1
+	for _, p := range s.peers {
+		if now.Sub(s.raft.acked[p]) < s.config.ElectionTimeout.Duration() {
+			acks++
+		}
+	}
+	return acks >= s.quorum()
+}
+
+func (s *Coordinator) runRaft() {
+	var ticker = time.NewTicker(s.config.HeartbeatInterval.Duration())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.exit.C:
+			return
+		case <-ticker.C:
+		}
+		s.mu.Lock()
+		if !s.closed {
+			s.tick(time.Now())
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *Coordinator) tick(now time.Time) {
+	switch s.raft.role {
+	case RoleLeader:
+		if now.Sub(s.raft.electAt) > s.config.ElectionTimeout.Duration() && !s.hasQuorum(now) {
+			log.Warnf("coordinator lost quorum, step down at term = %d", s.raft.term)
+			s.becomeFollower(s.raft.term, "")
+			return
+		}
+		s.expireSessions()
+		s.advanceCommit()
+		s.broadcast()
+	default:
+		if now.After(s.raft.deadline) {
+			s.campaign()
+		}
+	}
+}
+
+func (s *Coordinator) becomeFollower(term int64, leader string) {
+	if term > s.raft.term {
+		s.raft.term, s.raft.vote = term, ""
+		s.saveState()
+	}
+	if s.raft.role == RoleLeader {
+		log.Warnf("coordinator step down as follower, term = %d", s.raft.term)
+	}
+	if leader != "" && leader != s.raft.leader {
+		log.Warnf("coordinator follow leader %s, term = %d", leader, term)
+	}
+	s.raft.role, s.raft.leader = RoleFollower, leader
+	s.resetDeadline()
+}
+
+func (s *Coordinator) campaign() {
+	s.raft.role = RoleCandidate
+	s.raft.term++
+	s.raft.vote = s.member
+	s.raft.leader = ""
+	s.saveState()
+	s.resetDeadline()
+
+	log.Warnf("coordinator campaign for leader, term = %d", s.raft.term)
+
+	var votes = 1
+	if votes >= s.quorum() {
+		s.becomeLeader()
+		return
+	}
+	args := &voteArgs{
+		Term: s.raft.term, Candidate: s.member,
+		LastIndex: s.lastIndex(), LastTerm: s.lastTerm(),
+	}
+	for _, p := range s.peers {
+		c := s.peerClient(p)
+		go func() {
+			reply, err := c.requestVote(args)
+			if err != nil {
+				log.Debugf("coordinator request vote from %s failed: %s", c.addr, err)
+				return
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			switch {
+			case s.closed:
+				return
+			case reply.Term > s.raft.term:
+				s.becomeFollower(reply.Term, "")
+			case s.raft.role != RoleCandidate || s.raft.term != args.Term:
+				return
+			case reply.Granted:
+				if votes++; votes == s.quorum() {
+					s.becomeLeader()
+				}
+			}
+		}()
+	}
+}
+
+func (s *Coordinator) becomeLeader() {
+	s.raft.role, s.raft.leader = RoleLeader, s.member
+	s.raft.electAt = time.Now()
+	s.raft.next = make(map[string]int64)
+	s.raft.match = make(map[string]int64)
+	s.raft.acked = make(map[string]time.Time)
+	s.raft.inflight = make(map[string]bool)
+	for _, p := range s.peers {
+		s.raft.next[p] = s.lastIndex() + 1
+	}
+	s.sessions.alive = make(map[int64]time.Time)
+	s.sessions.closing = make(map[int64]bool)
+
+	log.Warnf("coordinator is elected as leader, term = %d", s.raft.term)
+
+	if _, err := s.appendLeader(&Op{Type: OpNoop}); err != nil {
+		log.ErrorErrorf(err, "coordinator append noop failed")
+	}
+	s.advanceCommit()
+	s.broadcast()
+}
+
+func (s *Coordinator) appendLeader(op *Op) (*Entry, error) {
+	e := &Entry{Index: s.lastIndex() + 1, Term: s.raft.term, Op: op}
+	if err := s.storage.appendLog([]*Entry{e}); err != nil {
+		log.ErrorErrorf(err, "coordinator append log failed")
+		return nil, err
+	}
+	s.raft.log = append(s.raft.log, e)
+	return e, nil
+}
+
+func (s *Coordinator) broadcast() {
+	for _, p := range s.peers {
+		s.replicate(p)
+	}
+}
+
+func (s *Coordinator) replicate(p string) {
+	if s.raft.inflight[p] {
+		return
+	}
+	var c = s.peerClient(p)
+	var next = s.raft.next[p]
+	var term = s.raft.term
+
+	if next <= s.raft.log[0].Index {
+		s.raft.inflight[p] = true
+		go func() {
+			snap, err := s.storage.loadSnapshot()
+			if err != nil {
+				log.WarnErrorf(err, "coordinator load snapshot failed")
+			}
+			var reply *snapshotReply
+			var sentAt = time.Now()
+			if err == nil {
+				reply, err = c.installSnapshot(&snapshotArgs{Term: term, Leader: s.member, Snapshot: snap})
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.onReply(p, term, err, replyTerm(reply)) {
+				s.raft.acked[p] = sentAt
+				s.raft.match[p] = snap.Index
+				s.raft.next[p] = snap.Index + 1
+				s.replicate(p)
+			}
+		}()
+		return
+	}
+
+	prev := next - 1
+	prevTerm, _ := s.termAt(prev)
+	entries := s.entriesFrom(next)
+	if len(entries) > maxAppendEntries {
+		entries = entries[:maxAppendEntries]
+	}
+	args := &appendArgs{
+		Term: term, Leader: s.member,
+		PrevIndex: prev, PrevTerm: prevTerm,
+		Entries: entries, Commit: s.raft.commit,
+	}
+	s.raft.inflight[p] = true
+	go func() {
+		var sentAt = time.Now()
+		reply, err := c.appendEntries(args)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var rterm int64
+		if reply != nil {
+			rterm = reply.Term
+		}
+		if !s.onReply(p, term, err, rterm) {
+			return
+		}
+		s.raft.acked[p] = sentAt
+		if reply.Success {
+			if match := prev + int64(len(entries)); match > s.raft.match[p] {
+				s.raft.match[p] = match
+			}
+			s.raft.next[p] = s.raft.match[p] + 1
+			s.advanceCommit()
+			if s.raft.next[p] <= s.lastIndex() {
+				s.replicate(p)
+			}
+		} else {
+			next := s.raft.next[p] - 1
+			if reply.LastIndex+1 < next {
+				next = reply.LastIndex + 1
+			}
+			if next < 1 {
+				next = 1
+			}
+			s.raft.next[p] = next
+			s.replicate(p)
+		}
+	}()
+}
+
+func replyTerm(reply *snapshotReply) int64 {
+	if reply != nil {
+		return reply.Term
+	}
+	return 0
+}
+
+// onReply handles common parts of replies to the leader, it returns whether
+// the reply should be processed further.
+func (s *Coordinator) onReply(p string, term int64, err error, rterm int64) bool {
+	s.raft.inflight[p] = false
+	switch {
+	case s.closed:
+		return false
+	case err != nil:
+		log.Debugf("coordinator replicate to %s failed: %s", p, err)
+		return false
+	case rterm > s.raft.term:
+		s.becomeFollower(rterm, "")
+		return false
+	}
+	return s.raft.role == RoleLeader && s.raft.term == term
+}
+
+func (s *Coordinator) advanceCommit() {
+	for n := s.lastIndex(); n > s.raft.commit; n-- {
+		if t, _ := s.termAt(n); t != s.raft.term {
+			return
+		}
+		var acks = 1
+		for _, p := range s.peers {
+			if s.raft.match[p] >= n {
+				acks++
+			}
+		}
+		if acks >= s.quorum() {
+			s.raft.commit = n
+			s.applyCommitted()
+			return
+		}
+	}
+}
+
+func (s *Coordinator) applyCommitted() {
+	if s.raft.applied >= s.raft.commit {
+		return
+	}
+	for s.raft.applied < s.raft.commit {
+		e := s.raft.log[s.raft.applied+1-s.raft.log[0].Index]
+		r := s.tree.apply(e.Index, e.Op)
+		s.raft.applied = e.Index
+
+		switch e.Op.Type {
+		case OpOpenSession:
+			s.sessions.alive[e.Index] = time.Now()
+		case OpCloseSession:
+			delete(s.sessions.alive, e.Op.Session)
+			delete(s.sessions.closing, e.Op.Session)
+		}
+		if p := s.waits[e.Index]; p != nil {
+			delete(s.waits, e.Index)
+			if p.term == e.Term {
+				p.signal <- r
+			} else {
+				p.signal <- nil
+			}
+		}
+	}
+	close(s.changed)
+	s.changed = make(chan struct{})
+
+	if s.raft.applied-s.raft.log[0].Index >= int64(s.config.SnapshotEntries) {
+		s.compact()
+	}
+}
+
+func (s *Coordinator) compact() {
+	data, err := s.tree.encode()
+	if err != nil {
+		log.ErrorErrorf(err, "coordinator encode snapshot failed")
+		return
+	}
+	index := s.raft.applied
+	term, _ := s.termAt(index)
+	snap := &snapshot{Index: index, Term: term, Data: data}
+	if err := s.storage.saveSnapshot(snap); err != nil {
+		log.ErrorErrorf(err, "coordinator save snapshot failed")
+		return
+	}
+	keep := append([]*Entry{}, s.entriesFrom(index+1)...)
+	if err := s.storage.rewriteLog(keep); err != nil {
+		log.PanicErrorf(err, "coordinator rewrite log failed")
+	}
+	s.raft.log = append([]*Entry{{Index: index, Term: term}}, keep...)
+
+	log.Warnf("coordinator take snapshot, index = %d, term = %d", index, term)
+}
+
+func (s *Coordinator) handleVote(args *voteArgs) *voteReply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || args.Term < s.raft.term {
+		return &voteReply{Term: s.raft.term}
+	}
+	var now = time.Now()
+	switch s.raft.role {
+	case RoleLeader:
+		if s.hasQuorum(now) {
+			return &voteReply{Term: s.raft.term}
+		}
+	case RoleFollower:
+		if s.raft.leader != "" && now.Sub(s.raft.heard) < s.config.ElectionTimeout.Duration() {
+			return &voteReply{Term: s.raft.term}
+		}
+	}
+	if args.Term > s.raft.term {
+		s.becomeFollower(args.Term, "")
+	}
+	var uptodate = args.LastTerm > s.lastTerm() ||
+		(args.LastTerm == s.lastTerm() && args.LastIndex >= s.lastIndex())
+	if uptodate && (s.raft.vote == "" || s.raft.vote == args.Candidate) {
+		s.raft.vote = args.Candidate
+		s.saveState()
+		s.resetDeadline()
+		return &voteReply{Term: s.raft.term, Granted: true}
+	}
+	return &voteReply{Term: s.raft.term}
+}
+
+func (s *Coordinator) handleAppend(args *appendArgs) *appendReply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || args.Term < s.raft.term {
+		return &appendReply{Term: s.raft.term, LastIndex: s.lastIndex()}
+	}
+	if args.Term > s.raft.term || s.raft.role != RoleFollower || s.raft.leader != args.Leader {
+		s.becomeFollower(args.Term, args.Leader)
+	}
+	s.raft.heard = time.Now()
+	s.resetDeadline()
+
+	if args.PrevIndex > s.lastIndex() {
+		return &appendReply{Term: s.raft.term, LastIndex: s.lastIndex()}
+	}
+	if t, ok := s.termAt(args.PrevIndex); ok && t != args.PrevTerm {
+		return &appendReply{Term: s.raft.term, LastIndex: args.PrevIndex - 1}
+	}
+
+	var entries = args.Entries
+	for len(entries) != 0 && entries[0].Index <= s.raft.log[0].Index {
+		entries = entries[1:]
+	}
+	for i, e := range entries {
+		if t, ok := s.termAt(e.Index); ok {
+			if t == e.Term {
+				continue
+			}
+			if e.Index <= s.raft.commit {
+				log.Panicf("coordinator truncate committed entry %d", e.Index)
+			}
+			s.raft.log = s.raft.log[:e.Index-s.raft.log[0].Index]
+			s.raft.log = append(s.raft.log, entries[i:]...)
+			if err := s.storage.rewriteLog(s.raft.log[1:]); err != nil {
+				log.PanicErrorf(err, "coordinator rewrite log failed")
+			}
+		} else {
+			s.raft.log = append(s.raft.log, entries[i:]...)
+			if err := s.storage.appendLog(entries[i:]); err != nil {
+				log.PanicErrorf(err, "coordinator append log failed")
+			}
+		}
+		break
+	}
+
+	var last = args.PrevIndex + int64(len(args.Entries))
+	if args.Commit > s.raft.commit && last > s.raft.commit {
+		if args.Commit < last {
+			s.raft.commit = args.Commit
+		} else {
+			s.raft.commit = last
+		}
+		s.applyCommitted()
+	}
+	return &appendReply{Term: s.raft.term, Success: true, LastIndex: last}
+}
+
+func (s *Coordinator) handleSnapshot(args *snapshotArgs) *snapshotReply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || args.Term < s.raft.term {
+		return &snapshotReply{Term: s.raft.term}
+	}
+	if args.Term > s.raft.term || s.raft.role != RoleFollower || s.raft.leader != args.Leader {
+		s.becomeFollower(args.Term, args.Leader)
+	}
+	s.raft.heard = time.Now()
+	s.resetDeadline()
+
+	var snap = args.Snapshot
+	if snap.Index <= s.raft.applied {
+		return &snapshotReply{Term: s.raft.term}
+	}
+	t, err := decodeTree(snap.Data)
+	if err != nil {
+		log.ErrorErrorf(err, "coordinator decode snapshot failed")
+		return &snapshotReply{Term: s.raft.term}
+	}
+	if err := s.storage.saveSnapshot(snap); err != nil {
+		log.PanicErrorf(err, "coordinator save snapshot failed")
+	}
+
+	var keep []*Entry
+	if term, ok := s.termAt(snap.Index); ok && term == snap.Term {
+		keep = append(keep, s.entriesFrom(snap.Index+1)...)
+	}
+	if err := s.storage.rewriteLog(keep); err != nil {
+		log.PanicErrorf(err, "coordinator rewrite log failed")
+	}
+	s.raft.log = append([]*Entry{{Index: snap.Index, Term: snap.Term}}, keep...)
+	s.raft.commit = snap.Index
+	s.raft.applied = snap.Index
+	s.tree = t
+
+	close(s.changed)
+	s.changed = make(chan struct{})
+
+	log.Warnf("coordinator install snapshot, index = %d, term = %d", snap.Index, snap.Term)
+	return &snapshotReply{Term: s.raft.term}
+}
@@ -0,0 +1,192 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package coordinator
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+)
+
+type Entry struct {
+	Index int64 `json:"index"`
+	Term  int64 `json:"term"`
+	Op    *Op   `json:"op,omitempty"`
+}
+
+type hardState struct {
+	Term int64  `json:"term"`
+	Vote string `json:"vote"`
+}
+
+type snapshot struct {
+	Index int64           `json:"index"`
+	Term  int64           `json:"term"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// storage keeps raft state & snapshot in files replaced by rename, and the
+// log entries after the snapshot as json lines.
+type storage struct {
+	dir  string
+	logf *os.File
+}
+
+func openStorage(dir string) (*storage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &storage{dir: dir}, nil
+}
+
+func (s *storage) Close() error {
+	if s.logf != nil {
+		s.logf.Close()
+		s.logf = nil
+	}
+	return nil
+}
+
+func (s *storage) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+func (s *storage) writeFile(name string, data []byte) error {
+	f, err := os.OpenFile(s.path(name+".tmp"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return errors.Trace(err)
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	if err := os.Rename(f.Name(), s.path(name)); err != nil {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+func (s *storage) readJson(name string, v interface{}) (bool, error) {
+	b, err := ioutil.ReadFile(s.path(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.Trace(err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return false, errors.Trace(err)
+	}
+	return true, nil
+}
+
+func (s *storage) writeJson(name string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return s.writeFile(name, b)
+}
+
+func (s *storage) loadState() (*hardState, error) {
+	st := &hardState{}
+	if _, err := s.readJson("raft.state", st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func (s *storage) saveState(st *hardState) error {
+	return s.writeJson("raft.state", st)
+}
+
+func (s *storage) loadSnapshot() (*snapshot, error) {
+	snap := &snapshot{}
+	if _, err := s.readJson("raft.snap", snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+func (s *storage) saveSnapshot(snap *snapshot) error {
+	return s.writeJson("raft.snap", snap)
+}
+
+// loadLog returns entries in the log file, a partially written line at the
+// end is dropped, which means the process died while appending it.
+func (s *storage) loadLog() ([]*Entry, error) {
+	b, err := ioutil.ReadFile(s.path("raft.log"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Trace(err)
+	}
+	var entries []*Entry
+	for _, line := range bytes.SplitAfter(b, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		e := &Entry{}
+		if line[len(line)-1] != '\n' {
+			log.Warnf("coordinator - drop partial log entry: %q", line)
+			return entries, s.rewriteLog(entries)
+		}
+		if err := json.Unmarshal(line, e); err != nil {
+			return nil, errors.Trace(err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (s *storage) appendLog(entries []*Entry) error {
+	if s.logf == nil {
+		f, err := os.OpenFile(s.path("raft.log"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		s.logf = f
+	}
+	var b bytes.Buffer
+	var e = json.NewEncoder(&b)
+	for _, entry := range entries {
+		if err := e.Encode(entry); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if _, err := s.logf.Write(b.Bytes()); err != nil {
+		return errors.Trace(err)
+	}
+	if err := s.logf.Sync(); err != nil {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+func (s *storage) rewriteLog(entries []*Entry) error {
+	var b bytes.Buffer
+	var e = json.NewEncoder(&b)
+	for _, entry := range entries {
+		if err := e.Encode(entry); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if s.logf != nil {
+		s.logf.Close()
+		s.logf = nil
+	}
+	return s.writeFile("raft.log", b.Bytes())
+}
@@ -0,0 +1,238 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package coordinator
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+)
+
+const (
+	OpNoop          = "noop"
+	OpCreate        = "create"
+	OpUpdate        = "update"
+	OpUpdateVersion = "update-version"
+	OpDelete        = "delete"
+	OpCommit        = "commit"
+	OpOpenSession   = "open-session"
+	OpCloseSession  = "close-session"
+)
+
+// Op is an update of the tree, which is replicated through the raft log and
+// applied by all members in the same order.
+type Op struct {
+	Type string `json:"type"`
+	Path string `json:"path,omitempty"`
+	Data []byte `json:"data,omitempty"`
+
+	Version    string `json:"version,omitempty"`
+	Session    int64  `json:"session,omitempty"`
+	Sequential bool   `json:"sequential,omitempty"`
+	TTL        int64  `json:"ttl,omitempty"`
+
+	Updates  map[string][]byte `json:"updates,omitempty"`
+	Versions map[string]string `json:"versions,omitempty"`
+}
+
+// Result of an applied op, failures like version mismatch are returned as
+// Error, since they are decided by the state rather than the cluster.
+type Result struct {
+	Path     string            `json:"path,omitempty"`
+	Version  string            `json:"version,omitempty"`
+	Versions map[string]string `json:"versions,omitempty"`
+	Session  int64             `json:"session,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+type treeNode struct {
+	Data    []byte `json:"data"`
+	Version int64  `json:"version"`
+	Session int64  `json:"session,omitempty"`
+}
+
+// tree is the replicated state, keys are flat and directories are implied
+// by the separators of deeper keys. The index of the applying entry is used
+// as version of nodes, and as revision of directories whose children change.
+type tree struct {
+	Nodes    map[string]*treeNode `json:"nodes"`
+	Sessions map[int64]int64      `json:"sessions"`
+	Children map[string]int64     `json:"children"`
+	Seqs     map[string]int64     `json:"seqs"`
+}
+
+func newTree() *tree {
+	t := &tree{}
+	t.init()
+	return t
+}
+
+func (t *tree) init() {
+	if t.Nodes == nil {
+		t.Nodes = make(map[string]*treeNode)
+	}
+	if t.Sessions == nil {
+		t.Sessions = make(map[int64]int64)
+	}
+	if t.Children == nil {
+		t.Children = make(map[string]int64)
+	}
+	if t.Seqs == nil {
+		t.Seqs = make(map[string]int64)
+	}
+}
+
+func (t *tree) encode() ([]byte, error) {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return b, nil
+}
+
+func decodeTree(b []byte) (*tree, error) {
+	t := &tree{}
+	if len(b) != 0 {
+		if err := json.Unmarshal(b, t); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	t.init()
+	return t, nil
+}
+
+func (t *tree) version(path string) string {
+	if n := t.Nodes[path]; n != nil {
+		return strconv.FormatInt(n.Version, 10)
+	}
+	return ""
+}
+
+func (t *tree) touch(index int64, path string) {
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		t.Children[dir] = index
+		if dir == "/" || dir == "." {
+			return
+		}
+	}
+}
+
+func (t *tree) list(path string) ([]string, bool) {
+	var prefix = strings.TrimSuffix(path, "/") + "/"
+	var set = make(map[string]bool)
+	for key := range t.Nodes {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		name := key[len(prefix):]
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			name = name[:i]
+		}
+		if name != "" {
+			set[prefix+name] = true
+		}
+	}
+	var paths []string
+	for p := range set {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths, len(paths) != 0 || t.Nodes[path] != nil
+}
+
+func (t *tree) apply(index int64, op *Op) *Result {
+	switch op.Type {
+	case OpNoop:
+		return &Result{}
+	case OpCreate:
+		return t.create(index, op)
+	case OpUpdate:
+		t.update(index, op.Path, op.Data)
+		return &Result{Version: t.version(op.Path)}
+	case OpUpdateVersion:
+		if v := t.version(op.Path); v != op.Version {
+			return &Result{Error: fmt.Sprintf("version of node %s doesn't match", op.Path)}
+		}
+		t.update(index, op.Path, op.Data)
+		return &Result{Version: t.version(op.Path)}
+	case OpDelete:
+		t.delete(index, op.Path)
+		return &Result{}
+	case OpCommit:
+		return t.commit(index, op)
+	case OpOpenSession:
+		t.Sessions[index] = op.TTL
+		return &Result{Session: index}
+	case OpCloseSession:
+		t.closeSession(index, op.Session)
+		return &Result{}
+	}
+	return &Result{Error: fmt.Sprintf("invalid op type = %s", op.Type)}
+}
+
+func (t *tree) create(index int64, op *Op) *Result {
+	var path = op.Path
+	if op.Sequential {
+		t.Seqs[path]++
+		path = fmt.Sprintf("%s/%010d", strings.TrimSuffix(path, "/"), t.Seqs[path])
+	}
+	if _, ok := t.Sessions[op.Session]; op.Session != 0 && !ok {
+		return &Result{Error: fmt.Sprintf("session %d doesn't exist", op.Session)}
+	}
+	if t.Nodes[path] != nil {
+		return &Result{Error: fmt.Sprintf("node %s already exists", path)}
+	}
+	t.Nodes[path] = &treeNode{Data: op.Data, Version: index, Session: op.Session}
+	t.touch(index, path)
+	return &Result{Path: path, Version: t.version(path)}
+}
+
+func (t *tree) update(index int64, path string, data []byte) {
+	if n := t.Nodes[path]; n != nil {
+		n.Data, n.Version = data, index
+	} else {
+		t.Nodes[path] = &treeNode{Data: data, Version: index}
+		t.touch(index, path)
+	}
+}
+
+func (t *tree) delete(index int64, path string) {
+	if t.Nodes[path] != nil {
+		delete(t.Nodes, path)
+		t.touch(index, path)
+	}
+}
+
+func (t *tree) commit(index int64, op *Op) *Result {
+	for path, version := range op.Versions {
+		if v := t.version(path); v != version {
+			return &Result{Error: fmt.Sprintf("version of node %s doesn't match", path)}
+		}
+	}
+	var versions = make(map[string]string)
+	for path, data := range op.Updates {
+		if data != nil {
+			t.update(index, path, data)
+		} else {
+			t.delete(index, path)
+		}
+		versions[path] = t.version(path)
+	}
+	return &Result{Versions: versions}
+}
+
+func (t *tree) closeSession(index int64, session int64) {
+	delete(t.Sessions, session)
+	for path, n := range t.Nodes {
+		if n.Session == session {
+			t.delete(index, path)
+		}
+	}
+}
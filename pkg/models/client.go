@@ -7,7 +7,9 @@ import (
 	"time"
 
 	"github.com/CodisLabs/codis/pkg/models/etcd"
+	"github.com/CodisLabs/codis/pkg/models/etcdv3"
 	"github.com/CodisLabs/codis/pkg/models/fs"
+	"github.com/CodisLabs/codis/pkg/models/raft"
 	"github.com/CodisLabs/codis/pkg/models/zk"
 	"github.com/CodisLabs/codis/pkg/utils/errors"
 )
@@ -20,6 +22,14 @@ type Client interface {
 	Read(path string, must bool) ([]byte, error)
 	List(path string, must bool) ([]string, error)
 
+	// Versions are opaque, an empty version means the node must not exist.
+	ReadVersion(path string, must bool) ([]byte, string, error)
+	UpdateVersion(path string, data []byte, version string) (string, error)
+
+	// Commit applies all updates or none of them, a nil data deletes the node.
+	// Nodes listed in versions are checked, and latest versions are returned.
+	Commit(updates map[string][]byte, versions map[string]string) (map[string]string, error)
+
 	Close() error
 
 	WatchInOrder(path string) (<-chan struct{}, []string, error)
@@ -34,8 +44,12 @@ func NewClient(coordinator string, addrlist string, auth string, timeout time.Du
 		return zkclient.New(addrlist, auth, timeout)
 	case "etcd":
 		return etcdclient.New(addrlist, auth, timeout)
+	case "etcdv3":
+		return etcdv3client.New(addrlist, auth, timeout)
 	case "fs", "filesystem":
 		return fsclient.New(addrlist)
+	case "raft":
+		return raftclient.New(addrlist, auth, timeout)
 	}
 	return nil, errors.Errorf("invalid coordinator name = %s", coordinator)
 }
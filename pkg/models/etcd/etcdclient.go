@@ -4,6 +4,8 @@
 package etcdclient
 
 import (
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -158,6 +160,98 @@ func (c *Client) Update(path string, data []byte) error {
 	return nil
 }
 
+func (c *Client) UpdateVersion(path string, data []byte, version string) (string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return "", errors.Trace(ErrClosedClient)
+	}
+	opts := &client.SetOptions{PrevExist: client.PrevNoExist}
+	if version != "" {
+		index, err := strconv.ParseUint(version, 10, 64)
+		if err != nil {
+			return "", errors.Errorf("invalid version = %q", version)
+		}
+		opts = &client.SetOptions{PrevExist: client.PrevExist, PrevIndex: index}
+	}
+	cntx, cancel := c.newContext()
+	defer cancel()
+	log.Debugf("etcd update-version node %s, version = %q", path, version)
+	r, err := c.kapi.Set(cntx, path, string(data), opts)
+	if err != nil {
+		log.Debugf("etcd update-version node %s failed: %s", path, err)
+		return "", errors.Trace(err)
+	}
+	latest := strconv.FormatUint(r.Node.ModifiedIndex, 10)
+	log.Debugf("etcd update-version OK, version = %s", latest)
+	return latest, nil
+}
+
+// Commit of etcd v2 is not atomic, since there's no multi-key transaction.
+// Versions are checked ahead, then nodes are updated one by one.
+func (c *Client) Commit(updates map[string][]byte, versions map[string]string) (map[string]string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil, errors.Trace(ErrClosedClient)
+	}
+	log.Debugf("etcd commit %d nodes", len(updates))
+	latest, err := func() (map[string]string, error) {
+		var paths []string
+		for path := range updates {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			version, ok := versions[path]
+			if !ok {
+				continue
+			}
+			cntx, cancel := c.newContext()
+			r, err := c.kapi.Get(cntx, path, &client.GetOptions{Quorum: true})
+			cancel()
+			var current string
+			switch {
+			case err == nil:
+				current = strconv.FormatUint(r.Node.ModifiedIndex, 10)
+			case !isErrNoNode(err):
+				return nil, errors.Trace(err)
+			}
+			if current != version {
+				return nil, errors.Errorf("version of node %s doesn't match", path)
+			}
+		}
+
+		var latest = make(map[string]string)
+		for _, path := range paths {
+			cntx, cancel := c.newContext()
+			if data := updates[path]; data != nil {
+				r, err := c.kapi.Set(cntx, path, string(data), &client.SetOptions{PrevExist: client.PrevIgnore})
+				cancel()
+				if err != nil {
+					return nil, errors.Trace(err)
+				}
+				latest[path] = strconv.FormatUint(r.Node.ModifiedIndex, 10)
+			} else {
+				_, err := c.kapi.Delete(cntx, path, nil)
+				cancel()
+				if err != nil && !isErrNoNode(err) {
+					return nil, errors.Trace(err)
+				}
+				latest[path] = ""
+			}
+		}
+		return latest, nil
+	}()
+	if err != nil {
+		log.Debugf("etcd commit %d nodes failed: %s", len(updates), err)
+		return nil, err
+	}
+	log.Debugf("etcd commit OK")
+	return latest, nil
+}
+
 func (c *Client) Delete(path string) error {
 	c.Lock()
 	defer c.Unlock()
@@ -200,6 +294,30 @@ func (c *Client) Read(path string, must bool) ([]byte, error) {
 	}
 }
 
+func (c *Client) ReadVersion(path string, must bool) ([]byte, string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil, "", errors.Trace(ErrClosedClient)
+	}
+	cntx, cancel := c.newContext()
+	defer cancel()
+	r, err := c.kapi.Get(cntx, path, &client.GetOptions{Quorum: true})
+	switch {
+	case err != nil:
+		if isErrNoNode(err) && !must {
+			return nil, "", nil
+		}
+		log.Debugf("etcd read-version node %s failed: %s", path, err)
+		return nil, "", errors.Trace(err)
+	case !r.Node.Dir:
+		return []byte(r.Node.Value), strconv.FormatUint(r.Node.ModifiedIndex, 10), nil
+	default:
+		log.Debugf("etcd read-version node %s failed: not a file", path)
+		return nil, "", errors.Trace(ErrNotFile)
+	}
+}
+
 func (c *Client) List(path string, must bool) ([]string, error) {
 	c.Lock()
 	defer c.Unlock()
@@ -0,0 +1,823 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package etcdv3client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/CodisLabs/codis/pkg/utils/math2"
+)
+
+var ErrClosedClient = errors.New("use of closed etcdv3 client")
+
+var (
+	ErrNoNode     = errors.New("etcdv3: node doesn't exist")
+	ErrNodeExists = errors.New("etcdv3: node already exists")
+	ErrModified   = errors.New("etcdv3: node is modified concurrently")
+	ErrLeaseLost  = errors.New("etcdv3: lease is lost")
+)
+
+// Client talks to etcd (>= 3.4) through the v3 grpc-gateway, all requests
+// are json encoded and posted to http://{endpoint}/v3/{api}.
+//
+// The mutex only guards the fields of the client, it's never held across
+// requests. Ephemeral nodes share one session lease per client, which is
+// granted on demand and kept alive by a single goroutine.
+type Client struct {
+	sync.Mutex
+
+	endpoints []string
+	username  string
+	password  string
+	token     string
+
+	client *http.Client
+
+	session  *session
+	granting sync.Mutex
+
+	closed  bool
+	timeout time.Duration
+
+	cancel  context.CancelFunc
+	context context.Context
+}
+
+type session struct {
+	id   int64
+	lost chan struct{}
+}
+
+func New(addrlist string, auth string, timeout time.Duration) (*Client, error) {
+	var endpoints []string
+	for _, s := range strings.Split(addrlist, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if !strings.HasPrefix(s, "http://") && !strings.HasPrefix(s, "https://") {
+			s = "http://" + s
+		}
+		endpoints = append(endpoints, strings.TrimSuffix(s, "/"))
+	}
+	if len(endpoints) == 0 {
+		return nil, errors.Errorf("invalid address list")
+	}
+	if timeout <= 0 {
+		timeout = time.Second * 5
+	}
+
+	c := &Client{
+		endpoints: endpoints, timeout: timeout,
+		client: &http.Client{},
+	}
+	if auth != "" {
+		split := strings.SplitN(auth, ":", 2)
+		if len(split) != 2 || split[0] == "" {
+			return nil, errors.Errorf("invalid auth")
+		}
+		c.username = split[0]
+		c.password = split[1]
+	}
+	c.context, c.cancel = context.WithCancel(context.Background())
+
+	if c.username != "" {
+		if err := c.authenticate(); err != nil {
+			c.cancel()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *Client) Close() error {
+	c.Lock()
+	if c.closed {
+		c.Unlock()
+		return nil
+	}
+	c.closed = true
+	s := c.session
+	c.session = nil
+	c.Unlock()
+
+	if s != nil {
+		if err := c.revoke(s.id); err != nil {
+			log.Debugf("etcdv3 revoke lease %x failed: %s", s.id, err)
+		}
+	}
+	c.cancel()
+	return nil
+}
+
+func (c *Client) checkClosed() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return errors.Trace(ErrClosedClient)
+	}
+	return nil
+}
+
+func (c *Client) newContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(c.context, c.timeout)
+}
+
+type apiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Reason  string `json:"error"`
+}
+
+const codeUnauthenticated = 16
+
+func (c *Client) post(cntx context.Context, api string, args interface{}) (*http.Response, error) {
+	b, err := json.Marshal(args)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	c.Lock()
+	var endpoints = append([]string{}, c.endpoints...)
+	var token = c.token
+	c.Unlock()
+
+	var lastErr error
+	for i := range endpoints {
+		req, err := http.NewRequest("POST", endpoints[i]+"/v3/"+api, bytes.NewReader(b))
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		rsp, err := c.client.Do(req.WithContext(cntx))
+		if err != nil {
+			if cntx.Err() != nil {
+				return nil, errors.Trace(err)
+			}
+			lastErr = err
+			continue
+		}
+		if i != 0 {
+			c.promote(endpoints[i])
+		}
+		return rsp, nil
+	}
+	return nil, errors.Trace(lastErr)
+}
+
+func (c *Client) promote(endpoint string) {
+	c.Lock()
+	defer c.Unlock()
+	for i := range c.endpoints {
+		if c.endpoints[i] == endpoint {
+			c.endpoints[0], c.endpoints[i] = c.endpoints[i], c.endpoints[0]
+			return
+		}
+	}
+}
+
+func (c *Client) call(api string, args, reply interface{}) error {
+	for retry := 0; ; retry++ {
+		cntx, cancel := c.newContext()
+		err := c.callContext(cntx, api, args, reply)
+		cancel()
+		if e, ok := errors.Cause(err).(*apiError); ok && e.Code == codeUnauthenticated {
+			if c.username != "" && retry == 0 {
+				if err := c.authenticate(); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		return err
+	}
+}
+
+func (c *Client) callContext(cntx context.Context, api string, args, reply interface{}) error {
+	rsp, err := c.post(cntx, api, args)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if rsp.StatusCode != http.StatusOK {
+		e := &apiError{}
+		if err := json.Unmarshal(b, e); err != nil || (e.Message == "" && e.Reason == "") {
+			return errors.Errorf("etcdv3: %s returns [%d] %s", api, rsp.StatusCode, bytes.TrimSpace(b))
+		}
+		return errors.Trace(e)
+	}
+	if reply != nil {
+		if err := json.Unmarshal(b, reply); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func (e *apiError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("etcdv3: %s (code = %d)", e.Message, e.Code)
+	}
+	return fmt.Sprintf("etcdv3: %s (code = %d)", e.Reason, e.Code)
+}
+
+func (c *Client) authenticate() error {
+	var args = map[string]string{"name": c.username, "password": c.password}
+	var reply struct {
+		Token string `json:"token"`
+	}
+	c.Lock()
+	c.token = ""
+	c.Unlock()
+	cntx, cancel := c.newContext()
+	defer cancel()
+	if err := c.callContext(cntx, "auth/authenticate", args, &reply); err != nil {
+		log.Debugf("etcdv3 authenticate failed: %s", err)
+		return err
+	}
+	c.Lock()
+	c.token = reply.Token
+	c.Unlock()
+	return nil
+}
+
+type keyValue struct {
+	Key            []byte `json:"key"`
+	Value          []byte `json:"value"`
+	CreateRevision int64  `json:"create_revision,string"`
+	ModRevision    int64  `json:"mod_revision,string"`
+	Version        int64  `json:"version,string"`
+	Lease          int64  `json:"lease,string"`
+}
+
+type responseHeader struct {
+	Revision int64 `json:"revision,string"`
+}
+
+type rangeRequest struct {
+	Key      []byte `json:"key"`
+	RangeEnd []byte `json:"range_end,omitempty"`
+	KeysOnly bool   `json:"keys_only,omitempty"`
+}
+
+type rangeResponse struct {
+	Header responseHeader `json:"header"`
+	Kvs    []*keyValue    `json:"kvs"`
+}
+
+type putRequest struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+	Lease int64  `json:"lease,omitempty"`
+}
+
+type compare struct {
+	Key         []byte `json:"key"`
+	Target      string `json:"target"`
+	Result      string `json:"result"`
+	Version     *int64 `json:"version,omitempty"`
+	ModRevision *int64 `json:"mod_revision,omitempty"`
+}
+
+type deleteRangeRequest struct {
+	Key []byte `json:"key"`
+}
+
+type requestOp struct {
+	RequestPut         *putRequest         `json:"request_put,omitempty"`
+	RequestDeleteRange *deleteRangeRequest `json:"request_delete_range,omitempty"`
+}
+
+type txnRequest struct {
+	Compare []*compare   `json:"compare"`
+	Success []*requestOp `json:"success"`
+}
+
+type txnResponse struct {
+	Header    responseHeader `json:"header"`
+	Succeeded bool           `json:"succeeded"`
+}
+
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return []byte{0}
+}
+
+func dirPrefix(path string) []byte {
+	return []byte(strings.TrimSuffix(path, "/") + "/")
+}
+
+func (c *Client) get(path string) (*keyValue, error) {
+	var reply rangeResponse
+	if err := c.call("kv/range", &rangeRequest{Key: []byte(path)}, &reply); err != nil {
+		return nil, err
+	}
+	if len(reply.Kvs) == 0 {
+		return nil, nil
+	}
+	return reply.Kvs[0], nil
+}
+
+func (c *Client) txnPut(cmp *compare, path string, data []byte, lease int64) (*txnResponse, error) {
+	var args = &txnRequest{
+		Compare: []*compare{cmp},
+		Success: []*requestOp{{RequestPut: &putRequest{Key: []byte(path), Value: data, Lease: lease}}},
+	}
+	var reply txnResponse
+	if err := c.call("kv/txn", args, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+func (c *Client) create(path string, data []byte, lease int64) (int64, error) {
+	var version int64
+	var cmp = &compare{Key: []byte(path), Target: "VERSION", Result: "EQUAL", Version: &version}
+	if r, err := c.txnPut(cmp, path, data, lease); err != nil {
+		return 0, err
+	} else if !r.Succeeded {
+		return 0, errors.Trace(ErrNodeExists)
+	} else {
+		return r.Header.Revision, nil
+	}
+}
+
+func (c *Client) compareAndSwap(path string, data []byte, revision int64) (int64, error) {
+	var cmp = &compare{Key: []byte(path), Target: "MOD", Result: "EQUAL", ModRevision: &revision}
+	if r, err := c.txnPut(cmp, path, data, 0); err != nil {
+		return 0, err
+	} else if !r.Succeeded {
+		return 0, errors.Trace(ErrModified)
+	} else {
+		return r.Header.Revision, nil
+	}
+}
+
+func (c *Client) Mkdir(path string) error {
+	return nil
+}
+
+func (c *Client) Create(path string, data []byte) error {
+	if err := c.checkClosed(); err != nil {
+		return err
+	}
+	log.Debugf("etcdv3 create node %s", path)
+	if _, err := c.create(path, data, 0); err != nil {
+		log.Debugf("etcdv3 create node %s failed: %s", path, err)
+		return err
+	}
+	log.Debugf("etcdv3 create OK")
+	return nil
+}
+
+func (c *Client) Update(path string, data []byte) error {
+	if err := c.checkClosed(); err != nil {
+		return err
+	}
+	log.Debugf("etcdv3 update node %s", path)
+	err := func() error {
+		kv, err := c.get(path)
+		if err != nil {
+			return err
+		}
+		var revision int64
+		if kv != nil {
+			revision = kv.ModRevision
+		}
+		_, err = c.compareAndSwap(path, data, revision)
+		return err
+	}()
+	if err != nil {
+		log.Debugf("etcdv3 update node %s failed: %s", path, err)
+		return err
+	}
+	log.Debugf("etcdv3 update OK")
+	return nil
+}
+
+func (c *Client) UpdateVersion(path string, data []byte, version string) (string, error) {
+	if err := c.checkClosed(); err != nil {
+		return "", err
+	}
+	log.Debugf("etcdv3 update-version node %s, version = %q", path, version)
+	latest, err := func() (int64, error) {
+		if version == "" {
+			return c.create(path, data, 0)
+		}
+		revision, err := strconv.ParseInt(version, 10, 64)
+		if err != nil {
+			return 0, errors.Errorf("invalid version = %q", version)
+		}
+		return c.compareAndSwap(path, data, revision)
+	}()
+	if err != nil {
+		log.Debugf("etcdv3 update-version node %s failed: %s", path, err)
+		return "", err
+	}
+	log.Debugf("etcdv3 update-version OK, version = %d", latest)
+	return strconv.FormatInt(latest, 10), nil
+}
+
+func (c *Client) Commit(updates map[string][]byte, versions map[string]string) (map[string]string, error) {
+	if err := c.checkClosed(); err != nil {
+		return nil, err
+	}
+	log.Debugf("etcdv3 commit %d nodes", len(updates))
+	latest, err := func() (map[string]string, error) {
+		var paths []string
+		for path := range updates {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		var args = &txnRequest{}
+		for _, path := range paths {
+			if version, ok := versions[path]; ok {
+				var cmp = &compare{Key: []byte(path), Result: "EQUAL"}
+				if version == "" {
+					cmp.Target, cmp.Version = "VERSION", new(int64)
+				} else {
+					revision, err := strconv.ParseInt(version, 10, 64)
+					if err != nil {
+						return nil, errors.Errorf("invalid version = %q", version)
+					}
+					cmp.Target, cmp.ModRevision = "MOD", &revision
+				}
+				args.Compare = append(args.Compare, cmp)
+			}
+			if data := updates[path]; data != nil {
+				args.Success = append(args.Success, &requestOp{
+					RequestPut: &putRequest{Key: []byte(path), Value: data},
+				})
+			} else {
+				args.Success = append(args.Success, &requestOp{
+					RequestDeleteRange: &deleteRangeRequest{Key: []byte(path)},
+				})
+			}
+		}
+		var reply txnResponse
+		if err := c.call("kv/txn", args, &reply); err != nil {
+			return nil, err
+		}
+		if !reply.Succeeded {
+			return nil, errors.Trace(ErrModified)
+		}
+		var latest = make(map[string]string)
+		for _, path := range paths {
+			if updates[path] != nil {
+				latest[path] = strconv.FormatInt(reply.Header.Revision, 10)
+			} else {
+				latest[path] = ""
+			}
+		}
+		return latest, nil
+	}()
+	if err != nil {
+		log.Debugf("etcdv3 commit %d nodes failed: %s", len(updates), err)
+		return nil, err
+	}
+	log.Debugf("etcdv3 commit OK")
+	return latest, nil
+}
+
+func (c *Client) Delete(path string) error {
+	if err := c.checkClosed(); err != nil {
+		return err
+	}
+	log.Debugf("etcdv3 delete node %s", path)
+	var args = map[string][]byte{"key": []byte(path)}
+	if err := c.call("kv/deleterange", args, nil); err != nil {
+		log.Debugf("etcdv3 delete node %s failed: %s", path, err)
+		return err
+	}
+	log.Debugf("etcdv3 delete OK")
+	return nil
+}
+
+func (c *Client) Read(path string, must bool) ([]byte, error) {
+	if err := c.checkClosed(); err != nil {
+		return nil, err
+	}
+	kv, err := c.get(path)
+	switch {
+	case err != nil:
+		log.Debugf("etcdv3 read node %s failed: %s", path, err)
+		return nil, err
+	case kv != nil:
+		return kv.Value, nil
+	case must:
+		log.Debugf("etcdv3 read node %s failed: not found", path)
+		return nil, errors.Trace(ErrNoNode)
+	default:
+		return nil, nil
+	}
+}
+
+func (c *Client) ReadVersion(path string, must bool) ([]byte, string, error) {
+	if err := c.checkClosed(); err != nil {
+		return nil, "", err
+	}
+	kv, err := c.get(path)
+	switch {
+	case err != nil:
+		log.Debugf("etcdv3 read-version node %s failed: %s", path, err)
+		return nil, "", err
+	case kv != nil:
+		return kv.Value, strconv.FormatInt(kv.ModRevision, 10), nil
+	case must:
+		log.Debugf("etcdv3 read-version node %s failed: not found", path)
+		return nil, "", errors.Trace(ErrNoNode)
+	default:
+		return nil, "", nil
+	}
+}
+
+// children returns direct children of path. Keys are flat in v3, so that
+// directories are implied by the separators of deeper keys.
+func children(path string, kvs []*keyValue) []string {
+	var prefix = string(dirPrefix(path))
+	var paths []string
+	var exists = make(map[string]bool)
+	for _, kv := range kvs {
+		name := strings.TrimPrefix(string(kv.Key), prefix)
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			name = name[:i]
+		}
+		if name == "" || exists[name] {
+			continue
+		}
+		exists[name] = true
+		paths = append(paths, prefix+name)
+	}
+	return paths
+}
+
+func (c *Client) List(path string, must bool) ([]string, error) {
+	if err := c.checkClosed(); err != nil {
+		return nil, err
+	}
+	var prefix = dirPrefix(path)
+	var args = &rangeRequest{Key: prefix, RangeEnd: prefixEnd(prefix), KeysOnly: true}
+	var reply rangeResponse
+	if err := c.call("kv/range", args, &reply); err != nil {
+		log.Debugf("etcdv3 list node %s failed: %s", path, err)
+		return nil, err
+	}
+	if len(reply.Kvs) == 0 && must {
+		log.Debugf("etcdv3 list node %s failed: not found", path)
+		return nil, errors.Trace(ErrNoNode)
+	}
+	return children(path, reply.Kvs), nil
+}
+
+// leaseTTL is a multiple of the request timeout, so a lease outlives a few
+// keepalives that fail or time out.
+func (c *Client) leaseTTL() time.Duration {
+	return math2.MaxDuration(time.Second, c.timeout) * 3
+}
+
+func (c *Client) grant() (int64, error) {
+	var args = map[string]int64{"TTL": int64(c.leaseTTL() / time.Second)}
+	var reply struct {
+		ID int64 `json:"ID,string"`
+	}
+	if err := c.call("lease/grant", args, &reply); err != nil {
+		return 0, err
+	}
+	return reply.ID, nil
+}
+
+func (c *Client) revoke(id int64) error {
+	return c.call("lease/revoke", map[string]int64{"ID": id}, nil)
+}
+
+func (c *Client) KeepAlive(id int64) error {
+	if err := c.checkClosed(); err != nil {
+		return err
+	}
+	var reply struct {
+		Result struct {
+			TTL int64 `json:"TTL,string"`
+		} `json:"result"`
+	}
+	log.Debugf("etcdv3 keepalive lease %x", id)
+	if err := c.call("lease/keepalive", map[string]int64{"ID": id}, &reply); err != nil {
+		log.Debugf("etcdv3 keepalive lease %x failed: %s", id, err)
+		return err
+	}
+	if reply.Result.TTL <= 0 {
+		log.Debugf("etcdv3 keepalive lease %x failed: expired", id)
+		return errors.Trace(ErrLeaseLost)
+	}
+	return nil
+}
+
+// lease returns the session lease of the client, a new one is granted if
+// there's none or the last one is lost.
+func (c *Client) lease() (*session, error) {
+	c.granting.Lock()
+	defer c.granting.Unlock()
+
+	c.Lock()
+	s := c.session
+	c.Unlock()
+	if s != nil {
+		select {
+		case <-s.lost:
+		default:
+			return s, nil
+		}
+	}
+
+	id, err := c.grant()
+	if err != nil {
+		return nil, err
+	}
+	s = &session{id: id, lost: make(chan struct{})}
+
+	c.Lock()
+	if c.closed {
+		c.Unlock()
+		c.revoke(id)
+		return nil, errors.Trace(ErrClosedClient)
+	}
+	c.session = s
+	c.Unlock()
+
+	go c.keepAlive(s)
+	return s, nil
+}
+
+// keepAlive retries failed keepalives until the lease could have expired,
+// then the session is dropped.
+func (c *Client) keepAlive(s *session) {
+	defer close(s.lost)
+	var ttl, renewed = c.leaseTTL(), time.Now()
+	for {
+		select {
+		case <-c.context.Done():
+			return
+		case <-time.After(ttl / 6):
+		}
+		var start = time.Now()
+		err := c.KeepAlive(s.id)
+		switch {
+		case err == nil:
+			renewed = start
+			continue
+		case errors.Equal(err, ErrLeaseLost), errors.Equal(err, ErrClosedClient):
+		case time.Since(renewed)+ttl/6+c.timeout < ttl:
+			log.WarnErrorf(err, "etcdv3 keepalive lease %x failed, retry", s.id)
+			continue
+		}
+		c.Lock()
+		if c.session == s {
+			c.session = nil
+		}
+		c.Unlock()
+		return
+	}
+}
+
+func (c *Client) CreateEphemeral(path string, data []byte) (<-chan struct{}, error) {
+	if err := c.checkClosed(); err != nil {
+		return nil, err
+	}
+	log.Debugf("etcdv3 create-ephemeral node %s", path)
+	s, err := c.lease()
+	if err == nil {
+		_, err = c.create(path, data, s.id)
+	}
+	if err != nil {
+		log.Debugf("etcdv3 create-ephemeral node %s failed: %s", path, err)
+		return nil, err
+	}
+	log.Debugf("etcdv3 create-ephemeral OK")
+	return s.lost, nil
+}
+
+// CreateEphemeralInOrder keeps a sequence as the version of the dir key, the
+// sequence and the node are updated in one transaction.
+func (c *Client) CreateEphemeralInOrder(path string, data []byte) (<-chan struct{}, string, error) {
+	if err := c.checkClosed(); err != nil {
+		return nil, "", err
+	}
+	log.Debugf("etcdv3 create-ephemeral-inorder node %s", path)
+	var signal <-chan struct{}
+	var node string
+	err := func() error {
+		s, err := c.lease()
+		if err != nil {
+			return err
+		}
+		var seq = strings.TrimSuffix(path, "/")
+		for {
+			kv, err := c.get(seq)
+			if err != nil {
+				return err
+			}
+			var version int64
+			if kv != nil {
+				version = kv.Version
+			}
+			var p = fmt.Sprintf("%s%010d", dirPrefix(path), version+1)
+			var args = &txnRequest{
+				Compare: []*compare{{Key: []byte(seq), Target: "VERSION", Result: "EQUAL", Version: &version}},
+				Success: []*requestOp{
+					{RequestPut: &putRequest{Key: []byte(seq)}},
+					{RequestPut: &putRequest{Key: []byte(p), Value: data, Lease: s.id}},
+				},
+			}
+			var reply txnResponse
+			if err := c.call("kv/txn", args, &reply); err != nil {
+				return err
+			}
+			if reply.Succeeded {
+				signal, node = s.lost, p
+				return nil
+			}
+		}
+	}()
+	if err != nil {
+		log.Debugf("etcdv3 create-ephemeral-inorder node %s failed: %s", path, err)
+		return nil, "", err
+	}
+	log.Debugf("etcdv3 create-ephemeral-inorder OK, node = %s", node)
+	return signal, node, nil
+}
+
+func (c *Client) WatchInOrder(path string) (<-chan struct{}, []string, error) {
+	if err := c.checkClosed(); err != nil {
+		return nil, nil, err
+	}
+	log.Debugf("etcdv3 watch-inorder node %s", path)
+	var prefix = dirPrefix(path)
+	var args = &rangeRequest{Key: prefix, RangeEnd: prefixEnd(prefix), KeysOnly: true}
+	var reply rangeResponse
+	if err := c.call("kv/range", args, &reply); err != nil {
+		log.Debugf("etcdv3 watch-inorder node %s failed: %s", path, err)
+		return nil, nil, err
+	}
+	var create = map[string]interface{}{
+		"key": prefix, "range_end": prefixEnd(prefix),
+		"start_revision": reply.Header.Revision + 1,
+	}
+	rsp, err := c.post(c.context, "watch", map[string]interface{}{"create_request": create})
+	if err != nil {
+		log.Debugf("etcdv3 watch-inorder node %s failed: %s", path, err)
+		return nil, nil, err
+	}
+	signal := make(chan struct{})
+	go func() {
+		defer close(signal)
+		defer rsp.Body.Close()
+		dec := json.NewDecoder(rsp.Body)
+		for {
+			var r struct {
+				Result struct {
+					Canceled bool              `json:"canceled"`
+					Events   []json.RawMessage `json:"events"`
+				} `json:"result"`
+			}
+			if err := dec.Decode(&r); err != nil {
+				if err != io.EOF {
+					log.Debugf("etcdv3 watch-inorder node %s failed: %s", path, err)
+				}
+				return
+			}
+			if r.Result.Canceled || len(r.Result.Events) != 0 {
+				log.Debugf("etcdv3 watch-inorder node %s update", path)
+				return
+			}
+		}
+	}()
+	log.Debugf("etcdv3 watch-inorder OK")
+	return signal, children(path, reply.Kvs), nil
+}
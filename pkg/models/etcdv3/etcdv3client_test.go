@@ -0,0 +1,522 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package etcdv3client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+)
+
+// fakeGateway implements the subset of the etcd v3 grpc-gateway used by
+// the client, keys are kept in memory and every change bumps the revision.
+type fakeGateway struct {
+	mu sync.Mutex
+
+	revision int64
+	kvs      map[string]*keyValue
+	leases   map[int64]bool
+	nextID   int64
+	grants   int
+	changed  chan struct{}
+
+	blocked  map[string]chan struct{}
+	failures int
+
+	*httptest.Server
+}
+
+func newFakeGateway() *fakeGateway {
+	g := &fakeGateway{
+		revision: 1,
+		kvs:      make(map[string]*keyValue),
+		leases:   make(map[int64]bool),
+		changed:  make(chan struct{}),
+		blocked:  make(map[string]chan struct{}),
+	}
+	g.Server = httptest.NewServer(g)
+	return g
+}
+
+func (g *fakeGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var api = strings.TrimPrefix(r.URL.Path, "/v3/")
+	if api == "watch" {
+		g.serveWatch(w, r)
+		return
+	}
+	var reply interface{}
+	switch api {
+	case "kv/range":
+		var args rangeRequest
+		json.NewDecoder(r.Body).Decode(&args)
+		g.mu.Lock()
+		block := g.blocked[string(args.Key)]
+		g.mu.Unlock()
+		if block != nil {
+			<-block
+		}
+		reply = g.doRange(&args)
+	case "kv/txn":
+		var args txnRequest
+		json.NewDecoder(r.Body).Decode(&args)
+		if x := g.doTxn(&args); x != nil {
+			reply = x
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(&apiError{Code: 5, Message: "etcdserver: requested lease not found"})
+			return
+		}
+	case "kv/deleterange":
+		var args deleteRangeRequest
+		json.NewDecoder(r.Body).Decode(&args)
+		g.mu.Lock()
+		if g.delete(string(args.Key)) {
+			g.notify()
+		}
+		g.mu.Unlock()
+		reply = struct{}{}
+	case "lease/grant":
+		g.mu.Lock()
+		g.nextID++
+		g.grants++
+		g.leases[g.nextID] = true
+		reply = map[string]string{"ID": strconv.FormatInt(g.nextID, 10)}
+		g.mu.Unlock()
+	case "lease/keepalive", "lease/revoke":
+		g.mu.Lock()
+		if api == "lease/keepalive" && g.failures != 0 {
+			g.failures--
+			g.mu.Unlock()
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(&apiError{Code: 14, Message: "unavailable"})
+			return
+		}
+		g.mu.Unlock()
+		var args struct {
+			ID int64 `json:"ID"`
+		}
+		json.NewDecoder(r.Body).Decode(&args)
+		g.mu.Lock()
+		var ttl = "0"
+		if g.leases[args.ID] {
+			ttl = "10"
+		}
+		if api == "lease/revoke" {
+			g.dropLease(args.ID)
+		}
+		g.mu.Unlock()
+		reply = map[string]map[string]string{"result": {"TTL": ttl}}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(&apiError{Code: 12, Message: "unknown api " + api})
+		return
+	}
+	json.NewEncoder(w).Encode(reply)
+}
+
+// notify bumps the revision once for all changes made since the last call.
+func (g *fakeGateway) notify() {
+	g.revision++
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+func (g *fakeGateway) put(key string, value []byte, lease int64) {
+	kv := g.kvs[key]
+	if kv == nil {
+		kv = &keyValue{Key: []byte(key), CreateRevision: g.revision + 1}
+		g.kvs[key] = kv
+	}
+	kv.Value, kv.Lease = value, lease
+	kv.ModRevision = g.revision + 1
+	kv.Version++
+}
+
+func (g *fakeGateway) delete(key string) bool {
+	if g.kvs[key] == nil {
+		return false
+	}
+	delete(g.kvs, key)
+	return true
+}
+
+func (g *fakeGateway) dropLease(id int64) {
+	delete(g.leases, id)
+	var changed bool
+	for key, kv := range g.kvs {
+		if kv.Lease == id {
+			changed = g.delete(key) || changed
+		}
+	}
+	if changed {
+		g.notify()
+	}
+}
+
+func (g *fakeGateway) doRange(args *rangeRequest) *rangeResponse {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	reply := &rangeResponse{Header: responseHeader{Revision: g.revision}}
+	for key, kv := range g.kvs {
+		match := key == string(args.Key)
+		if args.RangeEnd != nil {
+			match = key >= string(args.Key) && key < string(args.RangeEnd)
+		}
+		if match {
+			x := *kv
+			reply.Kvs = append(reply.Kvs, &x)
+		}
+	}
+	return reply
+}
+
+func (g *fakeGateway) doTxn(args *txnRequest) *txnResponse {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var succeeded = true
+	for _, cmp := range args.Compare {
+		var version, revision int64
+		if kv := g.kvs[string(cmp.Key)]; kv != nil {
+			version, revision = kv.Version, kv.ModRevision
+		}
+		switch cmp.Target {
+		case "VERSION":
+			succeeded = succeeded && version == *cmp.Version
+		case "MOD":
+			succeeded = succeeded && revision == *cmp.ModRevision
+		}
+	}
+	for _, op := range args.Success {
+		if op.RequestPut != nil && op.RequestPut.Lease != 0 && !g.leases[op.RequestPut.Lease] {
+			return nil
+		}
+	}
+	if succeeded && len(args.Success) != 0 {
+		for _, op := range args.Success {
+			switch {
+			case op.RequestPut != nil:
+				g.put(string(op.RequestPut.Key), op.RequestPut.Value, op.RequestPut.Lease)
+			case op.RequestDeleteRange != nil:
+				g.delete(string(op.RequestDeleteRange.Key))
+			}
+		}
+		g.notify()
+	}
+	return &txnResponse{Header: responseHeader{Revision: g.revision}, Succeeded: succeeded}
+}
+
+func (g *fakeGateway) serveWatch(w http.ResponseWriter, r *http.Request) {
+	var args struct {
+		Create struct {
+			Key      []byte `json:"key"`
+			RangeEnd []byte `json:"range_end"`
+			Start    int64  `json:"start_revision"`
+		} `json:"create_request"`
+	}
+	json.NewDecoder(r.Body).Decode(&args)
+	var key, end = string(args.Create.Key), string(args.Create.RangeEnd)
+
+	w.Write([]byte(`{"result":{"created":true}}` + "\n"))
+	w.(http.Flusher).Flush()
+
+	var seen = make(map[string]int64)
+	g.mu.Lock()
+	for k, kv := range g.kvs {
+		seen[k] = kv.ModRevision
+	}
+	for {
+		var events []string
+		for k, kv := range g.kvs {
+			if k >= key && k < end && kv.ModRevision >= args.Create.Start && seen[k] != kv.ModRevision {
+				events = append(events, k)
+			}
+		}
+		for k := range seen {
+			if k >= key && k < end && g.kvs[k] == nil {
+				events = append(events, k)
+			}
+		}
+		if len(events) != 0 {
+			g.mu.Unlock()
+			b, _ := json.Marshal(map[string]interface{}{
+				"result": map[string]interface{}{"events": events},
+			})
+			w.Write(append(b, '\n'))
+			w.(http.Flusher).Flush()
+			return
+		}
+		changed := g.changed
+		g.mu.Unlock()
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+		g.mu.Lock()
+	}
+}
+
+func (g *fakeGateway) stats() (grants int, leases int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.grants, len(g.leases)
+}
+
+func openClient(g *fakeGateway) *Client {
+	c, err := New(g.URL, "", time.Second)
+	assert.MustNoError(err)
+	return c
+}
+
+func TestCreateUpdate(t *testing.T) {
+	g := newFakeGateway()
+	defer g.Close()
+	c := openClient(g)
+	defer c.Close()
+
+	assert.MustNoError(c.Create("/codis3/a", []byte("1")))
+	assert.Must(errors.Equal(c.Create("/codis3/a", []byte("2")), ErrNodeExists))
+
+	b, err := c.Read("/codis3/a", true)
+	assert.MustNoError(err)
+	assert.Must(string(b) == "1")
+
+	assert.MustNoError(c.Update("/codis3/a", []byte("2")))
+	assert.MustNoError(c.Update("/codis3/b", []byte("3")))
+
+	b, v1, err := c.ReadVersion("/codis3/a", true)
+	assert.MustNoError(err)
+	assert.Must(string(b) == "2" && v1 != "")
+
+	v2, err := c.UpdateVersion("/codis3/a", []byte("4"), v1)
+	assert.MustNoError(err)
+	assert.Must(v2 != v1)
+
+	_, err = c.UpdateVersion("/codis3/a", []byte("5"), v1)
+	assert.Must(errors.Equal(err, ErrModified))
+	_, err = c.UpdateVersion("/codis3/a", []byte("5"), "")
+	assert.Must(errors.Equal(err, ErrNodeExists))
+
+	paths, err := c.List("/codis3", true)
+	assert.MustNoError(err)
+	assert.Must(len(paths) == 2)
+
+	assert.MustNoError(c.Delete("/codis3/a"))
+	_, err = c.Read("/codis3/a", true)
+	assert.Must(errors.Equal(err, ErrNoNode))
+	b, err = c.Read("/codis3/a", false)
+	assert.Must(err == nil && b == nil)
+}
+
+func TestCommit(t *testing.T) {
+	g := newFakeGateway()
+	defer g.Close()
+	c := openClient(g)
+	defer c.Close()
+
+	assert.MustNoError(c.Create("/codis3/a", []byte("1")))
+	_, va, err := c.ReadVersion("/codis3/a", true)
+	assert.MustNoError(err)
+
+	latest, err := c.Commit(map[string][]byte{
+		"/codis3/a": []byte("2"), "/codis3/b": []byte("3"),
+	}, map[string]string{
+		"/codis3/a": va, "/codis3/b": "",
+	})
+	assert.MustNoError(err)
+	assert.Must(len(latest) == 2 && latest["/codis3/a"] == latest["/codis3/b"])
+
+	_, err = c.Commit(map[string][]byte{
+		"/codis3/a": []byte("4"), "/codis3/c": []byte("5"),
+	}, map[string]string{
+		"/codis3/a": va,
+	})
+	assert.Must(errors.Equal(err, ErrModified))
+
+	_, err = c.Read("/codis3/c", true)
+	assert.Must(errors.Equal(err, ErrNoNode))
+
+	latest, err = c.Commit(map[string][]byte{
+		"/codis3/a": nil,
+	}, map[string]string{
+		"/codis3/a": latest["/codis3/a"],
+	})
+	assert.MustNoError(err)
+	assert.Must(latest["/codis3/a"] == "")
+	_, err = c.Read("/codis3/a", true)
+	assert.Must(errors.Equal(err, ErrNoNode))
+}
+
+func TestEphemeralSession(t *testing.T) {
+	g := newFakeGateway()
+	defer g.Close()
+	c := openClient(g)
+
+	var signal <-chan struct{}
+	for i := 1; i <= 20; i++ {
+		w, node, err := c.CreateEphemeralInOrder("/codis3/bus", []byte("x"))
+		assert.MustNoError(err)
+		assert.Must(node == fmt.Sprintf("/codis3/bus/%010d", i))
+		assert.Must(signal == nil || signal == w)
+		signal = w
+	}
+	_, err := c.CreateEphemeral("/codis3/proxy", []byte("x"))
+	assert.MustNoError(err)
+
+	grants, leases := g.stats()
+	assert.Must(grants == 1 && leases == 1)
+
+	paths, err := c.List("/codis3/bus", true)
+	assert.MustNoError(err)
+	assert.Must(len(paths) == 20)
+
+	assert.MustNoError(c.Close())
+	_, leases = g.stats()
+	assert.Must(leases == 0)
+
+	select {
+	case <-signal:
+	case <-time.After(time.Second * 5):
+		assert.Must(false)
+	}
+
+	d := openClient(g)
+	defer d.Close()
+	paths, err = d.List("/codis3/bus", false)
+	assert.MustNoError(err)
+	assert.Must(len(paths) == 0)
+	b, err := d.Read("/codis3/proxy", false)
+	assert.Must(err == nil && b == nil)
+}
+
+func TestEphemeralLeaseLost(t *testing.T) {
+	g := newFakeGateway()
+	defer g.Close()
+	c := openClient(g)
+	defer c.Close()
+
+	w1, err := c.CreateEphemeral("/codis3/a", []byte("x"))
+	assert.MustNoError(err)
+
+	g.mu.Lock()
+	g.dropLease(c.session.id)
+	g.mu.Unlock()
+
+	select {
+	case <-w1:
+	case <-time.After(time.Second * 5):
+		assert.Must(false)
+	}
+
+	w2, err := c.CreateEphemeral("/codis3/a", []byte("x"))
+	assert.MustNoError(err)
+	assert.Must(w2 != w1)
+
+	grants, leases := g.stats()
+	assert.Must(grants == 2 && leases == 1)
+}
+
+func TestEphemeralKeepAliveRetry(t *testing.T) {
+	g := newFakeGateway()
+	defer g.Close()
+	c := openClient(g)
+	defer c.Close()
+
+	w, err := c.CreateEphemeral("/codis3/a", []byte("x"))
+	assert.MustNoError(err)
+	assert.Must(c.leaseTTL() == time.Second*3)
+
+	g.mu.Lock()
+	g.failures = 1
+	g.mu.Unlock()
+
+	select {
+	case <-w:
+		assert.Must(false)
+	case <-time.After(time.Millisecond * 1500):
+	}
+	g.mu.Lock()
+	assert.Must(g.failures == 0)
+	g.mu.Unlock()
+
+	grants, leases := g.stats()
+	assert.Must(grants == 1 && leases == 1)
+}
+
+func TestWatchInOrder(t *testing.T) {
+	g := newFakeGateway()
+	defer g.Close()
+	c := openClient(g)
+	defer c.Close()
+
+	_, node, err := c.CreateEphemeralInOrder("/codis3/bus", []byte("x"))
+	assert.MustNoError(err)
+
+	w, paths, err := c.WatchInOrder("/codis3/bus")
+	assert.MustNoError(err)
+	assert.Must(len(paths) == 1 && paths[0] == node)
+
+	select {
+	case <-w:
+		assert.Must(false)
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	_, _, err = c.CreateEphemeralInOrder("/codis3/bus", []byte("y"))
+	assert.MustNoError(err)
+
+	select {
+	case <-w:
+	case <-time.After(time.Second * 5):
+		assert.Must(false)
+	}
+}
+
+func TestUnlockedRequests(t *testing.T) {
+	g := newFakeGateway()
+	defer g.Close()
+	c := openClient(g)
+	defer c.Close()
+
+	var block = make(chan struct{})
+	g.mu.Lock()
+	g.blocked["/codis3/slow"] = block
+	g.mu.Unlock()
+
+	var done = make(chan error, 1)
+	go func() {
+		_, err := c.Read("/codis3/slow", false)
+		done <- err
+	}()
+	time.Sleep(time.Millisecond * 50)
+
+	assert.MustNoError(c.Create("/codis3/fast", []byte("x")))
+	_, err := c.CreateEphemeral("/codis3/ephemeral", []byte("x"))
+	assert.MustNoError(err)
+
+	close(block)
+	assert.MustNoError(<-done)
+}
+
+func TestApiError(t *testing.T) {
+	g := newFakeGateway()
+	defer g.Close()
+	c := openClient(g)
+	defer c.Close()
+
+	err := c.call("kv/unknown", struct{}{}, nil)
+	e, ok := errors.Cause(err).(*apiError)
+	assert.Must(ok && e.Code == 12)
+	assert.Must(bytes.Contains([]byte(err.Error()), []byte("unknown api")))
+}
@@ -4,12 +4,16 @@
 package fsclient
 
 import (
+	"crypto/sha1"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sort"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
@@ -20,6 +24,8 @@ import (
 
 var ErrClosedClient = errors.New("use of closed fs client")
 
+const DefaultTimeout = time.Second * 30
+
 type Client struct {
 	sync.Mutex
 
@@ -27,9 +33,19 @@ type Client struct {
 	DataDir  string
 	TempDir  string
 	LockFile string
+	LeaseDir string
+	SeqDir   string
+
+	// Timeout of ephemeral nodes, they are refreshed every Timeout/3.
+	Timeout time.Duration
 
 	lockfd *os.File
 	closed bool
+
+	owner string
+	exit  chan struct{}
+
+	ephemerals map[string]chan struct{}
 }
 
 func New(dir string) (*Client, error) {
@@ -42,6 +58,14 @@ func New(dir string) (*Client, error) {
 		DataDir:  filepath.Join(fullpath, "data"),
 		TempDir:  filepath.Join(fullpath, "temp"),
 		LockFile: filepath.Join(fullpath, "data.lck"),
+		LeaseDir: filepath.Join(fullpath, "lease"),
+		SeqDir:   filepath.Join(fullpath, "sequence"),
+		Timeout:  DefaultTimeout,
+
+		owner: fmt.Sprintf("%d-%x", os.Getpid(), time.Now().UnixNano()),
+		exit:  make(chan struct{}),
+
+		ephemerals: make(map[string]chan struct{}),
 	}, nil
 }
 
@@ -92,6 +116,7 @@ func (c *Client) lockFs() error {
 		log.WarnErrorf(err, "fsclient - lock write failed")
 	}
 	c.lockfd = f
+	c.recoverCommit()
 	return nil
 }
 
@@ -122,6 +147,24 @@ func (c *Client) Close() error {
 		return nil
 	}
 	c.closed = true
+	close(c.exit)
+
+	if len(c.ephemerals) == 0 {
+		return nil
+	}
+	if err := c.lockFs(); err != nil {
+		log.WarnErrorf(err, "fsclient - close remove ephemerals failed")
+		return nil
+	}
+	defer c.unlockFs()
+
+	for path, signal := range c.ephemerals {
+		if l, err := c.readLease(path); err == nil && l != nil && l.Owner == c.owner {
+			c.removeEphemeral(path)
+		}
+		close(signal)
+	}
+	c.ephemerals = nil
 	return nil
 }
 
@@ -188,6 +231,8 @@ func (c *Client) Create(path string, data []byte) error {
 	}
 	defer c.unlockFs()
 
+	c.expireEphemeral(path)
+
 	if err := c.writeFile(c.realpath(path), data, true); err != nil {
 		log.Warnf("fsclient - create %s failed", path)
 		return err
@@ -234,6 +279,7 @@ func (c *Client) Delete(path string) error {
 		log.Warnf("fsclient - delete %s failed", path)
 		return errors.Trace(err)
 	} else {
+		c.removeLease(path)
 		log.Infof("fsclient - delete %s OK", path)
 		return nil
 	}
@@ -251,6 +297,8 @@ func (c *Client) Read(path string, must bool) ([]byte, error) {
 	}
 	defer c.unlockFs()
 
+	c.expireEphemeral(path)
+
 	realpath := c.realpath(path)
 	if !must {
 		_, err := os.Stat(realpath)
@@ -270,6 +318,242 @@ func (c *Client) Read(path string, must bool) ([]byte, error) {
 	return b, nil
 }
 
+// fileVersion is derived from mtime & content of the file, since rename is
+// used for updates, the mtime changes even if the same content is written.
+func fileVersion(info os.FileInfo, data []byte) string {
+	return fmt.Sprintf("%x-%x", info.ModTime().UnixNano(), sha1.Sum(data))
+}
+
+func (c *Client) readVersion(realpath string) ([]byte, string, error) {
+	f, err := os.Open(realpath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, "", errors.Trace(err)
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, "", errors.Trace(err)
+	}
+	return b, fileVersion(info, b), nil
+}
+
+func (c *Client) ReadVersion(path string, must bool) ([]byte, string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil, "", errors.Trace(ErrClosedClient)
+	}
+
+	if err := c.lockFs(); err != nil {
+		return nil, "", err
+	}
+	defer c.unlockFs()
+
+	c.expireEphemeral(path)
+
+	b, version, err := c.readVersion(c.realpath(path))
+	if err != nil {
+		if os.IsNotExist(err) && !must {
+			return nil, "", nil
+		}
+		log.Warnf("fsclient - read-version %s failed", path)
+		return nil, "", errors.Trace(err)
+	}
+	return b, version, nil
+}
+
+var ErrBadVersion = errors.New("version doesn't match")
+
+func (c *Client) UpdateVersion(path string, data []byte, version string) (string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return "", errors.Trace(ErrClosedClient)
+	}
+
+	if err := c.lockFs(); err != nil {
+		return "", err
+	}
+	defer c.unlockFs()
+
+	c.expireEphemeral(path)
+
+	realpath := c.realpath(path)
+	if version != "" {
+		_, current, err := c.readVersion(realpath)
+		if err != nil {
+			log.Warnf("fsclient - update-version %s failed", path)
+			return "", errors.Trace(err)
+		}
+		if current != version {
+			log.Warnf("fsclient - update-version %s failed, version = %s, expect = %s", path, current, version)
+			return "", errors.Trace(ErrBadVersion)
+		}
+	}
+	if err := c.writeFile(realpath, data, version == ""); err != nil {
+		log.Warnf("fsclient - update-version %s failed", path)
+		return "", err
+	}
+	_, latest, err := c.readVersion(realpath)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	log.Infof("fsclient - update-version %s OK", path)
+	return latest, nil
+}
+
+// Commit applies updates on a hard-linked copy of the data dir, which is
+// swapped with the data dir by renames. If the process dies in the middle of
+// the swap, the next lockFs finishes it by recoverCommit.
+func (c *Client) Commit(updates map[string][]byte, versions map[string]string) (map[string]string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil, errors.Trace(ErrClosedClient)
+	}
+
+	if err := c.lockFs(); err != nil {
+		return nil, err
+	}
+	defer c.unlockFs()
+
+	latest, err := c.commit(updates, versions)
+	if err != nil {
+		log.Warnf("fsclient - commit %d nodes failed", len(updates))
+		return nil, err
+	}
+	log.Infof("fsclient - commit %d nodes OK", len(updates))
+	return latest, nil
+}
+
+func (c *Client) commitDirs() (building, staging, backup string) {
+	return filepath.Join(c.TempDir, "commit.tmp"),
+		filepath.Join(c.TempDir, "commit.new"),
+		filepath.Join(c.TempDir, "commit.old")
+}
+
+func (c *Client) commit(updates map[string][]byte, versions map[string]string) (map[string]string, error) {
+	for path := range updates {
+		c.expireEphemeral(path)
+	}
+	for path, version := range versions {
+		if _, ok := updates[path]; !ok {
+			continue
+		}
+		_, current, err := c.readVersion(c.realpath(path))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, errors.Trace(err)
+		}
+		if current != version {
+			log.Warnf("fsclient - commit %s failed, version = %s, expect = %s", path, current, version)
+			return nil, errors.Trace(ErrBadVersion)
+		}
+	}
+
+	building, staging, backup := c.commitDirs()
+	defer os.RemoveAll(building)
+
+	if err := os.RemoveAll(building); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := linkTree(c.DataDir, building); err != nil {
+		return nil, err
+	}
+	for path, data := range updates {
+		realpath := filepath.Join(building, filepath.Clean(path))
+		if data == nil {
+			if err := os.RemoveAll(realpath); err != nil {
+				return nil, errors.Trace(err)
+			}
+		} else {
+			if err := c.writeFile(realpath, data, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := os.Rename(building, staging); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if err := os.Rename(c.DataDir, backup); err != nil && !os.IsNotExist(err) {
+		os.RemoveAll(staging)
+		return nil, errors.Trace(err)
+	}
+	if err := os.Rename(staging, c.DataDir); err != nil {
+		if err := os.Rename(backup, c.DataDir); err != nil {
+			log.ErrorErrorf(err, "fsclient - commit rollback failed")
+		}
+		os.RemoveAll(staging)
+		return nil, errors.Trace(err)
+	}
+	if err := os.RemoveAll(backup); err != nil {
+		log.WarnErrorf(err, "fsclient - commit remove backup failed")
+	}
+
+	var latest = make(map[string]string)
+	for path, data := range updates {
+		if data == nil {
+			latest[path] = ""
+			continue
+		}
+		_, version, err := c.readVersion(c.realpath(path))
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		latest[path] = version
+	}
+	return latest, nil
+}
+
+func (c *Client) recoverCommit() {
+	building, staging, backup := c.commitDirs()
+	if _, err := os.Stat(c.DataDir); os.IsNotExist(err) {
+		for _, dir := range []string{staging, backup} {
+			if err := os.Rename(dir, c.DataDir); err == nil {
+				log.Warnf("fsclient - recover data dir from %s", dir)
+				break
+			}
+		}
+	}
+	for _, dir := range []string{building, staging, backup} {
+		if err := os.RemoveAll(dir); err != nil {
+			log.WarnErrorf(err, "fsclient - recover remove %s failed", dir)
+		}
+	}
+}
+
+// linkTree copies the directory tree of src to dst, files are hard links.
+func linkTree(src, dst string) error {
+	if err := mkdirAll(dst); err != nil {
+		return err
+	}
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == src && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return os.Link(path, target)
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
 func (c *Client) List(path string, must bool) ([]string, error) {
 	c.Lock()
 	defer c.Unlock()
@@ -282,6 +566,10 @@ func (c *Client) List(path string, must bool) ([]string, error) {
 	}
 	defer c.unlockFs()
 
+	return c.list(path, must)
+}
+
+func (c *Client) list(path string, must bool) ([]string, error) {
 	realpath := c.realpath(path)
 	if !must {
 		_, err := os.Stat(realpath)
@@ -309,29 +597,208 @@ func (c *Client) List(path string, must bool) ([]string, error) {
 
 	var results []string
 	for _, name := range names {
-		results = append(results, filepath.Join(path, name))
+		p := filepath.Join(path, name)
+		if c.expireEphemeral(p) {
+			continue
+		}
+		results = append(results, p)
 	}
 	return results, nil
 }
 
-var ErrNotSupported = errors.New("not supported")
+// lease of an ephemeral node, which is refreshed by the owner. Readers treat
+// the node as deleted once the lease expires. The pid is informational only,
+// owners may live in other pid namespaces or on other hosts sharing the dir.
+type lease struct {
+	Path   string `json:"path"`
+	Pid    int    `json:"pid"`
+	Owner  string `json:"owner"`
+	Expire int64  `json:"expire"`
+}
 
-func (c *Client) WatchInOrder(path string) (<-chan struct{}, []string, error) {
+func (l *lease) isStale(now time.Time) bool {
+	return now.UnixNano() > l.Expire
+}
+
+func (c *Client) leasePath(path string) string {
+	return filepath.Join(c.LeaseDir, url.QueryEscape(filepath.Clean(path)))
+}
+
+func (c *Client) readLease(path string) (*lease, error) {
+	b, err := ioutil.ReadFile(c.leasePath(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Trace(err)
+	}
+	l := &lease{}
+	if err := json.Unmarshal(b, l); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return l, nil
+}
+
+func (c *Client) writeLease(path string) error {
+	l := &lease{
+		Path: path, Pid: os.Getpid(), Owner: c.owner,
+		Expire: time.Now().Add(c.Timeout).UnixNano(),
+	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return c.writeFile(c.leasePath(path), b, false)
+}
+
+func (c *Client) removeLease(path string) {
+	if err := os.Remove(c.leasePath(path)); err != nil && !os.IsNotExist(err) {
+		log.WarnErrorf(err, "fsclient - remove lease of %s failed", path)
+	}
+}
+
+func (c *Client) removeEphemeral(path string) {
+	if err := os.RemoveAll(c.realpath(path)); err != nil {
+		log.WarnErrorf(err, "fsclient - remove ephemeral %s failed", path)
+	}
+	c.removeLease(path)
+}
+
+// expireEphemeral removes the node if it's an ephemeral node with a stale
+// lease, and returns whether it's removed.
+func (c *Client) expireEphemeral(path string) bool {
+	l, err := c.readLease(path)
+	if err != nil {
+		log.WarnErrorf(err, "fsclient - read lease of %s failed", path)
+		return false
+	}
+	if l == nil || !l.isStale(time.Now()) {
+		return false
+	}
+	log.Warnf("fsclient - ephemeral %s of pid = %d is expired", path, l.Pid)
+	c.removeEphemeral(path)
+	return true
+}
+
+func (c *Client) createEphemeral(path string, data []byte) (<-chan struct{}, error) {
+	c.expireEphemeral(path)
+
+	realpath := c.realpath(path)
+	if _, err := os.Stat(realpath); err == nil {
+		return nil, errors.Errorf("file already exists")
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Trace(err)
+	}
+	if err := c.writeLease(path); err != nil {
+		return nil, err
+	}
+	if err := c.writeFile(realpath, data, true); err != nil {
+		c.removeLease(path)
+		return nil, err
+	}
+	signal := make(chan struct{})
+	c.ephemerals[path] = signal
+	go c.runKeepAlive(path)
+	return signal, nil
+}
+
+func (c *Client) runKeepAlive(path string) {
+	for {
+		select {
+		case <-c.exit:
+			return
+		case <-time.After(c.Timeout / 3):
+		}
+		if err := c.keepAlive(path); err != nil {
+			return
+		}
+	}
+}
+
+// keepAlive refreshes the lease of the ephemeral node, failures of lockFs are
+// ignored and retried later, the node is lost once the lease is taken over.
+func (c *Client) keepAlive(path string) error {
 	c.Lock()
 	defer c.Unlock()
 	if c.closed {
-		return nil, nil, errors.Trace(ErrClosedClient)
+		return errors.Trace(ErrClosedClient)
+	}
+	signal := c.ephemerals[path]
+	if signal == nil {
+		return errors.Trace(ErrEphemeralLost)
+	}
+
+	if err := c.lockFs(); err != nil {
+		log.WarnErrorf(err, "fsclient - keepalive %s failed", path)
+		return nil
+	}
+	defer c.unlockFs()
+
+	err := func() error {
+		l, err := c.readLease(path)
+		if err != nil {
+			return err
+		}
+		if l == nil || l.Owner != c.owner {
+			return errors.Trace(ErrEphemeralLost)
+		}
+		if _, err := os.Stat(c.realpath(path)); err != nil {
+			c.removeLease(path)
+			return errors.Trace(ErrEphemeralLost)
+		}
+		return c.writeLease(path)
+	}()
+	if err != nil {
+		log.WarnErrorf(err, "fsclient - keepalive %s failed", path)
+		if errors.Equal(err, ErrEphemeralLost) {
+			delete(c.ephemerals, path)
+			close(signal)
+			return err
+		}
 	}
-	return nil, nil, errors.Trace(ErrNotSupported)
+	return nil
 }
 
+var ErrEphemeralLost = errors.New("ephemeral node is lost")
+
 func (c *Client) CreateEphemeral(path string, data []byte) (<-chan struct{}, error) {
 	c.Lock()
 	defer c.Unlock()
 	if c.closed {
 		return nil, errors.Trace(ErrClosedClient)
 	}
-	return nil, errors.Trace(ErrNotSupported)
+
+	if err := c.lockFs(); err != nil {
+		return nil, err
+	}
+	defer c.unlockFs()
+
+	signal, err := c.createEphemeral(path, data)
+	if err != nil {
+		log.Warnf("fsclient - create-ephemeral %s failed", path)
+		return nil, err
+	}
+	log.Infof("fsclient - create-ephemeral %s OK", path)
+	return signal, nil
+}
+
+// nextSequence returns the next sequence of dir, sequences are never reused
+// even if nodes are deleted.
+func (c *Client) nextSequence(dir string) (int64, error) {
+	file := filepath.Join(c.SeqDir, url.QueryEscape(filepath.Clean(dir)))
+	var seq int64
+	if b, err := ioutil.ReadFile(file); err == nil {
+		if seq, err = strconv.ParseInt(string(b), 10, 64); err != nil {
+			return 0, errors.Trace(err)
+		}
+	} else if !os.IsNotExist(err) {
+		return 0, errors.Trace(err)
+	}
+	seq++
+	if err := c.writeFile(file, []byte(strconv.FormatInt(seq, 10)), false); err != nil {
+		return 0, err
+	}
+	return seq, nil
 }
 
 func (c *Client) CreateEphemeralInOrder(path string, data []byte) (<-chan struct{}, string, error) {
@@ -340,5 +807,90 @@ func (c *Client) CreateEphemeralInOrder(path string, data []byte) (<-chan struct
 	if c.closed {
 		return nil, "", errors.Trace(ErrClosedClient)
 	}
-	return nil, "", errors.Trace(ErrNotSupported)
+
+	if err := c.lockFs(); err != nil {
+		return nil, "", err
+	}
+	defer c.unlockFs()
+
+	seq, err := c.nextSequence(path)
+	if err != nil {
+		log.Warnf("fsclient - create-ephemeral-inorder %s failed", path)
+		return nil, "", err
+	}
+	node := filepath.Join(path, fmt.Sprintf("%010d", seq))
+	signal, err := c.createEphemeral(node, data)
+	if err != nil {
+		log.Warnf("fsclient - create-ephemeral-inorder %s failed", path)
+		return nil, "", err
+	}
+	log.Infof("fsclient - create-ephemeral-inorder %s OK, node = %s", path, node)
+	return signal, node, nil
+}
+
+const watchPollInterval = time.Second
+
+// WatchInOrder re-lists path once notified by inotify (linux only), or every
+// watchPollInterval, which also catches ephemeral nodes that become stale.
+func (c *Client) WatchInOrder(path string) (<-chan struct{}, []string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil, nil, errors.Trace(ErrClosedClient)
+	}
+
+	if err := c.lockFs(); err != nil {
+		return nil, nil, err
+	}
+	defer c.unlockFs()
+
+	stop := make(chan struct{})
+	notify := notifyDir(c.realpath(path), stop)
+
+	paths, err := c.list(path, false)
+	if err != nil {
+		close(stop)
+		log.Warnf("fsclient - watch-inorder %s failed", path)
+		return nil, nil, err
+	}
+
+	signal := make(chan struct{})
+	go func() {
+		defer close(signal)
+		defer close(stop)
+		for {
+			select {
+			case <-c.exit:
+				return
+			case <-notify:
+			case <-time.After(watchPollInterval):
+			}
+			if changed, err := c.isChanged(path, paths); err != nil || changed {
+				return
+			}
+		}
+	}()
+	return signal, paths, nil
+}
+
+func (c *Client) isChanged(path string, paths []string) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return false, errors.Trace(ErrClosedClient)
+	}
+
+	if err := c.lockFs(); err != nil {
+		return false, nil
+	}
+	defer c.unlockFs()
+
+	latest, err := c.list(path, false)
+	if err != nil {
+		return false, err
+	}
+	if len(latest) == 0 && len(paths) == 0 {
+		return false, nil
+	}
+	return !reflect.DeepEqual(latest, paths), nil
 }
@@ -0,0 +1,160 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package fsclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+)
+
+func openClient(dir string, timeout time.Duration) *Client {
+	c, err := New(dir)
+	assert.MustNoError(err)
+	c.Timeout = timeout
+	return c
+}
+
+func TestLeaseStale(t *testing.T) {
+	var now = time.Now()
+	l := &lease{Pid: os.Getpid(), Expire: now.Add(time.Second).UnixNano()}
+	assert.Must(!l.isStale(now))
+	assert.Must(l.isStale(now.Add(time.Second * 2)))
+
+	l.Pid = 1 << 30
+	assert.Must(!l.isStale(now))
+}
+
+func TestEphemeral(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsclient")
+	assert.MustNoError(err)
+	defer os.RemoveAll(dir)
+
+	// the owner writes the lease but never refreshes it, as if it's gone
+	c1 := openClient(dir, time.Millisecond*300)
+	defer c1.Close()
+	c1.Lock()
+	assert.MustNoError(c1.lockFs())
+	assert.MustNoError(c1.writeLease("/codis3/proxy"))
+	assert.MustNoError(c1.writeFile(c1.realpath("/codis3/proxy"), []byte("x"), true))
+	w1 := make(chan struct{})
+	c1.ephemerals["/codis3/proxy"] = w1
+	c1.unlockFs()
+	c1.Unlock()
+
+	c2 := openClient(dir, DefaultTimeout)
+	defer c2.Close()
+	b, err := c2.Read("/codis3/proxy", true)
+	assert.MustNoError(err)
+	assert.Must(string(b) == "x")
+
+	time.Sleep(time.Millisecond * 400)
+
+	b, err = c2.Read("/codis3/proxy", false)
+	assert.Must(err == nil && b == nil)
+	_, err = c2.CreateEphemeral("/codis3/proxy", []byte("z"))
+	assert.MustNoError(err)
+
+	assert.Must(errors.Equal(c1.keepAlive("/codis3/proxy"), ErrEphemeralLost))
+	select {
+	case <-w1:
+	default:
+		assert.Must(false)
+	}
+	assert.MustNoError(c1.Close())
+
+	b, err = c2.Read("/codis3/proxy", true)
+	assert.MustNoError(err)
+	assert.Must(string(b) == "z")
+
+	assert.MustNoError(c2.Close())
+	c3 := openClient(dir, DefaultTimeout)
+	defer c3.Close()
+	b, err = c3.Read("/codis3/proxy", false)
+	assert.Must(err == nil && b == nil)
+}
+
+func TestEphemeralInOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsclient")
+	assert.MustNoError(err)
+	defer os.RemoveAll(dir)
+
+	c1 := openClient(dir, DefaultTimeout)
+	defer c1.Close()
+	c2 := openClient(dir, DefaultTimeout)
+	defer c2.Close()
+
+	var nodes []string
+	for i := 1; i <= 6; i++ {
+		var c = c1
+		if i%2 == 0 {
+			c = c2
+		}
+		_, node, err := c.CreateEphemeralInOrder("/codis3/bus", []byte("x"))
+		assert.MustNoError(err)
+		assert.Must(node == fmt.Sprintf("/codis3/bus/%010d", i))
+		nodes = append(nodes, node)
+	}
+
+	paths, err := c1.List("/codis3/bus", true)
+	assert.MustNoError(err)
+	assert.Must(len(paths) == 6)
+
+	assert.MustNoError(c1.Delete(nodes[5]))
+	_, node, err := c1.CreateEphemeralInOrder("/codis3/bus", []byte("x"))
+	assert.MustNoError(err)
+	assert.Must(node == fmt.Sprintf("/codis3/bus/%010d", 7))
+
+	assert.MustNoError(c2.Close())
+	paths, err = c1.List("/codis3/bus", true)
+	assert.MustNoError(err)
+	assert.Must(len(paths) == 4)
+}
+
+func TestWatchInOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsclient")
+	assert.MustNoError(err)
+	defer os.RemoveAll(dir)
+
+	c := openClient(dir, DefaultTimeout)
+	defer c.Close()
+
+	_, node, err := c.CreateEphemeralInOrder("/codis3/bus", []byte("x"))
+	assert.MustNoError(err)
+
+	w, paths, err := c.WatchInOrder("/codis3/bus")
+	assert.MustNoError(err)
+	assert.Must(len(paths) == 1 && paths[0] == node)
+
+	select {
+	case <-w:
+		assert.Must(false)
+	case <-time.After(watchPollInterval + time.Millisecond*200):
+	}
+
+	_, _, err = c.CreateEphemeralInOrder("/codis3/bus", []byte("y"))
+	assert.MustNoError(err)
+
+	select {
+	case <-w:
+	case <-time.After(watchPollInterval * 3):
+		assert.Must(false)
+	}
+
+	w, paths, err = c.WatchInOrder("/codis3/bus")
+	assert.MustNoError(err)
+	assert.Must(len(paths) == 2)
+
+	assert.MustNoError(c.Delete(paths[0]))
+	select {
+	case <-w:
+	case <-time.After(watchPollInterval * 3):
+		assert.Must(false)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+// +build linux
+
+package fsclient
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+)
+
+const notifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// notifyDir signals the returned channel when entries of dir change. It stops
+// once stop is closed or dir is removed, and returns nil if inotify fails, so
+// that callers fall back to polling.
+func notifyDir(dir string, stop <-chan struct{}) <-chan struct{} {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		log.WarnErrorf(err, "fsclient - inotify init failed")
+		return nil
+	}
+	if _, err := syscall.InotifyAddWatch(fd, dir, notifyMask); err != nil {
+		log.Debugf("fsclient - inotify watch %s failed: %s", dir, err)
+		syscall.Close(fd)
+		return nil
+	}
+	var set syscall.FdSet
+	if fd >= len(set.Bits)*int(unsafe.Sizeof(set.Bits[0])*8) {
+		syscall.Close(fd)
+		return nil
+	}
+
+	signal := make(chan struct{}, 1)
+	go func() {
+		defer syscall.Close(fd)
+		var buf [4096]byte
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			ready, err := waitReadable(fd, time.Second)
+			if err != nil {
+				log.WarnErrorf(err, "fsclient - inotify wait %s failed", dir)
+				return
+			}
+			if !ready {
+				continue
+			}
+			n, err := syscall.Read(fd, buf[:])
+			if err != nil {
+				if err == syscall.EAGAIN || err == syscall.EINTR {
+					continue
+				}
+				log.WarnErrorf(err, "fsclient - inotify read %s failed", dir)
+				return
+			}
+			var ignored bool
+			for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+				e := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				if e.Mask&syscall.IN_IGNORED != 0 {
+					ignored = true
+				}
+				off += syscall.SizeofInotifyEvent + int(e.Len)
+			}
+			select {
+			case signal <- struct{}{}:
+			default:
+			}
+			if ignored {
+				return
+			}
+		}
+	}()
+	return signal
+}
+
+func waitReadable(fd int, timeout time.Duration) (bool, error) {
+	var set syscall.FdSet
+	var bits = int(unsafe.Sizeof(set.Bits[0]) * 8)
+	set.Bits[fd/bits] |= 1 << uint(fd%bits)
+	tv := syscall.NsecToTimeval(timeout.Nanoseconds())
+	n, err := syscall.Select(fd+1, &set, nil, nil, &tv)
+	if err != nil {
+		if err == syscall.EINTR {
+			return false, nil
+		}
+		return false, err
+	}
+	return n != 0, nil
+}
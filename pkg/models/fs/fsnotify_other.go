@@ -0,0 +1,11 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+// +build !linux
+
+package fsclient
+
+// notifyDir is not supported without inotify, callers fall back to polling.
+func notifyDir(dir string, stop <-chan struct{}) <-chan struct{} {
+	return nil
+}
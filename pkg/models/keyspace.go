@@ -0,0 +1,38 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package models
+
+type KeyspaceReport struct {
+	Groups   []*KeyspaceGroup  `json:"groups"`
+	Prefixes []*KeyspacePrefix `json:"prefixes"`
+
+	Keys    int64            `json:"keys"`
+	Sampled int64            `json:"sampled"`
+	Types   map[string]int64 `json:"types"`
+	Expires map[string]int64 `json:"expires"`
+	Memory  bool             `json:"memory,omitempty"`
+
+	UnixTime int64 `json:"unixtime"`
+	Duration int64 `json:"duration_ms"`
+}
+
+type KeyspaceGroup struct {
+	GroupId int    `json:"group_id"`
+	Server  string `json:"server"`
+
+	Keys    int64  `json:"keys"`
+	Sampled int64  `json:"sampled"`
+	Error   string `json:"error,omitempty"`
+}
+
+type KeyspacePrefix struct {
+	Prefix string           `json:"prefix"`
+	Keys   int64            `json:"keys"`
+	Bytes  int64            `json:"bytes"`
+	Types  map[string]int64 `json:"types"`
+}
+
+func (r *KeyspaceReport) Encode() []byte {
+	return jsonEncode(r)
+}
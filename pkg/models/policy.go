@@ -0,0 +1,85 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package models
+
+import (
+	"strings"
+
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+)
+
+type CommandPolicy struct {
+	Deny   []string        `json:"deny,omitempty"`
+	Allow  []string        `json:"allow,omitempty"`
+	Limits []*CommandLimit `json:"limits,omitempty"`
+}
+
+type CommandLimit struct {
+	Command  string `json:"command"`
+	MaxArgs  int    `json:"max_args,omitempty"`
+	MaxRange int64  `json:"max_range,omitempty"`
+}
+
+func (p *CommandPolicy) Encode() []byte {
+	return jsonEncode(p)
+}
+
+var rangeCommands = map[string]bool{
+	"LRANGE": true, "ZRANGE": true, "ZREVRANGE": true, "GETRANGE": true,
+}
+
+func IsRangeCommand(opstr string) bool {
+	return rangeCommands[opstr]
+}
+
+func IsPolicyExempt(opstr string) bool {
+	switch opstr {
+	case "AUTH", "QUIT", "PING", "SELECT":
+		return true
+	}
+	return false
+}
+
+func (p *CommandPolicy) Normalize() {
+	for i := range p.Deny {
+		p.Deny[i] = strings.ToUpper(strings.TrimSpace(p.Deny[i]))
+	}
+	for i := range p.Allow {
+		p.Allow[i] = strings.ToUpper(strings.TrimSpace(p.Allow[i]))
+	}
+	for _, l := range p.Limits {
+		if l != nil {
+			l.Command = strings.ToUpper(strings.TrimSpace(l.Command))
+		}
+	}
+}
+
+func (p *CommandPolicy) Validate() error {
+	for _, opstr := range p.Deny {
+		if opstr == "" {
+			return errors.New("invalid policy, empty command in deny list")
+		}
+		if IsPolicyExempt(opstr) {
+			return errors.Errorf("invalid policy, command '%s' can't be denied", opstr)
+		}
+	}
+	for _, opstr := range p.Allow {
+		if opstr == "" {
+			return errors.New("invalid policy, empty command in allow list")
+		}
+	}
+	for _, l := range p.Limits {
+		switch {
+		case l == nil || l.Command == "":
+			return errors.New("invalid policy, empty command in limits")
+		case l.MaxArgs < 0:
+			return errors.Errorf("invalid policy, max_args of '%s' is negative", l.Command)
+		case l.MaxRange < 0:
+			return errors.Errorf("invalid policy, max_range of '%s' is negative", l.Command)
+		case l.MaxRange != 0 && !IsRangeCommand(l.Command):
+			return errors.Errorf("invalid policy, max_range is not supported by '%s'", l.Command)
+		}
+	}
+	return nil
+}
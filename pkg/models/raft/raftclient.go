@@ -0,0 +1,430 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package raftclient
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/coordinator"
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+)
+
+var ErrClosedClient = errors.New("use of closed raft client")
+
+var (
+	ErrNoNode      = errors.New("raft: node doesn't exist")
+	ErrSessionLost = errors.New("raft: session is lost")
+)
+
+// Client talks to members of codis-coordinator, requests are retried on the
+// next member until timeout, since followers forward them to the leader.
+// Ephemeral nodes of a client share one session, which is kept alive by the
+// client and lost after missing keepalives for timeout.
+type Client struct {
+	sync.Mutex
+
+	members []*coordinator.ApiClient
+	current int
+
+	session struct {
+		id   int64
+		lost chan struct{}
+	}
+
+	closed  bool
+	timeout time.Duration
+}
+
+func New(addrlist string, auth string, timeout time.Duration) (*Client, error) {
+	var members []*coordinator.ApiClient
+	for _, s := range strings.Split(addrlist, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		c := coordinator.NewApiClient(s)
+		c.SetXAuth(auth)
+		members = append(members, c)
+	}
+	if len(members) == 0 {
+		return nil, errors.Errorf("invalid address list")
+	}
+	if timeout <= 0 {
+		timeout = time.Second * 5
+	}
+	return &Client{members: members, timeout: timeout}, nil
+}
+
+func (c *Client) Close() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil
+	}
+	if c.session.id != 0 {
+		if err := c.closeSession(); err != nil {
+			log.Debugf("raft close session-[%d] failed: %s", c.session.id, err)
+		}
+	}
+	c.closed = true
+	return nil
+}
+
+// do calls fn on members in turn until it succeeds or timeout. Errors of fn
+// are caused by members or the raft group, e.g. the leader is changing.
+func (c *Client) do(fn func(m *coordinator.ApiClient) error) error {
+	var deadline = time.Now().Add(c.timeout)
+	for {
+		m := c.members[c.current]
+		err := fn(m)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		c.current = (c.current + 1) % len(c.members)
+		if c.current == 0 {
+			time.Sleep(time.Millisecond * 100)
+		}
+	}
+}
+
+// propose applies the op, note that an op may be applied more than once if
+// the reply is lost, e.g. a retried create could fail as the node exists.
+func (c *Client) propose(op *coordinator.Op) (*coordinator.Result, error) {
+	var r *coordinator.Result
+	err := c.do(func(m *coordinator.ApiClient) error {
+		x, err := m.Propose(op)
+		if err != nil {
+			return err
+		}
+		r = x
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if r.Error != "" {
+		return nil, errors.New(r.Error)
+	}
+	return r, nil
+}
+
+func (c *Client) read(path string) (*coordinator.ReadReply, error) {
+	var r *coordinator.ReadReply
+	err := c.do(func(m *coordinator.ApiClient) error {
+		x, err := m.Read(path)
+		if err != nil {
+			return err
+		}
+		r = x
+		return nil
+	})
+	return r, err
+}
+
+func (c *Client) list(path string) (*coordinator.ListReply, error) {
+	var r *coordinator.ListReply
+	err := c.do(func(m *coordinator.ApiClient) error {
+		x, err := m.List(path)
+		if err != nil {
+			return err
+		}
+		r = x
+		return nil
+	})
+	return r, err
+}
+
+func (c *Client) Mkdir(path string) error {
+	return nil
+}
+
+func (c *Client) Create(path string, data []byte) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return errors.Trace(ErrClosedClient)
+	}
+	log.Debugf("raft create node %s", path)
+	if _, err := c.propose(&coordinator.Op{Type: coordinator.OpCreate, Path: path, Data: data}); err != nil {
+		log.Debugf("raft create node %s failed: %s", path, err)
+		return err
+	}
+	log.Debugf("raft create OK")
+	return nil
+}
+
+func (c *Client) Update(path string, data []byte) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return errors.Trace(ErrClosedClient)
+	}
+	log.Debugf("raft update node %s", path)
+	if _, err := c.propose(&coordinator.Op{Type: coordinator.OpUpdate, Path: path, Data: data}); err != nil {
+		log.Debugf("raft update node %s failed: %s", path, err)
+		return err
+	}
+	log.Debugf("raft update OK")
+	return nil
+}
+
+func (c *Client) UpdateVersion(path string, data []byte, version string) (string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return "", errors.Trace(ErrClosedClient)
+	}
+	log.Debugf("raft update-version node %s, version = %q", path, version)
+	r, err := c.propose(&coordinator.Op{
+		Type: coordinator.OpUpdateVersion, Path: path, Data: data, Version: version,
+	})
+	if err != nil {
+		log.Debugf("raft update-version node %s failed: %s", path, err)
+		return "", err
+	}
+	log.Debugf("raft update-version OK, version = %s", r.Version)
+	return r.Version, nil
+}
+
+func (c *Client) Commit(updates map[string][]byte, versions map[string]string) (map[string]string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil, errors.Trace(ErrClosedClient)
+	}
+	log.Debugf("raft commit %d nodes", len(updates))
+	r, err := c.propose(&coordinator.Op{
+		Type: coordinator.OpCommit, Updates: updates, Versions: versions,
+	})
+	if err != nil {
+		log.Debugf("raft commit %d nodes failed: %s", len(updates), err)
+		return nil, err
+	}
+	log.Debugf("raft commit OK")
+	return r.Versions, nil
+}
+
+func (c *Client) Delete(path string) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return errors.Trace(ErrClosedClient)
+	}
+	log.Debugf("raft delete node %s", path)
+	if _, err := c.propose(&coordinator.Op{Type: coordinator.OpDelete, Path: path}); err != nil {
+		log.Debugf("raft delete node %s failed: %s", path, err)
+		return err
+	}
+	log.Debugf("raft delete OK")
+	return nil
+}
+
+func (c *Client) Read(path string, must bool) ([]byte, error) {
+	data, _, err := c.ReadVersion(path, must)
+	return data, err
+}
+
+func (c *Client) ReadVersion(path string, must bool) ([]byte, string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil, "", errors.Trace(ErrClosedClient)
+	}
+	r, err := c.read(path)
+	switch {
+	case err != nil:
+		log.Debugf("raft read node %s failed: %s", path, err)
+		return nil, "", err
+	case r.Exists:
+		if r.Data == nil {
+			return []byte{}, r.Version, nil
+		}
+		return r.Data, r.Version, nil
+	case must:
+		log.Debugf("raft read node %s failed: not found", path)
+		return nil, "", errors.Trace(ErrNoNode)
+	default:
+		return nil, "", nil
+	}
+}
+
+func (c *Client) List(path string, must bool) ([]string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil, errors.Trace(ErrClosedClient)
+	}
+	r, err := c.list(path)
+	switch {
+	case err != nil:
+		log.Debugf("raft list node %s failed: %s", path, err)
+		return nil, err
+	case !r.Exists && must:
+		log.Debugf("raft list node %s failed: not found", path)
+		return nil, errors.Trace(ErrNoNode)
+	default:
+		return r.Paths, nil
+	}
+}
+
+func (c *Client) openSession() error {
+	if c.session.id != 0 {
+		return nil
+	}
+	r, err := c.propose(&coordinator.Op{
+		Type: coordinator.OpOpenSession, TTL: int64(c.timeout / time.Millisecond),
+	})
+	if err != nil {
+		return err
+	}
+	c.session.id = r.Session
+	c.session.lost = make(chan struct{})
+	go c.runKeepAlive(c.session.id, c.session.lost)
+	return nil
+}
+
+func (c *Client) closeSession() error {
+	id := c.session.id
+	close(c.session.lost)
+	c.session.id, c.session.lost = 0, nil
+	_, err := c.propose(&coordinator.Op{Type: coordinator.OpCloseSession, Session: id})
+	return err
+}
+
+func (c *Client) KeepAlive(id int64) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return errors.Trace(ErrClosedClient)
+	}
+	if c.session.id != id {
+		return errors.Trace(ErrSessionLost)
+	}
+	log.Debugf("raft keepalive session-[%d]", id)
+	var r *coordinator.Result
+	err := c.do(func(m *coordinator.ApiClient) error {
+		x, err := m.KeepAlive(id)
+		if err != nil {
+			return err
+		}
+		r = x
+		return nil
+	})
+	if err == nil && r.Error != "" {
+		err = errors.New(r.Error)
+	}
+	if err != nil {
+		log.Debugf("raft keepalive session-[%d] failed: %s", id, err)
+		close(c.session.lost)
+		c.session.id, c.session.lost = 0, nil
+		return err
+	}
+	return nil
+}
+
+func (c *Client) runKeepAlive(id int64, lost chan struct{}) {
+	for {
+		select {
+		case <-lost:
+			return
+		case <-time.After(c.timeout / 3):
+		}
+		if err := c.KeepAlive(id); err != nil {
+			return
+		}
+	}
+}
+
+func (c *Client) createEphemeral(op *coordinator.Op) (<-chan struct{}, string, error) {
+	if err := c.openSession(); err != nil {
+		return nil, "", err
+	}
+	op.Session = c.session.id
+	r, err := c.propose(op)
+	if err != nil {
+		return nil, "", err
+	}
+	return c.session.lost, r.Path, nil
+}
+
+func (c *Client) CreateEphemeral(path string, data []byte) (<-chan struct{}, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil, errors.Trace(ErrClosedClient)
+	}
+	log.Debugf("raft create-ephemeral node %s", path)
+	signal, _, err := c.createEphemeral(&coordinator.Op{
+		Type: coordinator.OpCreate, Path: path, Data: data,
+	})
+	if err != nil {
+		log.Debugf("raft create-ephemeral node %s failed: %s", path, err)
+		return nil, err
+	}
+	log.Debugf("raft create-ephemeral OK")
+	return signal, nil
+}
+
+func (c *Client) CreateEphemeralInOrder(path string, data []byte) (<-chan struct{}, string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil, "", errors.Trace(ErrClosedClient)
+	}
+	log.Debugf("raft create-ephemeral-inorder node %s", path)
+	signal, node, err := c.createEphemeral(&coordinator.Op{
+		Type: coordinator.OpCreate, Path: path, Data: data, Sequential: true,
+	})
+	if err != nil {
+		log.Debugf("raft create-ephemeral-inorder node %s failed: %s", path, err)
+		return nil, "", err
+	}
+	log.Debugf("raft create-ephemeral-inorder OK, node = %s", node)
+	return signal, node, nil
+}
+
+// WatchInOrder long-polls the member that served the list, the signal is
+// closed once children of path change or the member fails.
+func (c *Client) WatchInOrder(path string) (<-chan struct{}, []string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil, nil, errors.Trace(ErrClosedClient)
+	}
+	log.Debugf("raft watch-inorder node %s", path)
+	r, err := c.list(path)
+	if err != nil {
+		log.Debugf("raft watch-inorder node %s failed: %s", path, err)
+		return nil, nil, err
+	}
+	m := c.members[c.current]
+	signal := make(chan struct{})
+	go func() {
+		defer close(signal)
+		for {
+			revision, err := m.Watch(path, r.Revision)
+			if err != nil {
+				log.Debugf("raft watch-inorder node %s failed: %s", path, err)
+				return
+			}
+			if revision > r.Revision {
+				log.Debugf("raft watch-inorder node %s update", path)
+				return
+			}
+			c.Lock()
+			closed := c.closed
+			c.Unlock()
+			if closed {
+				return
+			}
+		}
+	}()
+	log.Debugf("raft watch-inorder OK")
+	return signal, r.Paths, nil
+}
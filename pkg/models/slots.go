@@ -24,6 +24,13 @@ type Slot struct {
 	ForwardMethod int `json:"forward_method,omitempty"`
 
 	ReplicaGroups [][]string `json:"replica_groups,omitempty"`
+
+	Epoch int64 `json:"epoch,omitempty"`
+
+	// PrevEpoch is the epoch of the previous fill sent to all proxies, a
+	// proxy that hasn't applied it has missed some slots. It equals Epoch
+	// when all slots are filled at once.
+	PrevEpoch int64 `json:"prev_epoch,omitempty"`
 }
 
 func ParseForwardMethod(s string) (int, bool) {
@@ -7,6 +7,10 @@ import (
 	"fmt"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/CodisLabs/codis/pkg/utils/errors"
 	"github.com/CodisLabs/codis/pkg/utils/log"
@@ -34,6 +38,10 @@ func LockPath(product string) string {
 	return filepath.Join(CodisDir, product, "topom")
 }
 
+func ElectionDir(product string) string {
+	return filepath.Join(CodisDir, product, "election")
+}
+
 func SlotPath(product string, sid int) string {
 	return filepath.Join(CodisDir, product, "slots", fmt.Sprintf("slot-%04d", sid))
 }
@@ -58,6 +66,30 @@ func SentinelPath(product string) string {
 	return filepath.Join(CodisDir, product, "sentinel")
 }
 
+func CommandPolicyPath(product string) string {
+	return filepath.Join(CodisDir, product, "policy")
+}
+
+func KeyspacePath(product string) string {
+	return filepath.Join(CodisDir, product, "keyspace")
+}
+
+func CacheInvalidationDir(product string) string {
+	return filepath.Join(CodisDir, product, "cache-invalidation")
+}
+
+func EpochPath(product string) string {
+	return filepath.Join(CodisDir, product, "epoch")
+}
+
+func HistoryDir(product string) string {
+	return filepath.Join(CodisDir, product, "history")
+}
+
+func HistoryPath(product string, epoch int64) string {
+	return filepath.Join(CodisDir, product, "history", fmt.Sprintf("epoch-%010d", epoch))
+}
+
 func LoadTopom(client Client, product string, must bool) (*Topom, error) {
 	b, err := client.Read(LockPath(product), must)
 	if err != nil || b == nil {
@@ -73,10 +105,16 @@ func LoadTopom(client Client, product string, must bool) (*Topom, error) {
 type Store struct {
 	client  Client
 	product string
+
+	mu       sync.Mutex
+	versions map[string]string
 }
 
 func NewStore(client Client, product string) *Store {
-	return &Store{client, product}
+	return &Store{
+		client: client, product: product,
+		versions: make(map[string]string),
+	}
 }
 
 func (s *Store) Close() error {
@@ -91,6 +129,10 @@ func (s *Store) LockPath() string {
 	return LockPath(s.product)
 }
 
+func (s *Store) ElectionDir() string {
+	return ElectionDir(s.product)
+}
+
 func (s *Store) SlotPath(sid int) string {
 	return SlotPath(s.product, sid)
 }
@@ -115,6 +157,77 @@ func (s *Store) SentinelPath() string {
 	return SentinelPath(s.product)
 }
 
+func (s *Store) CommandPolicyPath() string {
+	return CommandPolicyPath(s.product)
+}
+
+func (s *Store) KeyspacePath() string {
+	return KeyspacePath(s.product)
+}
+
+func (s *Store) EpochPath() string {
+	return EpochPath(s.product)
+}
+
+func (s *Store) HistoryDir() string {
+	return HistoryDir(s.product)
+}
+
+func (s *Store) HistoryPath(epoch int64) string {
+	return HistoryPath(s.product, epoch)
+}
+
+// read remembers the version of the node (or its absence), so that the
+// following update of the node would fail if it has been changed since.
+func (s *Store) read(path string, must bool) ([]byte, error) {
+	b, version, err := s.client.ReadVersion(path, must)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.versions[path] = version
+	return b, nil
+}
+
+// update fails if the node has been changed since it was read, a node that
+// has never been read is created only if it doesn't exist.
+func (s *Store) update(path string, data []byte) error {
+	s.mu.Lock()
+	version := s.versions[path]
+	s.mu.Unlock()
+	latest, err := s.client.UpdateVersion(path, data, version)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.versions[path] = latest
+	return nil
+}
+
+// delete fails if the node has been changed since it was read, a node that
+// has never been read is deleted unconditionally.
+func (s *Store) delete(path string) error {
+	s.mu.Lock()
+	version, ok := s.versions[path]
+	s.mu.Unlock()
+	if !ok {
+		if err := s.client.Delete(path); err != nil {
+			return err
+		}
+	} else {
+		_, err := s.client.Commit(map[string][]byte{path: nil}, map[string]string{path: version})
+		if err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.versions[path] = ""
+	return nil
+}
+
 func (s *Store) Acquire(topom *Topom) error {
 	return s.client.Create(s.LockPath(), topom.Encode())
 }
@@ -123,6 +236,72 @@ func (s *Store) Release() error {
 	return s.client.Delete(s.LockPath())
 }
 
+var (
+	ErrCampaignCanceled = errors.New("campaign is canceled")
+	ErrCampaignLost     = errors.New("campaign node is lost")
+)
+
+// Campaign registers topom as a candidate and blocks until it is elected
+// as leader. The returned node should be passed to Resign on exit, and the
+// channel is closed once the leadership is lost (e.g. session expired).
+func (s *Store) Campaign(topom *Topom, cancel <-chan struct{}) (string, <-chan struct{}, error) {
+	lost, node, err := s.client.CreateEphemeralInOrder(s.ElectionDir(), topom.Encode())
+	if err != nil {
+		return "", nil, err
+	}
+	for {
+		w, paths, err := s.client.WatchInOrder(s.ElectionDir())
+		if err != nil {
+			s.Resign(node)
+			return "", nil, err
+		}
+		switch {
+		case len(paths) != 0 && paths[0] == node:
+			return node, lost, nil
+		case !containsPath(paths, node):
+			return "", nil, errors.Trace(ErrCampaignLost)
+		}
+		select {
+		case <-w:
+		case <-lost:
+			return "", nil, errors.Trace(ErrCampaignLost)
+		case <-cancel:
+			s.Resign(node)
+			return "", nil, errors.Trace(ErrCampaignCanceled)
+		}
+	}
+}
+
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) Resign(node string) error {
+	return s.client.Delete(node)
+}
+
+func (s *Store) LoadLeader() (*Topom, error) {
+	paths, err := s.client.List(s.ElectionDir(), false)
+	if err != nil || len(paths) == 0 {
+		return nil, err
+	}
+	sort.Strings(paths)
+	b, err := s.client.Read(paths[0], false)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	t := &Topom{}
+	if err := jsonDecode(t, b); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
 func (s *Store) LoadTopom(must bool) (*Topom, error) {
 	return LoadTopom(s.client, s.product, must)
 }
@@ -144,7 +323,7 @@ func (s *Store) SlotMappings() ([]*SlotMapping, error) {
 }
 
 func (s *Store) LoadSlotMapping(sid int, must bool) (*SlotMapping, error) {
-	b, err := s.client.Read(s.SlotPath(sid), must)
+	b, err := s.read(s.SlotPath(sid), must)
 	if err != nil || b == nil {
 		return nil, err
 	}
@@ -156,7 +335,7 @@ func (s *Store) LoadSlotMapping(sid int, must bool) (*SlotMapping, error) {
 }
 
 func (s *Store) UpdateSlotMapping(m *SlotMapping) error {
-	return s.client.Update(s.SlotPath(m.Id), m.Encode())
+	return s.update(s.SlotPath(m.Id), m.Encode())
 }
 
 func (s *Store) ListGroup() (map[int]*Group, error) {
@@ -166,7 +345,7 @@ func (s *Store) ListGroup() (map[int]*Group, error) {
 	}
 	group := make(map[int]*Group)
 	for _, path := range paths {
-		b, err := s.client.Read(path, true)
+		b, err := s.read(path, true)
 		if err != nil {
 			return nil, err
 		}
@@ -180,7 +359,7 @@ func (s *Store) ListGroup() (map[int]*Group, error) {
 }
 
 func (s *Store) LoadGroup(gid int, must bool) (*Group, error) {
-	b, err := s.client.Read(s.GroupPath(gid), must)
+	b, err := s.read(s.GroupPath(gid), must)
 	if err != nil || b == nil {
 		return nil, err
 	}
@@ -192,11 +371,11 @@ func (s *Store) LoadGroup(gid int, must bool) (*Group, error) {
 }
 
 func (s *Store) UpdateGroup(g *Group) error {
-	return s.client.Update(s.GroupPath(g.Id), g.Encode())
+	return s.update(s.GroupPath(g.Id), g.Encode())
 }
 
 func (s *Store) DeleteGroup(gid int) error {
-	return s.client.Delete(s.GroupPath(gid))
+	return s.delete(s.GroupPath(gid))
 }
 
 func (s *Store) ListProxy() (map[string]*Proxy, error) {
@@ -206,7 +385,7 @@ func (s *Store) ListProxy() (map[string]*Proxy, error) {
 	}
 	proxy := make(map[string]*Proxy)
 	for _, path := range paths {
-		b, err := s.client.Read(path, true)
+		b, err := s.read(path, true)
 		if err != nil {
 			return nil, err
 		}
@@ -220,7 +399,7 @@ func (s *Store) ListProxy() (map[string]*Proxy, error) {
 }
 
 func (s *Store) LoadProxy(token string, must bool) (*Proxy, error) {
-	b, err := s.client.Read(s.ProxyPath(token), must)
+	b, err := s.read(s.ProxyPath(token), must)
 	if err != nil || b == nil {
 		return nil, err
 	}
@@ -232,15 +411,15 @@ func (s *Store) LoadProxy(token string, must bool) (*Proxy, error) {
 }
 
 func (s *Store) UpdateProxy(p *Proxy) error {
-	return s.client.Update(s.ProxyPath(p.Token), p.Encode())
+	return s.update(s.ProxyPath(p.Token), p.Encode())
 }
 
 func (s *Store) DeleteProxy(token string) error {
-	return s.client.Delete(s.ProxyPath(token))
+	return s.delete(s.ProxyPath(token))
 }
 
 func (s *Store) LoadSentinel(must bool) (*Sentinel, error) {
-	b, err := s.client.Read(s.SentinelPath(), must)
+	b, err := s.read(s.SentinelPath(), must)
 	if err != nil || b == nil {
 		return nil, err
 	}
@@ -252,7 +431,156 @@ func (s *Store) LoadSentinel(must bool) (*Sentinel, error) {
 }
 
 func (s *Store) UpdateSentinel(p *Sentinel) error {
-	return s.client.Update(s.SentinelPath(), p.Encode())
+	return s.update(s.SentinelPath(), p.Encode())
+}
+
+func (s *Store) LoadCommandPolicy(must bool) (*CommandPolicy, error) {
+	b, err := s.read(s.CommandPolicyPath(), must)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	p := &CommandPolicy{}
+	if err := jsonDecode(p, b); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *Store) UpdateCommandPolicy(p *CommandPolicy) error {
+	return s.update(s.CommandPolicyPath(), p.Encode())
+}
+
+func (s *Store) LoadKeyspaceReport(must bool) (*KeyspaceReport, error) {
+	b, err := s.read(s.KeyspacePath(), must)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	r := &KeyspaceReport{}
+	if err := jsonDecode(r, b); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// UpdateKeyspaceReport overwrites the report unconditionally, it's replaced
+// as a whole by every scan.
+func (s *Store) UpdateKeyspaceReport(r *KeyspaceReport) error {
+	return s.client.Update(s.KeyspacePath(), r.Encode())
+}
+
+func (s *Store) LoadEpoch() (int64, error) {
+	b, err := s.read(s.EpochPath(), false)
+	if err != nil || b == nil {
+		return 0, err
+	}
+	var epoch int64
+	if err := jsonDecode(&epoch, b); err != nil {
+		return 0, err
+	}
+	return epoch, nil
+}
+
+func (s *Store) UpdateEpoch(epoch int64) error {
+	return s.update(s.EpochPath(), jsonEncode(epoch))
+}
+
+// ListHistory returns epochs of topology versions in ascending order.
+func (s *Store) ListHistory() ([]int64, error) {
+	paths, err := s.client.List(s.HistoryDir(), false)
+	if err != nil {
+		return nil, err
+	}
+	var epochs []int64
+	for _, path := range paths {
+		name := strings.TrimPrefix(filepath.Base(path), "epoch-")
+		if epoch, err := strconv.ParseInt(name, 10, 64); err == nil {
+			epochs = append(epochs, epoch)
+		}
+	}
+	sort.Slice(epochs, func(i, j int) bool {
+		return epochs[i] < epochs[j]
+	})
+	return epochs, nil
+}
+
+func (s *Store) LoadTopology(epoch int64, must bool) (*Topology, error) {
+	b, err := s.client.Read(s.HistoryPath(epoch), must)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	t := &Topology{}
+	if err := jsonDecode(t, b); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// CreateTopology fails if the epoch exists, versions are never overwritten.
+func (s *Store) CreateTopology(t *Topology) error {
+	return s.client.Create(s.HistoryPath(t.Epoch), t.Encode())
+}
+
+func (s *Store) DeleteTopology(epoch int64) error {
+	return s.client.Delete(s.HistoryPath(epoch))
+}
+
+// Batch collects updates of slots, groups & proxies, which are committed
+// to the coordinator all or nothing by Store.Commit.
+type Batch struct {
+	store   *Store
+	updates map[string][]byte
+}
+
+func (s *Store) NewBatch() *Batch {
+	return &Batch{store: s, updates: make(map[string][]byte)}
+}
+
+func (b *Batch) Len() int {
+	return len(b.updates)
+}
+
+func (b *Batch) UpdateSlotMapping(m *SlotMapping) {
+	b.updates[b.store.SlotPath(m.Id)] = m.Encode()
+}
+
+func (b *Batch) UpdateGroup(g *Group) {
+	b.updates[b.store.GroupPath(g.Id)] = g.Encode()
+}
+
+func (b *Batch) DeleteGroup(gid int) {
+	b.updates[b.store.GroupPath(gid)] = nil
+}
+
+func (b *Batch) UpdateProxy(p *Proxy) {
+	b.updates[b.store.ProxyPath(p.Token)] = p.Encode()
+}
+
+func (b *Batch) DeleteProxy(token string) {
+	b.updates[b.store.ProxyPath(token)] = nil
+}
+
+func (s *Store) Commit(b *Batch) error {
+	if len(b.updates) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	var versions = make(map[string]string)
+	for path, data := range b.updates {
+		if version, ok := s.versions[path]; ok || data != nil {
+			versions[path] = version
+		}
+	}
+	s.mu.Unlock()
+	latest, err := s.client.Commit(b.updates, versions)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for path, version := range latest {
+		s.versions[path] = version
+	}
+	return nil
 }
 
 func ValidateProduct(name string) error {
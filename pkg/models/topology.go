@@ -0,0 +1,213 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package models
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Topology is a version of slots, groups, proxies & sentinels of a product,
+// which is kept in coordinator as history. Epoch of versions is monotonic,
+// runtime states (e.g. actions & promoting) are not included.
+type Topology struct {
+	Epoch    int64 `json:"epoch"`
+	UnixTime int64 `json:"unixtime"`
+
+	Slots    []int            `json:"slots"`
+	Group    []*TopologyGroup `json:"group"`
+	Proxy    []*TopologyProxy `json:"proxy"`
+	Sentinel []string         `json:"sentinel"`
+}
+
+type TopologyGroup struct {
+	Id      int               `json:"id"`
+	Servers []*TopologyServer `json:"servers"`
+}
+
+type TopologyServer struct {
+	Addr         string `json:"server"`
+	DataCenter   string `json:"datacenter"`
+	ReplicaGroup bool   `json:"replica_group"`
+}
+
+type TopologyProxy struct {
+	Token      string `json:"token"`
+	AdminAddr  string `json:"admin_addr"`
+	ProxyAddr  string `json:"proxy_addr"`
+	DataCenter string `json:"datacenter"`
+}
+
+func NewTopology(slots []*SlotMapping, group map[int]*Group, proxy map[string]*Proxy, sentinel *Sentinel) *Topology {
+	t := &Topology{
+		Slots:    make([]int, len(slots)),
+		Group:    make([]*TopologyGroup, 0, len(group)),
+		Proxy:    make([]*TopologyProxy, 0, len(proxy)),
+		Sentinel: make([]string, 0),
+	}
+	for i, m := range slots {
+		t.Slots[i] = m.GroupId
+	}
+	for _, g := range SortGroup(group) {
+		x := &TopologyGroup{Id: g.Id, Servers: make([]*TopologyServer, 0, len(g.Servers))}
+		for _, s := range g.Servers {
+			x.Servers = append(x.Servers, &TopologyServer{
+				Addr: s.Addr, DataCenter: s.DataCenter, ReplicaGroup: s.ReplicaGroup,
+			})
+		}
+		t.Group = append(t.Group, x)
+	}
+	for _, p := range SortProxy(proxy) {
+		t.Proxy = append(t.Proxy, &TopologyProxy{
+			Token: p.Token, AdminAddr: p.AdminAddr, ProxyAddr: p.ProxyAddr, DataCenter: p.DataCenter,
+		})
+	}
+	if sentinel != nil {
+		t.Sentinel = append(t.Sentinel, sentinel.Servers...)
+	}
+	return t
+}
+
+func (t *Topology) Encode() []byte {
+	return jsonEncode(t)
+}
+
+// Equal reports whether t & o are the same topology, epoch & time are ignored.
+func (t *Topology) Equal(o *Topology) bool {
+	var x, y = *t, *o
+	x.Epoch, x.UnixTime = 0, 0
+	y.Epoch, y.UnixTime = 0, 0
+	return bytes.Equal(x.Encode(), y.Encode())
+}
+
+func (t *Topology) getGroup(gid int) *TopologyGroup {
+	for _, g := range t.Group {
+		if g.Id == gid {
+			return g
+		}
+	}
+	return nil
+}
+
+type TopologyDiff struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+
+	Slots []*TopologySlotDiff  `json:"slots,omitempty"`
+	Group []*TopologyGroupDiff `json:"group,omitempty"`
+	Proxy struct {
+		Add []*TopologyProxy `json:"add,omitempty"`
+		Del []*TopologyProxy `json:"del,omitempty"`
+	} `json:"proxy"`
+	Sentinel struct {
+		Add []string `json:"add,omitempty"`
+		Del []string `json:"del,omitempty"`
+	} `json:"sentinel"`
+}
+
+type TopologySlotDiff struct {
+	Id   int `json:"id"`
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+const (
+	TopologyCreate = "create"
+	TopologyRemove = "remove"
+	TopologyUpdate = "update"
+)
+
+// TopologyGroupDiff lists servers of the group in both versions, order of
+// servers matters since the first one is the master.
+type TopologyGroupDiff struct {
+	Id     int               `json:"id"`
+	Action string            `json:"action"`
+	From   []*TopologyServer `json:"from,omitempty"`
+	To     []*TopologyServer `json:"to,omitempty"`
+}
+
+func (d *TopologyDiff) IsEmpty() bool {
+	if len(d.Slots) != 0 || len(d.Group) != 0 {
+		return false
+	}
+	if len(d.Proxy.Add) != 0 || len(d.Proxy.Del) != 0 {
+		return false
+	}
+	return len(d.Sentinel.Add) == 0 && len(d.Sentinel.Del) == 0
+}
+
+func DiffTopology(from, to *Topology) *TopologyDiff {
+	d := &TopologyDiff{From: from.Epoch, To: to.Epoch}
+
+	for i := 0; i < len(from.Slots) || i < len(to.Slots); i++ {
+		var x, y int
+		if i < len(from.Slots) {
+			x = from.Slots[i]
+		}
+		if i < len(to.Slots) {
+			y = to.Slots[i]
+		}
+		if x != y {
+			d.Slots = append(d.Slots, &TopologySlotDiff{Id: i, From: x, To: y})
+		}
+	}
+
+	var gids = make(map[int]bool)
+	for _, g := range from.Group {
+		gids[g.Id] = true
+	}
+	for _, g := range to.Group {
+		gids[g.Id] = true
+	}
+	var groupIds = make([]int, 0, len(gids))
+	for gid := range gids {
+		groupIds = append(groupIds, gid)
+	}
+	sort.Ints(groupIds)
+
+	for _, gid := range groupIds {
+		x, y := from.getGroup(gid), to.getGroup(gid)
+		switch {
+		case x == nil:
+			d.Group = append(d.Group, &TopologyGroupDiff{Id: gid, Action: TopologyCreate, To: y.Servers})
+		case y == nil:
+			d.Group = append(d.Group, &TopologyGroupDiff{Id: gid, Action: TopologyRemove, From: x.Servers})
+		case !bytes.Equal(jsonEncode(x), jsonEncode(y)):
+			d.Group = append(d.Group, &TopologyGroupDiff{Id: gid, Action: TopologyUpdate, From: x.Servers, To: y.Servers})
+		}
+	}
+
+	var proxy = make(map[string]bool)
+	for _, p := range from.Proxy {
+		proxy[p.Token] = true
+	}
+	for _, p := range to.Proxy {
+		if !proxy[p.Token] {
+			d.Proxy.Add = append(d.Proxy.Add, p)
+		}
+		delete(proxy, p.Token)
+	}
+	for _, p := range from.Proxy {
+		if proxy[p.Token] {
+			d.Proxy.Del = append(d.Proxy.Del, p)
+		}
+	}
+
+	var sentinel = make(map[string]bool)
+	for _, s := range from.Sentinel {
+		sentinel[s] = true
+	}
+	for _, s := range to.Sentinel {
+		if !sentinel[s] {
+			d.Sentinel.Add = append(d.Sentinel.Add, s)
+		}
+		delete(sentinel, s)
+	}
+	for _, s := range from.Sentinel {
+		if sentinel[s] {
+			d.Sentinel.Del = append(d.Sentinel.Del, s)
+		}
+	}
+	return d
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -127,7 +128,7 @@ func (c *Client) Do(fn func(conn *zk.Conn) error) error {
 
 func (c *Client) shell(fn func(conn *zk.Conn) error) error {
 	if err := fn(c.conn); err != nil {
-		for _, e := range []error{zk.ErrNoNode, zk.ErrNodeExists, zk.ErrNotEmpty} {
+		for _, e := range []error{zk.ErrNoNode, zk.ErrNodeExists, zk.ErrNotEmpty, zk.ErrBadVersion} {
 			if errors.Equal(e, err) {
 				return err
 			}
@@ -236,19 +237,21 @@ func (c *Client) create(conn *zk.Conn, path string, data []byte, flag int32) (st
 	if err := c.mkdir(conn, filepath.Dir(path)); err != nil {
 		return "", err
 	}
-	p, err := conn.Create(path, data, flag, func() []zk.ACL {
-		const perm = zk.PermAdmin | zk.PermRead | zk.PermWrite
-		if c.username != "" {
-			return zk.DigestACL(perm, c.username, c.password)
-		}
-		return zk.WorldACL(perm)
-	}())
+	p, err := conn.Create(path, data, flag, c.nodeACL())
 	if err != nil {
 		return "", errors.Trace(err)
 	}
 	return p, nil
 }
 
+func (c *Client) nodeACL() []zk.ACL {
+	const perm = zk.PermAdmin | zk.PermRead | zk.PermWrite
+	if c.username != "" {
+		return zk.DigestACL(perm, c.username, c.password)
+	}
+	return zk.WorldACL(perm)
+}
+
 func (c *Client) watch(conn *zk.Conn, path string) (<-chan struct{}, error) {
 	_, _, w, err := conn.GetW(path)
 	if err != nil {
@@ -297,6 +300,122 @@ func (c *Client) update(conn *zk.Conn, path string, data []byte) error {
 	return nil
 }
 
+func (c *Client) UpdateVersion(path string, data []byte, version string) (string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return "", errors.Trace(ErrClosedClient)
+	}
+	log.Debugf("zkclient update-version node %s, version = %q", path, version)
+	var latest string
+	err := c.shell(func(conn *zk.Conn) error {
+		if version == "" {
+			if _, err := c.create(conn, path, data, 0); err != nil {
+				return err
+			}
+			latest = "0"
+			return nil
+		}
+		v, err := strconv.ParseInt(version, 10, 32)
+		if err != nil {
+			return errors.Errorf("invalid version = %q", version)
+		}
+		stat, err := conn.Set(path, data, int32(v))
+		if err != nil {
+			return errors.Trace(err)
+		}
+		latest = strconv.Itoa(int(stat.Version))
+		return nil
+	})
+	if err != nil {
+		log.Debugf("zkclient update-version node %s failed: %s", path, err)
+		return "", err
+	}
+	log.Debugf("zkclient update-version OK, version = %s", latest)
+	return latest, nil
+}
+
+func (c *Client) Commit(updates map[string][]byte, versions map[string]string) (map[string]string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil, errors.Trace(ErrClosedClient)
+	}
+	log.Debugf("zkclient commit %d nodes", len(updates))
+	var latest map[string]string
+	err := c.shell(func(conn *zk.Conn) error {
+		var paths []string
+		for path := range updates {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		var ops []interface{}
+		var opPaths []string
+		for _, path := range paths {
+			var data = updates[path]
+			var version int32 = -1
+			if s, ok := versions[path]; !ok {
+				exists, stat, err := conn.Exists(path)
+				if err != nil {
+					return errors.Trace(err)
+				}
+				if exists {
+					version = stat.Version
+				}
+			} else if s != "" {
+				v, err := strconv.ParseInt(s, 10, 32)
+				if err != nil {
+					return errors.Errorf("invalid version = %q", s)
+				}
+				version = int32(v)
+			}
+			switch {
+			case data == nil && version < 0:
+				continue
+			case data == nil:
+				ops = append(ops, &zk.DeleteRequest{Path: path, Version: version})
+			case version < 0:
+				if err := c.mkdir(conn, filepath.Dir(path)); err != nil {
+					return err
+				}
+				ops = append(ops, &zk.CreateRequest{Path: path, Data: data, Acl: c.nodeACL()})
+			default:
+				ops = append(ops, &zk.SetDataRequest{Path: path, Data: data, Version: version})
+			}
+			opPaths = append(opPaths, path)
+		}
+		latest = make(map[string]string)
+		if len(ops) == 0 {
+			return nil
+		}
+		responses, err := conn.Multi(ops...)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for i, r := range responses {
+			if r.Error != nil {
+				return errors.Trace(r.Error)
+			}
+			switch ops[i].(type) {
+			case *zk.DeleteRequest:
+				latest[opPaths[i]] = ""
+			case *zk.CreateRequest:
+				latest[opPaths[i]] = "0"
+			case *zk.SetDataRequest:
+				latest[opPaths[i]] = strconv.Itoa(int(r.Stat.Version))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Debugf("zkclient commit %d nodes failed: %s", len(updates), err)
+		return nil, err
+	}
+	log.Debugf("zkclient commit OK")
+	return latest, nil
+}
+
 func (c *Client) Delete(path string) error {
 	c.Lock()
 	defer c.Unlock()
@@ -344,6 +463,32 @@ func (c *Client) Read(path string, must bool) ([]byte, error) {
 	return data, nil
 }
 
+func (c *Client) ReadVersion(path string, must bool) ([]byte, string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil, "", errors.Trace(ErrClosedClient)
+	}
+	var data []byte
+	var version string
+	err := c.shell(func(conn *zk.Conn) error {
+		b, stat, err := conn.Get(path)
+		if err != nil {
+			if errors.Equal(err, zk.ErrNoNode) && !must {
+				return nil
+			}
+			return errors.Trace(err)
+		}
+		data, version = b, strconv.Itoa(int(stat.Version))
+		return nil
+	})
+	if err != nil {
+		log.Debugf("zkclient read-version node %s failed: %s", path, err)
+		return nil, "", err
+	}
+	return data, version, nil
+}
+
 func (c *Client) List(path string, must bool) ([]string, error) {
 	c.Lock()
 	defer c.Unlock()
@@ -35,6 +35,8 @@ type BackendConn struct {
 	}
 	state atomic2.Int64
 
+	health *backendHealth
+
 	closed atomic2.Bool
 	config *Config
 
@@ -42,8 +44,13 @@ type BackendConn struct {
 }
 
 func NewBackendConn(addr string, database int, config *Config) *BackendConn {
+	return newBackendConn(addr, database, config, newBackendHealth(config))
+}
+
+func newBackendConn(addr string, database int, config *Config, health *backendHealth) *BackendConn {
 	bc := &BackendConn{
 		addr: addr, config: config, database: database,
+		health: health,
 	}
 	bc.input = make(chan *Request, 1024)
 	bc.retry.delay = &DelayExp2{
@@ -71,10 +78,22 @@ func (bc *BackendConn) IsConnected() bool {
 	return bc.state.Int64() == stateConnected
 }
 
+func (bc *BackendConn) IsAvailable() bool {
+	return bc.IsConnected() && !bc.health.breaker.IsOpen()
+}
+
 func (bc *BackendConn) PushBack(r *Request) {
 	if r.Batch != nil {
 		r.Batch.Add(1)
 	}
+	if !bc.health.breaker.allow() {
+		bc.setResponse(r, nil, ErrBackendBreakerOpen)
+		return
+	}
+	bc.health.inflight.Incr()
+	if r.trace != nil {
+		r.traceNano = time.Now().UnixNano()
+	}
 	bc.input <- r
 }
 
@@ -163,6 +182,7 @@ func (bc *BackendConn) newBackendReader(round int, config *Config) (*redis.Conn,
 	}
 	c.ReaderTimeout = config.BackendRecvTimeout.Duration()
 	c.WriterTimeout = config.BackendSendTimeout.Duration()
+	c.MaxRespSize = config.BackendMaxReplySize.Int64()
 	c.SetKeepAlivePeriod(config.BackendKeepAlivePeriod.Duration())
 
 	if err := bc.verifyAuth(c, config.ProductAuth); err != nil {
@@ -239,7 +259,28 @@ func (bc *BackendConn) selectDatabase(c *redis.Conn, database int) error {
 }
 
 func (bc *BackendConn) setResponse(r *Request, resp *redis.Resp, err error) error {
+	if err != ErrBackendBreakerOpen {
+		bc.health.inflight.Decr()
+		switch err {
+		case nil:
+			bc.health.breaker.record(true)
+			bc.health.updateLatency(r)
+		case ErrRequestIsBroken:
+		default:
+			bc.health.breaker.record(false)
+		}
+	}
 	r.Resp, r.Err = resp, err
+	if r.invalidate != nil {
+		r.invalidate()
+	}
+	if r.trace != nil && r.traceNano != 0 {
+		r.trace.add(SpanBackend, r.traceNano, time.Now().UnixNano(), bc.addr)
+	}
+	if r.hedge != nil {
+		r.hedge.complete(r)
+		return err
+	}
 	if r.Group != nil {
 		r.Group.Done()
 	}
@@ -336,6 +377,7 @@ func (bc *BackendConn) loopWriter(round int) (err error) {
 	}()
 	c, tasks, err := bc.newBackendReader(round, bc.config)
 	if err != nil {
+		bc.health.breaker.record(false)
 		return err
 	}
 	defer close(tasks)
@@ -351,7 +393,7 @@ func (bc *BackendConn) loopWriter(round int) (err error) {
 	p.MaxBuffered = cap(tasks) / 2
 
 	for r := range bc.input {
-		if r.IsReadOnly() && r.IsBroken() {
+		if r.IsExpired() || (r.IsReadOnly() && r.IsBroken()) {
 			bc.setResponse(r, nil, ErrRequestIsBroken)
 			continue
 		}
@@ -361,6 +403,11 @@ func (bc *BackendConn) loopWriter(round int) (err error) {
 		if err := p.Flush(len(bc.input) == 0); err != nil {
 			return bc.setResponse(r, nil, fmt.Errorf("backend conn failure, %s", err))
 		} else {
+			r.sendNano = time.Now().UnixNano()
+			if r.trace != nil {
+				r.trace.add(SpanQueue, r.traceNano, r.sendNano, "")
+				r.traceNano = r.sendNano
+			}
 			tasks <- r
 		}
 	}
@@ -375,6 +422,8 @@ type sharedBackendConn struct {
 	owner *sharedBackendConnPool
 	conns [][]*BackendConn
 
+	health *backendHealth
+
 	single []*BackendConn
 
 	refcnt int
@@ -390,11 +439,12 @@ func newSharedBackendConn(addr string, pool *sharedBackendConnPool) *sharedBacke
 		host: []byte(host), port: []byte(port),
 	}
 	s.owner = pool
+	s.health = newBackendHealth(pool.config)
 	s.conns = make([][]*BackendConn, pool.config.BackendNumberDatabases)
 	for database := range s.conns {
 		parallel := make([]*BackendConn, pool.parallel)
 		for i := range parallel {
-			parallel[i] = NewBackendConn(addr, database, pool.config)
+			parallel[i] = newBackendConn(addr, database, pool.config, s.health)
 		}
 		s.conns[database] = parallel
 	}
@@ -458,6 +508,10 @@ func (s *sharedBackendConn) KeepAlive() {
 	}
 }
 
+func (s *sharedBackendConn) IsLagging() bool {
+	return s.health.isLagging(s.owner.config.BackendReplicaMaxLag.Duration())
+}
+
 func (s *sharedBackendConn) BackendConn(database int32, seed uint, must bool) *BackendConn {
 	if s == nil {
 		return nil
@@ -465,7 +519,7 @@ func (s *sharedBackendConn) BackendConn(database int32, seed uint, must bool) *B
 
 	if s.single != nil {
 		bc := s.single[database]
-		if must || bc.IsConnected() {
+		if must || bc.IsAvailable() {
 			return bc
 		}
 		return nil
@@ -476,7 +530,7 @@ func (s *sharedBackendConn) BackendConn(database int32, seed uint, must bool) *B
 	var i = seed
 	for range parallel {
 		i = (i + 1) % uint(len(parallel))
-		if bc := parallel[i]; bc.IsConnected() {
+		if bc := parallel[i]; bc.IsAvailable() {
 			return bc
 		}
 	}
@@ -489,13 +543,16 @@ func (s *sharedBackendConn) BackendConn(database int32, seed uint, must bool) *B
 type sharedBackendConnPool struct {
 	config   *Config
 	parallel int
+	replica  bool
+
+	primary *sharedBackendConnPool
 
 	pool map[string]*sharedBackendConn
 }
 
-func newSharedBackendConnPool(config *Config, parallel int) *sharedBackendConnPool {
+func newSharedBackendConnPool(config *Config, parallel int, replica bool) *sharedBackendConnPool {
 	p := &sharedBackendConnPool{
-		config: config, parallel: math2.MaxInt(1, parallel),
+		config: config, parallel: math2.MaxInt(1, parallel), replica: replica,
 	}
 	p.pool = make(map[string]*sharedBackendConn)
 	return p
@@ -503,10 +560,21 @@ func newSharedBackendConnPool(config *Config, parallel int) *sharedBackendConnPo
 
 func (p *sharedBackendConnPool) KeepAlive() {
 	for _, bc := range p.pool {
+		if p.replica && p.config.BackendReplicaMaxLag != 0 {
+			bc.refreshLag()
+		}
 		bc.KeepAlive()
 	}
 }
 
+func (p *sharedBackendConnPool) BackendStats() []*BackendStats {
+	var list []*BackendStats
+	for _, bc := range p.pool {
+		list = append(list, bc.BackendStats())
+	}
+	return list
+}
+
 func (p *sharedBackendConnPool) Get(addr string) *sharedBackendConn {
 	return p.pool[addr]
 }
@@ -0,0 +1,176 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/sync2/atomic2"
+)
+
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+var breakerStateNames = []string{
+	breakerClosed:   "closed",
+	breakerOpen:     "open",
+	breakerHalfOpen: "half-open",
+}
+
+var ErrBackendBreakerOpen = errors.New("backend circuit breaker is open")
+
+type circuitBreaker struct {
+	mu sync.Mutex
+
+	state  atomic2.Int64
+	expire int64
+
+	probing bool
+
+	window struct {
+		start int64
+		total int64
+		fails int64
+	}
+	failures int
+
+	trips    atomic2.Int64
+	rejected atomic2.Int64
+
+	maxFailures int
+	failureRate int
+	minRequests int64
+	period      int64
+	cooldown    int64
+}
+
+func newCircuitBreaker(config *Config) *circuitBreaker {
+	if config.BackendBreakerMaxFailures == 0 && config.BackendBreakerFailureRate == 0 {
+		return nil
+	}
+	return &circuitBreaker{
+		maxFailures: config.BackendBreakerMaxFailures,
+		failureRate: config.BackendBreakerFailureRate,
+		minRequests: int64(config.BackendBreakerMinRequests),
+		period:      int64(config.BackendBreakerWindow.Duration()),
+		cooldown:    int64(config.BackendBreakerCooldown.Duration()),
+	}
+}
+
+func (b *circuitBreaker) State() int {
+	if b == nil {
+		return breakerClosed
+	}
+	switch state := b.state.Int64(); state {
+	case breakerOpen:
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if time.Now().UnixNano() >= b.expire {
+			return breakerHalfOpen
+		}
+		return breakerOpen
+	default:
+		return int(state)
+	}
+}
+
+func (b *circuitBreaker) IsOpen() bool {
+	return b.State() == breakerOpen
+}
+
+func (b *circuitBreaker) allow() bool {
+	if b == nil || b.state.Int64() == breakerClosed {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var now = time.Now().UnixNano()
+
+	switch b.state.Int64() {
+	case breakerClosed:
+		return true
+	case breakerOpen:
+		if now < b.expire {
+			break
+		}
+		b.state.Set(breakerHalfOpen)
+		b.probing = false
+		fallthrough
+	case breakerHalfOpen:
+		if !b.probing || now >= b.expire {
+			b.probing = true
+			b.expire = now + b.cooldown
+			return true
+		}
+	}
+	b.rejected.Incr()
+	return false
+}
+
+func (b *circuitBreaker) record(success bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var now = time.Now().UnixNano()
+
+	switch b.state.Int64() {
+	case breakerOpen:
+		return
+	case breakerHalfOpen:
+		b.probing = false
+		if success {
+			b.reset(now)
+			b.state.Set(breakerClosed)
+		} else {
+			b.trip(now)
+		}
+		return
+	}
+
+	if now-b.window.start >= b.period {
+		b.window.start = now
+		b.window.total = 0
+		b.window.fails = 0
+	}
+	b.window.total++
+
+	if success {
+		b.failures = 0
+		return
+	}
+	b.window.fails++
+	b.failures++
+
+	switch {
+	case b.maxFailures != 0 && b.failures >= b.maxFailures:
+		b.trip(now)
+	case b.failureRate != 0 && b.window.total >= b.minRequests:
+		if b.window.fails*100 >= b.window.total*int64(b.failureRate) {
+			b.trip(now)
+		}
+	}
+}
+
+func (b *circuitBreaker) trip(now int64) {
+	b.reset(now)
+	b.expire = now + b.cooldown
+	b.state.Set(breakerOpen)
+	b.trips.Incr()
+}
+
+func (b *circuitBreaker) reset(now int64) {
+	b.window.start = now
+	b.window.total = 0
+	b.window.fails = 0
+	b.failures = 0
+}
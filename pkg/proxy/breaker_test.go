@@ -0,0 +1,106 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/proxy/redis"
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+)
+
+func newBreakerConfig() *Config {
+	config := NewDefaultConfig()
+	config.BackendBreakerMaxFailures = 5
+	config.BackendBreakerFailureRate = 50
+	config.BackendBreakerMinRequests = 10
+	config.BackendBreakerWindow.Set(time.Minute)
+	config.BackendBreakerCooldown.Set(time.Millisecond * 100)
+	return config
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	config := NewDefaultConfig()
+	config.BackendBreakerMaxFailures = 0
+	config.BackendBreakerFailureRate = 0
+	b := newCircuitBreaker(config)
+	assert.Must(b == nil)
+	for i := 0; i < 100; i++ {
+		b.record(false)
+	}
+	assert.Must(b.allow())
+	assert.Must(b.State() == breakerClosed)
+}
+
+func TestBreakerFailures(t *testing.T) {
+	b := newCircuitBreaker(newBreakerConfig())
+	for i := 0; i < 4; i++ {
+		b.record(false)
+	}
+	b.record(true)
+	for i := 0; i < 4; i++ {
+		b.record(false)
+	}
+	assert.Must(b.State() == breakerClosed)
+	b.record(false)
+	assert.Must(b.State() == breakerOpen)
+	assert.Must(!b.allow())
+	assert.Must(b.trips.Int64() == 1)
+	assert.Must(b.rejected.Int64() == 1)
+
+	time.Sleep(time.Millisecond * 150)
+	assert.Must(b.State() == breakerHalfOpen)
+	assert.Must(b.allow())
+	assert.Must(!b.allow())
+
+	b.record(false)
+	assert.Must(b.State() == breakerOpen)
+	assert.Must(b.trips.Int64() == 2)
+
+	time.Sleep(time.Millisecond * 150)
+	assert.Must(b.allow())
+	b.record(true)
+	assert.Must(b.State() == breakerClosed)
+	assert.Must(b.allow() && b.allow())
+}
+
+func TestBreakerFailureRate(t *testing.T) {
+	b := newCircuitBreaker(newBreakerConfig())
+	for i := 0; i < 4; i++ {
+		b.record(true)
+		b.record(false)
+	}
+	assert.Must(b.State() == breakerClosed)
+	b.record(true)
+	b.record(false)
+	assert.Must(b.State() == breakerOpen)
+}
+
+func TestBackendFastFail(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.MustNoError(err)
+	addr := l.Addr().String()
+	l.Close()
+
+	config := newBreakerConfig()
+	config.BackendBreakerCooldown.Set(time.Hour)
+
+	bc := NewBackendConn(addr, 0, config)
+	defer bc.Close()
+
+	for i := 0; i < 50 && !bc.health.breaker.IsOpen(); i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Must(bc.health.breaker.IsOpen())
+	assert.Must(!bc.IsAvailable())
+
+	r := &Request{Batch: &sync.WaitGroup{}}
+	r.Multi = []*redis.Resp{redis.NewBulkBytes([]byte("PING"))}
+	bc.PushBack(r)
+	r.Batch.Wait()
+	assert.Must(r.Err == ErrBackendBreakerOpen)
+}
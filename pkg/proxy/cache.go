@@ -0,0 +1,357 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"container/list"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/proxy/redis"
+	"github.com/CodisLabs/codis/pkg/utils/sync2/atomic2"
+)
+
+var cacheableCommands = map[string]bool{
+	"GET": true, "GETRANGE": true, "GETBIT": true, "STRLEN": true, "BITCOUNT": true,
+	"HGET": true, "HMGET": true, "HGETALL": true, "HEXISTS": true, "HLEN": true,
+	"HKEYS": true, "HVALS": true, "HSTRLEN": true,
+	"LINDEX": true, "LLEN": true, "LRANGE": true,
+	"SCARD": true, "SISMEMBER": true, "SMEMBERS": true,
+	"ZCARD": true, "ZSCORE": true, "ZRANK": true, "ZREVRANK": true, "ZRANGE": true, "ZREVRANGE": true,
+}
+
+func isCacheableCommand(opstr string) bool {
+	return cacheableCommands[opstr]
+}
+
+var multiKeyWriteCommands = map[string]bool{
+	"RENAME": true, "RENAMENX": true, "RPOPLPUSH": true, "SMOVE": true,
+	"SDIFFSTORE": true, "SINTERSTORE": true, "SUNIONSTORE": true,
+	"ZINTERSTORE": true, "ZUNIONSTORE": true, "PFMERGE": true,
+}
+
+// scriptKeys returns KEYS of EVAL & EVALSHA, i.e. the numkeys arguments that
+// follow the script, the rest are ARGV.
+func scriptKeys(multi []*redis.Resp) [][]byte {
+	if len(multi) < 3 {
+		return nil
+	}
+	n, err := strconv.Atoi(string(multi[2].Value))
+	if err != nil || n <= 0 || n > len(multi)-3 {
+		return nil
+	}
+	var keys = make([][]byte, 0, n)
+	for _, m := range multi[3 : 3+n] {
+		keys = append(keys, m.Value)
+	}
+	return keys
+}
+
+type cacheKey struct {
+	db  int32
+	key string
+}
+
+type cacheReply struct {
+	resp   *redis.Resp
+	expire int64
+}
+
+type cacheEntry struct {
+	key   cacheKey
+	epoch uint64
+	elem  *list.Element
+
+	replies map[string]*cacheReply
+}
+
+type localCache struct {
+	mu sync.Mutex
+
+	lru   *list.List
+	table map[cacheKey]*cacheEntry
+	size  int
+
+	epoch   uint64
+	evicted uint64
+
+	maxEntries int
+	ttl        int64
+	prefixes   [][]byte
+	commands   map[string]bool
+
+	pending struct {
+		keys     []cacheKey
+		overflow bool
+		enabled  bool
+	}
+
+	stats struct {
+		hits        atomic2.Int64
+		misses      atomic2.Int64
+		evicts      atomic2.Int64
+		invalidates atomic2.Int64
+	}
+}
+
+const maxPendingInvalidations = 1024 * 64
+
+func newLocalCache(config *Config) *localCache {
+	if config.CacheMaxEntries <= 0 {
+		return nil
+	}
+	c := &localCache{
+		lru:   list.New(),
+		table: make(map[cacheKey]*cacheEntry),
+	}
+	c.maxEntries = config.CacheMaxEntries
+	c.ttl = int64(config.CacheTTL.Duration())
+	for _, prefix := range config.CacheKeyPrefixes {
+		c.prefixes = append(c.prefixes, []byte(prefix))
+	}
+	c.commands = make(map[string]bool)
+	for _, opstr := range config.CacheCommands {
+		c.commands[opstr] = true
+	}
+	c.pending.enabled = config.CacheBroadcast
+	return c
+}
+
+func (c *localCache) match(key []byte) bool {
+	if len(c.prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range c.prefixes {
+		if bytes.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *localCache) handle(r *Request, hkey []byte) bool {
+	if !r.IsReadOnly() {
+		c.invalidateRequest(r, hkey)
+		return false
+	}
+	if !c.commands[r.OpStr] || len(r.Multi) < 2 || !c.match(hkey) {
+		return false
+	}
+	if r.ReadPref == ReadPrefPrimary {
+		return false
+	}
+	return c.lookup(r, hkey)
+}
+
+func (c *localCache) signature(r *Request) string {
+	var b bytes.Buffer
+	b.WriteString(r.OpStr)
+	for _, m := range r.Multi[2:] {
+		b.WriteByte(' ')
+		b.WriteString(strconv.Itoa(len(m.Value)))
+		b.WriteByte(':')
+		b.Write(m.Value)
+	}
+	return b.String()
+}
+
+func (c *localCache) lookup(r *Request, key []byte) bool {
+	var k = cacheKey{r.Database, string(key)}
+	var sig = c.signature(r)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var epoch = c.epoch
+	if e := c.table[k]; e != nil {
+		if x := e.replies[sig]; x != nil {
+			if x.expire > time.Now().UnixNano() {
+				c.lru.MoveToFront(e.elem)
+				c.stats.hits.Incr()
+				r.Resp = x.resp
+				return true
+			}
+			delete(e.replies, sig)
+			c.size--
+		}
+		epoch = e.epoch
+	}
+	c.stats.misses.Incr()
+
+	r.Coalesce = func() error {
+		if r.Err == nil && r.Resp != nil && !r.Resp.IsError() {
+			c.store(k, sig, epoch, r.Resp)
+		}
+		return nil
+	}
+	return false
+}
+
+func (c *localCache) store(k cacheKey, sig string, epoch uint64, resp *redis.Resp) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var e = c.table[k]
+	switch {
+	case e == nil && c.evicted > epoch:
+		return
+	case e == nil:
+		e = &cacheEntry{key: k, epoch: epoch}
+		e.elem = c.lru.PushFront(e)
+		c.table[k] = e
+	case e.epoch > epoch:
+		return
+	default:
+		c.lru.MoveToFront(e.elem)
+	}
+	if e.replies == nil {
+		e.replies = make(map[string]*cacheReply)
+	}
+	if e.replies[sig] == nil {
+		c.size++
+	}
+	e.replies[sig] = &cacheReply{
+		resp: resp, expire: time.Now().UnixNano() + c.ttl,
+	}
+	for c.size > c.maxEntries && c.lru.Len() > 1 {
+		c.evict(c.lru.Back().Value.(*cacheEntry))
+	}
+}
+
+func (c *localCache) evict(e *cacheEntry) {
+	if e.epoch > c.evicted {
+		c.evicted = e.epoch
+	}
+	c.lru.Remove(e.elem)
+	delete(c.table, e.key)
+	c.size -= len(e.replies)
+	c.stats.evicts.Incr()
+}
+
+// invalidateRequest invalidates keys of a write when it's forwarded & again
+// when it's done, so fills of reads served in between are dropped by epoch.
+// Other proxies are notified once the write is done.
+func (c *localCache) invalidateRequest(r *Request, hkey []byte) {
+	var keys = [][]byte{hkey}
+	switch {
+	case r.OpStr == "EVAL" || r.OpStr == "EVALSHA":
+		keys = scriptKeys(r.Multi)
+	case multiKeyWriteCommands[r.OpStr]:
+		keys = keys[:0]
+		for _, m := range r.Multi[1:] {
+			keys = append(keys, m.Value)
+		}
+	}
+	var db = r.Database
+	for _, key := range keys {
+		c.invalidateKey(db, key, false)
+	}
+	r.invalidate = func() {
+		for _, key := range keys {
+			c.invalidateKey(db, key, true)
+		}
+	}
+}
+
+func (c *localCache) Invalidate(db int32, key []byte) {
+	c.invalidateKey(db, key, true)
+}
+
+func (c *localCache) invalidateKey(db int32, key []byte, broadcast bool) {
+	if key == nil || !c.match(key) {
+		return
+	}
+	var k = cacheKey{db, string(key)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.invalidate(k)
+
+	if broadcast && c.pending.enabled && !c.pending.overflow {
+		if len(c.pending.keys) < maxPendingInvalidations {
+			c.pending.keys = append(c.pending.keys, k)
+		} else {
+			c.pending.keys, c.pending.overflow = nil, true
+		}
+	}
+}
+
+func (c *localCache) invalidate(k cacheKey) {
+	c.epoch++
+	c.stats.invalidates.Incr()
+
+	if e := c.table[k]; e != nil {
+		c.size -= len(e.replies)
+		e.replies = nil
+		e.epoch = c.epoch
+		c.lru.MoveToFront(e.elem)
+	} else {
+		e = &cacheEntry{key: k, epoch: c.epoch}
+		e.elem = c.lru.PushFront(e)
+		c.table[k] = e
+	}
+	for c.lru.Len() > c.maxEntries {
+		c.evict(c.lru.Back().Value.(*cacheEntry))
+	}
+}
+
+func (c *localCache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.epoch++
+	c.evicted = c.epoch
+	c.lru.Init()
+	c.table = make(map[cacheKey]*cacheEntry)
+	c.size = 0
+	c.stats.invalidates.Incr()
+}
+
+func (c *localCache) Apply(x *CacheInvalidation) {
+	if x.All {
+		c.InvalidateAll()
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range x.Keys {
+		c.invalidate(cacheKey{k.Database, string(k.Key)})
+	}
+}
+
+func (c *localCache) drainPending() *CacheInvalidation {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var x = &CacheInvalidation{All: c.pending.overflow}
+	if !x.All {
+		for _, k := range c.pending.keys {
+			x.Keys = append(x.Keys, &CacheKey{k.db, []byte(k.key)})
+		}
+	}
+	c.pending.keys, c.pending.overflow = nil, false
+	return x
+}
+
+func (c *localCache) Entries() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return int64(c.size)
+}
+
+type CacheKey struct {
+	Database int32  `json:"db"`
+	Key      []byte `json:"key"`
+}
+
+type CacheInvalidation struct {
+	Token string      `json:"token"`
+	All   bool        `json:"all,omitempty"`
+	Keys  []*CacheKey `json:"keys,omitempty"`
+}
+
+func (x *CacheInvalidation) IsEmpty() bool {
+	return !x.All && len(x.Keys) == 0
+}
@@ -0,0 +1,168 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/models"
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/CodisLabs/codis/pkg/utils/math2"
+)
+
+var ErrClosedCacheBus = errors.New("use of closed cache bus")
+
+type cacheBus struct {
+	mu sync.Mutex
+
+	dir   string
+	token string
+
+	cache  *localCache
+	client models.Client
+	closed bool
+	exit   chan struct{}
+
+	published []cacheBusNode
+}
+
+type cacheBusNode struct {
+	path string
+	unix int64
+}
+
+func newCacheBus(c models.Client, product, token string, cache *localCache) *cacheBus {
+	return &cacheBus{
+		dir: models.CacheInvalidationDir(product), token: token,
+		cache: cache, client: c,
+		exit: make(chan struct{}),
+	}
+}
+
+func (b *cacheBus) IsClosed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+func (b *cacheBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	close(b.exit)
+
+	for _, n := range b.published {
+		if err := b.client.Delete(n.path); err != nil {
+			log.WarnErrorf(err, "cache bus remove node %s failed", n.path)
+		}
+	}
+	b.published = nil
+	return b.client.Close()
+}
+
+func (b *cacheBus) Start(period time.Duration) {
+	go b.loopPublish(math2.MaxDuration(period, time.Millisecond*10))
+	go b.loopSubscribe()
+}
+
+func (b *cacheBus) publish(retention time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrClosedCacheBus
+	}
+
+	var expire = time.Now().Add(-retention).UnixNano()
+	for len(b.published) != 0 && b.published[0].unix < expire {
+		if err := b.client.Delete(b.published[0].path); err != nil {
+			log.WarnErrorf(err, "cache bus remove node %s failed", b.published[0].path)
+		}
+		b.published = b.published[1:]
+	}
+
+	x := b.cache.drainPending()
+	if x.IsEmpty() {
+		return nil
+	}
+	x.Token = b.token
+
+	data, err := json.Marshal(x)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	_, node, err := b.client.CreateEphemeralInOrder(b.dir, data)
+	if err != nil {
+		return err
+	}
+	b.published = append(b.published, cacheBusNode{node, time.Now().UnixNano()})
+	return nil
+}
+
+func (b *cacheBus) loopPublish(period time.Duration) {
+	var retention = math2.MaxDuration(period*10, time.Second*5)
+	for !b.IsClosed() {
+		if err := b.publish(retention); err != nil {
+			log.WarnErrorf(err, "cache bus publish invalidations failed")
+			b.cache.InvalidateAll()
+		}
+		time.Sleep(period)
+	}
+}
+
+func (b *cacheBus) loopSubscribe() {
+	var delay = &DelayExp2{
+		Min: 1, Max: 30,
+		Unit: time.Second,
+	}
+	var seen = make(map[string]bool)
+	for !b.IsClosed() {
+		w, paths, err := b.client.WatchInOrder(b.dir)
+		if err != nil {
+			log.WarnErrorf(err, "cache bus watch %s failed", b.dir)
+			b.cache.InvalidateAll()
+			delay.SleepWithCancel(b.IsClosed)
+			continue
+		}
+		delay.Reset()
+
+		var latest = make(map[string]bool, len(paths))
+		for _, path := range paths {
+			latest[path] = true
+			if seen[path] {
+				continue
+			}
+			if err := b.apply(path); err != nil {
+				log.WarnErrorf(err, "cache bus apply %s failed", path)
+				b.cache.InvalidateAll()
+			}
+		}
+		seen = latest
+
+		select {
+		case <-w:
+		case <-b.exit:
+		}
+	}
+}
+
+func (b *cacheBus) apply(path string) error {
+	data, err := b.client.Read(path, false)
+	if err != nil || data == nil {
+		return err
+	}
+	var x = &CacheInvalidation{}
+	if err := json.Unmarshal(data, x); err != nil {
+		return errors.Trace(err)
+	}
+	if x.Token != b.token {
+		b.cache.Apply(x)
+	}
+	return nil
+}
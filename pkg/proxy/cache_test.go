@@ -0,0 +1,175 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/proxy/redis"
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+	"github.com/CodisLabs/codis/pkg/utils/timesize"
+)
+
+func newCacheRequest(args ...string) *Request {
+	r := &Request{}
+	for _, arg := range args {
+		r.Multi = append(r.Multi, redis.NewBulkBytes([]byte(arg)))
+	}
+	opstr, flag, err := getOpInfo(r.Multi)
+	assert.MustNoError(err)
+	r.OpStr, r.OpFlag = opstr, flag
+	return r
+}
+
+func newTestLocalCache(maxEntries int, prefixes ...string) *localCache {
+	config := NewDefaultConfig()
+	config.CacheMaxEntries = maxEntries
+	config.CacheKeyPrefixes = prefixes
+	assert.MustNoError(config.Validate())
+	return newLocalCache(config)
+}
+
+func fetchFromCache(c *localCache, args ...string) *Request {
+	r := newCacheRequest(args...)
+	if c.handle(r, getHashKey(r.Multi, r.OpStr)) {
+		return r
+	}
+	if r.Coalesce != nil {
+		r.Resp = redis.NewBulkBytes([]byte("value"))
+		assert.MustNoError(r.Coalesce())
+	}
+	if r.invalidate != nil {
+		r.invalidate()
+	}
+	return nil
+}
+
+func TestLocalCacheHitAndInvalidate(t *testing.T) {
+	c := newTestLocalCache(128)
+
+	assert.Must(fetchFromCache(c, "GET", "foo") == nil)
+	r := fetchFromCache(c, "GET", "foo")
+	assert.Must(r != nil && string(r.Resp.Value) == "value")
+
+	assert.Must(fetchFromCache(c, "HGET", "foo", "f1") == nil)
+	assert.Must(fetchFromCache(c, "HGET", "foo", "f1") != nil)
+	assert.Must(fetchFromCache(c, "HGET", "foo", "f2") == nil)
+
+	assert.Must(fetchFromCache(c, "SET", "foo", "bar") == nil)
+	assert.Must(fetchFromCache(c, "GET", "foo") == nil)
+	assert.Must(fetchFromCache(c, "HGET", "foo", "f1") == nil)
+	assert.Must(c.stats.hits.Int64() == 2)
+}
+
+func TestLocalCacheStaleFill(t *testing.T) {
+	c := newTestLocalCache(128)
+
+	r := newCacheRequest("GET", "foo")
+	assert.Must(!c.handle(r, []byte("foo")))
+	assert.Must(r.Coalesce != nil)
+
+	c.Invalidate(0, []byte("foo"))
+
+	r.Resp = redis.NewBulkBytes([]byte("stale"))
+	assert.MustNoError(r.Coalesce())
+	assert.Must(fetchFromCache(c, "GET", "foo") == nil)
+	assert.Must(fetchFromCache(c, "GET", "foo") != nil)
+}
+
+func TestLocalCacheWriteInFlight(t *testing.T) {
+	c := newTestLocalCache(128)
+
+	r1 := newCacheRequest("GET", "foo")
+	assert.Must(!c.handle(r1, []byte("foo")))
+
+	w := newCacheRequest("SET", "foo", "bar")
+	assert.Must(!c.handle(w, []byte("foo")))
+	assert.Must(w.invalidate != nil)
+
+	r2 := newCacheRequest("GET", "foo")
+	assert.Must(!c.handle(r2, []byte("foo")))
+	r2.Resp = redis.NewBulkBytes([]byte("stale"))
+	assert.MustNoError(r2.Coalesce())
+
+	w.invalidate()
+
+	r1.Resp = redis.NewBulkBytes([]byte("stale"))
+	assert.MustNoError(r1.Coalesce())
+	assert.Must(fetchFromCache(c, "GET", "foo") == nil)
+
+	r := fetchFromCache(c, "GET", "foo")
+	assert.Must(r != nil && string(r.Resp.Value) == "value")
+}
+
+func TestLocalCachePrefixAndCommands(t *testing.T) {
+	c := newTestLocalCache(128, "user:")
+
+	assert.Must(fetchFromCache(c, "GET", "item:1") == nil)
+	assert.Must(fetchFromCache(c, "GET", "item:1") == nil)
+	assert.Must(fetchFromCache(c, "GET", "user:1") == nil)
+	assert.Must(fetchFromCache(c, "GET", "user:1") != nil)
+
+	assert.Must(fetchFromCache(c, "LRANGE", "user:2", "0", "-1") == nil)
+	assert.Must(fetchFromCache(c, "LRANGE", "user:2", "0", "-1") == nil)
+
+	assert.Must(fetchFromCache(c, "RENAME", "item:1", "user:1") == nil)
+	assert.Must(fetchFromCache(c, "GET", "user:1") == nil)
+}
+
+func TestLocalCacheExpireAndEvict(t *testing.T) {
+	c := newTestLocalCache(2)
+	c.ttl = int64(time.Millisecond * 50)
+
+	for _, key := range []string{"k1", "k2", "k3"} {
+		assert.Must(fetchFromCache(c, "GET", key) == nil)
+	}
+	assert.Must(c.Entries() == 2)
+	assert.Must(fetchFromCache(c, "GET", "k3") != nil)
+	assert.Must(fetchFromCache(c, "GET", "k1") == nil)
+
+	time.Sleep(time.Millisecond * 100)
+	assert.Must(fetchFromCache(c, "GET", "k3") == nil)
+}
+
+func TestLocalCacheScript(t *testing.T) {
+	c := newTestLocalCache(128)
+
+	for _, key := range []string{"foo", "bar", "baz"} {
+		assert.Must(fetchFromCache(c, "GET", key) == nil)
+		assert.Must(fetchFromCache(c, "GET", key) != nil)
+	}
+	assert.Must(fetchFromCache(c, "EVAL", "return 1", "2", "foo", "bar", "baz") == nil)
+	assert.Must(fetchFromCache(c, "GET", "foo") == nil)
+	assert.Must(fetchFromCache(c, "GET", "bar") == nil)
+	assert.Must(fetchFromCache(c, "GET", "baz") != nil)
+
+	assert.Must(fetchFromCache(c, "EVALSHA", "baz", "0", "baz") == nil)
+	assert.Must(fetchFromCache(c, "GET", "baz") != nil)
+
+	assert.Must(len(scriptKeys(newCacheRequest("EVAL", "return 1", "3", "foo").Multi)) == 0)
+	assert.Must(len(scriptKeys(newCacheRequest("EVAL", "return 1", "x", "foo").Multi)) == 0)
+}
+
+func TestLocalCacheBroadcast(t *testing.T) {
+	config := NewDefaultConfig()
+	config.CacheMaxEntries = 128
+	config.CacheBroadcast = true
+	config.CacheBroadcastPeriod = timesize.Duration(time.Second)
+	assert.Must(config.Validate() != nil)
+	config.JodisName, config.JodisAddr = "zookeeper", "127.0.0.1:2181"
+	assert.MustNoError(config.Validate())
+
+	c1, c2 := newLocalCache(config), newLocalCache(config)
+	assert.Must(fetchFromCache(c2, "GET", "foo") == nil)
+	assert.Must(fetchFromCache(c2, "GET", "foo") != nil)
+
+	assert.Must(fetchFromCache(c1, "DEL", "foo") == nil)
+	x := c1.drainPending()
+	assert.Must(len(x.Keys) == 1 && string(x.Keys[0].Key) == "foo")
+	assert.Must(c1.drainPending().IsEmpty())
+
+	c2.Apply(x)
+	assert.Must(fetchFromCache(c2, "GET", "foo") == nil)
+}
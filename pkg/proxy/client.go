@@ -0,0 +1,209 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/proxy/redis"
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/sync2/atomic2"
+)
+
+var (
+	ErrClientNotFound   = errors.New("client not found")
+	ErrKilledSession    = errors.New("session is killed")
+	sessionIdGeneration atomic2.Int64
+)
+
+type ClientInfo struct {
+	Id       int64  `json:"id"`
+	Addr     string `json:"addr"`
+	Name     string `json:"name,omitempty"`
+	Age      int64  `json:"age"`
+	Idle     int64  `json:"idle"`
+	Database int32  `json:"db"`
+	Ops      int64  `json:"ops"`
+}
+
+func (c *ClientInfo) String() string {
+	return fmt.Sprintf("id=%d addr=%s name=%s age=%d idle=%d db=%d ops=%d",
+		c.Id, c.Addr, c.Name, c.Age, c.Idle, c.Database, c.Ops)
+}
+
+func (s *Session) Name() string {
+	name, _ := s.name.Load().(string)
+	return name
+}
+
+func (s *Session) ClientInfo() *ClientInfo {
+	var now = time.Now().Unix()
+	var last = atomic.LoadInt64(&s.LastOpUnix)
+	if last == 0 {
+		last = s.CreateUnix
+	}
+	return &ClientInfo{
+		Id:       s.id,
+		Addr:     s.Conn.RemoteAddr(),
+		Name:     s.Name(),
+		Age:      now - s.CreateUnix,
+		Idle:     now - last,
+		Database: atomic.LoadInt32(&s.database),
+		Ops:      atomic.LoadInt64(&s.Ops),
+	}
+}
+
+func (s *Session) kill() {
+	s.CloseWithError(ErrKilledSession)
+}
+
+func (t *sessionTable) clients() []*ClientInfo {
+	var list []*ClientInfo
+	for _, s := range t.list() {
+		list = append(list, s.ClientInfo())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Id < list[j].Id
+	})
+	return list
+}
+
+func (t *sessionTable) kill(self *Session, match func(s *Session) bool) int {
+	var n int
+	for _, s := range t.list() {
+		if !match(s) {
+			continue
+		}
+		if s == self {
+			s.quit.Set(true)
+		} else {
+			s.kill()
+		}
+		n++
+	}
+	return n
+}
+
+func (s *Session) handleClient(r *Request, d *Router) error {
+	if len(r.Multi) < 2 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'CLIENT' command")
+		return nil
+	}
+	switch sub := strings.ToUpper(string(r.Multi[1].Value)); sub {
+	case "LIST":
+		var b bytes.Buffer
+		for _, c := range d.sessions.clients() {
+			fmt.Fprintf(&b, "%s\n", c)
+		}
+		r.Resp = redis.NewBulkBytes(b.Bytes())
+	case "KILL":
+		return s.handleClientKill(r, d)
+	case "SETNAME":
+		if len(r.Multi) != 3 {
+			r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'CLIENT SETNAME' command")
+			return nil
+		}
+		name := string(r.Multi[2].Value)
+		if strings.IndexFunc(name, func(c rune) bool { return c <= ' ' || c > '~' }) >= 0 {
+			r.Resp = redis.NewErrorf("ERR Client names cannot contain spaces, newlines or special characters.")
+			return nil
+		}
+		s.name.Store(name)
+		r.Resp = RespOK
+	case "GETNAME":
+		if name := s.Name(); name != "" {
+			r.Resp = redis.NewBulkBytes([]byte(name))
+		} else {
+			r.Resp = redis.NewBulkBytes(nil)
+		}
+	default:
+		r.Resp = redis.NewErrorf("ERR unknown subcommand '%s' for 'CLIENT' command", sub)
+	}
+	return nil
+}
+
+func (s *Session) handleClientKill(r *Request, d *Router) error {
+	var args = r.Multi[2:]
+	if len(args) == 1 {
+		addr := string(args[0].Value)
+		if d.sessions.kill(s, func(x *Session) bool {
+			return x.Conn.RemoteAddr() == addr
+		}) == 0 {
+			r.Resp = redis.NewErrorf("ERR No such client")
+		} else {
+			r.Resp = RespOK
+		}
+		return nil
+	}
+	if len(args) == 0 || len(args)%2 != 0 {
+		r.Resp = redis.NewErrorf("ERR syntax error")
+		return nil
+	}
+	var filters []func(x *Session) bool
+	var skipme = true
+	for i := 0; i < len(args); i += 2 {
+		key, val := strings.ToUpper(string(args[i].Value)), string(args[i+1].Value)
+		switch key {
+		case "ID":
+			id, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				r.Resp = redis.NewErrorf("ERR client-id should be greater than 0")
+				return nil
+			}
+			filters = append(filters, func(x *Session) bool { return x.id == id })
+		case "ADDR":
+			filters = append(filters, func(x *Session) bool { return x.Conn.RemoteAddr() == val })
+		case "SKIPME":
+			switch strings.ToLower(val) {
+			case "yes":
+				skipme = true
+			case "no":
+				skipme = false
+			default:
+				r.Resp = redis.NewErrorf("ERR syntax error")
+				return nil
+			}
+		default:
+			r.Resp = redis.NewErrorf("ERR syntax error")
+			return nil
+		}
+	}
+	n := d.sessions.kill(s, func(x *Session) bool {
+		if skipme && x == s {
+			return false
+		}
+		for _, match := range filters {
+			if !match(x) {
+				return false
+			}
+		}
+		return true
+	})
+	r.Resp = redis.NewInt(strconv.AppendInt(nil, int64(n), 10))
+	return nil
+}
+
+func (s *Proxy) Clients() []*ClientInfo {
+	return s.router.sessions.clients()
+}
+
+func (s *Proxy) KillClient(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosedProxy
+	}
+	if s.router.sessions.kill(nil, func(x *Session) bool {
+		return x.id == id
+	}) == 0 {
+		return ErrClientNotFound
+	}
+	return nil
+}
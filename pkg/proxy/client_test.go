@@ -0,0 +1,80 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/CodisLabs/codis/pkg/proxy/redis"
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+)
+
+func newClientConn(addr string) *redis.Conn {
+	sock, err := net.Dial("tcp", addr)
+	assert.MustNoError(err)
+	return redis.NewConn(sock, 1024, 1024)
+}
+
+func doClientCommand(c *redis.Conn, args ...string) *redis.Resp {
+	var multi []*redis.Resp
+	for _, arg := range args {
+		multi = append(multi, redis.NewBulkBytes([]byte(arg)))
+	}
+	assert.MustNoError(c.EncodeMultiBulk(multi, true))
+	r, err := c.Decode()
+	assert.MustNoError(err)
+	return r
+}
+
+func TestClientCommands(t *testing.T) {
+	s, addr := openProxy()
+	defer s.Close()
+	assert.MustNoError(s.Start())
+
+	c1 := newClientConn(s.Model().ProxyAddr)
+	defer c1.Close()
+	c2 := newClientConn(s.Model().ProxyAddr)
+	defer c2.Close()
+
+	r := doClientCommand(c1, "CLIENT", "GETNAME")
+	assert.Must(r.IsBulkBytes() && r.Value == nil)
+	r = doClientCommand(c1, "CLIENT", "SETNAME", "bad name")
+	assert.Must(r.IsError())
+	r = doClientCommand(c1, "CLIENT", "SETNAME", "worker-1")
+	assert.Must(string(r.Value) == "OK")
+	r = doClientCommand(c1, "CLIENT", "GETNAME")
+	assert.Must(string(r.Value) == "worker-1")
+
+	doClientCommand(c2, "SELECT", "2")
+	r = doClientCommand(c2, "CLIENT", "LIST")
+	lines := strings.Split(strings.TrimSpace(string(r.Value)), "\n")
+	assert.Must(len(lines) == 2)
+	assert.Must(strings.Contains(lines[0], "name=worker-1 ") && strings.Contains(lines[1], "db=2"))
+
+	api := NewApiClient(addr)
+	api.SetXAuth(config.ProductName, config.ProductAuth, s.Model().Token)
+	clients, err := api.Clients()
+	assert.MustNoError(err)
+	assert.Must(len(clients) == 2 && clients[0].Name == "worker-1" && clients[1].Database == 2)
+	assert.Must(clients[0].Addr == c1.LocalAddr())
+
+	r = doClientCommand(c2, "CLIENT", "KILL", "ADDR", c2.LocalAddr())
+	assert.Must(r.IsInt() && string(r.Value) == "0")
+	r = doClientCommand(c2, "CLIENT", "KILL", "1.2.3.4:5")
+	assert.Must(r.IsError())
+
+	assert.MustNoError(api.KillClient(clients[0].Id))
+	_, err = c1.Decode()
+	assert.Must(err != nil)
+	assert.Must(api.KillClient(clients[0].Id) != nil)
+
+	r = doClientCommand(c2, "CLIENT", "KILL", "ID", "0")
+	assert.Must(r.IsInt() && string(r.Value) == "0")
+	r = doClientCommand(c2, "CLIENT", "KILL", c2.LocalAddr())
+	assert.Must(string(r.Value) == "OK")
+	_, err = c2.Decode()
+	assert.Must(err != nil)
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/BurntSushi/toml"
 
+	"github.com/CodisLabs/codis/pkg/proxy/redis"
 	"github.com/CodisLabs/codis/pkg/utils/bytesize"
 	"github.com/CodisLabs/codis/pkg/utils/errors"
 	"github.com/CodisLabs/codis/pkg/utils/log"
@@ -30,7 +31,11 @@ product_auth = ""
 #      codis-proxy and codis-server.
 #   2. session_auth is different from product_auth, it requires clients
 #      to issue AUTH <PASSWORD> before processing any other commands.
+#   3. session_auth_users lists users as "<USER>:<PASSWORD>", clients issue AUTH <USER> <PASSWORD>
+#      to log in as the user, which is matched by ratelimit rules of kind "user".
+#      AUTH <PASSWORD> logs in as user "default" with session_auth.
 session_auth = ""
+session_auth_users = []
 
 # Set bind address for admin(rpc), tcp only.
 admin_addr = "0.0.0.0:11080"
@@ -40,9 +45,9 @@ proto_type = "tcp4"
 proxy_addr = "0.0.0.0:19000"
 
 # Set jodis address & session timeout
-#   1. jodis_name is short for jodis_coordinator_name, only accept "zookeeper" & "etcd".
+#   1. jodis_name is short for jodis_coordinator_name, only accept "zookeeper" & "etcd" & "etcdv3" & "raft" & "filesystem".
 #   2. jodis_addr is short for jodis_coordinator_addr
-#   3. jodis_auth is short for jodis_coordinator_auth, for zookeeper/etcd, "user:password" is accepted.
+#   3. jodis_auth is short for jodis_coordinator_auth, for zookeeper/etcd/etcdv3, "user:password" is accepted.
 #   4. proxy will be registered as node:
 #        if jodis_compatible = true (not suggested):
 #          /zk/codis/db_{PRODUCT_NAME}/proxy-{HASHID} (compatible with Codis2.0)
@@ -66,6 +71,10 @@ proxy_max_offheap_size = "1024mb"
 # Set heap placeholder to reduce GC frequency.
 proxy_heap_placeholder = "256mb"
 
+# Set max time to wait for in-flight requests when proxy is draining on SIGTERM or handing off
+# listeners on SIGUSR2. (0 to close immediately)
+proxy_drain_timeout = "0s"
+
 # Proxy will ping backend redis (and clear 'MASTERDOWN' state) in a predefined interval. (0 to disable)
 backend_ping_period = "5s"
 
@@ -93,6 +102,32 @@ backend_keepalive_period = "75s"
 # Set number of databases of backend.
 backend_number_databases = 16
 
+# Set max size of a single reply from backend, connection to backend will be reset if exceeded. (0 to disable)
+backend_max_reply_size = "0"
+
+# Set backend circuit breaker. The breaker opens after N consecutive failures, or if the failure
+# rate (in percent) exceeds the threshold within the window, and requests fast-fail until the
+# cooldown expires. (0 to disable, e.g. set max_failures = 20 & failure_rate = 50 to enable)
+backend_breaker_max_failures = 0
+backend_breaker_failure_rate = 0
+backend_breaker_min_requests = 100
+backend_breaker_window = "10s"
+backend_breaker_cooldown = "3s"
+
+# Set max replication lag of replica, checked by 'INFO replication' every backend_ping_period.
+# The lag is how long ago the master had written past the replica's offset, so it's measured at the
+# granularity of backend_ping_period. Replicas whose master isn't found among the group servers by the
+# reported master_host:master_port are only checked for link status.
+# Reads will fall back to master if all replicas are lagging. (0 to disable, e.g. "30s" to enable)
+backend_replica_max_lag = "0s"
+
+# Set hedged reads. If a read-only request hasn't been answered within the given percentile of recent
+# read latency (but no less than the min delay), a duplicate is sent to another replica of the same
+# group and whichever answers first wins. At most budget percent of reads are hedged. (0 to disable)
+backend_hedge_percentile = 0
+backend_hedge_min_delay = "5ms"
+backend_hedge_budget = 5
+
 # If there is no request from client for a long time, the connection will be closed. (0 to disable)
 # Set session recv buffer size & timeout.
 session_recv_bufsize = "128kb"
@@ -112,6 +147,60 @@ session_keepalive_period = "75s"
 # Set session to be sensitive to failures. Default is false, instead of closing socket, proxy will send an error response to client.
 session_break_on_failure = false
 
+# Set max size of each bulk & max number of bulks in a request, the session will be closed if exceeded.
+session_max_bulk_size = "512mb"
+session_max_multibulk_len = 1048576
+
+# Set default read preference of sessions, should be primary, replica or nearest.
+# Sessions can change it by 'CODIS READPREF <pref>', or 'READONLY' & 'READWRITE'.
+session_read_preference = "replica"
+
+# Set per-request timeout by command class, counted from when the request is read from the client.
+# An expired request is answered with a timeout error and dropped if it hasn't been sent to backend yet,
+# the backend connection is kept as it is. Writes already sent to backend may still be applied. (0 to disable)
+session_read_request_timeout = "0s"
+session_write_request_timeout = "0s"
+
+# Set rate limits of sessions, each rule is "<KIND>[=<MATCH>] rate=<N> [burst=<N>] [action=reject|delay] [max_delay_ms=<N>]",
+# kind can be "user", "client", "class" (all, read or write) or "prefix", e.g.
+#   session_ratelimits = ["user=batch rate=1000 burst=100", "class=write rate=5000 action=delay max_delay_ms=10"]
+# Rules set through admin api override these until proxy restarts.
+session_ratelimits = []
+
+# Set local read cache of proxy. (0 to disable)
+#   1. only replies of commands listed in cache_commands are cached, and keys must match one of
+#      cache_key_prefixes (empty to match all keys).
+#   2. cached replies expire after cache_ttl, writes forwarded by this proxy invalidate them immediately.
+#   3. if cache_broadcast = true, invalidations are exchanged with other proxies through the coordinator
+#      specified by jodis_name & jodis_addr.
+cache_max_entries = 0
+cache_ttl = "1s"
+cache_key_prefixes = []
+cache_commands = ["GET", "HGET", "HMGET", "HGETALL"]
+cache_broadcast = false
+cache_broadcast_period = "100ms"
+
+# Set shadow address (usually a proxy of the candidate cluster) to mirror traffic to. Requests are sent
+# asynchronously after replied to the client, and dropped if more than mirror_max_pending are queued.
+#   1. mirror_mode = "write" mirrors write commands only, "all" mirrors every command, and "compare"
+#      mirrors every command and counts shadow replies that differ from the ones of the primary.
+#   2. only keys match one of mirror_key_prefixes (empty to match all keys) are mirrored, and
+#      mirror_sample_rate is the percent of them to be sampled.
+mirror_addr = ""
+mirror_mode = "write"
+mirror_key_prefixes = []
+mirror_sample_rate = 100
+mirror_max_pending = 4096
+
+# Set request tracing. Sampled requests record spans of decode, queue wait, migration, backend round trip
+# and encode, and are exported as OTLP/HTTP json to trace_collector (such as http://localhost:4318/v1/traces),
+# or appended to trace_file as json lines if no collector is set. (0 to disable)
+trace_sample_ratio = 0.0
+trace_collector = ""
+trace_file = ""
+trace_export_period = "1s"
+trace_max_pending = 4096
+
 # Set metrics server (such as http://localhost:28000), proxy will report json formatted metrics to specified server in a predefined period.
 metrics_report_server = ""
 metrics_report_period = "1s"
@@ -143,15 +232,18 @@ type Config struct {
 	JodisTimeout    timesize.Duration `toml:"jodis_timeout" json:"jodis_timeout"`
 	JodisCompatible bool              `toml:"jodis_compatible" json:"jodis_compatible"`
 
-	ProductName string `toml:"product_name" json:"product_name"`
-	ProductAuth string `toml:"product_auth" json:"-"`
-	SessionAuth string `toml:"session_auth" json:"-"`
+	ProductName      string   `toml:"product_name" json:"product_name"`
+	ProductAuth      string   `toml:"product_auth" json:"-"`
+	SessionAuth      string   `toml:"session_auth" json:"-"`
+	SessionAuthUsers []string `toml:"session_auth_users" json:"-"`
 
 	ProxyDataCenter      string         `toml:"proxy_datacenter" json:"proxy_datacenter"`
 	ProxyMaxClients      int            `toml:"proxy_max_clients" json:"proxy_max_clients"`
 	ProxyMaxOffheapBytes bytesize.Int64 `toml:"proxy_max_offheap_size" json:"proxy_max_offheap_size"`
 	ProxyHeapPlaceholder bytesize.Int64 `toml:"proxy_heap_placeholder" json:"proxy_heap_placeholder"`
 
+	ProxyDrainTimeout timesize.Duration `toml:"proxy_drain_timeout" json:"proxy_drain_timeout"`
+
 	BackendPingPeriod      timesize.Duration `toml:"backend_ping_period" json:"backend_ping_period"`
 	BackendRecvBufsize     bytesize.Int64    `toml:"backend_recv_bufsize" json:"backend_recv_bufsize"`
 	BackendRecvTimeout     timesize.Duration `toml:"backend_recv_timeout" json:"backend_recv_timeout"`
@@ -163,6 +255,19 @@ type Config struct {
 	BackendReplicaParallel int               `toml:"backend_replica_parallel" json:"backend_replica_parallel"`
 	BackendKeepAlivePeriod timesize.Duration `toml:"backend_keepalive_period" json:"backend_keepalive_period"`
 	BackendNumberDatabases int32             `toml:"backend_number_databases" json:"backend_number_databases"`
+	BackendMaxReplySize    bytesize.Int64    `toml:"backend_max_reply_size" json:"backend_max_reply_size"`
+
+	BackendBreakerMaxFailures int               `toml:"backend_breaker_max_failures" json:"backend_breaker_max_failures"`
+	BackendBreakerFailureRate int               `toml:"backend_breaker_failure_rate" json:"backend_breaker_failure_rate"`
+	BackendBreakerMinRequests int               `toml:"backend_breaker_min_requests" json:"backend_breaker_min_requests"`
+	BackendBreakerWindow      timesize.Duration `toml:"backend_breaker_window" json:"backend_breaker_window"`
+	BackendBreakerCooldown    timesize.Duration `toml:"backend_breaker_cooldown" json:"backend_breaker_cooldown"`
+
+	BackendReplicaMaxLag timesize.Duration `toml:"backend_replica_max_lag" json:"backend_replica_max_lag"`
+
+	BackendHedgePercentile int               `toml:"backend_hedge_percentile" json:"backend_hedge_percentile"`
+	BackendHedgeMinDelay   timesize.Duration `toml:"backend_hedge_min_delay" json:"backend_hedge_min_delay"`
+	BackendHedgeBudget     int               `toml:"backend_hedge_budget" json:"backend_hedge_budget"`
 
 	SessionRecvBufsize     bytesize.Int64    `toml:"session_recv_bufsize" json:"session_recv_bufsize"`
 	SessionRecvTimeout     timesize.Duration `toml:"session_recv_timeout" json:"session_recv_timeout"`
@@ -171,6 +276,33 @@ type Config struct {
 	SessionMaxPipeline     int               `toml:"session_max_pipeline" json:"session_max_pipeline"`
 	SessionKeepAlivePeriod timesize.Duration `toml:"session_keepalive_period" json:"session_keepalive_period"`
 	SessionBreakOnFailure  bool              `toml:"session_break_on_failure" json:"session_break_on_failure"`
+	SessionMaxBulkSize     bytesize.Int64    `toml:"session_max_bulk_size" json:"session_max_bulk_size"`
+	SessionMaxMultiBulkLen int               `toml:"session_max_multibulk_len" json:"session_max_multibulk_len"`
+	SessionReadPreference  string            `toml:"session_read_preference" json:"session_read_preference"`
+
+	SessionReadRequestTimeout  timesize.Duration `toml:"session_read_request_timeout" json:"session_read_request_timeout"`
+	SessionWriteRequestTimeout timesize.Duration `toml:"session_write_request_timeout" json:"session_write_request_timeout"`
+
+	SessionRateLimits []string `toml:"session_ratelimits" json:"session_ratelimits"`
+
+	CacheMaxEntries      int               `toml:"cache_max_entries" json:"cache_max_entries"`
+	CacheTTL             timesize.Duration `toml:"cache_ttl" json:"cache_ttl"`
+	CacheKeyPrefixes     []string          `toml:"cache_key_prefixes" json:"cache_key_prefixes"`
+	CacheCommands        []string          `toml:"cache_commands" json:"cache_commands"`
+	CacheBroadcast       bool              `toml:"cache_broadcast" json:"cache_broadcast"`
+	CacheBroadcastPeriod timesize.Duration `toml:"cache_broadcast_period" json:"cache_broadcast_period"`
+
+	MirrorAddr        string   `toml:"mirror_addr" json:"mirror_addr"`
+	MirrorMode        string   `toml:"mirror_mode" json:"mirror_mode"`
+	MirrorKeyPrefixes []string `toml:"mirror_key_prefixes" json:"mirror_key_prefixes"`
+	MirrorSampleRate  int      `toml:"mirror_sample_rate" json:"mirror_sample_rate"`
+	MirrorMaxPending  int      `toml:"mirror_max_pending" json:"mirror_max_pending"`
+
+	TraceSampleRatio  float64           `toml:"trace_sample_ratio" json:"trace_sample_ratio"`
+	TraceCollector    string            `toml:"trace_collector" json:"trace_collector"`
+	TraceFile         string            `toml:"trace_file" json:"trace_file"`
+	TraceExportPeriod timesize.Duration `toml:"trace_export_period" json:"trace_export_period"`
+	TraceMaxPending   int               `toml:"trace_max_pending" json:"trace_max_pending"`
 
 	MetricsReportServer           string            `toml:"metrics_report_server" json:"metrics_report_server"`
 	MetricsReportPeriod           timesize.Duration `toml:"metrics_report_period" json:"metrics_report_period"`
@@ -244,6 +376,9 @@ func (c *Config) Validate() error {
 	if d := c.ProxyHeapPlaceholder; d < 0 || d > MaxInt {
 		return errors.New("invalid proxy_heap_placeholder")
 	}
+	if c.ProxyDrainTimeout < 0 {
+		return errors.New("invalid proxy_drain_timeout")
+	}
 	if c.BackendPingPeriod < 0 {
 		return errors.New("invalid backend_ping_period")
 	}
@@ -275,6 +410,36 @@ func (c *Config) Validate() error {
 	if c.BackendNumberDatabases < 1 {
 		return errors.New("invalid backend_number_databases")
 	}
+	if c.BackendMaxReplySize < 0 {
+		return errors.New("invalid backend_max_reply_size")
+	}
+	if c.BackendBreakerMaxFailures < 0 {
+		return errors.New("invalid backend_breaker_max_failures")
+	}
+	if c.BackendBreakerFailureRate < 0 || c.BackendBreakerFailureRate > 100 {
+		return errors.New("invalid backend_breaker_failure_rate")
+	}
+	if c.BackendBreakerMinRequests < 0 {
+		return errors.New("invalid backend_breaker_min_requests")
+	}
+	if c.BackendBreakerWindow <= 0 {
+		return errors.New("invalid backend_breaker_window")
+	}
+	if c.BackendBreakerCooldown <= 0 {
+		return errors.New("invalid backend_breaker_cooldown")
+	}
+	if c.BackendReplicaMaxLag < 0 {
+		return errors.New("invalid backend_replica_max_lag")
+	}
+	if c.BackendHedgePercentile < 0 || c.BackendHedgePercentile > 100 {
+		return errors.New("invalid backend_hedge_percentile")
+	}
+	if c.BackendHedgeMinDelay < 0 {
+		return errors.New("invalid backend_hedge_min_delay")
+	}
+	if c.BackendHedgeBudget < 0 || c.BackendHedgeBudget > 100 {
+		return errors.New("invalid backend_hedge_budget")
+	}
 
 	if d := c.SessionRecvBufsize; d < 0 || d > MaxInt {
 		return errors.New("invalid session_recv_bufsize")
@@ -294,6 +459,84 @@ func (c *Config) Validate() error {
 	if c.SessionKeepAlivePeriod < 0 {
 		return errors.New("invalid session_keepalive_period")
 	}
+	if d := c.SessionMaxBulkSize; d <= 0 || d > redis.MaxBulkBytesLen {
+		return errors.New("invalid session_max_bulk_size")
+	}
+	if d := c.SessionMaxMultiBulkLen; d <= 0 || d > redis.MaxArrayLen {
+		return errors.New("invalid session_max_multibulk_len")
+	}
+	if c.SessionReadRequestTimeout < 0 {
+		return errors.New("invalid session_read_request_timeout")
+	}
+	if c.SessionWriteRequestTimeout < 0 {
+		return errors.New("invalid session_write_request_timeout")
+	}
+	if _, ok := ParseReadPref(c.SessionReadPreference); !ok {
+		return errors.New("invalid session_read_preference")
+	}
+	var users = make(map[string]bool)
+	for _, s := range c.SessionAuthUsers {
+		user, _, ok := parseAuthUser(s)
+		if !ok || user == "default" {
+			return errors.Errorf("invalid session_auth_users, bad user '%s'", user)
+		}
+		if users[user] {
+			return errors.Errorf("invalid session_auth_users, user '%s' is duplicated", user)
+		}
+		users[user] = true
+	}
+	if _, err := ParseRateLimits(c.SessionRateLimits); err != nil {
+		return errors.Errorf("invalid session_ratelimits, %s", err)
+	}
+
+	if c.CacheMaxEntries < 0 {
+		return errors.New("invalid cache_max_entries")
+	}
+	if c.CacheMaxEntries != 0 {
+		if c.CacheTTL <= 0 {
+			return errors.New("invalid cache_ttl")
+		}
+		for _, opstr := range c.CacheCommands {
+			if !isCacheableCommand(opstr) {
+				return errors.Errorf("invalid cache_commands, command '%s' can't be cached", opstr)
+			}
+		}
+		if c.CacheBroadcast {
+			if c.JodisAddr == "" {
+				return errors.New("invalid cache_broadcast, jodis_addr is required")
+			}
+			if c.CacheBroadcastPeriod <= 0 {
+				return errors.New("invalid cache_broadcast_period")
+			}
+		}
+	}
+
+	if c.MirrorAddr != "" {
+		if !isValidMirrorMode(c.MirrorMode) {
+			return errors.New("invalid mirror_mode")
+		}
+		if c.MirrorSampleRate < 0 || c.MirrorSampleRate > 100 {
+			return errors.New("invalid mirror_sample_rate")
+		}
+		if c.MirrorMaxPending <= 0 {
+			return errors.New("invalid mirror_max_pending")
+		}
+	}
+
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		return errors.New("invalid trace_sample_ratio")
+	}
+	if c.TraceSampleRatio != 0 {
+		if c.TraceCollector == "" && c.TraceFile == "" {
+			return errors.New("invalid trace_collector, trace_collector or trace_file is required")
+		}
+		if c.TraceExportPeriod <= 0 {
+			return errors.New("invalid trace_export_period")
+		}
+		if c.TraceMaxPending <= 0 {
+			return errors.New("invalid trace_max_pending")
+		}
+	}
 
 	if c.MetricsReportPeriod < 0 {
 		return errors.New("invalid metrics_report_period")
@@ -0,0 +1,220 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+)
+
+type sessionTable struct {
+	mu sync.Mutex
+
+	m map[*Session]struct{}
+
+	draining bool
+}
+
+func (t *sessionTable) add(s *Session) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return false
+	}
+	if t.m == nil {
+		t.m = make(map[*Session]struct{})
+	}
+	t.m[s] = struct{}{}
+	return true
+}
+
+func (t *sessionTable) del(s *Session) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.m, s)
+}
+
+func (t *sessionTable) list() []*Session {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var list = make([]*Session, 0, len(t.m))
+	for s := range t.m {
+		list = append(list, s)
+	}
+	return list
+}
+
+func (t *sessionTable) drain() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.draining = true
+	for s := range t.m {
+		s.drain()
+	}
+	return len(t.m)
+}
+
+func (s *Session) drain() {
+	s.draining.Set(true)
+	if s.tasks.Buffered() == 0 {
+		s.Conn.CloseReader()
+	}
+}
+
+var ErrDrainingProxy = errors.New("proxy is draining")
+
+func (s *Proxy) IsDraining() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.draining
+}
+
+func (s *Proxy) Drain(timeout time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosedProxy
+	}
+	if s.draining {
+		return nil
+	}
+	return s.drain(timeout)
+}
+
+func (s *Proxy) drain(timeout time.Duration) error {
+	s.draining = true
+
+	log.Warnf("[%p] proxy start draining, timeout = %s", s, timeout)
+
+	if s.jodis != nil {
+		s.jodis.Close()
+	}
+	if s.lproxy != nil {
+		s.lproxy.Close()
+	}
+
+	var unregister = s.unregister
+
+	go func() {
+		defer s.Close()
+		var deadline = time.Now().Add(timeout)
+		if unregister != nil {
+			if err := unregister(timeout); err != nil {
+				log.WarnErrorf(err, "[%p] proxy unregister failed", s)
+			} else {
+				log.Warnf("[%p] proxy unregistered", s)
+			}
+		}
+		for {
+			n := s.router.sessions.drain()
+			if n == 0 {
+				log.Warnf("[%p] proxy drained", s)
+				return
+			}
+			if time.Now().After(deadline) {
+				log.Warnf("[%p] proxy drain timeout, %d sessions left", s, n)
+				return
+			}
+			time.Sleep(time.Millisecond * 100)
+		}
+	}()
+	return nil
+}
+
+const ListenerFdsEnv = "CODIS_PROXY_LISTENER_FDS"
+
+func inheritedListener(index int) (net.Listener, error) {
+	var env = os.Getenv(ListenerFdsEnv)
+	if env == "" {
+		return nil, nil
+	}
+	fds := strings.Split(env, ",")
+	if index >= len(fds) {
+		return nil, nil
+	}
+	fd, err := strconv.Atoi(fds[index])
+	if err != nil {
+		return nil, errors.Errorf("invalid %s = '%s'", ListenerFdsEnv, env)
+	}
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("listener-%d", fd))
+	defer f.Close()
+	l, err := net.FileListener(f)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	log.Warnf("inherit listener %s from fd = %d", l.Addr(), fd)
+	return l, nil
+}
+
+func newListener(proto, addr string, index int) (net.Listener, error) {
+	l, err := inheritedListener(index)
+	if err != nil || l != nil {
+		return l, err
+	}
+	if l, err := net.Listen(proto, addr); err != nil {
+		return nil, errors.Trace(err)
+	} else {
+		return l, nil
+	}
+}
+
+type fileListener interface {
+	File() (*os.File, error)
+}
+
+func (s *Proxy) Handoff(timeout time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, ErrClosedProxy
+	}
+	if s.draining {
+		return 0, ErrDrainingProxy
+	}
+
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, l := range []net.Listener{s.lproxy, s.ladmin} {
+		x, ok := l.(fileListener)
+		if !ok {
+			return 0, errors.Errorf("listener %s can't be handed off", l.Addr())
+		}
+		f, err := x.File()
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		files = append(files, f)
+	}
+
+	cmd := exec.Command(os.Args[0], os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=3,4", ListenerFdsEnv))
+	if err := cmd.Start(); err != nil {
+		log.ErrorErrorf(err, "[%p] proxy handoff failed", s)
+		return 0, errors.Trace(err)
+	}
+	log.Warnf("[%p] proxy handoff listeners to pid = %d", s, cmd.Process.Pid)
+
+	go cmd.Wait()
+
+	if s.ladmin != nil {
+		s.ladmin.Close()
+	}
+	return cmd.Process.Pid, s.drain(timeout)
+}
@@ -0,0 +1,116 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/proxy/redis"
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+)
+
+func TestSessionTable(t *testing.T) {
+	var table sessionTable
+	s1 := &Session{tasks: NewRequestChan()}
+	s2 := &Session{tasks: NewRequestChan()}
+	assert.Must(table.add(s1))
+	assert.Must(table.add(s2))
+	assert.Must(len(table.list()) == 2)
+
+	table.del(s1)
+	assert.Must(len(table.list()) == 1)
+
+	s2.tasks.PushBack(&Request{})
+	assert.Must(table.drain() == 1)
+	assert.Must(s2.draining.IsTrue())
+	assert.Must(!table.add(s1))
+}
+
+func TestDrain(t *testing.T) {
+	s, _ := openProxy()
+	defer s.Close()
+	assert.MustNoError(s.Start())
+
+	sock, err := net.Dial("tcp", s.Model().ProxyAddr)
+	assert.MustNoError(err)
+	defer sock.Close()
+
+	c := redis.NewConn(sock, 1024, 1024)
+	multi := []*redis.Resp{
+		redis.NewBulkBytes([]byte("SELECT")),
+		redis.NewBulkBytes([]byte("0")),
+	}
+	assert.MustNoError(c.EncodeMultiBulk(multi, true))
+	r, err := c.Decode()
+	assert.MustNoError(err)
+	assert.Must(string(r.Value) == "OK")
+
+	assert.MustNoError(s.Drain(time.Second * 5))
+	assert.Must(s.IsDraining())
+
+	_, err = c.Decode()
+	assert.Must(err != nil)
+
+	for i := 0; i < 50 && !s.IsClosed(); i++ {
+		time.Sleep(time.Millisecond * 100)
+	}
+	assert.Must(s.IsClosed())
+	assert.Must(s.Drain(time.Second) == ErrClosedProxy)
+
+	_, err = net.DialTimeout("tcp", s.Model().ProxyAddr, time.Second)
+	assert.Must(err != nil)
+}
+
+func TestDrainUnregister(t *testing.T) {
+	s, _ := openProxy()
+	defer s.Close()
+	assert.MustNoError(s.Start())
+
+	var called = make(chan time.Duration, 1)
+	s.SetUnregister(func(timeout time.Duration) error {
+		called <- timeout
+		return nil
+	})
+	assert.MustNoError(s.Drain(time.Second * 3))
+
+	select {
+	case timeout := <-called:
+		assert.Must(timeout == time.Second*3)
+	case <-time.After(time.Second * 5):
+		assert.Must(false)
+	}
+}
+
+func TestHandoffUnregister(t *testing.T) {
+	s, _ := openProxy()
+	defer s.Close()
+	assert.MustNoError(s.Start())
+
+	var called = make(chan time.Duration, 1)
+	s.SetUnregister(func(timeout time.Duration) error {
+		called <- timeout
+		return nil
+	})
+
+	args := os.Args
+	defer func() {
+		os.Args = args
+	}()
+	os.Args = []string{"true"}
+
+	pid, err := s.Handoff(time.Second * 3)
+	assert.MustNoError(err)
+	assert.Must(pid != 0)
+	assert.Must(s.IsDraining())
+
+	select {
+	case timeout := <-called:
+		assert.Must(timeout == time.Second*3)
+	case <-time.After(time.Second * 5):
+		assert.Must(false)
+	}
+}
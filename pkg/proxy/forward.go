@@ -34,31 +34,35 @@ func (d *forwardSync) GetId() int {
 
 func (d *forwardSync) Forward(s *Slot, r *Request, hkey []byte) error {
 	s.lock.RLock()
-	bc, err := d.process(s, r, hkey)
+	bc, alt, err := d.process(s, r, hkey)
 	s.lock.RUnlock()
 	if err != nil {
 		return err
 	}
-	bc.PushBack(r)
+	d.pushBack(s, r, bc, alt)
 	return nil
 }
 
-func (d *forwardSync) process(s *Slot, r *Request, hkey []byte) (*BackendConn, error) {
+func (d *forwardSync) process(s *Slot, r *Request, hkey []byte) (_, alt *BackendConn, _ error) {
 	if s.backend.bc == nil {
 		log.Debugf("slot-%04d is not ready: hash key = '%s'",
 			s.id, hkey)
-		return nil, ErrSlotIsNotReady
+		return nil, nil, ErrSlotIsNotReady
 	}
 	if s.migrate.bc != nil && len(hkey) != 0 {
-		if err := d.slotsmgrt(s, hkey, r.Database, r.Seed16()); err != nil {
+		start := time.Now().UnixNano()
+		err := d.slotsmgrt(s, hkey, r.Database, r.Seed16())
+		r.trace.add(SpanMigrate, start, time.Now().UnixNano(), s.migrate.bc.Addr())
+		if err != nil {
 			log.Debugf("slot-%04d migrate from = %s to %s failed: hash key = '%s', database = %d, error = %s",
 				s.id, s.migrate.bc.Addr(), s.backend.bc.Addr(), hkey, r.Database, err)
-			return nil, err
+			return nil, nil, err
 		}
 	}
 	r.Group = &s.refs
 	r.Group.Add(1)
-	return d.forward2(s, r), nil
+	bc := d.forward2(s, r)
+	return bc, d.hedgeTarget(s, r, bc), nil
 }
 
 type forwardSemiAsync struct {
@@ -73,7 +77,7 @@ func (d *forwardSemiAsync) Forward(s *Slot, r *Request, hkey []byte) error {
 	var loop int
 	for {
 		s.lock.RLock()
-		bc, retry, err := d.process(s, r, hkey)
+		bc, alt, retry, err := d.process(s, r, hkey)
 		s.lock.RUnlock()
 
 		switch {
@@ -81,7 +85,7 @@ func (d *forwardSemiAsync) Forward(s *Slot, r *Request, hkey []byte) error {
 			return err
 		case !retry:
 			if bc != nil {
-				bc.PushBack(r)
+				d.pushBack(s, r, bc, alt)
 			}
 			return nil
 		}
@@ -104,31 +108,34 @@ func (d *forwardSemiAsync) Forward(s *Slot, r *Request, hkey []byte) error {
 	}
 }
 
-func (d *forwardSemiAsync) process(s *Slot, r *Request, hkey []byte) (_ *BackendConn, retry bool, _ error) {
+func (d *forwardSemiAsync) process(s *Slot, r *Request, hkey []byte) (_, alt *BackendConn, retry bool, _ error) {
 	if s.backend.bc == nil {
 		log.Debugf("slot-%04d is not ready: hash key = '%s'",
 			s.id, hkey)
-		return nil, false, ErrSlotIsNotReady
+		return nil, nil, false, ErrSlotIsNotReady
 	}
 	if s.migrate.bc != nil && len(hkey) != 0 {
+		start := time.Now().UnixNano()
 		resp, moved, err := d.slotsmgrtExecWrapper(s, hkey, r.Database, r.Seed16(), r.Multi)
+		r.trace.add(SpanMigrate, start, time.Now().UnixNano(), s.migrate.bc.Addr())
 		switch {
 		case err != nil:
 			log.Debugf("slot-%04d migrate from = %s to %s failed: hash key = '%s', error = %s",
 				s.id, s.migrate.bc.Addr(), s.backend.bc.Addr(), hkey, err)
-			return nil, false, err
+			return nil, nil, false, err
 		case !moved:
 			switch {
 			case resp != nil:
 				r.Resp = resp
-				return nil, false, nil
+				return nil, nil, false, nil
 			}
-			return nil, true, nil
+			return nil, nil, true, nil
 		}
 	}
 	r.Group = &s.refs
 	r.Group.Add(1)
-	return d.forward2(s, r), false, nil
+	bc := d.forward2(s, r)
+	return bc, d.hedgeTarget(s, r, bc), false, nil
 }
 
 type forwardHelper struct {
@@ -216,11 +223,20 @@ func (d *forwardHelper) slotsmgrtExecWrapper(s *Slot, hkey []byte, database int3
 func (d *forwardHelper) forward2(s *Slot, r *Request) *BackendConn {
 	var database, seed = r.Database, r.Seed16()
 	if s.migrate.bc == nil && !r.IsMasterOnly() && len(s.replicaGroups) != 0 {
-		for _, group := range s.replicaGroups {
-			var i = seed
-			for range group {
-				i = (i + 1) % uint(len(group))
-				if bc := group[i].BackendConn(database, seed, false); bc != nil {
+		switch r.ReadPref {
+		case ReadPrefReplica:
+			for _, group := range s.replicaGroups {
+				if bc := d.pickReplica(group, database, seed); bc != nil {
+					return bc
+				}
+			}
+		case ReadPrefNearest:
+			for _, group := range s.replicaGroups {
+				if bc := d.pickReplica(group, database, seed); bc != nil {
+					master := s.backend.bc.BackendConn(database, seed, false)
+					if master != nil && master.health.score() <= bc.health.score() {
+						return master
+					}
 					return bc
 				}
 			}
@@ -228,3 +244,23 @@ func (d *forwardHelper) forward2(s *Slot, r *Request) *BackendConn {
 	}
 	return s.backend.bc.BackendConn(database, seed, true)
 }
+
+func (d *forwardHelper) pickReplica(group []*sharedBackendConn, database int32, seed uint) *BackendConn {
+	var best *BackendConn
+	var score int64
+	var i = seed
+	for range group {
+		i = (i + 1) % uint(len(group))
+		if group[i].IsLagging() {
+			continue
+		}
+		bc := group[i].BackendConn(database, seed, false)
+		if bc == nil {
+			continue
+		}
+		if x := bc.health.score(); best == nil || x < score {
+			best, score = bc, x
+		}
+	}
+	return best
+}
@@ -0,0 +1,285 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/proxy/redis"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/CodisLabs/codis/pkg/utils/sync2/atomic2"
+)
+
+type backendHealth struct {
+	breaker *circuitBreaker
+
+	latency  atomic2.Int64
+	inflight atomic2.Int64
+
+	lag atomic2.Int64
+
+	repl struct {
+		sync.Mutex
+		master  string
+		samples []offsetSample
+	}
+}
+
+type offsetSample struct {
+	offset int64
+	time   time.Time
+}
+
+const maxOffsetSamples = 64
+
+func newBackendHealth(config *Config) *backendHealth {
+	return &backendHealth{breaker: newCircuitBreaker(config)}
+}
+
+func (h *backendHealth) updateLatency(r *Request) {
+	if r.sendNano == 0 {
+		return
+	}
+	var sample = time.Now().UnixNano() - r.sendNano
+	if sample < 0 {
+		return
+	}
+	for {
+		var old = h.latency.Int64()
+		var ewma = sample
+		if old != 0 {
+			ewma = old + (sample-old)/8
+		}
+		if h.latency.CompareAndSwap(old, ewma) {
+			return
+		}
+	}
+}
+
+func (h *backendHealth) score() int64 {
+	return h.latency.Int64() * (h.inflight.Int64() + 1)
+}
+
+func (h *backendHealth) isLagging(maxLag time.Duration) bool {
+	if maxLag == 0 {
+		return false
+	}
+	lag := h.lag.Int64()
+	return lag < 0 || lag > int64(maxLag/time.Second)
+}
+
+func (h *backendHealth) masterAddr() string {
+	h.repl.Lock()
+	defer h.repl.Unlock()
+	return h.repl.master
+}
+
+func (h *backendHealth) setMasterAddr(addr string) {
+	h.repl.Lock()
+	defer h.repl.Unlock()
+	h.repl.master = addr
+}
+
+// recordOffset keeps the time at which the master's replication offset was
+// first seen at each value, samples are only appended when the offset grows.
+func (h *backendHealth) recordOffset(offset int64, now time.Time) {
+	h.repl.Lock()
+	defer h.repl.Unlock()
+	if n := len(h.repl.samples); n != 0 {
+		switch last := h.repl.samples[n-1].offset; {
+		case offset == last:
+			return
+		case offset < last:
+			h.repl.samples = nil
+		}
+	}
+	h.repl.samples = append(h.repl.samples, offsetSample{offset, now})
+	if n := len(h.repl.samples); n > maxOffsetSamples {
+		h.repl.samples = append(h.repl.samples[:0], h.repl.samples[n-maxOffsetSamples:]...)
+	}
+}
+
+// lagBehind returns how many seconds ago the master had already written past
+// the given offset, or 0 if no sample of the master is ahead of it.
+func (h *backendHealth) lagBehind(offset int64, now time.Time) int64 {
+	h.repl.Lock()
+	defer h.repl.Unlock()
+	for _, x := range h.repl.samples {
+		if x.offset > offset {
+			return int64(now.Sub(x.time) / time.Second)
+		}
+	}
+	return 0
+}
+
+type replicationInfo struct {
+	Role    string
+	Master  string
+	LinkUp  bool
+	Syncing bool
+	Offset  int64
+}
+
+func parseReplicationInfo(text string) (*replicationInfo, error) {
+	var info = make(map[string]string)
+	for _, line := range strings.Split(text, "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if key := strings.TrimSpace(kv[0]); key != "" {
+			info[key] = strings.TrimSpace(kv[1])
+		}
+	}
+	x := &replicationInfo{Role: info["role"]}
+	switch x.Role {
+	case "master":
+		n, err := strconv.ParseInt(info["master_repl_offset"], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad replication info: master_repl_offset = '%s'", info["master_repl_offset"])
+		}
+		x.Offset = n
+	case "slave":
+		x.Master = net.JoinHostPort(info["master_host"], info["master_port"])
+		x.LinkUp = info["master_link_status"] == "up"
+		x.Syncing = info["master_sync_in_progress"] == "1"
+		if x.LinkUp && !x.Syncing {
+			n, err := strconv.ParseInt(info["slave_repl_offset"], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad replication info: slave_repl_offset = '%s'", info["slave_repl_offset"])
+			}
+			x.Offset = n
+		}
+	default:
+		return nil, fmt.Errorf("bad replication info: role = '%s'", x.Role)
+	}
+	return x, nil
+}
+
+// replicationLag compares the replica's offset with the offsets sampled on
+// its master. If the master isn't known to the proxy, only the link status
+// is taken into account.
+func replicationLag(x *replicationInfo, master *backendHealth, now time.Time) int64 {
+	switch {
+	case x.Role == "master":
+		return 0
+	case !x.LinkUp || x.Syncing:
+		return -1
+	case master == nil:
+		return 0
+	}
+	return master.lagBehind(x.Offset, now)
+}
+
+func newReplicationInfoRequest() *Request {
+	m := &Request{}
+	m.Multi = []*redis.Resp{
+		redis.NewBulkBytes([]byte("INFO")),
+		redis.NewBulkBytes([]byte("replication")),
+	}
+	m.Batch = &sync.WaitGroup{}
+	return m
+}
+
+func waitReplicationInfo(m *Request) (*replicationInfo, error) {
+	m.Batch.Wait()
+	if err := m.Err; err != nil {
+		return nil, err
+	}
+	switch resp := m.Resp; {
+	case resp == nil:
+		return nil, ErrRespIsRequired
+	case resp.IsError():
+		return nil, fmt.Errorf("bad info resp: %s", resp.Value)
+	case resp.IsBulkBytes():
+		return parseReplicationInfo(string(resp.Value))
+	default:
+		return nil, fmt.Errorf("bad info resp: should be string, but got %s", resp.Type)
+	}
+}
+
+func (s *sharedBackendConn) refreshLag() {
+	bc := s.conns[0][0]
+	if len(bc.input) != 0 || !bc.IsConnected() {
+		return
+	}
+	var master *sharedBackendConn
+	if p := s.owner.primary; p != nil {
+		master = p.Get(s.health.masterAddr())
+	}
+
+	var sample *Request
+	if master != nil {
+		if mc := master.conns[0][0]; len(mc.input) == 0 && mc.IsConnected() {
+			sample = newReplicationInfoRequest()
+			mc.PushBack(sample)
+		}
+	}
+	m := newReplicationInfoRequest()
+	bc.PushBack(m)
+
+	keepAliveCallback <- func() {
+		var now = time.Now()
+		if sample != nil {
+			if x, err := waitReplicationInfo(sample); err != nil {
+				log.WarnErrorf(err, "backend %s sample replication offset failed", master.addr)
+			} else if x.Role == "master" {
+				master.health.recordOffset(x.Offset, now)
+			}
+		}
+		x, err := waitReplicationInfo(m)
+		if err != nil {
+			if bc.closed.IsFalse() {
+				log.WarnErrorf(err, "backend %s refresh replication lag failed", s.addr)
+			}
+			return
+		}
+		s.health.setMasterAddr(x.Master)
+
+		var h *backendHealth
+		if master != nil && master.addr == x.Master {
+			h = master.health
+		}
+		lag := replicationLag(x, h, now)
+		if old := s.health.lag.Swap(lag); (old < 0) != (lag < 0) {
+			log.Warnf("backend %s replication lag = %d -> %d", s.addr, old, lag)
+		}
+	}
+}
+
+type BackendStats struct {
+	Addr string `json:"addr"`
+	Pool string `json:"pool"`
+
+	Latency  int64 `json:"latency_us"`
+	InFlight int64 `json:"inflight"`
+	Lag      int64 `json:"lag,omitempty"`
+
+	Breaker struct {
+		State    string `json:"state"`
+		Trips    int64  `json:"trips"`
+		Rejected int64  `json:"rejected"`
+	} `json:"breaker"`
+}
+
+func (s *sharedBackendConn) BackendStats() *BackendStats {
+	var h = s.health
+	x := &BackendStats{Addr: s.addr}
+	x.Latency = h.latency.Int64() / int64(time.Microsecond)
+	x.InFlight = h.inflight.Int64()
+	x.Lag = h.lag.Int64()
+	if b := h.breaker; b != nil {
+		x.Breaker.State = breakerStateNames[b.State()]
+		x.Breaker.Trips = b.trips.Int64()
+		x.Breaker.Rejected = b.rejected.Int64()
+	} else {
+		x.Breaker.State = "disabled"
+	}
+	return x
+}
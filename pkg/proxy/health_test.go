@@ -0,0 +1,127 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+)
+
+func TestReplicationInfo(t *testing.T) {
+	x, err := parseReplicationInfo("# Replication\r\nrole:master\r\nconnected_slaves:1\r\nmaster_repl_offset:1024\r\n")
+	assert.MustNoError(err)
+	assert.Must(x.Role == "master" && x.Offset == 1024)
+	assert.Must(replicationLag(x, nil, time.Now()) == 0)
+
+	x, err = parseReplicationInfo("role:slave\r\nmaster_host:127.0.0.1\r\nmaster_port:6379\r\nmaster_link_status:up\r\n" +
+		"master_last_io_seconds_ago:3\r\nmaster_sync_in_progress:0\r\nslave_repl_offset:512\r\n")
+	assert.MustNoError(err)
+	assert.Must(x.Master == "127.0.0.1:6379" && x.LinkUp && !x.Syncing && x.Offset == 512)
+	assert.Must(replicationLag(x, nil, time.Now()) == 0)
+
+	x, err = parseReplicationInfo("role:slave\r\nmaster_link_status:down\r\nmaster_last_io_seconds_ago:-1\r\n")
+	assert.MustNoError(err)
+	assert.Must(replicationLag(x, nil, time.Now()) == -1)
+
+	x, err = parseReplicationInfo("role:slave\r\nmaster_link_status:up\r\nmaster_sync_in_progress:1\r\n")
+	assert.MustNoError(err)
+	assert.Must(replicationLag(x, nil, time.Now()) == -1)
+
+	_, err = parseReplicationInfo("connected_slaves:1\r\n")
+	assert.Must(err != nil)
+	_, err = parseReplicationInfo("role:slave\r\nmaster_link_status:up\r\n")
+	assert.Must(err != nil)
+
+	h := &backendHealth{}
+	assert.Must(!h.isLagging(0))
+	h.lag.Set(5)
+	assert.Must(!h.isLagging(time.Second * 10))
+	assert.Must(h.isLagging(time.Second * 3))
+	h.lag.Set(-1)
+	assert.Must(h.isLagging(time.Second * 10))
+}
+
+func TestReplicationOffsetLag(t *testing.T) {
+	var now = time.Now()
+	master := &backendHealth{}
+	master.recordOffset(100, now.Add(-time.Second*30))
+	master.recordOffset(100, now.Add(-time.Second*25))
+	master.recordOffset(200, now.Add(-time.Second*20))
+	master.recordOffset(300, now.Add(-time.Second*10))
+
+	var replica = &replicationInfo{Role: "slave", LinkUp: true}
+	for _, c := range []struct {
+		offset int64
+		lag    int64
+	}{
+		{50, 30}, {100, 20}, {150, 20}, {200, 10}, {300, 0}, {400, 0},
+	} {
+		replica.Offset = c.offset
+		assert.Must(replicationLag(replica, master, now) == c.lag)
+	}
+
+	master.recordOffset(10, now)
+	replica.Offset = 0
+	assert.Must(replicationLag(replica, master, now) == 0)
+	assert.Must(len(master.repl.samples) == 1)
+
+	for i := 0; i < maxOffsetSamples*2; i++ {
+		master.recordOffset(int64(100+i), now)
+	}
+	assert.Must(len(master.repl.samples) == maxOffsetSamples)
+}
+
+func TestLatencyEWMA(t *testing.T) {
+	h := &backendHealth{}
+	h.updateLatency(&Request{})
+	assert.Must(h.latency.Int64() == 0)
+
+	now := time.Now().UnixNano()
+	h.updateLatency(&Request{UnixNano: now - int64(time.Second), sendNano: now - int64(time.Millisecond*8)})
+	x1 := h.latency.Int64()
+	assert.Must(x1 >= int64(time.Millisecond*8) && x1 < int64(time.Second))
+
+	h.updateLatency(&Request{sendNano: time.Now().UnixNano()})
+	x2 := h.latency.Int64()
+	assert.Must(x2 < x1 && x2 > x1/2)
+}
+
+func TestPickReplica(t *testing.T) {
+	config := NewDefaultConfig()
+	config.BackendBreakerMaxFailures = 0
+	config.BackendBreakerFailureRate = 0
+	config.BackendReplicaMaxLag.Set(time.Second * 10)
+	config.BackendNumberDatabases = 1
+
+	pool := newSharedBackendConnPool(config, 1, true)
+	var group []*sharedBackendConn
+	for _, addr := range []string{"127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3"} {
+		s := pool.Retain(addr)
+		defer s.Release()
+		s.single[0].state.Set(stateConnected)
+		group = append(group, s)
+	}
+	group[0].health.latency.Set(int64(time.Millisecond * 2))
+	group[1].health.latency.Set(int64(time.Millisecond * 1))
+	group[2].health.latency.Set(int64(time.Millisecond * 3))
+
+	var d forwardHelper
+	for seed := uint(0); seed < 3; seed++ {
+		assert.Must(d.pickReplica(group, 0, seed) == group[1].single[0])
+	}
+
+	group[1].health.inflight.Set(4)
+	assert.Must(d.pickReplica(group, 0, 0) == group[0].single[0])
+
+	group[0].health.lag.Set(-1)
+	assert.Must(d.pickReplica(group, 0, 0) == group[2].single[0])
+
+	group[2].health.lag.Set(60)
+	assert.Must(d.pickReplica(group, 0, 0) == group[1].single[0])
+
+	group[1].single[0].state.Set(0)
+	assert.Must(d.pickReplica(group, 0, 0) == nil)
+}
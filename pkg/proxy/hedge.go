@@ -0,0 +1,234 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/sync2/atomic2"
+)
+
+const hedgeHistogramSize = 96
+
+type hedger struct {
+	percentile float64
+	minDelay   int64
+	budget     int64
+
+	delay atomic2.Int64
+	renew atomic2.Int64
+
+	histogram [hedgeHistogramSize]atomic2.Int64
+
+	reads atomic2.Int64
+	hedge atomic2.Int64
+
+	stats struct {
+		fired   atomic2.Int64
+		won     atomic2.Int64
+		skipped atomic2.Int64
+	}
+}
+
+func newHedger(config *Config) *hedger {
+	if config.BackendHedgePercentile == 0 {
+		return nil
+	}
+	h := &hedger{
+		percentile: float64(config.BackendHedgePercentile) / 100,
+		minDelay:   int64(config.BackendHedgeMinDelay.Duration()),
+		budget:     int64(config.BackendHedgeBudget),
+	}
+	h.delay.Set(h.minDelay)
+	return h
+}
+
+func (h *hedger) bucket(nano int64) int {
+	us := float64(nano) / float64(time.Microsecond)
+	if us < 1 {
+		return 0
+	}
+	i := int(math.Log2(us) * 4)
+	if i >= hedgeHistogramSize {
+		return hedgeHistogramSize - 1
+	}
+	return i
+}
+
+func (h *hedger) record(nano int64) {
+	h.histogram[h.bucket(nano)].Incr()
+}
+
+func (h *hedger) getDelay() time.Duration {
+	var now = time.Now().UnixNano()
+	if renew := h.renew.Int64(); now >= renew && h.renew.CompareAndSwap(renew, now+int64(time.Second)) {
+		var counts [hedgeHistogramSize]int64
+		var total int64
+		for i := range h.histogram {
+			n := h.histogram[i].Int64()
+			h.histogram[i].Sub(n / 2)
+			counts[i] = n
+			total += n
+		}
+		if total != 0 {
+			var limit = int64(math.Ceil(float64(total) * h.percentile))
+			var sum int64
+			for i, n := range counts {
+				if sum += n; sum >= limit {
+					us := math.Exp2(float64(i+1) / 4)
+					h.delay.Set(int64(math.Max(us*float64(time.Microsecond), float64(h.minDelay))))
+					break
+				}
+			}
+		}
+		h.reads.Set(h.reads.Int64() / 2)
+		h.hedge.Set(h.hedge.Int64() / 2)
+	}
+	return time.Duration(h.delay.Int64())
+}
+
+func (h *hedger) acquire() bool {
+	if h.hedge.Int64()*100 >= h.reads.Int64()*h.budget {
+		h.stats.skipped.Incr()
+		return false
+	}
+	h.hedge.Incr()
+	h.stats.fired.Incr()
+	return true
+}
+
+func (h *hedger) forward(r *Request, bc, alt *BackendConn) {
+	h.reads.Incr()
+
+	x := &hedgeState{hedger: h, origin: r, start: time.Now().UnixNano()}
+	if r.Batch != nil {
+		r.Batch.Add(1)
+	}
+	x.pending = 1
+	bc.PushBack(x.newAttempt(false))
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.done {
+		x.timer = time.AfterFunc(h.getDelay(), func() {
+			x.mu.Lock()
+			if x.done || !h.acquire() {
+				x.mu.Unlock()
+				return
+			}
+			x.pending++
+			x.mu.Unlock()
+
+			alt.PushBack(x.newAttempt(true))
+		})
+	}
+}
+
+type hedgeState struct {
+	mu sync.Mutex
+
+	hedger *hedger
+	origin *Request
+	start  int64
+
+	timer   *time.Timer
+	pending int
+	done    bool
+}
+
+func (x *hedgeState) newAttempt(hedged bool) *Request {
+	r := x.origin
+	return &Request{
+		Multi: r.Multi, Broken: r.Broken, Expired: r.Expired,
+		OpStr: r.OpStr, OpFlag: r.OpFlag,
+		Database: r.Database, UnixNano: r.UnixNano, ReadPref: r.ReadPref,
+		hedge: x, hedged: hedged, trace: r.trace,
+	}
+}
+
+func (x *hedgeState) complete(a *Request) {
+	if a.Err == nil && !a.hedged {
+		x.hedger.record(time.Now().UnixNano() - x.start)
+	}
+
+	x.mu.Lock()
+	x.pending--
+	if x.done || (a.Err != nil && x.pending != 0) {
+		x.mu.Unlock()
+		return
+	}
+	x.done = true
+	if x.timer != nil {
+		x.timer.Stop()
+	}
+	x.mu.Unlock()
+
+	if a.Err == nil && a.hedged {
+		x.hedger.stats.won.Incr()
+	}
+
+	r := x.origin
+	r.Resp, r.Err = a.Resp, a.Err
+	if r.Group != nil {
+		r.Group.Done()
+	}
+	if r.Batch != nil {
+		r.Batch.Done()
+	}
+}
+
+func (d *forwardHelper) hedgeTarget(s *Slot, r *Request, bc *BackendConn) *BackendConn {
+	if s.hedger == nil || s.migrate.bc != nil || bc == nil {
+		return nil
+	}
+	if !r.IsReadOnly() || r.IsMasterOnly() || r.ReadPref == ReadPrefPrimary {
+		return nil
+	}
+	var database, seed = r.Database, r.Seed16()
+	for _, group := range s.replicaGroups {
+		var best *BackendConn
+		for _, x := range group {
+			if x.health == bc.health || x.IsLagging() {
+				continue
+			}
+			c := x.BackendConn(database, seed, false)
+			if c != nil && (best == nil || c.health.score() < best.health.score()) {
+				best = c
+			}
+		}
+		if best != nil {
+			return best
+		}
+	}
+	return nil
+}
+
+func (d *forwardHelper) pushBack(s *Slot, r *Request, bc, alt *BackendConn) {
+	if alt != nil {
+		s.hedger.forward(r, bc, alt)
+	} else {
+		bc.PushBack(r)
+	}
+}
+
+type HedgeStats struct {
+	Delay   int64 `json:"delay_us"`
+	Fired   int64 `json:"fired"`
+	Won     int64 `json:"won"`
+	Skipped int64 `json:"skipped"`
+}
+
+func (h *hedger) Stats() *HedgeStats {
+	if h == nil {
+		return nil
+	}
+	return &HedgeStats{
+		Delay:   h.delay.Int64() / int64(time.Microsecond),
+		Fired:   h.stats.fired.Int64(),
+		Won:     h.stats.won.Int64(),
+		Skipped: h.stats.skipped.Int64(),
+	}
+}
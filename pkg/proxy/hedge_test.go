@@ -0,0 +1,181 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/proxy/redis"
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+)
+
+func newHedgeConfig() *Config {
+	config := NewDefaultConfig()
+	config.BackendBreakerMaxFailures = 0
+	config.BackendBreakerFailureRate = 0
+	config.BackendHedgePercentile = 90
+	config.BackendHedgeMinDelay.Set(time.Millisecond * 10)
+	config.BackendHedgeBudget = 50
+	return config
+}
+
+func TestHedgeDelay(t *testing.T) {
+	h := newHedger(newHedgeConfig())
+	assert.Must(h.getDelay() == time.Millisecond*10)
+
+	for i := 0; i < 90; i++ {
+		h.record(int64(time.Millisecond))
+	}
+	for i := 0; i < 10; i++ {
+		h.record(int64(time.Second))
+	}
+	h.renew.Set(0)
+	d := h.getDelay()
+	assert.Must(d >= time.Millisecond*10 && d < time.Millisecond*20)
+
+	for i := 0; i < 100; i++ {
+		h.record(int64(time.Millisecond * 50))
+	}
+	h.renew.Set(0)
+	d = h.getDelay()
+	assert.Must(d >= time.Millisecond*50 && d < time.Millisecond*60)
+
+	config := newHedgeConfig()
+	config.BackendHedgePercentile = 0
+	assert.Must(newHedger(config) == nil)
+}
+
+func TestHedgeBudget(t *testing.T) {
+	h := newHedger(newHedgeConfig())
+	assert.Must(!h.acquire())
+	h.reads.Set(4)
+	assert.Must(h.acquire() && h.acquire())
+	assert.Must(!h.acquire())
+	assert.Must(h.stats.fired.Int64() == 2)
+	assert.Must(h.stats.skipped.Int64() == 2)
+}
+
+func newHedgeBackend(reply bool) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.MustNoError(err)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				dec := redis.NewDecoder(c)
+				for {
+					if _, err := dec.Decode(); err != nil {
+						return
+					}
+					if reply {
+						c.Write([]byte("+OK\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func TestHedgeForward(t *testing.T) {
+	slow := newHedgeBackend(false)
+	defer slow.Close()
+	fast := newHedgeBackend(true)
+	defer fast.Close()
+
+	config := newHedgeConfig()
+	h := newHedger(config)
+	h.reads.Set(100)
+
+	bc := NewBackendConn(slow.Addr().String(), 0, config)
+	defer bc.Close()
+	alt := NewBackendConn(fast.Addr().String(), 0, config)
+	defer alt.Close()
+
+	r := newCacheRequest("GET", "a")
+	r.Batch = &sync.WaitGroup{}
+	h.forward(r, bc, alt)
+	r.Batch.Wait()
+
+	assert.MustNoError(r.Err)
+	assert.Must(r.Resp != nil && string(r.Resp.Value) == "OK")
+	assert.Must(h.stats.fired.Int64() == 1)
+	assert.Must(h.stats.won.Int64() == 1)
+}
+
+func TestHedgeBreakerOpen(t *testing.T) {
+	slow, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.MustNoError(err)
+	defer slow.Close()
+
+	var reply = make(chan struct{})
+	go func() {
+		c, err := slow.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		if _, err := redis.NewDecoder(c).Decode(); err != nil {
+			return
+		}
+		<-reply
+		c.Write([]byte("+OK\r\n"))
+	}()
+	fast := newHedgeBackend(true)
+	defer fast.Close()
+
+	config := newHedgeConfig()
+	h := newHedger(config)
+	h.reads.Set(100)
+
+	bc := NewBackendConn(slow.Addr().String(), 0, config)
+	defer bc.Close()
+
+	broken := newHedgeConfig()
+	broken.BackendBreakerMaxFailures = 1
+	broken.BackendBreakerCooldown.Set(time.Minute)
+	alt := NewBackendConn(fast.Addr().String(), 0, broken)
+	defer alt.Close()
+	alt.health.breaker.trip(time.Now().UnixNano())
+	assert.Must(alt.health.breaker.IsOpen())
+
+	r := newCacheRequest("GET", "a")
+	r.Batch = &sync.WaitGroup{}
+	h.forward(r, bc, alt)
+
+	var done = make(chan struct{})
+	go func() {
+		r.Batch.Wait()
+		close(done)
+	}()
+
+	for i := 0; i < 100 && h.stats.fired.Int64() == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Must(h.stats.fired.Int64() == 1)
+
+	select {
+	case <-done:
+		assert.Must(false)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	close(reply)
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		assert.Must(false)
+	}
+	assert.MustNoError(r.Err)
+	assert.Must(r.Resp != nil && string(r.Resp.Value) == "OK")
+	assert.Must(h.stats.won.Int64() == 0)
+	assert.Must(alt.health.breaker.rejected.Int64() == 1)
+}
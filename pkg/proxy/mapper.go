@@ -72,8 +72,9 @@ func init() {
 		{"BLPOP", FlagWrite | FlagNotAllow},
 		{"BRPOP", FlagWrite | FlagNotAllow},
 		{"BRPOPLPUSH", FlagWrite | FlagNotAllow},
-		{"CLIENT", FlagNotAllow},
+		{"CLIENT", 0},
 		{"CLUSTER", FlagNotAllow},
+		{"CODIS", 0},
 		{"COMMAND", 0},
 		{"CONFIG", FlagNotAllow},
 		{"DBSIZE", FlagNotAllow},
@@ -162,8 +163,8 @@ func init() {
 		{"PUNSUBSCRIBE", FlagNotAllow},
 		{"QUIT", 0},
 		{"RANDOMKEY", FlagNotAllow},
-		{"READONLY", FlagNotAllow},
-		{"READWRITE", FlagNotAllow},
+		{"READONLY", 0},
+		{"READWRITE", 0},
 		{"RENAME", FlagWrite | FlagNotAllow},
 		{"RENAMENX", FlagWrite | FlagNotAllow},
 		{"REPLCONF", FlagNotAllow},
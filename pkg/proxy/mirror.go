@@ -0,0 +1,216 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/CodisLabs/codis/pkg/proxy/redis"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/CodisLabs/codis/pkg/utils/sync2/atomic2"
+)
+
+const (
+	MirrorModeWrite   = "write"
+	MirrorModeAll     = "all"
+	MirrorModeCompare = "compare"
+)
+
+func isValidMirrorMode(mode string) bool {
+	switch mode {
+	case MirrorModeWrite, MirrorModeAll, MirrorModeCompare:
+		return true
+	}
+	return false
+}
+
+var mirrorIgnored = map[string]bool{
+	"QUIT": true, "AUTH": true, "SELECT": true, "PING": true, "INFO": true,
+	"READONLY": true, "READWRITE": true, "CODIS": true, "CLIENT": true,
+	"SLOTSINFO": true, "SLOTSSCAN": true, "SLOTSMAPPING": true,
+}
+
+type trafficMirror struct {
+	mu sync.RWMutex
+
+	addr     string
+	mode     string
+	rate     int64
+	prefixes [][]byte
+
+	config *Config
+	closed bool
+
+	input  chan *mirrorTask
+	output chan *mirrorTask
+	conns  map[int32]*BackendConn
+
+	counter atomic2.Int64
+
+	stats struct {
+		sent       atomic2.Int64
+		dropped    atomic2.Int64
+		errors     atomic2.Int64
+		mismatches atomic2.Int64
+	}
+}
+
+type mirrorTask struct {
+	r      *Request
+	expect *redis.Resp
+}
+
+func newTrafficMirror(config *Config) *trafficMirror {
+	if config.MirrorAddr == "" {
+		return nil
+	}
+	m := &trafficMirror{
+		addr: config.MirrorAddr, mode: config.MirrorMode,
+		rate: int64(config.MirrorSampleRate), config: config,
+	}
+	for _, prefix := range config.MirrorKeyPrefixes {
+		m.prefixes = append(m.prefixes, []byte(prefix))
+	}
+	m.input = make(chan *mirrorTask, config.MirrorMaxPending)
+	m.output = make(chan *mirrorTask, config.MirrorMaxPending)
+	m.conns = make(map[int32]*BackendConn)
+
+	go m.loopWriter()
+	go m.loopReader()
+
+	return m
+}
+
+func (m *trafficMirror) sample(r *Request) bool {
+	if m == nil || mirrorIgnored[r.OpStr] {
+		return false
+	}
+	if m.mode == MirrorModeWrite && r.IsReadOnly() {
+		return false
+	}
+	if !m.match(getHashKey(r.Multi, r.OpStr)) {
+		return false
+	}
+	n := m.counter.Incr()
+	return n*m.rate/100 != (n-1)*m.rate/100
+}
+
+func (m *trafficMirror) match(key []byte) bool {
+	if len(m.prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range m.prefixes {
+		if bytes.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *trafficMirror) push(r *Request, resp *redis.Resp) {
+	t := &mirrorTask{}
+	t.r = &Request{
+		Multi: r.Multi, Batch: &sync.WaitGroup{},
+		OpStr: r.OpStr, OpFlag: r.OpFlag,
+		Database: r.Database, UnixNano: r.UnixNano,
+	}
+	if m.mode == MirrorModeCompare && (r.Expired == nil || r.Expired.IsFalse()) {
+		t.expect = resp
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return
+	}
+	select {
+	case m.input <- t:
+	default:
+		m.stats.dropped.Incr()
+	}
+}
+
+func (m *trafficMirror) loopWriter() {
+	defer func() {
+		for _, bc := range m.conns {
+			bc.Close()
+		}
+		close(m.output)
+	}()
+	for t := range m.input {
+		bc := m.conns[t.r.Database]
+		if bc == nil {
+			bc = NewBackendConn(m.addr, int(t.r.Database), m.config)
+			m.conns[t.r.Database] = bc
+		}
+		bc.PushBack(t.r)
+		m.stats.sent.Incr()
+		m.output <- t
+	}
+}
+
+func (m *trafficMirror) loopReader() {
+	for t := range m.output {
+		t.r.Batch.Wait()
+		switch {
+		case t.r.Err != nil:
+			m.stats.errors.Incr()
+		case t.expect != nil && !equalResp(t.expect, t.r.Resp):
+			m.stats.mismatches.Incr()
+			log.Debugf("mirror to %s mismatched: command = %s, database = %d",
+				m.addr, t.r.OpStr, t.r.Database)
+		}
+	}
+}
+
+func (m *trafficMirror) Close() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	m.closed = true
+	close(m.input)
+}
+
+func equalResp(a, b *redis.Resp) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Type != b.Type || !bytes.Equal(a.Value, b.Value) || len(a.Array) != len(b.Array) {
+		return false
+	}
+	for i := range a.Array {
+		if !equalResp(a.Array[i], b.Array[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+type MirrorStats struct {
+	Addr       string `json:"addr"`
+	Mode       string `json:"mode"`
+	Sent       int64  `json:"sent"`
+	Dropped    int64  `json:"dropped"`
+	Errors     int64  `json:"errors"`
+	Mismatches int64  `json:"mismatches,omitempty"`
+}
+
+func (m *trafficMirror) Stats() *MirrorStats {
+	if m == nil {
+		return nil
+	}
+	return &MirrorStats{
+		Addr: m.addr, Mode: m.mode,
+		Sent:       m.stats.sent.Int64(),
+		Dropped:    m.stats.dropped.Int64(),
+		Errors:     m.stats.errors.Int64(),
+		Mismatches: m.stats.mismatches.Int64(),
+	}
+}
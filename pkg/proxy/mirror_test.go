@@ -0,0 +1,56 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/proxy/redis"
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+)
+
+func TestMirrorSample(t *testing.T) {
+	config := NewDefaultConfig()
+	assert.Must(newTrafficMirror(config) == nil)
+	assert.Must(!newTrafficMirror(config).sample(newCacheRequest("SET", "a", "1")))
+
+	m := &trafficMirror{mode: MirrorModeWrite, rate: 25}
+	var n int
+	for i := 0; i < 100; i++ {
+		if m.sample(newCacheRequest("SET", "a", "1")) {
+			n++
+		}
+	}
+	assert.Must(n == 25)
+	assert.Must(!m.sample(newCacheRequest("GET", "a")))
+	assert.Must(!m.sample(newCacheRequest("PING")))
+
+	m = &trafficMirror{mode: MirrorModeAll, rate: 100, prefixes: [][]byte{[]byte("user:")}}
+	assert.Must(m.sample(newCacheRequest("GET", "user:1")))
+	assert.Must(!m.sample(newCacheRequest("GET", "item:1")))
+}
+
+func TestMirrorCompare(t *testing.T) {
+	l := newHedgeBackend(true)
+	defer l.Close()
+
+	config := NewDefaultConfig()
+	config.MirrorAddr = l.Addr().String()
+	config.MirrorMode = MirrorModeCompare
+	m := newTrafficMirror(config)
+	defer m.Close()
+
+	m.push(newCacheRequest("SET", "a", "1"), RespOK)
+	m.push(newCacheRequest("GET", "a"), redis.NewBulkBytes([]byte("1")))
+
+	for i := 0; i < 100 && m.stats.mismatches.Int64() == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	s := m.Stats()
+	assert.Must(s.Sent == 2 && s.Errors == 0 && s.Mismatches == 1)
+
+	assert.Must(equalResp(redis.NewArray([]*redis.Resp{RespOK}), redis.NewArray([]*redis.Resp{RespOK})))
+	assert.Must(!equalResp(RespOK, nil))
+}
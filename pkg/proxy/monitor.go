@@ -0,0 +1,195 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/proxy/redis"
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/sync2/atomic2"
+)
+
+const (
+	maxMonitorBuffered = 1024
+	maxMonitorArgs     = 8
+	maxMonitorArgLen   = 64
+)
+
+type MonitorFilter struct {
+	Commands []string `json:"commands,omitempty"`
+	Prefix   string   `json:"prefix,omitempty"`
+	Client   string   `json:"client,omitempty"`
+	Sample   float64  `json:"sample,omitempty"`
+}
+
+func (f *MonitorFilter) Encode() url.Values {
+	var q = url.Values{}
+	if len(f.Commands) != 0 {
+		q.Set("cmd", strings.Join(f.Commands, ","))
+	}
+	if f.Prefix != "" {
+		q.Set("prefix", f.Prefix)
+	}
+	if f.Client != "" {
+		q.Set("client", f.Client)
+	}
+	if f.Sample != 0 {
+		q.Set("sample", strconv.FormatFloat(f.Sample, 'f', -1, 64))
+	}
+	return q
+}
+
+func DecodeMonitorFilter(q url.Values) (*MonitorFilter, error) {
+	var f = &MonitorFilter{}
+	for _, s := range strings.Split(q.Get("cmd"), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			f.Commands = append(f.Commands, strings.ToUpper(s))
+		}
+	}
+	f.Prefix = q.Get("prefix")
+	f.Client = q.Get("client")
+	if s := q.Get("sample"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v < 0 || v > 1 {
+			return nil, errors.Errorf("invalid sample = %s", s)
+		}
+		f.Sample = v
+	}
+	return f, nil
+}
+
+type MonitorEvent struct {
+	Time     string   `json:"time"`
+	Client   string   `json:"client"`
+	Database int32    `json:"db"`
+	Command  string   `json:"cmd"`
+	Args     []string `json:"args,omitempty"`
+	Status   string   `json:"status"`
+	Error    string   `json:"error,omitempty"`
+	Duration int64    `json:"us"`
+	Dropped  int64    `json:"dropped,omitempty"`
+}
+
+type monitorWatcher struct {
+	filter   *MonitorFilter
+	commands map[string]bool
+	prefix   []byte
+
+	events  chan *MonitorEvent
+	dropped atomic2.Int64
+}
+
+func (w *monitorWatcher) match(r *Request, client string) bool {
+	if len(w.commands) != 0 && !w.commands[r.OpStr] {
+		return false
+	}
+	if len(w.prefix) != 0 && !bytes.HasPrefix(getHashKey(r.Multi, r.OpStr), w.prefix) {
+		return false
+	}
+	if w.filter.Client != "" && !strings.HasPrefix(client, w.filter.Client) {
+		return false
+	}
+	if s := w.filter.Sample; s != 0 && s < 1 && rand.Float64() >= s {
+		return false
+	}
+	return true
+}
+
+func (w *monitorWatcher) publish(e *MonitorEvent) {
+	select {
+	case w.events <- e:
+	default:
+		w.dropped.Incr()
+	}
+}
+
+type monitorHub struct {
+	mu sync.RWMutex
+
+	watchers map[*monitorWatcher]struct{}
+	active   atomic2.Int64
+}
+
+func (h *monitorHub) watch(f *MonitorFilter) *monitorWatcher {
+	w := &monitorWatcher{filter: f, prefix: []byte(f.Prefix)}
+	w.events = make(chan *MonitorEvent, maxMonitorBuffered)
+	if len(f.Commands) != 0 {
+		w.commands = make(map[string]bool)
+		for _, opstr := range f.Commands {
+			w.commands[opstr] = true
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.watchers == nil {
+		h.watchers = make(map[*monitorWatcher]struct{})
+	}
+	h.watchers[w] = struct{}{}
+	h.active.Set(int64(len(h.watchers)))
+	return w
+}
+
+func (h *monitorHub) unwatch(w *monitorWatcher) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.watchers, w)
+	h.active.Set(int64(len(h.watchers)))
+}
+
+func (h *monitorHub) match(r *Request, client string) []*monitorWatcher {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var matched []*monitorWatcher
+	for w := range h.watchers {
+		if w.match(r, client) {
+			matched = append(matched, w)
+		}
+	}
+	return matched
+}
+
+func (s *Session) publishMonitor(r *Request, resp *redis.Resp, err error) {
+	e := &MonitorEvent{
+		Time:     time.Unix(0, r.UnixNano).Format("2006-01-02 15:04:05.000000"),
+		Client:   s.Conn.RemoteAddr(),
+		Database: r.Database,
+		Command:  r.OpStr,
+		Duration: (time.Now().UnixNano() - r.UnixNano) / int64(time.Microsecond),
+	}
+	for i, arg := range r.Multi[1:] {
+		if r.OpStr == "AUTH" {
+			e.Args = []string{"(redacted)"}
+			break
+		}
+		if i == maxMonitorArgs {
+			e.Args = append(e.Args, "...")
+			break
+		}
+		if len(arg.Value) > maxMonitorArgLen {
+			e.Args = append(e.Args, string(arg.Value[:maxMonitorArgLen])+"...")
+		} else {
+			e.Args = append(e.Args, string(arg.Value))
+		}
+	}
+	switch {
+	case err != nil:
+		e.Status, e.Error = "fail", err.Error()
+	case resp.IsError():
+		e.Status, e.Error = "error", string(resp.Value)
+	default:
+		e.Status = "ok"
+	}
+	for _, w := range r.monitors {
+		x := *e
+		x.Dropped = w.dropped.Int64()
+		w.publish(&x)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/proxy/redis"
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+)
+
+func TestMonitorFilter(t *testing.T) {
+	q := url.Values{}
+	q.Set("cmd", "get, Set")
+	q.Set("prefix", "user:")
+	q.Set("client", "10.0.0.1")
+	f, err := DecodeMonitorFilter(q)
+	assert.MustNoError(err)
+	assert.Must(len(f.Commands) == 2 && f.Commands[1] == "SET")
+
+	g, err := DecodeMonitorFilter(f.Encode())
+	assert.MustNoError(err)
+	assert.Must(g.Prefix == f.Prefix && g.Client == f.Client && len(g.Commands) == 2)
+
+	q.Set("sample", "2")
+	_, err = DecodeMonitorFilter(q)
+	assert.Must(err != nil)
+
+	var h monitorHub
+	w := h.watch(f)
+	assert.Must(h.active.Int64() == 1)
+	assert.Must(len(h.match(newCacheRequest("GET", "user:1"), "10.0.0.1:5000")) == 1)
+	assert.Must(len(h.match(newCacheRequest("GET", "user:1"), "10.0.0.2:5000")) == 0)
+	assert.Must(len(h.match(newCacheRequest("GET", "item:1"), "10.0.0.1:5000")) == 0)
+	assert.Must(len(h.match(newCacheRequest("HGET", "user:1", "a"), "10.0.0.1:5000")) == 0)
+
+	for i := 0; i < maxMonitorBuffered+10; i++ {
+		w.publish(&MonitorEvent{})
+	}
+	assert.Must(w.dropped.Int64() == 10)
+
+	h.unwatch(w)
+	assert.Must(h.active.Int64() == 0)
+}
+
+func TestMonitorStream(t *testing.T) {
+	s, addr := openProxy()
+	defer s.Close()
+	assert.MustNoError(s.Start())
+
+	c := NewApiClient(addr)
+	c.SetXAuth(config.ProductName, config.ProductAuth, s.Model().Token)
+
+	events := make(chan *MonitorEvent, 16)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.Monitor(&MonitorFilter{Commands: []string{"SELECT"}}, func(e *MonitorEvent) error {
+			events <- e
+			return nil
+		})
+	}()
+	for i := 0; i < 100 && s.router.monitors.active.Int64() == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Must(s.router.monitors.active.Int64() == 1)
+
+	sock, err := net.Dial("tcp", s.Model().ProxyAddr)
+	assert.MustNoError(err)
+	defer sock.Close()
+
+	conn := redis.NewConn(sock, 1024, 1024)
+	for _, args := range [][]string{{"CODIS", "READPREF"}, {"SELECT", "1"}} {
+		var multi []*redis.Resp
+		for _, arg := range args {
+			multi = append(multi, redis.NewBulkBytes([]byte(arg)))
+		}
+		assert.MustNoError(conn.EncodeMultiBulk(multi, true))
+		_, err := conn.Decode()
+		assert.MustNoError(err)
+	}
+
+	select {
+	case e := <-events:
+		assert.Must(e.Command == "SELECT" && e.Status == "ok" && e.Database == 0)
+		assert.Must(len(e.Args) == 1 && e.Args[0] == "1")
+	case <-time.After(time.Second * 5):
+		assert.Must(false)
+	}
+
+	s.Close()
+	select {
+	case err := <-errs:
+		assert.MustNoError(err)
+	case <-time.After(time.Second * 5):
+		assert.Must(false)
+	}
+}
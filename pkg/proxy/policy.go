@@ -0,0 +1,88 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/CodisLabs/codis/pkg/models"
+	"github.com/CodisLabs/codis/pkg/proxy/redis"
+)
+
+type commandPolicy struct {
+	model *models.CommandPolicy
+
+	deny   map[string]bool
+	allow  map[string]bool
+	limits map[string]*models.CommandLimit
+}
+
+func newCommandPolicy(m *models.CommandPolicy) (*commandPolicy, error) {
+	if m == nil {
+		m = &models.CommandPolicy{}
+	}
+	m.Normalize()
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	p := &commandPolicy{model: m}
+	p.deny = make(map[string]bool)
+	for _, opstr := range m.Deny {
+		p.deny[opstr] = true
+	}
+	if len(m.Allow) != 0 {
+		p.allow = make(map[string]bool)
+		for _, opstr := range m.Allow {
+			p.allow[opstr] = true
+		}
+	}
+	p.limits = make(map[string]*models.CommandLimit)
+	for _, l := range m.Limits {
+		p.limits[l.Command] = l
+	}
+	return p, nil
+}
+
+func (p *commandPolicy) check(r *Request) error {
+	if models.IsPolicyExempt(r.OpStr) {
+		return nil
+	}
+	if p.deny[r.OpStr] {
+		return fmt.Errorf("command '%s' is denied by policy", r.OpStr)
+	}
+	if p.allow != nil && !p.allow[r.OpStr] {
+		return fmt.Errorf("command '%s' is not in the allow list of policy", r.OpStr)
+	}
+	l := p.limits[r.OpStr]
+	if l == nil {
+		return nil
+	}
+	if l.MaxArgs != 0 && len(r.Multi)-1 > l.MaxArgs {
+		return fmt.Errorf("command '%s' has too many arguments, limit = %d", r.OpStr, l.MaxArgs)
+	}
+	if l.MaxRange != 0 && len(r.Multi) >= 4 {
+		if n, ok := rangeSpan(r.Multi[2], r.Multi[3]); !ok || n > l.MaxRange {
+			return fmt.Errorf("command '%s' has too large range, limit = %d", r.OpStr, l.MaxRange)
+		}
+	}
+	return nil
+}
+
+func rangeSpan(beg, end *redis.Resp) (int64, bool) {
+	start, err := redis.Btoi64(beg.Value)
+	if err != nil {
+		return 0, false
+	}
+	stop, err := redis.Btoi64(end.Value)
+	if err != nil {
+		return 0, false
+	}
+	if (start < 0) != (stop < 0) {
+		return 0, false
+	}
+	if stop < start {
+		return 0, true
+	}
+	return stop - start + 1, true
+}
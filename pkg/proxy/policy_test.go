@@ -0,0 +1,58 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+
+	"github.com/CodisLabs/codis/pkg/models"
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+)
+
+func TestCommandPolicyDeny(t *testing.T) {
+	p, err := newCommandPolicy(&models.CommandPolicy{
+		Deny: []string{"keys", " FlushAll "},
+	})
+	assert.MustNoError(err)
+	assert.Must(p.check(newCacheRequest("KEYS", "*")) != nil)
+	assert.Must(p.check(newCacheRequest("FLUSHALL")) != nil)
+	assert.MustNoError(p.check(newCacheRequest("GET", "foo")))
+	assert.MustNoError(p.check(newCacheRequest("PING")))
+
+	_, err = newCommandPolicy(&models.CommandPolicy{Deny: []string{"auth"}})
+	assert.Must(err != nil)
+}
+
+func TestCommandPolicyAllow(t *testing.T) {
+	p, err := newCommandPolicy(&models.CommandPolicy{
+		Allow: []string{"GET", "SET"},
+	})
+	assert.MustNoError(err)
+	assert.MustNoError(p.check(newCacheRequest("GET", "foo")))
+	assert.MustNoError(p.check(newCacheRequest("SELECT", "0")))
+	assert.Must(p.check(newCacheRequest("HGETALL", "foo")) != nil)
+}
+
+func TestCommandPolicyLimits(t *testing.T) {
+	p, err := newCommandPolicy(&models.CommandPolicy{
+		Limits: []*models.CommandLimit{
+			{Command: "lrange", MaxRange: 100},
+			{Command: "hmget", MaxArgs: 3},
+		},
+	})
+	assert.MustNoError(err)
+	assert.MustNoError(p.check(newCacheRequest("LRANGE", "foo", "0", "99")))
+	assert.MustNoError(p.check(newCacheRequest("LRANGE", "foo", "-10", "-1")))
+	assert.Must(p.check(newCacheRequest("LRANGE", "foo", "0", "100")) != nil)
+	assert.Must(p.check(newCacheRequest("LRANGE", "foo", "0", "-1")) != nil)
+	assert.Must(p.check(newCacheRequest("LRANGE", "foo", "0", "x")) != nil)
+
+	assert.MustNoError(p.check(newCacheRequest("HMGET", "foo", "f1", "f2")))
+	assert.Must(p.check(newCacheRequest("HMGET", "foo", "f1", "f2", "f3")) != nil)
+
+	_, err = newCommandPolicy(&models.CommandPolicy{
+		Limits: []*models.CommandLimit{{Command: "GET", MaxRange: 1}},
+	})
+	assert.Must(err != nil)
+}
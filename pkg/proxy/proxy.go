@@ -38,6 +38,10 @@ type Proxy struct {
 	online bool
 	closed bool
 
+	draining bool
+
+	unregister func(timeout time.Duration) error
+
 	config *Config
 	router *Router
 	ignore []byte
@@ -51,6 +55,8 @@ type Proxy struct {
 		servers []string
 	}
 	jodis *Jodis
+
+	cachebus *cacheBus
 }
 
 var ErrClosedProxy = errors.New("use of closed proxy")
@@ -104,8 +110,8 @@ func New(config *Config) (*Proxy, error) {
 
 func (s *Proxy) setup(config *Config) error {
 	proto := config.ProtoType
-	if l, err := net.Listen(proto, config.ProxyAddr); err != nil {
-		return errors.Trace(err)
+	if l, err := newListener(proto, config.ProxyAddr, 0); err != nil {
+		return err
 	} else {
 		s.lproxy = l
 
@@ -118,8 +124,8 @@ func (s *Proxy) setup(config *Config) error {
 	}
 
 	proto = "tcp"
-	if l, err := net.Listen(proto, config.AdminAddr); err != nil {
-		return errors.Trace(err)
+	if l, err := newListener(proto, config.AdminAddr, 1); err != nil {
+		return err
 	} else {
 		s.ladmin = l
 
@@ -154,6 +160,14 @@ func (s *Proxy) setup(config *Config) error {
 		s.jodis = NewJodis(c, s.model)
 	}
 
+	if config.CacheBroadcast && s.router.cache != nil {
+		c, err := models.NewClient(config.JodisName, config.JodisAddr, config.JodisAuth, config.JodisTimeout.Duration())
+		if err != nil {
+			return err
+		}
+		s.cachebus = newCacheBus(c, config.ProductName, s.model.Token, s.router.cache)
+	}
+
 	return nil
 }
 
@@ -171,6 +185,9 @@ func (s *Proxy) Start() error {
 	if s.jodis != nil {
 		s.jodis.Start()
 	}
+	if s.cachebus != nil {
+		s.cachebus.Start(s.config.CacheBroadcastPeriod.Duration())
+	}
 	return nil
 }
 
@@ -186,6 +203,9 @@ func (s *Proxy) Close() error {
 	if s.jodis != nil {
 		s.jodis.Close()
 	}
+	if s.cachebus != nil {
+		s.cachebus.Close()
+	}
 	if s.ladmin != nil {
 		s.ladmin.Close()
 	}
@@ -260,6 +280,46 @@ func (s *Proxy) FillSlots(slots []*models.Slot) error {
 	return nil
 }
 
+func (s *Proxy) CommandPolicy() *models.CommandPolicy {
+	return s.router.GetCommandPolicy()
+}
+
+func (s *Proxy) SetUnregister(fn func(timeout time.Duration) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unregister = fn
+}
+
+func (s *Proxy) SetCommandPolicy(p *models.CommandPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosedProxy
+	}
+	if err := s.router.SetCommandPolicy(p); err != nil {
+		return err
+	}
+	log.Warnf("[%p] set command policy:\n%s", s, p.Encode())
+	return nil
+}
+
+func (s *Proxy) RateLimits() []*RateLimitStats {
+	return s.router.limiter.Limits()
+}
+
+func (s *Proxy) SetRateLimits(limits []*RateLimit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosedProxy
+	}
+	if err := s.router.limiter.SetLimits(limits); err != nil {
+		return err
+	}
+	log.Warnf("[%p] set ratelimits = %v", s, limits)
+	return nil
+}
+
 func (s *Proxy) SwitchMasters(masters map[int]string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -389,6 +449,11 @@ func (s *Proxy) serveAdmin() {
 	case <-s.exit.C:
 		log.Warnf("[%p] admin shutdown", s)
 	case err := <-eh:
+		if s.IsDraining() {
+			log.Warnf("[%p] admin stop service, draining", s)
+			<-s.exit.C
+			return
+		}
 		log.ErrorErrorf(err, "[%p] admin exit on error", s)
 	}
 }
@@ -423,6 +488,11 @@ func (s *Proxy) serveProxy() {
 	case <-s.exit.C:
 		log.Warnf("[%p] proxy shutdown", s)
 	case err := <-eh:
+		if s.IsDraining() {
+			log.Warnf("[%p] proxy stop accepting, draining", s)
+			<-s.exit.C
+			return
+		}
 		log.ErrorErrorf(err, "[%p] proxy exit on error", s)
 	}
 }
@@ -471,6 +541,12 @@ type Stats struct {
 	Online bool `json:"online"`
 	Closed bool `json:"closed"`
 
+	Draining bool `json:"draining,omitempty"`
+
+	Epoch int64 `json:"epoch"`
+
+	SyncedEpoch int64 `json:"synced_epoch"`
+
 	Sentinels struct {
 		Servers  []string          `json:"servers,omitempty"`
 		Masters  map[string]string `json:"masters,omitempty"`
@@ -500,9 +576,29 @@ type Stats struct {
 	} `json:"rusage"`
 
 	Backend struct {
-		PrimaryOnly bool `json:"primary_only"`
+		PrimaryOnly bool            `json:"primary_only"`
+		Servers     []*BackendStats `json:"servers,omitempty"`
+		Hedge       *HedgeStats     `json:"hedge,omitempty"`
 	} `json:"backend"`
 
+	Cache struct {
+		Enabled     bool  `json:"enabled"`
+		Entries     int64 `json:"entries"`
+		Hits        int64 `json:"hits"`
+		Misses      int64 `json:"misses"`
+		Evicts      int64 `json:"evicts"`
+		Invalidates int64 `json:"invalidates"`
+	} `json:"cache"`
+
+	Mirror *MirrorStats `json:"mirror,omitempty"`
+	Trace  *TraceStats  `json:"trace,omitempty"`
+
+	RateLimit struct {
+		Delayed  int64             `json:"delayed"`
+		Rejected int64             `json:"rejected"`
+		Rules    []*RateLimitStats `json:"rules,omitempty"`
+	} `json:"ratelimit"`
+
 	Runtime *RuntimeStats `json:"runtime,omitempty"`
 }
 
@@ -567,6 +663,9 @@ func (s *Proxy) Stats(flags StatsFlags) *Stats {
 	stats := &Stats{}
 	stats.Online = s.IsOnline()
 	stats.Closed = s.IsClosed()
+	stats.Draining = s.IsDraining()
+	stats.Epoch = s.router.Epoch()
+	stats.SyncedEpoch = s.router.SyncedEpoch()
 
 	servers, masters := s.GetSentinels()
 	if servers != nil {
@@ -600,6 +699,24 @@ func (s *Proxy) Stats(flags StatsFlags) *Stats {
 	}
 
 	stats.Backend.PrimaryOnly = s.Config().BackendPrimaryOnly
+	stats.Backend.Servers = s.router.BackendStats()
+	stats.Backend.Hedge = s.router.hedger.Stats()
+
+	if c := s.router.cache; c != nil {
+		stats.Cache.Enabled = true
+		stats.Cache.Entries = c.Entries()
+		stats.Cache.Hits = c.stats.hits.Int64()
+		stats.Cache.Misses = c.stats.misses.Int64()
+		stats.Cache.Evicts = c.stats.evicts.Int64()
+		stats.Cache.Invalidates = c.stats.invalidates.Int64()
+	}
+
+	stats.Mirror = s.router.mirror.Stats()
+	stats.Trace = s.router.tracer.Stats()
+
+	stats.RateLimit.Delayed = s.router.limiter.delayed.Int64()
+	stats.RateLimit.Rejected = s.router.limiter.rejected.Int64()
+	stats.RateLimit.Rules = s.RateLimits()
 
 	if flags.HasBit(StatsRuntime) {
 		var r runtime.MemStats
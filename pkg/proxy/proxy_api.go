@@ -4,10 +4,14 @@
 package proxy
 
 import (
+	"bufio"
+	"encoding/json"
+	"io"
 	"net/http"
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	_ "net/http/pprof"
 
@@ -45,7 +49,11 @@ func newApiServer(p *Proxy) http.Handler {
 		}
 		c.Next()
 	})
-	m.Use(gzip.All())
+	m.Use(func(c martini.Context, req *http.Request) {
+		if !strings.HasPrefix(req.URL.Path, "/api/proxy/monitor/") {
+			c.Invoke(gzip.All())
+		}
+	})
 	m.Use(func(c martini.Context, w http.ResponseWriter) {
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	})
@@ -76,10 +84,18 @@ func newApiServer(p *Proxy) http.Handler {
 		r.Put("/stats/reset/:xauth", api.ResetStats)
 		r.Put("/forcegc/:xauth", api.ForceGC)
 		r.Put("/shutdown/:xauth", api.Shutdown)
+		r.Put("/drain/:xauth/:timeout", api.Drain)
+		r.Get("/monitor/:xauth", api.Monitor)
+		r.Get("/clients/:xauth", api.Clients)
+		r.Put("/clients/kill/:xauth/:id", api.KillClient)
 		r.Put("/loglevel/:xauth/:value", api.LogLevel)
 		r.Put("/fillslots/:xauth", binding.Json([]*models.Slot{}), api.FillSlots)
 		r.Put("/sentinels/:xauth", binding.Json(models.Sentinel{}), api.SetSentinels)
 		r.Put("/sentinels/:xauth/rewatch", api.RewatchSentinels)
+		r.Get("/policy/:xauth", api.CommandPolicy)
+		r.Put("/policy/:xauth", binding.Json(models.CommandPolicy{}), api.SetCommandPolicy)
+		r.Get("/ratelimit/:xauth", api.RateLimits)
+		r.Put("/ratelimit/:xauth", binding.Json([]*RateLimit{}), api.SetRateLimits)
 	})
 
 	m.MapTo(r, (*martini.Routes)(nil))
@@ -205,6 +221,44 @@ func (s *apiServer) Shutdown(params martini.Params) (int, string) {
 	}
 }
 
+func (s *apiServer) Drain(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	n, err := strconv.Atoi(params["timeout"])
+	if err != nil || n < 0 {
+		return rpc.ApiResponseError(errors.New("invalid timeout"))
+	}
+	if err := s.proxy.Drain(time.Second * time.Duration(n)); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson("OK")
+	}
+}
+
+func (s *apiServer) Clients(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(s.proxy.Clients())
+	}
+}
+
+func (s *apiServer) KillClient(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	id, err := strconv.ParseInt(params["id"], 10, 64)
+	if err != nil {
+		return rpc.ApiResponseError(errors.New("invalid client id"))
+	}
+	if err := s.proxy.KillClient(id); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson("OK")
+	}
+}
+
 func (s *apiServer) FillSlots(slots []*models.Slot, params martini.Params) (int, string) {
 	if err := s.verifyXAuth(params); err != nil {
 		return rpc.ApiResponseError(err)
@@ -235,6 +289,82 @@ func (s *apiServer) RewatchSentinels(params martini.Params) (int, string) {
 	return rpc.ApiResponseJson("OK")
 }
 
+func (s *apiServer) CommandPolicy(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(s.proxy.CommandPolicy())
+	}
+}
+
+func (s *apiServer) SetCommandPolicy(policy models.CommandPolicy, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.proxy.SetCommandPolicy(&policy); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson("OK")
+}
+
+func (s *apiServer) RateLimits(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(s.proxy.RateLimits())
+	}
+}
+
+func (s *apiServer) SetRateLimits(limits []*RateLimit, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.proxy.SetRateLimits(limits); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson("OK")
+}
+
+func (s *apiServer) Monitor(params martini.Params, w http.ResponseWriter, req *http.Request) {
+	f, err := DecodeMonitorFilter(req.URL.Query())
+	if err == nil {
+		err = s.verifyXAuth(params)
+	}
+	if err != nil {
+		code, body := rpc.ApiResponseError(err)
+		w.WriteHeader(code)
+		w.Write([]byte(body))
+		return
+	}
+	hub := &s.proxy.router.monitors
+	watcher := hub.watch(f)
+	defer hub.unwatch(watcher)
+
+	w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case e := <-watcher.events:
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+			if flusher != nil && len(watcher.events) == 0 {
+				flusher.Flush()
+			}
+		case <-req.Context().Done():
+			return
+		case <-s.proxy.exit.C:
+			return
+		}
+	}
+}
+
 type ApiClient struct {
 	addr  string
 	xauth string
@@ -327,6 +457,61 @@ func (c *ApiClient) Shutdown() error {
 	return rpc.ApiPutJson(url, nil, nil)
 }
 
+func (c *ApiClient) Drain(timeout time.Duration) error {
+	url := c.encodeURL("/api/proxy/drain/%s/%d", c.xauth, int64(timeout/time.Second))
+	return rpc.ApiPutJson(url, nil, nil)
+}
+
+func (c *ApiClient) Clients() ([]*ClientInfo, error) {
+	url := c.encodeURL("/api/proxy/clients/%s", c.xauth)
+	var clients []*ClientInfo
+	if err := rpc.ApiGetJson(url, &clients); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (c *ApiClient) KillClient(id int64) error {
+	url := c.encodeURL("/api/proxy/clients/kill/%s/%d", c.xauth, id)
+	return rpc.ApiPutJson(url, nil, nil)
+}
+
+func (c *ApiClient) Monitor(f *MonitorFilter, handler func(e *MonitorEvent) error) error {
+	url := c.encodeURL("/api/proxy/monitor/%s", c.xauth)
+	if q := f.Encode(); len(q) != 0 {
+		url += "?" + q.Encode()
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	req.Header.Set("Accept-Encoding", "identity")
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		b, _ := bufio.NewReader(rsp.Body).ReadString('\n')
+		return errors.Errorf("monitor failed, status = %d, %s", rsp.StatusCode, strings.TrimSpace(b))
+	}
+	dec := json.NewDecoder(rsp.Body)
+	for {
+		e := &MonitorEvent{}
+		if err := dec.Decode(e); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.Trace(err)
+		}
+		if err := handler(e); err != nil {
+			return err
+		}
+	}
+}
+
 func (c *ApiClient) FillSlots(slots ...*models.Slot) error {
 	url := c.encodeURL("/api/proxy/fillslots/%s", c.xauth)
 	return rpc.ApiPutJson(url, slots, nil)
@@ -341,3 +526,31 @@ func (c *ApiClient) RewatchSentinels() error {
 	url := c.encodeURL("/api/proxy/sentinels/%s/rewatch", c.xauth)
 	return rpc.ApiPutJson(url, nil, nil)
 }
+
+func (c *ApiClient) CommandPolicy() (*models.CommandPolicy, error) {
+	url := c.encodeURL("/api/proxy/policy/%s", c.xauth)
+	policy := &models.CommandPolicy{}
+	if err := rpc.ApiGetJson(url, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (c *ApiClient) SetCommandPolicy(policy *models.CommandPolicy) error {
+	url := c.encodeURL("/api/proxy/policy/%s", c.xauth)
+	return rpc.ApiPutJson(url, policy, nil)
+}
+
+func (c *ApiClient) RateLimits() ([]*RateLimitStats, error) {
+	url := c.encodeURL("/api/proxy/ratelimit/%s", c.xauth)
+	limits := []*RateLimitStats{}
+	if err := rpc.ApiGetJson(url, &limits); err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+func (c *ApiClient) SetRateLimits(limits ...*RateLimit) error {
+	url := c.encodeURL("/api/proxy/ratelimit/%s", c.xauth)
+	return rpc.ApiPutJson(url, limits, nil)
+}
@@ -110,6 +110,77 @@ func TestFillSlot(x *testing.T) {
 	verifySlots(c, expect)
 }
 
+func TestFillSlotEpoch(x *testing.T) {
+	s, addr := openProxy()
+	defer s.Close()
+
+	var c = NewApiClient(addr)
+	c.SetXAuth(config.ProductName, config.ProductAuth, s.Model().Token)
+
+	fill := func(epoch int64) error {
+		slots := []*models.Slot{}
+		for i := 0; i < 4; i++ {
+			slots = append(slots, &models.Slot{Id: i, BackendAddr: "x.x.x.x:xxxx", Epoch: epoch})
+		}
+		return c.FillSlots(slots...)
+	}
+	epoch := func() int64 {
+		stats, err := c.StatsSimple()
+		assert.MustNoError(err)
+		return stats.Epoch
+	}
+
+	assert.MustNoError(fill(10))
+	assert.Must(epoch() == 10)
+	assert.MustNoError(fill(10))
+	assert.Must(fill(9) != nil)
+	assert.Must(epoch() == 10)
+
+	assert.MustNoError(fill(0))
+	assert.Must(epoch() == 10)
+	assert.MustNoError(fill(11))
+	assert.Must(epoch() == 11)
+
+	slots, err := c.Slots()
+	assert.MustNoError(err)
+	assert.Must(slots[0].Epoch == 11 && slots[4].Epoch == 0)
+}
+
+func TestFillSlotSyncedEpoch(x *testing.T) {
+	s, addr := openProxy()
+	defer s.Close()
+
+	var c = NewApiClient(addr)
+	c.SetXAuth(config.ProductName, config.ProductAuth, s.Model().Token)
+
+	fill := func(sid int, epoch, prev int64) {
+		assert.MustNoError(c.FillSlots(&models.Slot{Id: sid, Epoch: epoch, PrevEpoch: prev}))
+	}
+	synced := func() int64 {
+		stats, err := c.StatsSimple()
+		assert.MustNoError(err)
+		return stats.SyncedEpoch
+	}
+
+	fill(0, 3, 3)
+	assert.Must(synced() == 3)
+	fill(0, 4, 2)
+	assert.Must(synced() == 4)
+	fill(1, 4, 2)
+	assert.Must(synced() == 4)
+
+	// the fill of epoch = 5 is missed
+	fill(1, 6, 5)
+	assert.Must(synced() == 4)
+	fill(2, 7, 6)
+	assert.Must(synced() == 4)
+	fill(3, 8, 0)
+	assert.Must(synced() == 4)
+
+	fill(0, 9, 9)
+	assert.Must(synced() == 9)
+}
+
 func TestStartAndShutdown(x *testing.T) {
 	s, addr := openProxy()
 	defer s.Close()
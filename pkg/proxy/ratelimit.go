@@ -0,0 +1,403 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/proxy/redis"
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/sync2/atomic2"
+)
+
+const (
+	RateLimitUser   = "user"
+	RateLimitClient = "client"
+	RateLimitClass  = "class"
+	RateLimitPrefix = "prefix"
+
+	RateLimitReject = "reject"
+	RateLimitDelay  = "delay"
+)
+
+type RateLimit struct {
+	Kind  string  `json:"kind"`
+	Match string  `json:"match,omitempty"`
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst,omitempty"`
+
+	Action     string `json:"action,omitempty"`
+	MaxDelayMs int64  `json:"max_delay_ms,omitempty"`
+}
+
+func (l *RateLimit) String() string {
+	if l.Match == "" {
+		return fmt.Sprintf("%s=*", l.Kind)
+	}
+	return fmt.Sprintf("%s=%s", l.Kind, l.Match)
+}
+
+// ParseRateLimit parses rules of config, e.g. "user=batch rate=1000 burst=100"
+// or "class=write rate=5000 action=delay max_delay_ms=10".
+func ParseRateLimit(s string) (*RateLimit, error) {
+	var fields = strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, errors.Errorf("invalid ratelimit '%s'", s)
+	}
+	var l = &RateLimit{}
+	l.Kind = fields[0]
+	if i := strings.IndexByte(l.Kind, '='); i >= 0 {
+		l.Kind, l.Match = l.Kind[:i], l.Kind[i+1:]
+		if l.Match == "*" {
+			l.Match = ""
+		}
+	}
+	for _, f := range fields[1:] {
+		i := strings.IndexByte(f, '=')
+		if i < 0 {
+			return nil, errors.Errorf("invalid ratelimit '%s', bad field '%s'", s, f)
+		}
+		var err error
+		switch key, value := f[:i], f[i+1:]; key {
+		case "rate":
+			l.Rate, err = strconv.ParseFloat(value, 64)
+		case "burst":
+			l.Burst, err = strconv.Atoi(value)
+		case "action":
+			l.Action = value
+		case "max_delay_ms":
+			l.MaxDelayMs, err = strconv.ParseInt(value, 10, 64)
+		default:
+			err = errors.Errorf("unknown field '%s'", key)
+		}
+		if err != nil {
+			return nil, errors.Errorf("invalid ratelimit '%s', %s", s, err)
+		}
+	}
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func ParseRateLimits(list []string) ([]*RateLimit, error) {
+	var limits []*RateLimit
+	for _, s := range list {
+		l, err := ParseRateLimit(s)
+		if err != nil {
+			return nil, err
+		}
+		limits = append(limits, l)
+	}
+	return limits, nil
+}
+
+func (l *RateLimit) Validate() error {
+	switch l.Kind {
+	default:
+		return errors.Errorf("invalid ratelimit kind '%s'", l.Kind)
+	case RateLimitUser, RateLimitClient:
+	case RateLimitClass:
+		switch l.Match {
+		default:
+			return errors.Errorf("invalid ratelimit class '%s'", l.Match)
+		case "all", "read", "write":
+		}
+	case RateLimitPrefix:
+		if l.Match == "" {
+			return errors.New("invalid ratelimit prefix, should not be empty")
+		}
+	}
+	if l.Rate <= 0 || math.IsInf(l.Rate, 0) || math.IsNaN(l.Rate) {
+		return errors.Errorf("invalid ratelimit rate of %s", l)
+	}
+	if l.Burst < 0 {
+		return errors.Errorf("invalid ratelimit burst of %s", l)
+	}
+	switch l.Action {
+	default:
+		return errors.Errorf("invalid ratelimit action '%s'", l.Action)
+	case "", RateLimitReject, RateLimitDelay:
+	}
+	if l.MaxDelayMs < 0 {
+		return errors.Errorf("invalid ratelimit max_delay_ms of %s", l)
+	}
+	return nil
+}
+
+type RateLimitStats struct {
+	*RateLimit
+
+	Passed   int64 `json:"passed"`
+	Delayed  int64 `json:"delayed"`
+	Rejected int64 `json:"rejected"`
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   int64
+}
+
+const maxRateLimitBuckets = 1024 * 16
+
+type rateLimitRule struct {
+	mu sync.Mutex
+
+	*RateLimit
+	buckets map[string]*tokenBucket
+
+	// overflow is shared by new identities while buckets are full of busy ones
+	overflow tokenBucket
+	swept    int64
+
+	burst    float64
+	maxDelay int64
+
+	passed   atomic2.Int64
+	delayed  atomic2.Int64
+	rejected atomic2.Int64
+}
+
+func newRateLimitRule(l *RateLimit) *rateLimitRule {
+	x := &rateLimitRule{RateLimit: l}
+	x.buckets = make(map[string]*tokenBucket)
+	x.burst = math.Max(float64(l.Burst), 1)
+	x.maxDelay = l.MaxDelayMs * int64(time.Millisecond)
+	return x
+}
+
+func (x *rateLimitRule) identity(s *Session, r *Request, hkey []byte) (string, bool) {
+	switch x.Kind {
+	case RateLimitUser:
+		return s.user, x.Match == "" || x.Match == s.user
+	case RateLimitClient:
+		return s.clientIP, x.Match == "" || x.Match == s.clientIP
+	case RateLimitClass:
+		switch x.Match {
+		case "read":
+			return "", r.IsReadOnly()
+		case "write":
+			return "", !r.IsReadOnly()
+		}
+		return "", true
+	case RateLimitPrefix:
+		return "", hkey != nil && bytes.HasPrefix(hkey, []byte(x.Match))
+	}
+	return "", false
+}
+
+func (x *rateLimitRule) bucket(id string, now int64) *tokenBucket {
+	b := x.buckets[id]
+	if b == nil {
+		if len(x.buckets) >= maxRateLimitBuckets {
+			x.sweep(now)
+		}
+		if len(x.buckets) < maxRateLimitBuckets {
+			b = &tokenBucket{tokens: x.burst, last: now}
+			x.buckets[id] = b
+		} else {
+			b = &x.overflow
+		}
+	}
+	elapsed := float64(now-b.last) / float64(time.Second)
+	b.tokens = math.Min(x.burst, b.tokens+elapsed*x.Rate)
+	b.last = now
+	return b
+}
+
+// sweep drops buckets that have been refilled to full burst, they are the same
+// as new ones. It runs at most once a second while buckets are busy.
+func (x *rateLimitRule) sweep(now int64) {
+	if now-x.swept < int64(time.Second) {
+		return
+	}
+	x.swept = now
+	for id, b := range x.buckets {
+		if float64(now-b.last)/float64(time.Second)*x.Rate >= x.burst-b.tokens {
+			delete(x.buckets, id)
+		}
+	}
+}
+
+// check returns how long the request should wait, tokens are not taken
+// until all rules have been checked.
+func (x *rateLimitRule) check(id string, now int64) (time.Duration, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	b := x.bucket(id, now)
+	if b.tokens >= 1 {
+		return 0, true
+	}
+	wait := int64((1 - b.tokens) / x.Rate * float64(time.Second))
+	if x.Action != RateLimitDelay || wait > x.maxDelay {
+		x.rejected.Incr()
+		return 0, false
+	}
+	return time.Duration(wait), true
+}
+
+func (x *rateLimitRule) take(id string, now int64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	b := x.bucket(id, now)
+	if b.tokens >= 1 {
+		x.passed.Incr()
+	} else {
+		x.delayed.Incr()
+	}
+	b.tokens -= 1
+}
+
+func (x *rateLimitRule) Stats() *RateLimitStats {
+	return &RateLimitStats{
+		RateLimit: x.RateLimit,
+		Passed:    x.passed.Int64(),
+		Delayed:   x.delayed.Int64(),
+		Rejected:  x.rejected.Int64(),
+	}
+}
+
+type rateLimiter struct {
+	mu    sync.RWMutex
+	rules []*rateLimitRule
+
+	delayed  atomic2.Int64
+	rejected atomic2.Int64
+}
+
+func (l *rateLimiter) SetLimits(limits []*RateLimit) error {
+	var rules []*rateLimitRule
+	for _, x := range limits {
+		if err := x.Validate(); err != nil {
+			return err
+		}
+		rules = append(rules, newRateLimitRule(x))
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rules = rules
+	return nil
+}
+
+func (l *rateLimiter) Limits() []*RateLimitStats {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var stats = make([]*RateLimitStats, 0, len(l.rules))
+	for _, x := range l.rules {
+		stats = append(stats, x.Stats())
+	}
+	return stats
+}
+
+func (l *rateLimiter) Acquire(s *Session, r *Request) (time.Duration, *RateLimit) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if len(l.rules) == 0 {
+		return 0, nil
+	}
+	var hkey = getHashKey(r.Multi, r.OpStr)
+	var now = time.Now().UnixNano()
+	var delay time.Duration
+	var matched []*rateLimitRule
+	var ids []string
+	for _, x := range l.rules {
+		id, ok := x.identity(s, r, hkey)
+		if !ok {
+			continue
+		}
+		wait, ok := x.check(id, now)
+		if !ok {
+			l.rejected.Incr()
+			return 0, x.RateLimit
+		}
+		if wait > delay {
+			delay = wait
+		}
+		matched = append(matched, x)
+		ids = append(ids, id)
+	}
+	for i, x := range matched {
+		x.take(ids[i], now)
+	}
+	if delay != 0 {
+		l.delayed.Incr()
+	}
+	return delay, nil
+}
+
+type delayedRequest struct {
+	r     *Request
+	until int64
+}
+
+// deferRequest queues r if it should be delayed until the given time, or
+// there're delayed requests of the session, so loopReader never sleeps.
+// Queued requests are handled in order by loopDelayed, until = 0 means the
+// request hasn't been handled yet, it sleeps in loopDelayed if it's delayed.
+func (s *Session) deferRequest(r *Request, d *Router, until int64) bool {
+	s.delayed.Lock()
+	defer s.delayed.Unlock()
+	switch {
+	case until == 0 && !s.delayed.running:
+		return false
+	case until != 0 && s.delayed.handling:
+		return false
+	}
+	r.Batch.Add(1)
+	s.delayed.queue = append(s.delayed.queue, &delayedRequest{r: r, until: until})
+	if !s.delayed.running {
+		s.delayed.running = true
+		go s.loopDelayed(d)
+	}
+	return true
+}
+
+func (s *Session) loopDelayed(d *Router) {
+	for {
+		s.delayed.Lock()
+		if len(s.delayed.queue) == 0 {
+			s.delayed.running = false
+			s.delayed.Unlock()
+			return
+		}
+		x := s.delayed.queue[0]
+		s.delayed.queue = s.delayed.queue[1:]
+		s.delayed.Unlock()
+
+		var r = x.r
+		var err error
+		if x.until != 0 {
+			if wait := x.until - time.Now().UnixNano(); wait > 0 {
+				time.Sleep(time.Duration(wait))
+			}
+			err = s.dispatchRequest(r, d)
+		} else {
+			r.Database = atomic.LoadInt32(&s.database)
+			r.ReadPref = s.readPref
+			s.delayed.Lock()
+			s.delayed.handling = true
+			s.delayed.Unlock()
+			err = s.handleRequest(r, d)
+			s.delayed.Lock()
+			s.delayed.handling = false
+			s.delayed.Unlock()
+			if d.monitors.active.Int64() != 0 {
+				r.monitors = d.monitors.match(r, s.Conn.RemoteAddr())
+			}
+		}
+		if err != nil {
+			r.Resp = redis.NewErrorf("ERR handle request, %s", err)
+		}
+		r.Batch.Done()
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+)
+
+func TestRateLimitValidate(t *testing.T) {
+	var invalid = []*RateLimit{
+		{Kind: "unknown", Rate: 1},
+		{Kind: RateLimitClass, Match: "admin", Rate: 1},
+		{Kind: RateLimitPrefix, Rate: 1},
+		{Kind: RateLimitUser, Rate: 0},
+		{Kind: RateLimitUser, Rate: 1, Burst: -1},
+		{Kind: RateLimitUser, Rate: 1, Action: "drop"},
+	}
+	for _, l := range invalid {
+		assert.Must(l.Validate() != nil)
+	}
+	l := &RateLimit{Kind: RateLimitClient, Rate: 100, Burst: 10, Action: RateLimitDelay, MaxDelayMs: 10}
+	assert.MustNoError(l.Validate())
+}
+
+func TestRateLimitReject(t *testing.T) {
+	var l = &rateLimiter{}
+	assert.MustNoError(l.SetLimits([]*RateLimit{
+		{Kind: RateLimitClient, Rate: 1, Burst: 2},
+	}))
+	s1 := &Session{clientIP: "10.0.0.1"}
+	s2 := &Session{clientIP: "10.0.0.2"}
+
+	for i := 0; i < 2; i++ {
+		_, limit := l.Acquire(s1, newCacheRequest("GET", "foo"))
+		assert.Must(limit == nil)
+	}
+	_, limit := l.Acquire(s1, newCacheRequest("GET", "foo"))
+	assert.Must(limit != nil && limit.Kind == RateLimitClient)
+
+	_, limit = l.Acquire(s2, newCacheRequest("GET", "foo"))
+	assert.Must(limit == nil)
+
+	stats := l.Limits()
+	assert.Must(len(stats) == 1)
+	assert.Must(stats[0].Passed == 3 && stats[0].Rejected == 1)
+}
+
+func TestRateLimitDelay(t *testing.T) {
+	var l = &rateLimiter{}
+	assert.MustNoError(l.SetLimits([]*RateLimit{
+		{Kind: RateLimitClass, Match: "write", Rate: 100, Action: RateLimitDelay, MaxDelayMs: 100},
+		{Kind: RateLimitPrefix, Match: "hot:", Rate: 1},
+	}))
+	s := &Session{}
+
+	delay, limit := l.Acquire(s, newCacheRequest("SET", "foo", "bar"))
+	assert.Must(limit == nil && delay == 0)
+	delay, limit = l.Acquire(s, newCacheRequest("SET", "foo", "bar"))
+	assert.Must(limit == nil && delay > 0 && delay <= time.Millisecond*10)
+
+	delay, limit = l.Acquire(s, newCacheRequest("GET", "foo"))
+	assert.Must(limit == nil && delay == 0)
+
+	_, limit = l.Acquire(s, newCacheRequest("GET", "hot:1"))
+	assert.Must(limit == nil)
+	_, limit = l.Acquire(s, newCacheRequest("GET", "hot:1"))
+	assert.Must(limit != nil && limit.Kind == RateLimitPrefix)
+
+	assert.Must(l.delayed.Int64() == 1 && l.rejected.Int64() == 1)
+}
+
+func TestRateLimitUser(t *testing.T) {
+	var l = &rateLimiter{}
+	assert.MustNoError(l.SetLimits([]*RateLimit{
+		{Kind: RateLimitUser, Match: "batch", Rate: 1},
+	}))
+	s1 := &Session{user: "batch"}
+	s2 := &Session{user: "default"}
+	for i := 0; i < 10; i++ {
+		_, limit := l.Acquire(s2, newCacheRequest("GET", "foo"))
+		assert.Must(limit == nil)
+	}
+	_, limit := l.Acquire(s1, newCacheRequest("GET", "foo"))
+	assert.Must(limit == nil)
+	_, limit = l.Acquire(s1, newCacheRequest("GET", "foo"))
+	assert.Must(limit != nil)
+
+	assert.MustNoError(l.SetLimits(nil))
+	_, limit = l.Acquire(s1, newCacheRequest("GET", "foo"))
+	assert.Must(limit == nil)
+}
+
+func TestRateLimitCheckBeforeTake(t *testing.T) {
+	var l = &rateLimiter{}
+	assert.MustNoError(l.SetLimits([]*RateLimit{
+		{Kind: RateLimitClient, Rate: 1, Burst: 2},
+		{Kind: RateLimitPrefix, Match: "hot:", Rate: 1},
+	}))
+	s := &Session{clientIP: "10.0.0.1"}
+
+	_, limit := l.Acquire(s, newCacheRequest("GET", "hot:1"))
+	assert.Must(limit == nil)
+	_, limit = l.Acquire(s, newCacheRequest("GET", "hot:1"))
+	assert.Must(limit != nil && limit.Kind == RateLimitPrefix)
+
+	_, limit = l.Acquire(s, newCacheRequest("GET", "foo"))
+	assert.Must(limit == nil)
+	_, limit = l.Acquire(s, newCacheRequest("GET", "foo"))
+	assert.Must(limit != nil && limit.Kind == RateLimitClient)
+}
+
+func TestRateLimitBuckets(t *testing.T) {
+	x := newRateLimitRule(&RateLimit{Kind: RateLimitClient, Rate: 1, Burst: 2})
+
+	var now = time.Now().UnixNano()
+	for i := 0; i < maxRateLimitBuckets; i++ {
+		x.take(strconv.Itoa(i), now)
+		x.take(strconv.Itoa(i), now)
+	}
+	_, ok := x.check("0", now)
+	assert.Must(!ok)
+
+	// busy buckets are kept, new identities share the overflow bucket
+	x.take("x", now)
+	x.take("y", now)
+	_, ok = x.check("z", now)
+	assert.Must(!ok && len(x.buckets) == maxRateLimitBuckets)
+	_, ok = x.check("0", now)
+	assert.Must(!ok)
+
+	// buckets refilled to full burst are dropped
+	now += int64(time.Second)
+	x.take("0", now)
+	now += int64(time.Millisecond * 1500)
+	_, ok = x.check("x", now)
+	assert.Must(ok && len(x.buckets) == 2)
+	_, ok = x.check("0", now)
+	assert.Must(ok)
+}
+
+func TestParseRateLimit(t *testing.T) {
+	l, err := ParseRateLimit("user=batch rate=1000 burst=100 action=delay max_delay_ms=10")
+	assert.MustNoError(err)
+	assert.Must(l.Kind == RateLimitUser && l.Match == "batch")
+	assert.Must(l.Rate == 1000 && l.Burst == 100)
+	assert.Must(l.Action == RateLimitDelay && l.MaxDelayMs == 10)
+
+	l, err = ParseRateLimit("client=* rate=1")
+	assert.MustNoError(err)
+	assert.Must(l.Kind == RateLimitClient && l.Match == "" && l.String() == "client=*")
+
+	for _, s := range []string{"", "user=batch", "user rate", "user rate=1 color=red", "class=admin rate=1"} {
+		_, err := ParseRateLimit(s)
+		assert.Must(err != nil)
+	}
+
+	config := NewDefaultConfig()
+	config.SessionRateLimits = []string{"prefix=hot: rate=1"}
+	assert.MustNoError(config.Validate())
+	assert.Must(len(NewRouter(config).limiter.Limits()) == 1)
+
+	config.SessionRateLimits = []string{"prefix rate=1"}
+	assert.Must(config.Validate() != nil)
+}
+
+func TestRateLimitAuthUser(t *testing.T) {
+	config := NewDefaultConfig()
+	config.SessionAuthUsers = []string{"default:secret"}
+	assert.Must(config.Validate() != nil)
+	config.SessionAuthUsers = []string{"batch:secret", "batch:secret2"}
+	assert.Must(config.Validate() != nil)
+
+	config.SessionAuth = "product"
+	config.SessionAuthUsers = []string{"batch:secret"}
+	assert.MustNoError(config.Validate())
+
+	s := &Session{config: config}
+	var auth = func(args ...string) bool {
+		r := newCacheRequest(append([]string{"AUTH"}, args...)...)
+		assert.MustNoError(s.handleAuth(r))
+		return !r.Resp.IsError()
+	}
+	assert.Must(!auth("batch", "product"))
+	assert.Must(!auth("admin", "product"))
+	assert.Must(auth("product") && s.user == "default")
+	assert.Must(auth("batch", "secret") && s.user == "batch")
+	assert.Must(auth("default", "product") && s.user == "default")
+}
+
+func TestRateLimitDelayQueue(t *testing.T) {
+	config := NewDefaultConfig()
+	config.SessionRateLimits = []string{"class=all rate=10 action=delay max_delay_ms=1000"}
+	assert.MustNoError(config.Validate())
+
+	d := NewRouter(config)
+	s := &Session{config: config}
+
+	var requests []*Request
+	for _, db := range []string{"1", "2", "3"} {
+		r := newCacheRequest("SELECT", db)
+		r.Batch = &sync.WaitGroup{}
+		if !s.deferRequest(r, d, 0) {
+			assert.MustNoError(s.handleRequest(r, d))
+		}
+		requests = append(requests, r)
+	}
+	assert.Must(atomic.LoadInt32(&s.database) == 1)
+
+	for _, r := range requests {
+		r.Batch.Wait()
+		assert.Must(r.Resp != nil && !r.Resp.IsError())
+	}
+	assert.Must(atomic.LoadInt32(&s.database) == 3)
+}
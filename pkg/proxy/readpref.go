@@ -0,0 +1,87 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"strings"
+
+	"github.com/CodisLabs/codis/pkg/proxy/redis"
+)
+
+type ReadPref int32
+
+const (
+	ReadPrefReplica ReadPref = iota
+	ReadPrefPrimary
+	ReadPrefNearest
+)
+
+var readPrefNames = []string{
+	ReadPrefReplica: "replica",
+	ReadPrefPrimary: "primary",
+	ReadPrefNearest: "nearest",
+}
+
+func (p ReadPref) String() string {
+	if p >= 0 && int(p) < len(readPrefNames) {
+		return readPrefNames[p]
+	}
+	return "unknown"
+}
+
+func ParseReadPref(s string) (ReadPref, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i, name := range readPrefNames {
+		if name == s {
+			return ReadPref(i), true
+		}
+	}
+	return 0, false
+}
+
+func (s *Session) handleReadOnly(r *Request) error {
+	if len(r.Multi) != 1 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for '%s' command", r.OpStr)
+		return nil
+	}
+	if r.OpStr == "READONLY" {
+		s.readPref = ReadPrefReplica
+	} else {
+		s.readPref = ReadPrefPrimary
+	}
+	r.Resp = RespOK
+	return nil
+}
+
+func (s *Session) handleCodis(r *Request) error {
+	if len(r.Multi) < 2 {
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'CODIS' command")
+		return nil
+	}
+	switch sub := strings.ToUpper(string(r.Multi[1].Value)); sub {
+	case "READPREF":
+		return s.handleCodisReadPref(r)
+	default:
+		r.Resp = redis.NewErrorf("ERR unknown subcommand '%s' for 'CODIS' command", sub)
+		return nil
+	}
+}
+
+func (s *Session) handleCodisReadPref(r *Request) error {
+	switch len(r.Multi) {
+	case 2:
+		r.Resp = redis.NewBulkBytes([]byte(s.readPref.String()))
+	case 3:
+		p, ok := ParseReadPref(string(r.Multi[2].Value))
+		if !ok {
+			r.Resp = redis.NewErrorf("ERR invalid read preference, should be primary, replica or nearest")
+			return nil
+		}
+		s.readPref = p
+		r.Resp = RespOK
+	default:
+		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'CODIS READPREF' command")
+	}
+	return nil
+}
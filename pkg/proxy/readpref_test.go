@@ -0,0 +1,87 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+)
+
+func TestParseReadPref(t *testing.T) {
+	for _, name := range []string{"primary", "replica", "nearest"} {
+		p, ok := ParseReadPref(name)
+		assert.Must(ok && p.String() == name)
+	}
+	p, ok := ParseReadPref(" Primary ")
+	assert.Must(ok && p == ReadPrefPrimary)
+	_, ok = ParseReadPref("secondary")
+	assert.Must(!ok)
+}
+
+func TestSessionReadPref(t *testing.T) {
+	s := &Session{}
+
+	r := newCacheRequest("CODIS", "READPREF")
+	assert.MustNoError(s.handleCodis(r))
+	assert.Must(string(r.Resp.Value) == "replica")
+
+	r = newCacheRequest("CODIS", "READPREF", "nearest")
+	assert.MustNoError(s.handleCodis(r))
+	assert.Must(r.Resp == RespOK && s.readPref == ReadPrefNearest)
+
+	r = newCacheRequest("CODIS", "READPREF", "any")
+	assert.MustNoError(s.handleCodis(r))
+	assert.Must(r.Resp.IsError() && s.readPref == ReadPrefNearest)
+
+	r = newCacheRequest("CODIS", "UNKNOWN")
+	assert.MustNoError(s.handleCodis(r))
+	assert.Must(r.Resp.IsError())
+
+	r = newCacheRequest("READWRITE")
+	assert.MustNoError(s.handleReadOnly(r))
+	assert.Must(r.Resp == RespOK && s.readPref == ReadPrefPrimary)
+
+	r = newCacheRequest("READONLY")
+	assert.MustNoError(s.handleReadOnly(r))
+	assert.Must(r.Resp == RespOK && s.readPref == ReadPrefReplica)
+}
+
+func TestForwardReadPref(t *testing.T) {
+	config := NewDefaultConfig()
+	config.BackendBreakerMaxFailures = 0
+	config.BackendBreakerFailureRate = 0
+	config.BackendNumberDatabases = 1
+
+	var newBackend = func(pool *sharedBackendConnPool, addr string, latency time.Duration) *sharedBackendConn {
+		s := pool.Retain(addr)
+		s.single[0].state.Set(stateConnected)
+		s.health.latency.Set(int64(latency))
+		return s
+	}
+	primary := newSharedBackendConnPool(config, 1, false)
+	replica := newSharedBackendConnPool(config, 1, true)
+
+	slot := &Slot{}
+	slot.backend.bc = newBackend(primary, "127.0.0.1:1", time.Millisecond)
+	defer slot.backend.bc.Release()
+	r1 := newBackend(replica, "127.0.0.1:2", time.Millisecond*2)
+	defer r1.Release()
+	slot.replicaGroups = [][]*sharedBackendConn{{r1}}
+
+	var d forwardHelper
+	var forward = func(pref ReadPref, args ...string) *BackendConn {
+		r := newCacheRequest(args...)
+		r.ReadPref = pref
+		return d.forward2(slot, r)
+	}
+	assert.Must(forward(ReadPrefReplica, "GET", "a") == r1.single[0])
+	assert.Must(forward(ReadPrefPrimary, "GET", "a") == slot.backend.bc.single[0])
+	assert.Must(forward(ReadPrefNearest, "GET", "a") == slot.backend.bc.single[0])
+	assert.Must(forward(ReadPrefReplica, "SET", "a", "b") == slot.backend.bc.single[0])
+
+	slot.backend.bc.health.inflight.Set(4)
+	assert.Must(forward(ReadPrefNearest, "GET", "a") == r1.single[0])
+}
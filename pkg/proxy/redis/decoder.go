@@ -23,6 +23,8 @@ var (
 
 	ErrBadMultiBulkLen     = errors.New("bad multi-bulk len")
 	ErrBadMultiBulkContent = errors.New("bad multi-bulk content, should be bulkbytes")
+
+	ErrBadRespSizeTooLarge = errors.New("bad resp size, too large")
 )
 
 const (
@@ -65,6 +67,12 @@ type Decoder struct {
 	br *bufio2.Reader
 
 	Err error
+
+	MaxBulkLen  int64
+	MaxArrayLen int64
+	MaxRespSize int64
+
+	size int64
 }
 
 var ErrFailedDecoder = errors.New("use of failed decoder")
@@ -81,10 +89,15 @@ func NewDecoderBuffer(br *bufio2.Reader) *Decoder {
 	return &Decoder{br: br}
 }
 
+func (d *Decoder) Buffered() int {
+	return d.br.Buffered()
+}
+
 func (d *Decoder) Decode() (*Resp, error) {
 	if d.Err != nil {
 		return nil, errors.Trace(ErrFailedDecoder)
 	}
+	d.size = 0
 	r, err := d.decodeResp()
 	if err != nil {
 		d.Err = err
@@ -96,6 +109,7 @@ func (d *Decoder) DecodeMultiBulk() ([]*Resp, error) {
 	if d.Err != nil {
 		return nil, errors.Trace(ErrFailedDecoder)
 	}
+	d.size = 0
 	m, err := d.decodeMultiBulk()
 	if err != nil {
 		d.Err = err
@@ -115,6 +129,28 @@ func DecodeMultiBulkFromBytes(p []byte) ([]*Resp, error) {
 	return NewDecoder(bytes.NewReader(p)).DecodeMultiBulk()
 }
 
+func (d *Decoder) maxBulkLen() int64 {
+	if d.MaxBulkLen > 0 && d.MaxBulkLen < MaxBulkBytesLen {
+		return d.MaxBulkLen
+	}
+	return MaxBulkBytesLen
+}
+
+func (d *Decoder) maxArrayLen() int64 {
+	if d.MaxArrayLen > 0 && d.MaxArrayLen < MaxArrayLen {
+		return d.MaxArrayLen
+	}
+	return MaxArrayLen
+}
+
+func (d *Decoder) incrRespSize(n int64) error {
+	d.size += n
+	if d.MaxRespSize > 0 && d.size > d.MaxRespSize {
+		return errors.Trace(ErrBadRespSizeTooLarge)
+	}
+	return nil
+}
+
 func (d *Decoder) decodeResp() (*Resp, error) {
 	b, err := d.br.ReadByte()
 	if err != nil {
@@ -143,7 +179,7 @@ func (d *Decoder) decodeTextBytes() ([]byte, error) {
 	if n := len(b) - 2; n < 0 || b[n] != '\r' {
 		return nil, errors.Trace(ErrBadCRLFEnd)
 	} else {
-		return b[:n], nil
+		return b[:n], d.incrRespSize(int64(n))
 	}
 }
 
@@ -167,11 +203,14 @@ func (d *Decoder) decodeBulkBytes() ([]byte, error) {
 	switch {
 	case n < -1:
 		return nil, errors.Trace(ErrBadBulkBytesLen)
-	case n > MaxBulkBytesLen:
+	case n > d.maxBulkLen():
 		return nil, errors.Trace(ErrBadBulkBytesLenTooLong)
 	case n == -1:
 		return nil, nil
 	}
+	if err := d.incrRespSize(n); err != nil {
+		return nil, err
+	}
 	b, err := d.br.ReadFull(int(n) + 2)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -190,7 +229,7 @@ func (d *Decoder) decodeArray() ([]*Resp, error) {
 	switch {
 	case n < -1:
 		return nil, errors.Trace(ErrBadArrayLen)
-	case n > MaxArrayLen:
+	case n > d.maxArrayLen():
 		return nil, errors.Trace(ErrBadArrayLenTooLong)
 	case n == -1:
 		return nil, nil
@@ -247,7 +286,7 @@ func (d *Decoder) decodeMultiBulk() ([]*Resp, error) {
 	switch {
 	case n <= 0:
 		return nil, errors.Trace(ErrBadArrayLen)
-	case n > MaxArrayLen:
+	case n > d.maxArrayLen():
 		return nil, errors.Trace(ErrBadArrayLenTooLong)
 	}
 	multi := make([]*Resp, n)
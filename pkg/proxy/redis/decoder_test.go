@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/CodisLabs/codis/pkg/utils/assert"
+	"github.com/CodisLabs/codis/pkg/utils/errors"
 )
 
 func TestBtoi64(t *testing.T) {
@@ -108,6 +109,30 @@ func TestDecoder(t *testing.T) {
 	}
 }
 
+func TestDecoderLimits(t *testing.T) {
+	d := NewDecoder(bytes.NewReader([]byte("*2\r\n$3\r\nGET\r\n$6\r\nfoobar\r\n")))
+	d.MaxBulkLen = 4
+	_, err := d.DecodeMultiBulk()
+	assert.Must(errors.Equal(err, ErrBadBulkBytesLenTooLong))
+
+	d = NewDecoder(bytes.NewReader([]byte("*3\r\n$3\r\nDEL\r\n$1\r\na\r\n$1\r\nb\r\n")))
+	d.MaxArrayLen = 2
+	_, err = d.DecodeMultiBulk()
+	assert.Must(errors.Equal(err, ErrBadArrayLenTooLong))
+
+	d = NewDecoder(bytes.NewReader([]byte("*2\r\n$3\r\nfoo\r\n$3\r\nbar\r\n$3\r\nfoo\r\n")))
+	d.MaxRespSize = 5
+	_, err = d.Decode()
+	assert.Must(errors.Equal(err, ErrBadRespSizeTooLarge))
+
+	d = NewDecoder(bytes.NewReader([]byte("$3\r\nfoo\r\n$3\r\nbar\r\n")))
+	d.MaxRespSize = 5
+	for i := 0; i < 2; i++ {
+		_, err = d.Decode()
+		assert.MustNoError(err)
+	}
+}
+
 type loopReader struct {
 	buf []byte
 	pos int
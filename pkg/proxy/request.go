@@ -16,24 +16,48 @@ type Request struct {
 	Batch *sync.WaitGroup
 	Group *sync.WaitGroup
 
-	Broken *atomic2.Bool
+	Broken  *atomic2.Bool
+	Expired *atomic2.Bool
 
 	OpStr string
 	OpFlag
 
 	Database int32
 	UnixNano int64
+	ReadPref ReadPref
 
 	*redis.Resp
 	Err error
 
 	Coalesce func() error
+
+	invalidate func()
+
+	hedge  *hedgeState
+	hedged bool
+	mirror *trafficMirror
+
+	trace     *requestTrace
+	traceNano int64
+
+	sendNano int64
+
+	done chan struct{}
+
+	monitors []*monitorWatcher
 }
 
 func (r *Request) IsBroken() bool {
+	if r.IsExpired() {
+		return true
+	}
 	return r.Broken != nil && r.Broken.IsTrue()
 }
 
+func (r *Request) IsExpired() bool {
+	return r.Expired != nil && r.Expired.IsTrue()
+}
+
 func (r *Request) MakeSubRequest(n int) []Request {
 	var sub = make([]Request, n)
 	for i := range sub {
@@ -42,8 +66,11 @@ func (r *Request) MakeSubRequest(n int) []Request {
 		x.OpStr = r.OpStr
 		x.OpFlag = r.OpFlag
 		x.Broken = r.Broken
+		x.Expired = r.Expired
 		x.Database = r.Database
 		x.UnixNano = r.UnixNano
+		x.ReadPref = r.ReadPref
+		x.trace = r.trace
 	}
 	return sub
 }
@@ -4,7 +4,9 @@
 package proxy
 
 import (
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/CodisLabs/codis/pkg/models"
@@ -23,6 +25,19 @@ type Router struct {
 		replica *sharedBackendConnPool
 	}
 	slots [MaxSlotNum]Slot
+	epoch int64
+
+	synced int64
+
+	cache   *localCache
+	limiter *rateLimiter
+	hedger  *hedger
+	mirror  *trafficMirror
+	tracer  *tracer
+	policy  atomic.Value
+
+	sessions sessionTable
+	monitors monitorHub
 
 	config *Config
 	online bool
@@ -31,11 +46,24 @@ type Router struct {
 
 func NewRouter(config *Config) *Router {
 	s := &Router{config: config}
-	s.pool.primary = newSharedBackendConnPool(config, config.BackendPrimaryParallel)
-	s.pool.replica = newSharedBackendConnPool(config, config.BackendReplicaParallel)
+	s.pool.primary = newSharedBackendConnPool(config, config.BackendPrimaryParallel, false)
+	s.pool.replica = newSharedBackendConnPool(config, config.BackendReplicaParallel, true)
+	s.pool.replica.primary = s.pool.primary
+	s.cache = newLocalCache(config)
+	s.limiter = &rateLimiter{}
+	if limits, err := ParseRateLimits(config.SessionRateLimits); err != nil {
+		log.WarnErrorf(err, "parse session_ratelimits failed")
+	} else {
+		s.limiter.SetLimits(limits)
+	}
+	s.hedger = newHedger(config)
+	s.mirror = newTrafficMirror(config)
+	s.tracer = newTracer(config)
+	s.policy.Store(&commandPolicy{})
 	for i := range s.slots {
 		s.slots[i].id = i
 		s.slots[i].method = &forwardSync{}
+		s.slots[i].hedger = s.hedger
 	}
 	return s
 }
@@ -60,6 +88,8 @@ func (s *Router) Close() {
 	for i := range s.slots {
 		s.fillSlot(&models.Slot{Id: i}, false, nil)
 	}
+	s.mirror.Close()
+	s.tracer.Close()
 }
 
 func (s *Router) GetSlots() []*models.Slot {
@@ -82,6 +112,20 @@ func (s *Router) GetSlot(id int) *models.Slot {
 	return slot.snapshot()
 }
 
+// Epoch returns the latest epoch of slots filled by dashboard.
+func (s *Router) Epoch() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.epoch
+}
+
+// SyncedEpoch returns the latest epoch up to which no fill has been missed.
+func (s *Router) SyncedEpoch() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.synced
+}
+
 func (s *Router) HasSwitched() bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -97,6 +141,7 @@ var (
 	ErrClosedRouter  = errors.New("use of closed router")
 	ErrInvalidSlotId = errors.New("use of invalid slot id")
 	ErrInvalidMethod = errors.New("use of invalid forwarder method")
+	ErrStaleEpoch    = errors.New("use of stale slot epoch")
 )
 
 func (s *Router) FillSlot(m *models.Slot) error {
@@ -117,10 +162,42 @@ func (s *Router) FillSlot(m *models.Slot) error {
 	case models.ForwardSemiAsync:
 		method = &forwardSemiAsync{}
 	}
+	if m.Epoch != 0 {
+		if m.Epoch < s.epoch {
+			log.Warnf("reject slot-[%d] of stale epoch = %d, current epoch = %d", m.Id, m.Epoch, s.epoch)
+			return ErrStaleEpoch
+		}
+		var fresh = m.Epoch != s.epoch
+		s.epoch = m.Epoch
+		switch {
+		case m.PrevEpoch == 0:
+		case m.PrevEpoch == m.Epoch || m.PrevEpoch <= s.synced:
+			s.synced = m.Epoch
+		case fresh:
+			log.Warnf("slot-[%d] of epoch = %d follows epoch = %d, synced epoch = %d", m.Id, m.Epoch, m.PrevEpoch, s.synced)
+		}
+	}
 	s.fillSlot(m, false, method)
 	return nil
 }
 
+func (s *Router) GetCommandPolicy() *models.CommandPolicy {
+	return s.policy.Load().(*commandPolicy).model
+}
+
+func (s *Router) SetCommandPolicy(m *models.CommandPolicy) error {
+	p, err := newCommandPolicy(m)
+	if err != nil {
+		return err
+	}
+	s.policy.Store(p)
+	return nil
+}
+
+func (s *Router) checkPolicy(r *Request) error {
+	return s.policy.Load().(*commandPolicy).check(r)
+}
+
 func (s *Router) KeepAlive() error {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -132,12 +209,36 @@ func (s *Router) KeepAlive() error {
 	return nil
 }
 
+func (s *Router) BackendStats() []*BackendStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []*BackendStats
+	for _, x := range s.pool.primary.BackendStats() {
+		x.Pool = "primary"
+		list = append(list, x)
+	}
+	for _, x := range s.pool.replica.BackendStats() {
+		x.Pool = "replica"
+		list = append(list, x)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Addr != list[j].Addr {
+			return list[i].Addr < list[j].Addr
+		}
+		return list[i].Pool < list[j].Pool
+	})
+	return list
+}
+
 func (s *Router) isOnline() bool {
 	return s.online && !s.closed
 }
 
 func (s *Router) dispatch(r *Request) error {
 	hkey := getHashKey(r.Multi, r.OpStr)
+	if s.cache != nil && s.cache.handle(r, hkey) {
+		return nil
+	}
 	var id = Hash(hkey) % MaxSlotNum
 	slot := &s.slots[id]
 	return slot.forward(r, hkey)
@@ -183,6 +284,7 @@ func (s *Router) fillSlot(m *models.Slot, switched bool, method forwardMethod) {
 	slot.replicaGroups = nil
 
 	slot.switched = switched
+	slot.epoch = m.Epoch
 
 	if addr := m.BackendAddr; len(addr) != 0 {
 		slot.backend.bc = s.pool.primary.Retain(addr)
@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/CodisLabs/codis/pkg/models"
@@ -27,8 +29,9 @@ type Session struct {
 	LastOpUnix int64
 
 	database int32
+	readPref ReadPref
 
-	quit bool
+	quit atomic2.Bool
 	exit sync.Once
 
 	stats struct {
@@ -45,7 +48,25 @@ type Session struct {
 	broken atomic2.Bool
 	config *Config
 
+	tasks    *RequestChan
+	draining atomic2.Bool
+
+	waiter *requestWaiter
+
 	authorized bool
+
+	delayed struct {
+		sync.Mutex
+		queue    []*delayedRequest
+		running  bool
+		handling bool
+	}
+
+	user     string
+	clientIP string
+
+	id   int64
+	name atomic.Value
 }
 
 func (s *Session) String() string {
@@ -55,7 +76,7 @@ func (s *Session) String() string {
 		LastOpUnix int64  `json:"lastop,omitempty"`
 		RemoteAddr string `json:"remote"`
 	}{
-		s.Ops, s.CreateUnix, s.LastOpUnix,
+		atomic.LoadInt64(&s.Ops), s.CreateUnix, atomic.LoadInt64(&s.LastOpUnix),
 		s.Conn.RemoteAddr(),
 	}
 	b, _ := json.Marshal(o)
@@ -69,13 +90,20 @@ func NewSession(sock net.Conn, config *Config) *Session {
 	)
 	c.ReaderTimeout = config.SessionRecvTimeout.Duration()
 	c.WriterTimeout = config.SessionSendTimeout.Duration()
+	c.MaxBulkLen = config.SessionMaxBulkSize.Int64()
+	c.MaxArrayLen = int64(config.SessionMaxMultiBulkLen)
 	c.SetKeepAlivePeriod(config.SessionKeepAlivePeriod.Duration())
 
 	s := &Session{
 		Conn: c, config: config,
 		CreateUnix: time.Now().Unix(),
+		id:         sessionIdGeneration.Incr(),
 	}
 	s.stats.opmap = make(map[string]*opStats, 16)
+	s.readPref, _ = ParseReadPref(config.SessionReadPreference)
+	if addr, ok := sock.RemoteAddr().(*net.TCPAddr); ok {
+		s.clientIP = addr.IP.String()
+	}
 	log.Infof("session [%p] create: %s", s, s)
 	return s
 }
@@ -107,6 +135,7 @@ var (
 	ErrRouterNotOnline          = errors.New("router is not online")
 	ErrTooManySessions          = errors.New("too many sessions")
 	ErrTooManyPipelinedRequests = errors.New("too many pipelined requests")
+	ErrDrainingSession          = errors.New("session is draining")
 )
 
 var RespOK = redis.NewString([]byte("OK"))
@@ -137,8 +166,21 @@ func (s *Session) Start(d *Router) {
 
 		tasks := NewRequestChanBuffer(1024)
 
+		s.tasks = tasks
+		if !d.sessions.add(s) {
+			go func() {
+				s.Conn.Encode(redis.NewErrorf("ERR proxy is draining"), true)
+				s.CloseWithError(ErrDrainingSession)
+				s.incrOpFails(nil, nil)
+				s.flushOpStats(true)
+			}()
+			decrSessions()
+			return
+		}
+
 		go func() {
 			s.loopWriter(tasks)
+			d.sessions.del(s)
 			decrSessions()
 		}()
 
@@ -159,9 +201,18 @@ func (s *Session) loopReader(tasks *RequestChan, d *Router) (err error) {
 		maxPipelineLen = s.config.SessionMaxPipeline
 	)
 
-	for !s.quit {
+	for s.quit.IsFalse() {
+		var decode int64
+		if d.tracer != nil && s.Conn.Decoder.Buffered() != 0 {
+			decode = time.Now().UnixNano()
+		}
 		multi, err := s.Conn.DecodeMultiBulk()
 		if err != nil {
+			if isRequestTooLarge(err) {
+				r := &Request{Batch: &sync.WaitGroup{}}
+				r.Resp = redis.NewErrorf("ERR request is too large, %s", errors.Cause(err))
+				tasks.PushBack(r)
+			}
 			return err
 		}
 		if len(multi) == 0 {
@@ -174,34 +225,69 @@ func (s *Session) loopReader(tasks *RequestChan, d *Router) (err error) {
 		}
 
 		start := time.Now()
-		s.LastOpUnix = start.Unix()
-		s.Ops++
+		atomic.StoreInt64(&s.LastOpUnix, start.Unix())
+		atomic.AddInt64(&s.Ops, 1)
 
 		r := &Request{}
 		r.Multi = multi
 		r.Batch = &sync.WaitGroup{}
-		r.Database = s.database
+		r.Database = atomic.LoadInt32(&s.database)
 		r.UnixNano = start.UnixNano()
 
-		if err := s.handleRequest(r, d); err != nil {
+		if d.tracer != nil {
+			if decode == 0 {
+				decode = r.UnixNano
+			}
+			r.trace = d.tracer.sample(r, s.Conn.RemoteAddr(), decode)
+		}
+
+		if s.deferRequest(r, d, 0) {
+			tasks.PushBack(r)
+			continue
+		}
+		r.ReadPref = s.readPref
+
+		err = s.handleRequest(r, d)
+
+		if d.monitors.active.Int64() != 0 {
+			r.monitors = d.monitors.match(r, s.Conn.RemoteAddr())
+		}
+
+		if err != nil {
 			r.Resp = redis.NewErrorf("ERR handle request, %s", err)
 			tasks.PushBack(r)
 			if breakOnFailure {
 				return err
 			}
 		} else {
+			watchResponse(r)
 			tasks.PushBack(r)
 		}
+
+		if s.draining.IsTrue() && s.Conn.Decoder.Buffered() == 0 {
+			return ErrDrainingSession
+		}
 	}
 	return nil
 }
 
+func isRequestTooLarge(err error) bool {
+	switch errors.Cause(err) {
+	case redis.ErrBadBulkBytesLenTooLong, redis.ErrBadArrayLenTooLong:
+		return true
+	}
+	return false
+}
+
 func (s *Session) loopWriter(tasks *RequestChan) (err error) {
 	defer func() {
 		s.CloseWithError(err)
 		tasks.PopFrontAllVoid(func(r *Request) {
 			s.incrOpFails(r, nil)
 		})
+		if s.waiter != nil {
+			s.waiter.Close()
+		}
 		s.flushOpStats(true)
 	}()
 
@@ -216,6 +302,9 @@ func (s *Session) loopWriter(tasks *RequestChan) (err error) {
 
 	return tasks.PopFrontAll(func(r *Request) error {
 		resp, err := s.handleResponse(r)
+		if len(r.monitors) != 0 {
+			s.publishMonitor(r, resp, err)
+		}
 		if err != nil {
 			resp = redis.NewErrorf("ERR handle response, %s", err)
 			if breakOnFailure {
@@ -223,15 +312,25 @@ func (s *Session) loopWriter(tasks *RequestChan) (err error) {
 				return s.incrOpFails(r, err)
 			}
 		}
+		var encode int64
+		if r.trace != nil {
+			encode = time.Now().UnixNano()
+		}
 		if err := p.Encode(resp); err != nil {
 			return s.incrOpFails(r, err)
 		}
+		if r.mirror != nil && err == nil {
+			r.mirror.push(r, resp)
+		}
 		fflush := tasks.IsEmpty()
 		if err := p.Flush(fflush); err != nil {
 			return s.incrOpFails(r, err)
 		} else {
 			s.incrOpStats(r, resp.Type)
 		}
+		if r.trace != nil {
+			r.trace.finish(r, encode, time.Now().UnixNano())
+		}
 		if fflush {
 			s.flushOpStats(false)
 		}
@@ -240,7 +339,9 @@ func (s *Session) loopWriter(tasks *RequestChan) (err error) {
 }
 
 func (s *Session) handleResponse(r *Request) (*redis.Resp, error) {
-	r.Batch.Wait()
+	if !s.waitResponse(r) {
+		return redis.NewErrorf("ERR request timeout after %s", s.requestTimeout(r)), nil
+	}
 	if r.Coalesce != nil {
 		if err := r.Coalesce(); err != nil {
 			return nil, err
@@ -262,6 +363,9 @@ func (s *Session) handleRequest(r *Request, d *Router) error {
 	r.OpStr = opstr
 	r.OpFlag = flag
 	r.Broken = &s.broken
+	if s.requestTimeout(r) != 0 {
+		r.Expired = &atomic2.Bool{}
+	}
 
 	if flag.IsNotAllowed() {
 		return fmt.Errorf("command '%s' is not allowed", opstr)
@@ -275,16 +379,46 @@ func (s *Session) handleRequest(r *Request, d *Router) error {
 	}
 
 	if !s.authorized {
-		if s.config.SessionAuth != "" {
+		if s.isAuthRequired() {
 			r.Resp = redis.NewErrorf("NOAUTH Authentication required")
 			return nil
 		}
 		s.authorized = true
 	}
 
+	if err := d.checkPolicy(r); err != nil {
+		r.Resp = redis.NewErrorf("ERR %s", err)
+		return nil
+	}
+
+	if delay, limit := d.limiter.Acquire(s, r); limit != nil {
+		r.Resp = redis.NewErrorf("ERR rate limit exceeded, %s", limit)
+		return nil
+	} else if delay != 0 {
+		if s.deferRequest(r, d, time.Now().Add(delay).UnixNano()) {
+			return nil
+		}
+		time.Sleep(delay)
+	}
+	return s.dispatchRequest(r, d)
+}
+
+func (s *Session) dispatchRequest(r *Request, d *Router) error {
+	var opstr = r.OpStr
+
+	if d.mirror.sample(r) {
+		r.mirror = d.mirror
+	}
+
 	switch opstr {
 	case "SELECT":
 		return s.handleSelect(r)
+	case "READONLY", "READWRITE":
+		return s.handleReadOnly(r)
+	case "CODIS":
+		return s.handleCodis(r)
+	case "CLIENT":
+		return s.handleClient(r, d)
 	case "PING":
 		return s.handleRequestPing(r, d)
 	case "INFO":
@@ -309,24 +443,61 @@ func (s *Session) handleRequest(r *Request, d *Router) error {
 }
 
 func (s *Session) handleQuit(r *Request) error {
-	s.quit = true
+	s.quit.Set(true)
 	r.Resp = RespOK
 	return nil
 }
 
+func parseAuthUser(s string) (string, string, bool) {
+	i := strings.IndexByte(s, ':')
+	if i <= 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+1:], true
+}
+
+func (s *Session) lookupAuthUser(user string) (string, bool) {
+	if user == "default" {
+		return s.config.SessionAuth, s.config.SessionAuth != ""
+	}
+	for _, x := range s.config.SessionAuthUsers {
+		if u, password, ok := parseAuthUser(x); ok && u == user {
+			return password, true
+		}
+	}
+	return "", false
+}
+
+func (s *Session) isAuthRequired() bool {
+	return s.config.SessionAuth != "" || len(s.config.SessionAuthUsers) != 0
+}
+
 func (s *Session) handleAuth(r *Request) error {
-	if len(r.Multi) != 2 {
+	var user, password string
+	switch len(r.Multi) {
+	case 2:
+		user, password = "default", string(r.Multi[1].Value)
+	case 3:
+		user, password = string(r.Multi[1].Value), string(r.Multi[2].Value)
+	default:
 		r.Resp = redis.NewErrorf("ERR wrong number of arguments for 'AUTH' command")
 		return nil
 	}
-	switch {
-	case s.config.SessionAuth == "":
+	if !s.isAuthRequired() {
 		r.Resp = redis.NewErrorf("ERR Client sent AUTH, but no password is set")
-	case s.config.SessionAuth != string(r.Multi[1].Value):
+		return nil
+	}
+	switch expect, ok := s.lookupAuthUser(user); {
+	case !ok || expect != password:
 		s.authorized = false
-		r.Resp = redis.NewErrorf("ERR invalid password")
+		if len(r.Multi) == 2 {
+			r.Resp = redis.NewErrorf("ERR invalid password")
+		} else {
+			r.Resp = redis.NewErrorf("ERR invalid username-password pair")
+		}
 	default:
 		s.authorized = true
+		s.user = user
 		r.Resp = RespOK
 	}
 	return nil
@@ -344,7 +515,7 @@ func (s *Session) handleSelect(r *Request) error {
 		r.Resp = redis.NewErrorf("ERR invalid DB index, only accept DB [0,%d)", s.config.BackendNumberDatabases)
 	default:
 		r.Resp = RespOK
-		s.database = int32(db)
+		atomic.StoreInt32(&s.database, int32(db))
 	}
 	return nil
 }
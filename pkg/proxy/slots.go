@@ -19,6 +19,8 @@ type Slot struct {
 
 	switched bool
 
+	epoch int64
+
 	backend, migrate struct {
 		id int
 		bc *sharedBackendConn
@@ -26,6 +28,7 @@ type Slot struct {
 	replicaGroups [][]*sharedBackendConn
 
 	method forwardMethod
+	hedger *hedger
 }
 
 func (s *Slot) snapshot() *models.Slot {
@@ -38,6 +41,7 @@ func (s *Slot) snapshot() *models.Slot {
 		MigrateFrom:        s.migrate.bc.Addr(),
 		MigrateFromGroupId: s.migrate.id,
 		ForwardMethod:      s.method.GetId(),
+		Epoch:              s.epoch,
 	}
 	for i := range s.replicaGroups {
 		var group []string
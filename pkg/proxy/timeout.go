@@ -0,0 +1,83 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import "time"
+
+func (s *Session) requestTimeout(r *Request) time.Duration {
+	if r.IsReadOnly() {
+		return s.config.SessionReadRequestTimeout.Duration()
+	}
+	return s.config.SessionWriteRequestTimeout.Duration()
+}
+
+// requestWaiter waits for each request of a session against its own deadline,
+// a request that has timed out doesn't hold up the following ones. The timer
+// is reused by the session writer.
+type requestWaiter struct {
+	timer *time.Timer
+}
+
+func newRequestWaiter() *requestWaiter {
+	w := &requestWaiter{timer: time.NewTimer(time.Hour)}
+	w.timer.Stop()
+	return w
+}
+
+// watchResponse starts waiting for the response of a request with timeout as
+// soon as it's dispatched, so it's seen by the writer even if the requests in
+// front of it have timed out.
+func watchResponse(r *Request) {
+	if r.Expired == nil || r.done != nil {
+		return
+	}
+	r.done = make(chan struct{})
+	go func() {
+		r.Batch.Wait()
+		close(r.done)
+	}()
+}
+
+func (w *requestWaiter) wait(r *Request, deadline time.Time) bool {
+	watchResponse(r)
+	select {
+	case <-r.done:
+		return true
+	default:
+	}
+	w.timer.Reset(time.Until(deadline))
+	defer func() {
+		w.timer.Stop()
+		select {
+		case <-w.timer.C:
+		default:
+		}
+	}()
+	select {
+	case <-r.done:
+		return true
+	case <-w.timer.C:
+		return false
+	}
+}
+
+func (w *requestWaiter) Close() {
+	w.timer.Stop()
+}
+
+func (s *Session) waitResponse(r *Request) bool {
+	if r.Expired == nil {
+		r.Batch.Wait()
+		return true
+	}
+	if s.waiter == nil {
+		s.waiter = newRequestWaiter()
+	}
+	deadline := time.Unix(0, r.UnixNano).Add(s.requestTimeout(r))
+	if s.waiter.wait(r, deadline) {
+		return true
+	}
+	r.Expired.Set(true)
+	return false
+}
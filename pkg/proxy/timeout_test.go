@@ -0,0 +1,157 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/proxy/redis"
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+	"github.com/CodisLabs/codis/pkg/utils/sync2/atomic2"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.MustNoError(err)
+	defer l.Close()
+
+	var received atomic2.Int64
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		dec, enc := redis.NewDecoder(c), redis.NewEncoder(c)
+		for {
+			multi, err := dec.DecodeMultiBulk()
+			if err != nil {
+				return
+			}
+			received.Incr()
+			time.Sleep(time.Millisecond * 50)
+			if err := enc.Encode(multi[1], true); err != nil {
+				return
+			}
+		}
+	}()
+
+	config := NewDefaultConfig()
+	config.SessionReadRequestTimeout.Set(time.Millisecond * 20)
+	config.SessionWriteRequestTimeout.Set(time.Second)
+
+	bc := NewBackendConn(l.Addr().String(), 0, config)
+	defer bc.Close()
+
+	s := &Session{config: config}
+	defer func() {
+		if s.waiter != nil {
+			s.waiter.Close()
+		}
+	}()
+	var send = func(args ...string) *Request {
+		r := newCacheRequest(args...)
+		r.Batch = &sync.WaitGroup{}
+		r.UnixNano = time.Now().UnixNano()
+		if s.requestTimeout(r) != 0 {
+			r.Expired = &atomic2.Bool{}
+		}
+		bc.PushBack(r)
+		return r
+	}
+
+	r1 := send("GET", "a")
+	resp, err := s.handleResponse(r1)
+	assert.MustNoError(err)
+	assert.Must(resp.IsError() && r1.IsBroken())
+
+	r2 := send("SET", "b", "1")
+	resp, err = s.handleResponse(r2)
+	assert.MustNoError(err)
+	assert.Must(string(resp.Value) == "b")
+	assert.Must(bc.state.Int64() == stateConnected)
+
+	r3 := newCacheRequest("SET", "c", "1")
+	r3.Batch = &sync.WaitGroup{}
+	r3.Expired = &atomic2.Bool{}
+	r3.Expired.Set(true)
+	bc.PushBack(r3)
+	r3.Batch.Wait()
+	assert.Must(r3.Err == ErrRequestIsBroken)
+
+	r4 := send("SET", "d", "1")
+	resp, err = s.handleResponse(r4)
+	assert.MustNoError(err)
+	assert.Must(string(resp.Value) == "d")
+	assert.Must(received.Int64() == 3)
+}
+
+func TestRequestTimeoutPipeline(t *testing.T) {
+	var listen = func(delay time.Duration) (net.Listener, string) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.MustNoError(err)
+		go func() {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			dec, enc := redis.NewDecoder(c), redis.NewEncoder(c)
+			for {
+				multi, err := dec.DecodeMultiBulk()
+				if err != nil {
+					return
+				}
+				time.Sleep(delay)
+				if err := enc.Encode(multi[1], true); err != nil {
+					return
+				}
+			}
+		}()
+		return l, l.Addr().String()
+	}
+	l1, addr1 := listen(time.Millisecond * 500)
+	defer l1.Close()
+	l2, addr2 := listen(0)
+	defer l2.Close()
+
+	config := NewDefaultConfig()
+	config.SessionReadRequestTimeout.Set(time.Millisecond * 100)
+	config.SessionWriteRequestTimeout.Set(time.Millisecond * 100)
+
+	bc1 := NewBackendConn(addr1, 0, config)
+	defer bc1.Close()
+	bc2 := NewBackendConn(addr2, 0, config)
+	defer bc2.Close()
+
+	s := &Session{config: config}
+	defer func() {
+		if s.waiter != nil {
+			s.waiter.Close()
+		}
+	}()
+	var send = func(bc *BackendConn, args ...string) *Request {
+		r := newCacheRequest(args...)
+		r.Batch = &sync.WaitGroup{}
+		r.UnixNano = time.Now().UnixNano()
+		r.Expired = &atomic2.Bool{}
+		bc.PushBack(r)
+		watchResponse(r)
+		return r
+	}
+
+	r1 := send(bc1, "GET", "a")
+	r2 := send(bc2, "SET", "b", "1")
+
+	resp, err := s.handleResponse(r1)
+	assert.MustNoError(err)
+	assert.Must(resp.IsError() && r1.IsBroken())
+
+	resp, err = s.handleResponse(r2)
+	assert.MustNoError(err)
+	assert.Must(string(resp.Value) == "b" && !r2.IsBroken())
+}
@@ -0,0 +1,341 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/CodisLabs/codis/pkg/utils/math2"
+	"github.com/CodisLabs/codis/pkg/utils/rpc"
+	"github.com/CodisLabs/codis/pkg/utils/sync2/atomic2"
+)
+
+const (
+	SpanDecode  = "decode"
+	SpanQueue   = "queue"
+	SpanMigrate = "migrate"
+	SpanBackend = "backend"
+	SpanEncode  = "encode"
+)
+
+type tracer struct {
+	mu sync.Mutex
+
+	ratio  float64
+	closed bool
+
+	collector string
+	filename  string
+
+	input    chan *requestTrace
+	resource map[string]string
+
+	stats struct {
+		sampled  atomic2.Int64
+		exported atomic2.Int64
+		dropped  atomic2.Int64
+		errors   atomic2.Int64
+	}
+}
+
+func newTracer(config *Config) *tracer {
+	if config.TraceSampleRatio <= 0 {
+		return nil
+	}
+	t := &tracer{
+		ratio:     config.TraceSampleRatio,
+		collector: config.TraceCollector,
+		filename:  config.TraceFile,
+	}
+	t.input = make(chan *requestTrace, config.TraceMaxPending)
+	t.resource = map[string]string{
+		"service.name":       "codis-proxy",
+		"codis.product_name": config.ProductName,
+		"codis.proxy_addr":   config.ProxyAddr,
+	}
+	go t.loopExport(math2.MaxDuration(time.Millisecond*100, config.TraceExportPeriod.Duration()))
+	return t
+}
+
+func (t *tracer) sample(r *Request, peer string, decode int64) *requestTrace {
+	if t == nil || rand.Float64() >= t.ratio {
+		return nil
+	}
+	t.stats.sampled.Incr()
+
+	x := &requestTrace{tracer: t, start: decode}
+	rand.Read(x.traceId[:])
+	rand.Read(x.spanId[:])
+	x.attrs = map[string]string{
+		"db.system":         "redis",
+		"db.redis.database": strconv.Itoa(int(r.Database)),
+		"net.peer.name":     peer,
+	}
+	if decode != r.UnixNano {
+		x.add(SpanDecode, decode, r.UnixNano, "")
+	}
+	return x
+}
+
+func (t *tracer) push(x *requestTrace) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.input <- x:
+	default:
+		t.stats.dropped.Incr()
+	}
+}
+
+func (t *tracer) Close() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	t.closed = true
+	close(t.input)
+}
+
+func (t *tracer) loopExport(period time.Duration) {
+	var ticker = time.NewTicker(period)
+	defer ticker.Stop()
+
+	var batch []*requestTrace
+	for {
+		select {
+		case x, ok := <-t.input:
+			if !ok {
+				t.export(batch)
+				return
+			}
+			batch = append(batch, x)
+			if len(batch) < cap(t.input) {
+				continue
+			}
+		case <-ticker.C:
+		}
+		if len(batch) != 0 {
+			t.export(batch)
+			batch = nil
+		}
+	}
+}
+
+func (t *tracer) export(batch []*requestTrace) {
+	if len(batch) == 0 {
+		return
+	}
+	var spans []*otlpSpan
+	for _, x := range batch {
+		spans = append(spans, x.spans()...)
+	}
+	var err error
+	if t.collector != "" {
+		err = rpc.ApiPostJson(t.collector, t.newPayload(spans))
+	} else {
+		err = t.writeFile(spans)
+	}
+	if err != nil {
+		t.stats.errors.Incr()
+		log.WarnErrorf(err, "export %d traces failed", len(batch))
+	} else {
+		t.stats.exported.Add(int64(len(batch)))
+	}
+}
+
+func (t *tracer) writeFile(spans []*otlpSpan) error {
+	f, err := os.OpenFile(t.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, span := range spans {
+		if err := enc.Encode(span); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return errors.Trace(w.Flush())
+}
+
+type requestTrace struct {
+	mu sync.Mutex
+
+	tracer *tracer
+
+	traceId [16]byte
+	spanId  [8]byte
+
+	start int64
+	attrs map[string]string
+
+	children []traceSpan
+	finished bool
+	end      int64
+}
+
+type traceSpan struct {
+	name       string
+	start, end int64
+	addr       string
+}
+
+func (x *requestTrace) add(name string, start, end int64, addr string) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if !x.finished {
+		x.children = append(x.children, traceSpan{name, start, end, addr})
+	}
+}
+
+func (x *requestTrace) finish(r *Request, encode, end int64) {
+	if x == nil {
+		return
+	}
+	x.add(SpanEncode, encode, end, "")
+
+	x.mu.Lock()
+	x.attrs["db.operation"] = r.OpStr
+	x.finished, x.end = true, end
+	x.mu.Unlock()
+	x.tracer.push(x)
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceId      string          `json:"traceId"`
+	SpanId       string          `json:"spanId"`
+	ParentSpanId string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+}
+
+func newOtlpAttributes(m map[string]string) []otlpAttribute {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var attrs []otlpAttribute
+	for _, k := range keys {
+		attrs = append(attrs, otlpAttribute{Key: k, Value: otlpValue{m[k]}})
+	}
+	return attrs
+}
+
+func (x *requestTrace) spans() []*otlpSpan {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	const (
+		kindInternal = 1
+		kindServer   = 2
+		kindClient   = 3
+	)
+	var traceId = hex.EncodeToString(x.traceId[:])
+	var parentId = hex.EncodeToString(x.spanId[:])
+
+	var spans = []*otlpSpan{{
+		TraceId: traceId, SpanId: parentId,
+		Name: "codis.request", Kind: kindServer,
+		Start:      strconv.FormatInt(x.start, 10),
+		End:        strconv.FormatInt(x.end, 10),
+		Attributes: newOtlpAttributes(x.attrs),
+	}}
+	for _, c := range x.children {
+		var spanId [8]byte
+		rand.Read(spanId[:])
+		span := &otlpSpan{
+			TraceId: traceId, SpanId: hex.EncodeToString(spanId[:]), ParentSpanId: parentId,
+			Name: "codis." + c.name, Kind: kindInternal,
+			Start: strconv.FormatInt(c.start, 10),
+			End:   strconv.FormatInt(c.end, 10),
+		}
+		if c.addr != "" {
+			span.Kind = kindClient
+			span.Attributes = newOtlpAttributes(map[string]string{"net.peer.name": c.addr})
+		}
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+type otlpPayload struct {
+	ResourceSpans []*otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []*otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []*otlpSpan `json:"spans"`
+}
+
+func (t *tracer) newPayload(spans []*otlpSpan) *otlpPayload {
+	ss := &otlpScopeSpans{Spans: spans}
+	ss.Scope.Name = "github.com/CodisLabs/codis/pkg/proxy"
+	rs := &otlpResourceSpans{ScopeSpans: []*otlpScopeSpans{ss}}
+	rs.Resource.Attributes = newOtlpAttributes(t.resource)
+	return &otlpPayload{ResourceSpans: []*otlpResourceSpans{rs}}
+}
+
+type TraceStats struct {
+	Sampled  int64 `json:"sampled"`
+	Exported int64 `json:"exported"`
+	Dropped  int64 `json:"dropped"`
+	Errors   int64 `json:"errors"`
+}
+
+func (t *tracer) Stats() *TraceStats {
+	if t == nil {
+		return nil
+	}
+	return &TraceStats{
+		Sampled:  t.stats.sampled.Int64(),
+		Exported: t.stats.exported.Int64(),
+		Dropped:  t.stats.dropped.Int64(),
+		Errors:   t.stats.errors.Int64(),
+	}
+}
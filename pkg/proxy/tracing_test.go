@@ -0,0 +1,94 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+)
+
+func newTestTrace(t *tracer) *requestTrace {
+	r := newCacheRequest("GET", "a")
+	r.UnixNano = time.Now().UnixNano()
+	x := t.sample(r, "127.0.0.1:10000", r.UnixNano-int64(time.Microsecond))
+	assert.Must(x != nil)
+	x.add(SpanQueue, r.UnixNano, r.UnixNano+1000, "")
+	x.add(SpanBackend, r.UnixNano+1000, r.UnixNano+5000, "127.0.0.1:6379")
+	x.finish(r, r.UnixNano+5000, r.UnixNano+6000)
+	return x
+}
+
+func TestTraceFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "codis-trace")
+	assert.MustNoError(err)
+	defer os.RemoveAll(dir)
+
+	config := NewDefaultConfig()
+	assert.Must(newTracer(config) == nil)
+
+	config.TraceSampleRatio = 1
+	config.TraceFile = filepath.Join(dir, "trace.json")
+	tr := newTracer(config)
+	x := newTestTrace(tr)
+	x.add(SpanBackend, 0, 0, "ignored after finish")
+	tr.Close()
+
+	var spans []*otlpSpan
+	for i := 0; i < 100 && tr.stats.exported.Int64() == 0; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	f, err := os.Open(config.TraceFile)
+	assert.MustNoError(err)
+	defer f.Close()
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		span := &otlpSpan{}
+		assert.MustNoError(json.Unmarshal(scanner.Bytes(), span))
+		spans = append(spans, span)
+	}
+	assert.Must(len(spans) == 5)
+	assert.Must(spans[0].Name == "codis.request" && spans[0].ParentSpanId == "")
+	var names = []string{"codis.request", "codis.decode", "codis.queue", "codis.backend", "codis.encode"}
+	for i, span := range spans {
+		assert.Must(span.Name == names[i] && span.TraceId == spans[0].TraceId)
+		if i != 0 {
+			assert.Must(span.ParentSpanId == spans[0].SpanId)
+		}
+	}
+}
+
+func TestTraceCollector(t *testing.T) {
+	var payloads = make(chan *otlpPayload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := &otlpPayload{}
+		assert.MustNoError(json.NewDecoder(r.Body).Decode(p))
+		payloads <- p
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	config := NewDefaultConfig()
+	config.TraceSampleRatio = 1
+	config.TraceCollector = server.URL + "/v1/traces"
+	config.TraceExportPeriod.Set(time.Millisecond * 100)
+	tr := newTracer(config)
+	defer tr.Close()
+	newTestTrace(tr)
+
+	select {
+	case p := <-payloads:
+		assert.Must(len(p.ResourceSpans) == 1 && len(p.ResourceSpans[0].ScopeSpans) == 1)
+		assert.Must(len(p.ResourceSpans[0].ScopeSpans[0].Spans) == 5)
+	case <-time.After(time.Second * 5):
+		assert.Must(false)
+	}
+}
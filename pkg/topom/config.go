@@ -22,8 +22,9 @@ const DefaultConfig = `
 #                                                #
 ##################################################
 
-# Set Coordinator, only accept "zookeeper" & "etcd" & "filesystem".
-# for zookeeper/etcd, coorinator_auth accept "user:password" 
+# Set Coordinator, only accept "zookeeper" & "etcd" & "etcdv3" & "raft" & "filesystem".
+# for zookeeper/etcd/etcdv3, coorinator_auth accept "user:password" 
+# for raft, coordinator_addr lists members of codis-coordinator, coordinator_auth is its auth.
 # Quick Start
 coordinator_name = "filesystem"
 coordinator_addr = "/tmp/codis"
@@ -38,6 +39,11 @@ product_auth = ""
 # Set bind address for admin(rpc), tcp only.
 admin_addr = "0.0.0.0:18080"
 
+# Set leader election, more than one dashboard could run for the same product, only the
+# elected leader takes the lock and others stay as standby, which serve read-only apis.
+# Requires coordinator supports ephemeral nodes (zookeeper, etcd or etcdv3).
+leader_election = false
+
 # Set arguments for data migration (only accept 'sync' & 'semi-async').
 migration_method = "semi-async"
 migration_parallel_slots = 100
@@ -54,6 +60,31 @@ sentinel_down_after = "30s"
 sentinel_failover_timeout = "5m"
 sentinel_notification_script = ""
 sentinel_client_reconfig_script = ""
+
+# Set big key scanner, keys exceed bigkey_max_bytes or bigkey_max_length will be reported. (0 to disable)
+#   1. keys are scanned by SLOTSSCAN on a replica of each group (or the master if there is none).
+#   2. size of non-string keys is measured by MEMORY USAGE if supported by backend.
+bigkey_scan_period = "0"
+bigkey_scan_count = 100
+bigkey_max_bytes = "10mb"
+bigkey_max_length = 100000
+bigkey_max_report = 32
+
+# Set keyspace analysis, at most keyspace_sample_per_slot keys of each slot are sampled. (0 to disable)
+#   1. keys are sampled by SLOTSSCAN on a replica of each group (or the master if there is none).
+#   2. keys are grouped by prefix, which ends with the keyspace_prefix_depth-th occurrence of any
+#      character in keyspace_prefix_delimiters.
+#   3. report is stored in coordinator.
+keyspace_scan_period = "0"
+keyspace_sample_per_slot = 100
+keyspace_prefix_delimiters = ":"
+keyspace_prefix_depth = 1
+keyspace_max_prefixes = 256
+
+# Set topology history, a new version with a monotonic epoch is stored in coordinator whenever slots, groups,
+# proxies or sentinels are changed. Versions are postponed while slot actions are in progress, so that a migration
+# or rebalance is recorded as one version. At most history_max_versions versions are kept. (0 to disable)
+history_max_versions = 256
 `
 
 type Config struct {
@@ -65,6 +96,8 @@ type Config struct {
 
 	HostAdmin string `toml:"-" json:"-"`
 
+	LeaderElection bool `toml:"leader_election" json:"leader_election"`
+
 	ProductName string `toml:"product_name" json:"product_name"`
 	ProductAuth string `toml:"product_auth" json:"-"`
 
@@ -82,6 +115,20 @@ type Config struct {
 	SentinelFailoverTimeout      timesize.Duration `toml:"sentinel_failover_timeout" json:"sentinel_failover_timeout"`
 	SentinelNotificationScript   string            `toml:"sentinel_notification_script" json:"sentinel_notification_script"`
 	SentinelClientReconfigScript string            `toml:"sentinel_client_reconfig_script" json:"sentinel_client_reconfig_script"`
+
+	BigKeyScanPeriod timesize.Duration `toml:"bigkey_scan_period" json:"bigkey_scan_period"`
+	BigKeyScanCount  int               `toml:"bigkey_scan_count" json:"bigkey_scan_count"`
+	BigKeyMaxBytes   bytesize.Int64    `toml:"bigkey_max_bytes" json:"bigkey_max_bytes"`
+	BigKeyMaxLength  int64             `toml:"bigkey_max_length" json:"bigkey_max_length"`
+	BigKeyMaxReport  int               `toml:"bigkey_max_report" json:"bigkey_max_report"`
+
+	KeyspaceScanPeriod       timesize.Duration `toml:"keyspace_scan_period" json:"keyspace_scan_period"`
+	KeyspaceSamplePerSlot    int               `toml:"keyspace_sample_per_slot" json:"keyspace_sample_per_slot"`
+	KeyspacePrefixDelimiters string            `toml:"keyspace_prefix_delimiters" json:"keyspace_prefix_delimiters"`
+	KeyspacePrefixDepth      int               `toml:"keyspace_prefix_depth" json:"keyspace_prefix_depth"`
+	KeyspaceMaxPrefixes      int               `toml:"keyspace_max_prefixes" json:"keyspace_max_prefixes"`
+
+	HistoryMaxVersions int `toml:"history_max_versions" json:"history_max_versions"`
 }
 
 func NewDefaultConfig() *Config {
@@ -157,5 +204,35 @@ func (c *Config) Validate() error {
 	if c.SentinelFailoverTimeout <= 0 {
 		return errors.New("invalid sentinel_failover_timeout")
 	}
+	if c.BigKeyScanPeriod < 0 {
+		return errors.New("invalid bigkey_scan_period")
+	}
+	if c.BigKeyScanCount <= 0 {
+		return errors.New("invalid bigkey_scan_count")
+	}
+	if c.BigKeyMaxBytes <= 0 {
+		return errors.New("invalid bigkey_max_bytes")
+	}
+	if c.BigKeyMaxLength <= 0 {
+		return errors.New("invalid bigkey_max_length")
+	}
+	if c.BigKeyMaxReport <= 0 {
+		return errors.New("invalid bigkey_max_report")
+	}
+	if c.KeyspaceScanPeriod < 0 {
+		return errors.New("invalid keyspace_scan_period")
+	}
+	if c.KeyspaceSamplePerSlot <= 0 {
+		return errors.New("invalid keyspace_sample_per_slot")
+	}
+	if c.KeyspacePrefixDepth < 0 {
+		return errors.New("invalid keyspace_prefix_depth")
+	}
+	if c.KeyspaceMaxPrefixes <= 0 {
+		return errors.New("invalid keyspace_max_prefixes")
+	}
+	if c.HistoryMaxVersions < 0 {
+		return errors.New("invalid history_max_versions")
+	}
 	return nil
 }
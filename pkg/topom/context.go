@@ -23,12 +23,15 @@ type context struct {
 	proxy map[string]*models.Proxy
 
 	sentinel *models.Sentinel
+	policy   *models.CommandPolicy
 
 	hosts struct {
 		sync.Mutex
 		m map[string]net.IP
 	}
 	method int
+	epoch  int64
+	prev   int64
 }
 
 func (ctx *context) getSlotMapping(sid int) (*models.SlotMapping, error) {
@@ -84,6 +87,9 @@ func (ctx *context) toSlot(m *models.SlotMapping, p *models.Proxy) *models.Slot
 		Locked: ctx.isSlotLocked(m),
 
 		ForwardMethod: ctx.method,
+
+		Epoch:     ctx.epoch,
+		PrevEpoch: ctx.prev,
 	}
 	switch m.Action.State {
 	case models.ActionNothing, models.ActionPending:
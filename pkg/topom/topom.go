@@ -38,6 +38,7 @@ type Topom struct {
 		proxy map[string]*models.Proxy
 
 		sentinel *models.Sentinel
+		policy   *models.CommandPolicy
 	}
 
 	exit struct {
@@ -69,12 +70,46 @@ type Topom struct {
 		proxies map[string]*ProxyStats
 	}
 
+	bigkey struct {
+		report  *BigKeyReport
+		running bool
+	}
+
+	keyspace struct {
+		running bool
+	}
+
+	history struct {
+		last   *models.Topology
+		notify chan struct{}
+	}
+
+	epoch struct {
+		value int64
+		limit int64
+
+		// synced is the epoch of the latest fill sent to all proxies, proxies
+		// that haven't applied all the fills up to it must be reinitialized.
+		// It's 0 until the first resync, which sends all the slots.
+		synced int64
+	}
+
 	ha struct {
 		redisp *redis.Pool
 
 		monitor *redis.Sentinel
 		masters map[int]string
 	}
+
+	election struct {
+		running  bool
+		standby  bool
+		routines bool
+
+		node string
+
+		refreshed time.Time
+	}
 }
 
 var ErrClosedTopom = errors.New("use of closed topom")
@@ -108,6 +143,7 @@ func New(client models.Client, config *Config) (*Topom, error) {
 	s.store = models.NewStore(client, config.ProductName)
 
 	s.stats.redisp = redis.NewPool(config.ProductAuth, time.Second*5)
+	s.history.notify = make(chan struct{}, 1)
 	s.stats.servers = make(map[string]*RedisStats)
 	s.stats.proxies = make(map[string]*ProxyStats)
 
@@ -167,6 +203,12 @@ func (s *Topom) Close() error {
 
 	defer s.store.Close()
 
+	if s.election.node != "" {
+		if err := s.store.Resign(s.election.node); err != nil {
+			log.WarnErrorf(err, "store: resign leader of %s failed", s.config.ProductName)
+		}
+		s.election.node = ""
+	}
 	if s.online {
 		if err := s.store.Release(); err != nil {
 			log.ErrorErrorf(err, "store: release lock of %s failed", s.config.ProductName)
@@ -182,8 +224,14 @@ func (s *Topom) Start(routines bool) error {
 	if s.closed {
 		return ErrClosedTopom
 	}
-	if s.online {
+	if s.online || s.election.running {
 		return nil
+	}
+	if s.config.LeaderElection {
+		s.election.running = true
+		s.election.standby = true
+		s.election.routines = routines
+		go s.runElection()
 	} else {
 		if err := s.store.Acquire(s.model); err != nil {
 			log.ErrorErrorf(err, "store: acquire lock of %s failed", s.config.ProductName)
@@ -195,11 +243,13 @@ func (s *Topom) Start(routines bool) error {
 	if !routines {
 		return nil
 	}
-	ctx, err := s.newContext()
-	if err != nil {
-		return err
+	if s.online {
+		ctx, err := s.newContext()
+		if err != nil {
+			return err
+		}
+		s.rewatchSentinels(ctx.sentinel.Servers)
 	}
-	s.rewatchSentinels(ctx.sentinel.Servers)
 
 	go func() {
 		for !s.IsClosed() {
@@ -249,6 +299,54 @@ func (s *Topom) Start(routines bool) error {
 		}
 	}()
 
+	go func() {
+		for !s.IsClosed() {
+			period := s.config.BigKeyScanPeriod.Duration()
+			if period == 0 {
+				return
+			}
+			if s.IsOnline() {
+				if _, err := s.ScanBigKeys(); err != nil {
+					log.WarnErrorf(err, "scan big keys failed")
+				}
+			}
+			time.Sleep(period)
+		}
+	}()
+
+	go func() {
+		for !s.IsClosed() {
+			period := s.config.KeyspaceScanPeriod.Duration()
+			if period == 0 {
+				return
+			}
+			if s.IsOnline() {
+				if _, err := s.AnalyzeKeyspace(); err != nil {
+					log.WarnErrorf(err, "analyze keyspace failed")
+				}
+			}
+			time.Sleep(period)
+		}
+	}()
+
+	go func() {
+		for !s.IsClosed() {
+			if s.config.HistoryMaxVersions == 0 {
+				return
+			}
+			if s.IsOnline() {
+				if _, err := s.RecordHistory(); err != nil {
+					log.WarnErrorf(err, "record topology history failed")
+					time.Sleep(time.Second * 5)
+				}
+			}
+			select {
+			case <-s.history.notify:
+			case <-time.After(time.Second):
+			}
+		}
+	}()
+
 	return nil
 }
 
@@ -262,11 +360,19 @@ func (s *Topom) Model() *models.Topom {
 
 var ErrNotOnline = errors.New("topom is not online")
 
+// standbyRefreshInterval limits how often a standby reloads all the models
+// from coordinator to serve read-only apis.
+const standbyRefreshInterval = time.Second
+
 func (s *Topom) newContext() (*context, error) {
 	if s.closed {
 		return nil, ErrClosedTopom
 	}
-	if s.online {
+	if s.election.standby && time.Since(s.election.refreshed) >= standbyRefreshInterval {
+		s.election.refreshed = time.Now()
+		s.dirtyCacheAll()
+	}
+	if s.online || s.election.standby {
 		if err := s.refillCache(); err != nil {
 			return nil, err
 		} else {
@@ -275,6 +381,7 @@ func (s *Topom) newContext() (*context, error) {
 			ctx.group = s.cache.group
 			ctx.proxy = s.cache.proxy
 			ctx.sentinel = s.cache.sentinel
+			ctx.policy = s.cache.policy
 			ctx.hosts.m = make(map[string]net.IP)
 			ctx.method, _ = models.ParseForwardMethod(s.config.MigrationMethod)
 			return ctx, nil
@@ -294,6 +401,7 @@ func (s *Topom) Stats() (*Stats, error) {
 
 	stats := &Stats{}
 	stats.Closed = s.closed
+	stats.Standby = s.election.standby
 
 	stats.Slots = ctx.slots
 
@@ -332,7 +440,8 @@ func (s *Topom) Stats() (*Stats, error) {
 }
 
 type Stats struct {
-	Closed bool `json:"closed"`
+	Closed  bool `json:"closed"`
+	Standby bool `json:"standby,omitempty"`
 
 	Slots []*models.SlotMapping `json:"slots"`
 
@@ -449,6 +558,7 @@ type Overview struct {
 	Compile string        `json:"compile"`
 	Config  *Config       `json:"config,omitempty"`
 	Model   *models.Topom `json:"model,omitempty"`
+	Leader  *models.Topom `json:"leader,omitempty"`
 	Stats   *Stats        `json:"stats,omitempty"`
 }
 
@@ -456,12 +566,20 @@ func (s *Topom) Overview() (*Overview, error) {
 	if stats, err := s.Stats(); err != nil {
 		return nil, err
 	} else {
-		return &Overview{
+		o := &Overview{
 			Version: utils.Version,
 			Compile: utils.Compile,
 			Config:  s.Config(),
 			Model:   s.Model(),
 			Stats:   stats,
-		}, nil
+		}
+		if stats.Standby {
+			if leader, err := s.Leader(); err != nil {
+				log.WarnErrorf(err, "load leader failed")
+			} else {
+				o.Leader = leader
+			}
+		}
+		return o, nil
 	}
 }
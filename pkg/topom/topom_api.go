@@ -5,6 +5,7 @@ package topom
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
@@ -51,6 +52,19 @@ func newApiServer(t *Topom) http.Handler {
 	m.Use(func(c martini.Context, w http.ResponseWriter) {
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	})
+	m.Use(func(w http.ResponseWriter, req *http.Request, c martini.Context) {
+		if req.Method != "GET" && isLeaderOnlyPath(req.URL.Path) && t.IsStandby() {
+			var err = ErrStandbyTopom
+			if leader, _ := t.Leader(); leader != nil {
+				err = errors.Errorf("topom is standby, leader is %s", leader.AdminAddr)
+			}
+			code, body := rpc.ApiResponseError(err)
+			w.WriteHeader(code)
+			io.WriteString(w, body)
+			return
+		}
+		c.Next()
+	})
 
 	api := &apiServer{topom: t}
 
@@ -82,6 +96,7 @@ func newApiServer(t *Topom) http.Handler {
 			r.Put("/online/:xauth/:addr", api.OnlineProxy)
 			r.Put("/reinit/:xauth/:token", api.ReinitProxy)
 			r.Put("/remove/:xauth/:token/:force", api.RemoveProxy)
+			r.Put("/drain/:xauth/:token/:timeout/:force", api.DrainProxy)
 		})
 		r.Group("/group", func(r martini.Router) {
 			r.Put("/create/:xauth/:gid", api.CreateGroup)
@@ -120,6 +135,24 @@ func newApiServer(t *Topom) http.Handler {
 			r.Get("/info/:addr", api.InfoSentinel)
 			r.Get("/info/:addr/monitored", api.InfoSentinelMonitored)
 		})
+		r.Group("/bigkeys", func(r martini.Router) {
+			r.Get("/:xauth", api.BigKeys)
+			r.Put("/scan/:xauth", api.ScanBigKeys)
+		})
+		r.Group("/keyspace", func(r martini.Router) {
+			r.Get("/:xauth", api.KeyspaceReport)
+			r.Put("/analyze/:xauth", api.AnalyzeKeyspace)
+		})
+		r.Group("/history", func(r martini.Router) {
+			r.Get("/:xauth", api.History)
+			r.Get("/epoch/:xauth/:epoch", api.HistoryTopology)
+			r.Get("/diff/:xauth/:from/:to", api.HistoryDiff)
+			r.Put("/rollback/:xauth/:epoch/:confirm", api.HistoryRollback)
+		})
+		r.Group("/policy", func(r martini.Router) {
+			r.Get("/:xauth", api.CommandPolicy)
+			r.Put("/:xauth", binding.Json(models.CommandPolicy{}), api.SetCommandPolicy)
+		})
 	})
 
 	m.MapTo(r, (*martini.Routes)(nil))
@@ -127,6 +160,18 @@ func newApiServer(t *Topom) http.Handler {
 	return m
 }
 
+func isLeaderOnlyPath(path string) bool {
+	if !strings.HasPrefix(path, "/api/topom/") {
+		return false
+	}
+	for _, prefix := range []string{"/api/topom/shutdown/", "/api/topom/loglevel/"} {
+		if strings.HasPrefix(path, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
 func (s *apiServer) verifyXAuth(params martini.Params) error {
 	if s.topom.IsClosed() {
 		return ErrClosedTopom
@@ -297,6 +342,29 @@ func (s *apiServer) RemoveProxy(params martini.Params) (int, string) {
 	}
 }
 
+func (s *apiServer) DrainProxy(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	token, err := s.parseToken(params)
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	timeout, err := s.parseInteger(params, "timeout")
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	force, err := s.parseInteger(params, "force")
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.topom.DrainProxy(token, time.Second*time.Duration(timeout), force != 0); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson("OK")
+	}
+}
+
 func (s *apiServer) CreateGroup(params martini.Params) (int, string) {
 	if err := s.verifyXAuth(params); err != nil {
 		return rpc.ApiResponseError(err)
@@ -504,6 +572,132 @@ func (s *apiServer) ResyncSentinels(params martini.Params) (int, string) {
 	}
 }
 
+func (s *apiServer) BigKeys(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	return rpc.ApiResponseJson(s.topom.BigKeys())
+}
+
+func (s *apiServer) ScanBigKeys(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if report, err := s.topom.ScanBigKeys(); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(report)
+	}
+}
+
+func (s *apiServer) KeyspaceReport(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if r, err := s.topom.KeyspaceReport(); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(r)
+	}
+}
+
+func (s *apiServer) AnalyzeKeyspace(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if r, err := s.topom.AnalyzeKeyspace(); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(r)
+	}
+}
+
+func (s *apiServer) History(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if epochs, err := s.topom.History(); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(epochs)
+	}
+}
+
+func (s *apiServer) HistoryTopology(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	epoch, err := s.parseInteger(params, "epoch")
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if t, err := s.topom.HistoryTopology(int64(epoch)); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(t)
+	}
+}
+
+func (s *apiServer) HistoryDiff(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	from, err := s.parseInteger(params, "from")
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	to, err := s.parseInteger(params, "to")
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if d, err := s.topom.HistoryDiff(int64(from), int64(to)); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(d)
+	}
+}
+
+func (s *apiServer) HistoryRollback(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	epoch, err := s.parseInteger(params, "epoch")
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	confirm, err := s.parseInteger(params, "confirm")
+	if err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if plan, err := s.topom.HistoryRollback(int64(epoch), confirm != 0); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(plan)
+	}
+}
+
+func (s *apiServer) CommandPolicy(params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if p, err := s.topom.CommandPolicy(); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson(p)
+	}
+}
+
+func (s *apiServer) SetCommandPolicy(policy models.CommandPolicy, params martini.Params) (int, string) {
+	if err := s.verifyXAuth(params); err != nil {
+		return rpc.ApiResponseError(err)
+	}
+	if err := s.topom.SetCommandPolicy(&policy); err != nil {
+		return rpc.ApiResponseError(err)
+	} else {
+		return rpc.ApiResponseJson("OK")
+	}
+}
+
 func (s *apiServer) InfoServer(params martini.Params) (int, string) {
 	addr, err := s.parseAddr(params)
 	if err != nil {
@@ -852,6 +1046,15 @@ func (c *ApiClient) RemoveProxy(token string, force bool) error {
 	return rpc.ApiPutJson(url, nil, nil)
 }
 
+func (c *ApiClient) DrainProxy(token string, timeout time.Duration, force bool) error {
+	var value int
+	if force {
+		value = 1
+	}
+	url := c.encodeURL("/api/topom/proxy/drain/%s/%s/%d/%d", c.xauth, token, int64(timeout/time.Second), value)
+	return rpc.ApiPutJson(url, nil, nil)
+}
+
 func (c *ApiClient) CreateGroup(gid int) error {
 	url := c.encodeURL("/api/topom/group/create/%s/%d", c.xauth, gid)
 	return rpc.ApiPutJson(url, nil, nil)
@@ -929,6 +1132,96 @@ func (c *ApiClient) ResyncSentinels() error {
 	return rpc.ApiPutJson(url, nil, nil)
 }
 
+func (c *ApiClient) BigKeys() (*BigKeyReport, error) {
+	url := c.encodeURL("/api/topom/bigkeys/%s", c.xauth)
+	var report *BigKeyReport
+	if err := rpc.ApiGetJson(url, &report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (c *ApiClient) ScanBigKeys() (*BigKeyReport, error) {
+	url := c.encodeURL("/api/topom/bigkeys/scan/%s", c.xauth)
+	var report *BigKeyReport
+	if err := rpc.ApiPutJson(url, nil, &report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (c *ApiClient) KeyspaceReport() (*models.KeyspaceReport, error) {
+	url := c.encodeURL("/api/topom/keyspace/%s", c.xauth)
+	var report *models.KeyspaceReport
+	if err := rpc.ApiGetJson(url, &report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (c *ApiClient) AnalyzeKeyspace() (*models.KeyspaceReport, error) {
+	url := c.encodeURL("/api/topom/keyspace/analyze/%s", c.xauth)
+	var report *models.KeyspaceReport
+	if err := rpc.ApiPutJson(url, nil, &report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (c *ApiClient) History() ([]int64, error) {
+	url := c.encodeURL("/api/topom/history/%s", c.xauth)
+	var epochs []int64
+	if err := rpc.ApiGetJson(url, &epochs); err != nil {
+		return nil, err
+	}
+	return epochs, nil
+}
+
+func (c *ApiClient) HistoryTopology(epoch int64) (*models.Topology, error) {
+	url := c.encodeURL("/api/topom/history/epoch/%s/%d", c.xauth, epoch)
+	t := &models.Topology{}
+	if err := rpc.ApiGetJson(url, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (c *ApiClient) HistoryDiff(from, to int64) (*models.TopologyDiff, error) {
+	url := c.encodeURL("/api/topom/history/diff/%s/%d/%d", c.xauth, from, to)
+	d := &models.TopologyDiff{}
+	if err := rpc.ApiGetJson(url, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (c *ApiClient) HistoryRollback(epoch int64, confirm bool) (*RollbackPlan, error) {
+	var value int
+	if confirm {
+		value = 1
+	}
+	url := c.encodeURL("/api/topom/history/rollback/%s/%d/%d", c.xauth, epoch, value)
+	plan := &RollbackPlan{}
+	if err := rpc.ApiPutJson(url, nil, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (c *ApiClient) CommandPolicy() (*models.CommandPolicy, error) {
+	url := c.encodeURL("/api/topom/policy/%s", c.xauth)
+	policy := &models.CommandPolicy{}
+	if err := rpc.ApiGetJson(url, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (c *ApiClient) SetCommandPolicy(policy *models.CommandPolicy) error {
+	url := c.encodeURL("/api/topom/policy/%s", c.xauth)
+	return rpc.ApiPutJson(url, policy, nil)
+}
+
 func (c *ApiClient) SyncCreateAction(addr string) error {
 	url := c.encodeURL("/api/topom/group/action/create/%s/%s", c.xauth, addr)
 	return rpc.ApiPutJson(url, nil, nil)
@@ -0,0 +1,213 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package topom
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/CodisLabs/codis/pkg/utils/redis"
+	"github.com/CodisLabs/codis/pkg/utils/rpc"
+	"github.com/CodisLabs/codis/pkg/utils/sync2"
+)
+
+type BigKey struct {
+	*redis.KeyInfo
+
+	Slot int `json:"slot"`
+}
+
+type BigKeyGroup struct {
+	GroupId int    `json:"group_id"`
+	Server  string `json:"server"`
+
+	Keys    []*BigKey `json:"keys"`
+	Scanned int64     `json:"scanned"`
+	Memory  bool      `json:"memory,omitempty"`
+
+	Error *rpc.RemoteError `json:"error,omitempty"`
+}
+
+type BigKeyReport struct {
+	Groups []*BigKeyGroup `json:"groups"`
+
+	UnixTime int64 `json:"unixtime"`
+	Duration int64 `json:"duration_ms"`
+}
+
+type keyScanTarget struct {
+	GroupId int
+	Server  string
+	Slots   []int
+}
+
+func (ctx *context) getKeyScanTargets() []*keyScanTarget {
+	var targets = make(map[int]*keyScanTarget)
+	for _, g := range ctx.group {
+		if len(g.Servers) == 0 {
+			continue
+		}
+		x := &keyScanTarget{GroupId: g.Id}
+		x.Server = g.Servers[len(g.Servers)-1].Addr
+		targets[g.Id] = x
+	}
+	for _, m := range ctx.slots {
+		if x := targets[m.GroupId]; x != nil {
+			x.Slots = append(x.Slots, m.Id)
+		}
+	}
+	var list []*keyScanTarget
+	for _, x := range targets {
+		if len(x.Slots) != 0 {
+			list = append(list, x)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].GroupId < list[j].GroupId
+	})
+	return list
+}
+
+func supportMemoryUsage(c *redis.Client) bool {
+	info, err := c.Info()
+	if err != nil {
+		return false
+	}
+	v := strings.SplitN(info["redis_version"], ".", 2)
+	if n, err := strconv.Atoi(v[0]); err != nil || n < 4 {
+		return false
+	}
+	return true
+}
+
+func (s *Topom) newKeyScanClient(x *keyScanTarget) (*redis.Client, error) {
+	return redis.NewClient(x.Server, s.config.ProductAuth, time.Second*5)
+}
+
+func (s *Topom) scanKeys(c *redis.Client, slots []int, count, limit int, memory bool, fn func(slot int, infos []*redis.KeyInfo)) error {
+	for _, sid := range slots {
+		var cursor, total int
+		for limit == 0 || total < limit {
+			if s.IsClosed() {
+				return ErrClosedTopom
+			}
+			next, keys, err := c.SlotsScan(sid, cursor, count)
+			if err != nil {
+				return err
+			}
+			if len(keys) != 0 {
+				infos, err := c.KeysInfo(keys, memory)
+				if err != nil {
+					return err
+				}
+				fn(sid, infos)
+				total += len(keys)
+			}
+			if cursor = next; cursor == 0 {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Topom) isBigKey(x *redis.KeyInfo) bool {
+	return x.Bytes > s.config.BigKeyMaxBytes.Int64() || (x.Type != "string" && x.Length > s.config.BigKeyMaxLength)
+}
+
+func (s *Topom) scanBigKeys(x *keyScanTarget) *BigKeyGroup {
+	g := &BigKeyGroup{GroupId: x.GroupId, Server: x.Server}
+	err := func() error {
+		c, err := s.newKeyScanClient(x)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+
+		g.Memory = supportMemoryUsage(c)
+
+		return s.scanKeys(c, x.Slots, s.config.BigKeyScanCount, 0, g.Memory, func(slot int, infos []*redis.KeyInfo) {
+			for _, info := range infos {
+				if s.isBigKey(info) {
+					g.Keys = append(g.Keys, &BigKey{KeyInfo: info, Slot: slot})
+				}
+			}
+			g.Scanned += int64(len(infos))
+		})
+	}()
+	if err != nil {
+		log.WarnErrorf(err, "scan big keys of group-[%d] on %s failed", x.GroupId, x.Server)
+		g.Error = rpc.NewRemoteError(err)
+	}
+
+	sort.SliceStable(g.Keys, func(i, j int) bool {
+		a, b := g.Keys[i], g.Keys[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.Length > b.Length
+	})
+	if n := s.config.BigKeyMaxReport; len(g.Keys) > n {
+		g.Keys = g.Keys[:n]
+	}
+	return g
+}
+
+var ErrBigKeyScanRunning = errors.New("big key scanner is running")
+
+func (s *Topom) ScanBigKeys() (*BigKeyReport, error) {
+	s.mu.Lock()
+	ctx, err := s.newContext()
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if s.bigkey.running {
+		s.mu.Unlock()
+		return nil, errors.Trace(ErrBigKeyScanRunning)
+	}
+	s.bigkey.running = true
+	targets := ctx.getKeyScanTargets()
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.bigkey.running = false
+		s.mu.Unlock()
+	}()
+
+	var start = time.Now()
+
+	var fut sync2.Future
+	for _, x := range targets {
+		fut.Add()
+		go func(x *keyScanTarget) {
+			fut.Done(strconv.Itoa(x.GroupId), s.scanBigKeys(x))
+		}(x)
+	}
+	report := &BigKeyReport{}
+	for _, v := range fut.Wait() {
+		report.Groups = append(report.Groups, v.(*BigKeyGroup))
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		return report.Groups[i].GroupId < report.Groups[j].GroupId
+	})
+	report.UnixTime = time.Now().Unix()
+	report.Duration = int64(time.Since(start) / time.Millisecond)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bigkey.report = report
+	return report, nil
+}
+
+func (s *Topom) BigKeys() *BigKeyReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bigkey.report
+}
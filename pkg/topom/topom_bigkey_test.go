@@ -0,0 +1,50 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package topom
+
+import (
+	"testing"
+
+	"github.com/CodisLabs/codis/pkg/models"
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+	"github.com/CodisLabs/codis/pkg/utils/redis"
+)
+
+func TestKeyScanTargets(x *testing.T) {
+	ctx := &context{}
+	ctx.group = map[int]*models.Group{
+		1: {Id: 1, Servers: []*models.GroupServer{{Addr: "master1"}, {Addr: "slave1"}}},
+		2: {Id: 2, Servers: []*models.GroupServer{{Addr: "master2"}}},
+		3: {Id: 3},
+	}
+	for i := 0; i < MaxSlotNum; i++ {
+		m := &models.SlotMapping{Id: i}
+		switch {
+		case i < 10:
+			m.GroupId = 1
+		case i < 15:
+			m.GroupId = 2
+		case i < 20:
+			m.GroupId = 3
+		}
+		ctx.slots = append(ctx.slots, m)
+	}
+	targets := ctx.getKeyScanTargets()
+	assert.Must(len(targets) == 2)
+	assert.Must(targets[0].GroupId == 1 && targets[0].Server == "slave1" && len(targets[0].Slots) == 10)
+	assert.Must(targets[1].GroupId == 2 && targets[1].Server == "master2" && len(targets[1].Slots) == 5)
+}
+
+func TestIsBigKey(x *testing.T) {
+	config := NewDefaultConfig()
+	config.BigKeyMaxBytes = 1024
+	config.BigKeyMaxLength = 100
+	t := &Topom{config: config}
+
+	assert.Must(t.isBigKey(&redis.KeyInfo{Type: "string", Length: 2048, Bytes: 2048}))
+	assert.Must(!t.isBigKey(&redis.KeyInfo{Type: "string", Length: 512, Bytes: 512}))
+	assert.Must(t.isBigKey(&redis.KeyInfo{Type: "hash", Length: 101}))
+	assert.Must(t.isBigKey(&redis.KeyInfo{Type: "list", Length: 10, Bytes: 4096}))
+	assert.Must(!t.isBigKey(&redis.KeyInfo{Type: "zset", Length: 100, Bytes: 1000}))
+}
@@ -39,12 +39,28 @@ func (s *Topom) dirtySentinelCache() {
 	})
 }
 
+func (s *Topom) dirtyPolicyCache() {
+	s.cache.hooks.PushBack(func() {
+		s.cache.policy = nil
+	})
+}
+
+// dirtyHistory wakes up the history loop once the topology is changed through
+// the store helpers, the change is recorded after the lock is released.
+func (s *Topom) dirtyHistory() {
+	select {
+	case s.history.notify <- struct{}{}:
+	default:
+	}
+}
+
 func (s *Topom) dirtyCacheAll() {
 	s.cache.hooks.PushBack(func() {
 		s.cache.slots = nil
 		s.cache.group = nil
 		s.cache.proxy = nil
 		s.cache.sentinel = nil
+		s.cache.policy = nil
 	})
 }
 
@@ -77,6 +93,12 @@ func (s *Topom) refillCache() error {
 	} else {
 		s.cache.sentinel = sentinel
 	}
+	if policy, err := s.refillCachePolicy(s.cache.policy); err != nil {
+		log.ErrorErrorf(err, "store: load policy failed")
+		return errors.Errorf("store: load policy failed")
+	} else {
+		s.cache.policy = policy
+	}
 	return nil
 }
 
@@ -157,19 +179,58 @@ func (s *Topom) refillCacheSentinel(sentinel *models.Sentinel) (*models.Sentinel
 	return &models.Sentinel{}, nil
 }
 
+func (s *Topom) refillCachePolicy(policy *models.CommandPolicy) (*models.CommandPolicy, error) {
+	if policy != nil {
+		return policy, nil
+	}
+	p, err := s.store.LoadCommandPolicy(false)
+	if err != nil {
+		return nil, err
+	}
+	if p != nil {
+		return p, nil
+	}
+	return &models.CommandPolicy{}, nil
+}
+
 func (s *Topom) storeUpdateSlotMapping(m *models.SlotMapping) error {
 	log.Warnf("update slot-[%d]:\n%s", m.Id, m.Encode())
+	s.dirtyHistory()
 	if err := s.store.UpdateSlotMapping(m); err != nil {
 		log.ErrorErrorf(err, "store: update slot-[%d] failed", m.Id)
+		s.dirtySlotsCache(m.Id)
 		return errors.Errorf("store: update slot-[%d] failed", m.Id)
 	}
 	return nil
 }
 
+func (s *Topom) batchUpdateSlotMapping(b *models.Batch, m *models.SlotMapping) {
+	log.Warnf("update slot-[%d]:\n%s", m.Id, m.Encode())
+	b.UpdateSlotMapping(m)
+}
+
+func (s *Topom) batchUpdateGroup(b *models.Batch, g *models.Group) {
+	log.Warnf("update group-[%d]:\n%s", g.Id, g.Encode())
+	b.UpdateGroup(g)
+}
+
+func (s *Topom) storeCommit(b *models.Batch) error {
+	log.Warnf("commit %d updates", b.Len())
+	s.dirtyHistory()
+	if err := s.store.Commit(b); err != nil {
+		log.ErrorErrorf(err, "store: commit %d updates failed", b.Len())
+		s.dirtyCacheAll()
+		return errors.Errorf("store: commit %d updates failed", b.Len())
+	}
+	return nil
+}
+
 func (s *Topom) storeCreateGroup(g *models.Group) error {
 	log.Warnf("create group-[%d]:\n%s", g.Id, g.Encode())
+	s.dirtyHistory()
 	if err := s.store.UpdateGroup(g); err != nil {
 		log.ErrorErrorf(err, "store: create group-[%d] failed", g.Id)
+		s.dirtyGroupCache(g.Id)
 		return errors.Errorf("store: create group-[%d] failed", g.Id)
 	}
 	return nil
@@ -177,8 +238,10 @@ func (s *Topom) storeCreateGroup(g *models.Group) error {
 
 func (s *Topom) storeUpdateGroup(g *models.Group) error {
 	log.Warnf("update group-[%d]:\n%s", g.Id, g.Encode())
+	s.dirtyHistory()
 	if err := s.store.UpdateGroup(g); err != nil {
 		log.ErrorErrorf(err, "store: update group-[%d] failed", g.Id)
+		s.dirtyGroupCache(g.Id)
 		return errors.Errorf("store: update group-[%d] failed", g.Id)
 	}
 	return nil
@@ -186,6 +249,7 @@ func (s *Topom) storeUpdateGroup(g *models.Group) error {
 
 func (s *Topom) storeRemoveGroup(g *models.Group) error {
 	log.Warnf("remove group-[%d]:\n%s", g.Id, g.Encode())
+	s.dirtyHistory()
 	if err := s.store.DeleteGroup(g.Id); err != nil {
 		log.ErrorErrorf(err, "store: remove group-[%d] failed", g.Id)
 		return errors.Errorf("store: remove group-[%d] failed", g.Id)
@@ -195,8 +259,10 @@ func (s *Topom) storeRemoveGroup(g *models.Group) error {
 
 func (s *Topom) storeCreateProxy(p *models.Proxy) error {
 	log.Warnf("create proxy-[%s]:\n%s", p.Token, p.Encode())
+	s.dirtyHistory()
 	if err := s.store.UpdateProxy(p); err != nil {
 		log.ErrorErrorf(err, "store: create proxy-[%s] failed", p.Token)
+		s.dirtyProxyCache(p.Token)
 		return errors.Errorf("store: create proxy-[%s] failed", p.Token)
 	}
 	return nil
@@ -204,8 +270,10 @@ func (s *Topom) storeCreateProxy(p *models.Proxy) error {
 
 func (s *Topom) storeUpdateProxy(p *models.Proxy) error {
 	log.Warnf("update proxy-[%s]:\n%s", p.Token, p.Encode())
+	s.dirtyHistory()
 	if err := s.store.UpdateProxy(p); err != nil {
 		log.ErrorErrorf(err, "store: update proxy-[%s] failed", p.Token)
+		s.dirtyProxyCache(p.Token)
 		return errors.Errorf("store: update proxy-[%s] failed", p.Token)
 	}
 	return nil
@@ -213,6 +281,7 @@ func (s *Topom) storeUpdateProxy(p *models.Proxy) error {
 
 func (s *Topom) storeRemoveProxy(p *models.Proxy) error {
 	log.Warnf("remove proxy-[%s]:\n%s", p.Token, p.Encode())
+	s.dirtyHistory()
 	if err := s.store.DeleteProxy(p.Token); err != nil {
 		log.ErrorErrorf(err, "store: remove proxy-[%s] failed", p.Token)
 		return errors.Errorf("store: remove proxy-[%s] failed", p.Token)
@@ -222,9 +291,57 @@ func (s *Topom) storeRemoveProxy(p *models.Proxy) error {
 
 func (s *Topom) storeUpdateSentinel(p *models.Sentinel) error {
 	log.Warnf("update sentinel:\n%s", p.Encode())
+	s.dirtyHistory()
 	if err := s.store.UpdateSentinel(p); err != nil {
 		log.ErrorErrorf(err, "store: update sentinel failed")
+		s.dirtySentinelCache()
 		return errors.Errorf("store: update sentinel failed")
 	}
 	return nil
 }
+
+func (s *Topom) storeUpdateCommandPolicy(p *models.CommandPolicy) error {
+	log.Warnf("update policy:\n%s", p.Encode())
+	if err := s.store.UpdateCommandPolicy(p); err != nil {
+		log.ErrorErrorf(err, "store: update policy failed")
+		s.dirtyPolicyCache()
+		return errors.Errorf("store: update policy failed")
+	}
+	return nil
+}
+
+func (s *Topom) storeUpdateKeyspaceReport(r *models.KeyspaceReport) error {
+	log.Warnf("update keyspace report: sampled = %d, keys = %d", r.Sampled, r.Keys)
+	if err := s.store.UpdateKeyspaceReport(r); err != nil {
+		log.ErrorErrorf(err, "store: update keyspace report failed")
+		return errors.Errorf("store: update keyspace report failed")
+	}
+	return nil
+}
+
+func (s *Topom) storeUpdateEpoch(epoch int64) error {
+	log.Warnf("update epoch limit = %d", epoch)
+	if err := s.store.UpdateEpoch(epoch); err != nil {
+		log.ErrorErrorf(err, "store: update epoch failed")
+		return errors.Errorf("store: update epoch failed")
+	}
+	return nil
+}
+
+func (s *Topom) storeCreateTopology(t *models.Topology) error {
+	log.Warnf("create topology epoch-[%d]", t.Epoch)
+	if err := s.store.CreateTopology(t); err != nil {
+		log.ErrorErrorf(err, "store: create topology epoch-[%d] failed", t.Epoch)
+		return errors.Errorf("store: create topology epoch-[%d] failed", t.Epoch)
+	}
+	return nil
+}
+
+func (s *Topom) storeRemoveTopology(epoch int64) error {
+	log.Warnf("remove topology epoch-[%d]", epoch)
+	if err := s.store.DeleteTopology(epoch); err != nil {
+		log.ErrorErrorf(err, "store: remove topology epoch-[%d] failed", epoch)
+		return errors.Errorf("store: remove topology epoch-[%d] failed", epoch)
+	}
+	return nil
+}
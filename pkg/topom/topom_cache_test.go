@@ -5,6 +5,7 @@ package topom
 
 import (
 	"testing"
+	"time"
 
 	"github.com/CodisLabs/codis/pkg/models"
 	"github.com/CodisLabs/codis/pkg/utils/assert"
@@ -149,3 +150,60 @@ func contextRemoveProxy(t *Topom, p *models.Proxy) {
 	t.dirtyProxyCache(p.Token)
 	assert.MustNoError(t.storeRemoveProxy(p))
 }
+
+func TestStoreConflict(x *testing.T) {
+	client := newDiskClient()
+
+	t, err := New(newForkClient(client), config)
+	assert.MustNoError(err)
+	defer t.Close()
+	assert.MustNoError(t.Start(false))
+
+	const gid = 100
+	assert.MustNoError(t.CreateGroup(gid))
+	_, err = t.Stats()
+	assert.MustNoError(err)
+
+	time.Sleep(time.Millisecond * 10)
+
+	store := models.NewStore(newForkClient(client), config.ProductName)
+	defer store.Close()
+	g, err := store.LoadGroup(gid, true)
+	assert.MustNoError(err)
+	g.OutOfSync = true
+	assert.MustNoError(store.UpdateGroup(g))
+
+	assert.Must(t.GroupAddServer(gid, "", "127.0.0.1:6379") != nil)
+
+	assert.MustNoError(t.GroupAddServer(gid, "", "127.0.0.1:6379"))
+	g, err = store.LoadGroup(gid, true)
+	assert.MustNoError(err)
+	assert.Must(g.OutOfSync && len(g.Servers) == 1)
+}
+
+func TestStoreCreateAndDelete(x *testing.T) {
+	client := newDiskClient()
+
+	s1 := models.NewStore(newForkClient(client), config.ProductName)
+	defer s1.Close()
+	s2 := models.NewStore(newForkClient(client), config.ProductName)
+	defer s2.Close()
+
+	const gid = 100
+	assert.MustNoError(s1.UpdateGroup(&models.Group{Id: gid}))
+	assert.Must(s2.UpdateGroup(&models.Group{Id: gid}) != nil)
+
+	g, err := s2.LoadGroup(gid, true)
+	assert.MustNoError(err)
+	g.OutOfSync = true
+	assert.MustNoError(s2.UpdateGroup(g))
+
+	assert.Must(s1.DeleteGroup(gid) != nil)
+	g, err = s1.LoadGroup(gid, true)
+	assert.MustNoError(err)
+	assert.Must(g.OutOfSync)
+	assert.MustNoError(s1.DeleteGroup(gid))
+
+	g, err = s2.LoadGroup(gid, false)
+	assert.Must(err == nil && g == nil)
+}
@@ -0,0 +1,122 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package topom
+
+import (
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/models"
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+)
+
+var ErrStandbyTopom = errors.New("topom is standby")
+
+func (s *Topom) IsStandby() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.election.standby && !s.closed
+}
+
+func (s *Topom) Leader() (*models.Topom, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrClosedTopom
+	}
+	if s.online {
+		return s.model, nil
+	}
+	if s.config.LeaderElection {
+		return s.store.LoadLeader()
+	}
+	return s.store.LoadTopom(false)
+}
+
+func (s *Topom) runElection() {
+	for !s.IsClosed() {
+		log.Warnf("[%p] campaign for leader of %s", s, s.config.ProductName)
+		node, lost, err := s.store.Campaign(s.model, s.exit.C)
+		if err != nil {
+			if !s.IsClosed() {
+				log.WarnErrorf(err, "[%p] campaign for leader failed", s)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		if err := s.takeover(node); err != nil {
+			log.ErrorErrorf(err, "[%p] takeover as leader failed", s)
+			s.stepdown()
+			time.Sleep(time.Second)
+			continue
+		}
+		select {
+		case <-s.exit.C:
+			return
+		case <-lost:
+			log.Warnf("[%p] leadership of %s is lost", s, s.config.ProductName)
+			s.stepdown()
+		}
+	}
+}
+
+func (s *Topom) takeover(node string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		s.store.Resign(node)
+		return ErrClosedTopom
+	}
+	s.election.node = node
+
+	if t, err := s.store.LoadTopom(false); err != nil {
+		return err
+	} else if t != nil && t.Token != s.model.Token {
+		log.Warnf("[%p] override lock of previous leader:\n%s", s, t.Encode())
+	}
+	if err := s.store.Client().Update(s.store.LockPath(), s.model.Encode()); err != nil {
+		log.ErrorErrorf(err, "store: update lock of %s failed", s.config.ProductName)
+		return errors.Errorf("store: update lock of %s failed", s.config.ProductName)
+	}
+	s.online = true
+	s.election.standby = false
+
+	s.dirtyCacheAll()
+	s.history.last = nil
+	s.epoch.limit = 0
+	s.epoch.synced = 0
+
+	ctx, err := s.newContext()
+	if err != nil {
+		s.online = false
+		s.election.standby = true
+		return err
+	}
+	if s.election.routines {
+		s.rewatchSentinels(ctx.sentinel.Servers)
+	}
+	log.Warnf("[%p] topom is elected as leader", s)
+	return nil
+}
+
+func (s *Topom) stepdown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.election.node != "" {
+		if err := s.store.Resign(s.election.node); err != nil {
+			log.WarnErrorf(err, "store: resign leader of %s failed", s.config.ProductName)
+		}
+		s.election.node = ""
+	}
+	if s.closed {
+		return
+	}
+	if s.online && s.election.routines {
+		s.rewatchSentinels(nil)
+	}
+	s.online = false
+	s.election.standby = true
+	s.election.refreshed = time.Time{}
+	s.dirtyCacheAll()
+}
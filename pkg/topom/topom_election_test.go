@@ -0,0 +1,285 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package topom
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+)
+
+type memNode struct {
+	data  []byte
+	owner *memClient
+	lost  chan struct{}
+
+	version int
+}
+
+type memStore struct {
+	sync.Mutex
+	nodes map[string]*memNode
+	watch map[string][]chan struct{}
+	seq   int
+}
+
+type memClient struct {
+	store *memStore
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		nodes: make(map[string]*memNode),
+		watch: make(map[string][]chan struct{}),
+	}
+}
+
+func (m *memStore) newClient() *memClient {
+	return &memClient{store: m}
+}
+
+func (m *memStore) notify(path string) {
+	dir := filepath.Dir(path)
+	for _, w := range m.watch[dir] {
+		close(w)
+	}
+	delete(m.watch, dir)
+}
+
+func (m *memStore) remove(path string) {
+	if n := m.nodes[path]; n != nil {
+		if n.lost != nil {
+			close(n.lost)
+		}
+		delete(m.nodes, path)
+		m.notify(path)
+	}
+}
+
+func (m *memStore) children(path string) []string {
+	var paths []string
+	for p := range m.nodes {
+		if filepath.Dir(p) == path {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (c *memClient) create(path string, data []byte, ephemeral bool) (<-chan struct{}, error) {
+	if c.store.nodes[path] != nil {
+		return nil, errors.Errorf("node %s already exists", path)
+	}
+	n := &memNode{data: data}
+	if ephemeral {
+		n.owner, n.lost = c, make(chan struct{})
+	}
+	c.store.nodes[path] = n
+	c.store.notify(path)
+	return n.lost, nil
+}
+
+func (c *memClient) Create(path string, data []byte) error {
+	c.store.Lock()
+	defer c.store.Unlock()
+	_, err := c.create(path, data, false)
+	return err
+}
+
+func (c *memClient) Update(path string, data []byte) error {
+	c.store.Lock()
+	defer c.store.Unlock()
+	if n := c.store.nodes[path]; n != nil {
+		n.data = data
+		n.version++
+	} else {
+		c.create(path, data, false)
+	}
+	return nil
+}
+
+func (c *memClient) UpdateVersion(path string, data []byte, version string) (string, error) {
+	c.store.Lock()
+	defer c.store.Unlock()
+	n := c.store.nodes[path]
+	switch {
+	case n == nil && version == "":
+		c.create(path, data, false)
+		return "0", nil
+	case n == nil || strconv.Itoa(n.version) != version:
+		return "", errors.Errorf("bad version of node %s", path)
+	}
+	n.data = data
+	n.version++
+	return strconv.Itoa(n.version), nil
+}
+
+func (c *memClient) Commit(updates map[string][]byte, versions map[string]string) (map[string]string, error) {
+	c.store.Lock()
+	defer c.store.Unlock()
+	for path, version := range versions {
+		var current string
+		if n := c.store.nodes[path]; n != nil {
+			current = strconv.Itoa(n.version)
+		}
+		if current != version {
+			return nil, errors.Errorf("bad version of node %s", path)
+		}
+	}
+	latest := make(map[string]string)
+	for path, data := range updates {
+		switch n := c.store.nodes[path]; {
+		case data == nil:
+			c.store.remove(path)
+			latest[path] = ""
+		case n == nil:
+			c.create(path, data, false)
+			latest[path] = "0"
+		default:
+			n.data = data
+			n.version++
+			latest[path] = strconv.Itoa(n.version)
+		}
+	}
+	return latest, nil
+}
+
+func (c *memClient) Delete(path string) error {
+	c.store.Lock()
+	defer c.store.Unlock()
+	c.store.remove(path)
+	return nil
+}
+
+func (c *memClient) Read(path string, must bool) ([]byte, error) {
+	c.store.Lock()
+	defer c.store.Unlock()
+	if n := c.store.nodes[path]; n != nil {
+		return n.data, nil
+	}
+	if must {
+		return nil, errors.Errorf("node %s not found", path)
+	}
+	return nil, nil
+}
+
+func (c *memClient) ReadVersion(path string, must bool) ([]byte, string, error) {
+	c.store.Lock()
+	defer c.store.Unlock()
+	if n := c.store.nodes[path]; n != nil {
+		return n.data, strconv.Itoa(n.version), nil
+	}
+	if must {
+		return nil, "", errors.Errorf("node %s not found", path)
+	}
+	return nil, "", nil
+}
+
+func (c *memClient) List(path string, must bool) ([]string, error) {
+	c.store.Lock()
+	defer c.store.Unlock()
+	return c.store.children(path), nil
+}
+
+func (c *memClient) Close() error {
+	c.expire()
+	return nil
+}
+
+func (c *memClient) expire() {
+	c.store.Lock()
+	defer c.store.Unlock()
+	for path, n := range c.store.nodes {
+		if n.owner == c {
+			c.store.remove(path)
+		}
+	}
+}
+
+func (c *memClient) WatchInOrder(path string) (<-chan struct{}, []string, error) {
+	c.store.Lock()
+	defer c.store.Unlock()
+	w := make(chan struct{})
+	c.store.watch[path] = append(c.store.watch[path], w)
+	return w, c.store.children(path), nil
+}
+
+func (c *memClient) CreateEphemeral(path string, data []byte) (<-chan struct{}, error) {
+	c.store.Lock()
+	defer c.store.Unlock()
+	return c.create(path, data, true)
+}
+
+func (c *memClient) CreateEphemeralInOrder(path string, data []byte) (<-chan struct{}, string, error) {
+	c.store.Lock()
+	defer c.store.Unlock()
+	c.store.seq++
+	node := fmt.Sprintf("%s/%010d", strings.TrimSuffix(path, "/"), c.store.seq)
+	lost, err := c.create(node, data, true)
+	return lost, node, err
+}
+
+func waitUntil(fn func() bool) bool {
+	for i := 0; i < 100; i++ {
+		if fn() {
+			return true
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	return false
+}
+
+func TestTopomElection(x *testing.T) {
+	store := newMemStore()
+
+	c := *config
+	c.LeaderElection = true
+
+	c1 := store.newClient()
+	t1, err := New(c1, &c)
+	assert.MustNoError(err)
+	defer t1.Close()
+	assert.MustNoError(t1.Start(false))
+	assert.Must(waitUntil(t1.IsOnline))
+
+	t2, err := New(store.newClient(), &c)
+	assert.MustNoError(err)
+	defer t2.Close()
+	assert.MustNoError(t2.Start(false))
+	assert.Must(t2.IsStandby() && !t2.IsOnline())
+
+	assert.MustNoError(t1.CreateGroup(1))
+
+	stats, err := t2.Stats()
+	assert.MustNoError(err)
+	assert.Must(stats.Standby && len(stats.Group.Models) == 1)
+
+	api := newApiClient(t2)
+	o, err := api.Overview()
+	assert.MustNoError(err)
+	assert.Must(o.Leader != nil && o.Leader.Token == t1.Model().Token)
+	assert.Must(api.CreateGroup(2) != nil)
+
+	c1.expire()
+
+	assert.Must(waitUntil(t2.IsOnline))
+	assert.Must(waitUntil(t1.IsStandby))
+	assert.MustNoError(api.CreateGroup(2))
+
+	t, err := t2.store.LoadTopom(true)
+	assert.MustNoError(err)
+	assert.Must(t.Token == t2.Model().Token)
+
+	t2.Close()
+	assert.Must(waitUntil(t1.IsOnline))
+}
@@ -0,0 +1,221 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package topom
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/models"
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+)
+
+func (ctx *context) toTopology() *models.Topology {
+	return models.NewTopology(ctx.slots, ctx.group, ctx.proxy, ctx.sentinel)
+}
+
+func (s *Topom) History() ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.newContext(); err != nil {
+		return nil, err
+	}
+	return s.store.ListHistory()
+}
+
+// HistoryTopology returns the version of epoch, or the current topology
+// (whose epoch is 0) if epoch is 0.
+func (s *Topom) HistoryTopology(epoch int64) (*models.Topology, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return nil, err
+	}
+	return s.loadTopology(ctx, epoch)
+}
+
+func (s *Topom) loadTopology(ctx *context, epoch int64) (*models.Topology, error) {
+	if epoch == 0 {
+		return ctx.toTopology(), nil
+	}
+	t, err := s.store.LoadTopology(epoch, false)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, errors.Errorf("topology epoch-[%d] doesn't exist", epoch)
+	}
+	return t, nil
+}
+
+func (s *Topom) HistoryDiff(from, to int64) (*models.TopologyDiff, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return nil, err
+	}
+	x, err := s.loadTopology(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	y, err := s.loadTopology(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+	return models.DiffTopology(x, y), nil
+}
+
+// RecordHistory stores the current topology as a new version if it differs
+// from the latest one, and removes the oldest versions beyond limit.
+func (s *Topom) RecordHistory() (*models.Topology, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return nil, err
+	}
+	return s.recordHistory(ctx)
+}
+
+// recordHistory is called by the history loop whenever the topology is changed
+// through the store helpers. While any slot action is in progress, the version
+// is postponed, so that a migration or rebalance ends up as one version once
+// it's done.
+func (s *Topom) recordHistory(ctx *context) (*models.Topology, error) {
+	if s.history.last == nil {
+		epochs, err := s.store.ListHistory()
+		if err != nil {
+			return nil, err
+		}
+		if n := len(epochs); n != 0 {
+			t, err := s.store.LoadTopology(epochs[n-1], true)
+			if err != nil {
+				return nil, err
+			}
+			s.history.last = t
+		}
+	}
+
+	for _, m := range ctx.slots {
+		if m.Action.State != models.ActionNothing {
+			return s.history.last, nil
+		}
+	}
+
+	t := ctx.toTopology()
+	if last := s.history.last; last != nil {
+		if last.Equal(t) {
+			return last, nil
+		}
+		t.Epoch = last.Epoch + 1
+	} else {
+		t.Epoch = 1
+	}
+	t.UnixTime = time.Now().Unix()
+
+	if err := s.storeCreateTopology(t); err != nil {
+		s.history.last = nil
+		return nil, err
+	}
+	s.history.last = t
+
+	if limit := s.config.HistoryMaxVersions; limit > 0 {
+		epochs, err := s.store.ListHistory()
+		if err != nil {
+			log.WarnErrorf(err, "store: list topology history failed")
+			return t, nil
+		}
+		for len(epochs) > limit {
+			if err := s.storeRemoveTopology(epochs[0]); err != nil {
+				return t, nil
+			}
+			epochs = epochs[1:]
+		}
+	}
+	return t, nil
+}
+
+// RollbackPlan lists slot migrations to roll back to the version of epoch,
+// slots that can't be migrated are skipped with reasons. Changes of groups,
+// proxies & sentinels are not rolled back, but reported in Diff.
+type RollbackPlan struct {
+	Epoch   int64                      `json:"epoch"`
+	Slots   []*models.TopologySlotDiff `json:"slots"`
+	Skipped []string                   `json:"skipped,omitempty"`
+
+	Diff *models.TopologyDiff `json:"diff"`
+}
+
+func (s *Topom) HistoryRollback(epoch int64, confirm bool) (*RollbackPlan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return nil, err
+	}
+	if epoch == 0 {
+		return nil, errors.Errorf("invalid epoch = %d", epoch)
+	}
+	t, err := s.loadTopology(ctx, epoch)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan = &RollbackPlan{Epoch: epoch}
+	plan.Diff = models.DiffTopology(ctx.toTopology(), t)
+
+	for _, d := range plan.Diff.Slots {
+		m, err := ctx.getSlotMapping(d.Id)
+		if err != nil {
+			return nil, err
+		}
+		var skip string
+		switch {
+		case m.Action.State != models.ActionNothing:
+			if m.Action.TargetId == d.To {
+				continue
+			}
+			skip = fmt.Sprintf("slot-[%d] is being migrated to group-[%d]", m.Id, m.Action.TargetId)
+		case d.To == 0:
+			skip = fmt.Sprintf("slot-[%d] can't be migrated to offline", m.Id)
+		default:
+			if g := ctx.group[d.To]; g == nil {
+				skip = fmt.Sprintf("slot-[%d] can't be migrated to group-[%d], group doesn't exist", m.Id, d.To)
+			} else if len(g.Servers) == 0 {
+				skip = fmt.Sprintf("slot-[%d] can't be migrated to group-[%d], group is empty", m.Id, d.To)
+			}
+		}
+		if skip != "" {
+			plan.Skipped = append(plan.Skipped, skip)
+		} else {
+			plan.Slots = append(plan.Slots, d)
+		}
+	}
+	plan.Diff.Slots = nil
+
+	if !confirm || len(plan.Slots) == 0 {
+		return plan, nil
+	}
+
+	var batch = s.store.NewBatch()
+	for _, d := range plan.Slots {
+		m, err := ctx.getSlotMapping(d.Id)
+		if err != nil {
+			return nil, err
+		}
+		defer s.dirtySlotsCache(m.Id)
+
+		m.Action.State = models.ActionPending
+		m.Action.Index = ctx.maxSlotActionIndex() + 1
+		m.Action.TargetId = d.To
+		s.batchUpdateSlotMapping(batch, m)
+	}
+	if err := s.storeCommit(batch); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
@@ -0,0 +1,204 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package topom
+
+import (
+	"testing"
+
+	"github.com/CodisLabs/codis/pkg/models"
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+)
+
+func TestHistoryRecord(x *testing.T) {
+	t := openTopom()
+	defer t.Close()
+
+	r1, err := t.RecordHistory()
+	assert.MustNoError(err)
+	assert.Must(r1.Epoch == 1)
+
+	r2, err := t.RecordHistory()
+	assert.MustNoError(err)
+	assert.Must(r2.Epoch == 1)
+
+	g := &models.Group{Id: 1, Servers: []*models.GroupServer{
+		&models.GroupServer{Addr: "server1"},
+	}}
+	contextCreateGroup(t, g)
+
+	r3, err := t.RecordHistory()
+	assert.MustNoError(err)
+	assert.Must(r3.Epoch == 2 && len(r3.Group) == 1)
+
+	t.history.last = nil
+	r4, err := t.RecordHistory()
+	assert.MustNoError(err)
+	assert.Must(r4.Epoch == 2)
+
+	epochs, err := t.History()
+	assert.MustNoError(err)
+	assert.Must(len(epochs) == 2 && epochs[0] == 1 && epochs[1] == 2)
+
+	d, err := t.HistoryDiff(1, 2)
+	assert.MustNoError(err)
+	assert.Must(len(d.Group) == 1 && d.Group[0].Action == models.TopologyCreate)
+	assert.Must(len(d.Slots) == 0)
+
+	d, err = t.HistoryDiff(2, 0)
+	assert.MustNoError(err)
+	assert.Must(d.IsEmpty())
+
+	_, err = t.HistoryDiff(1, 100)
+	assert.Must(err != nil)
+}
+
+func TestHistoryPrune(x *testing.T) {
+	t := openTopom()
+	defer t.Close()
+
+	config := *t.config
+	config.HistoryMaxVersions = 2
+	t.config = &config
+
+	for i := 0; i < 4; i++ {
+		contextUpdateSlotMapping(t, &models.SlotMapping{Id: 0, GroupId: i + 1})
+		r, err := t.RecordHistory()
+		assert.MustNoError(err)
+		assert.Must(r.Epoch == int64(i+1))
+	}
+
+	epochs, err := t.History()
+	assert.MustNoError(err)
+	assert.Must(len(epochs) == 2 && epochs[0] == 3 && epochs[1] == 4)
+}
+
+func TestHistoryOnChange(x *testing.T) {
+	t := openTopom()
+	defer t.Close()
+
+	_, err := t.RecordHistory()
+	assert.MustNoError(err)
+
+	for gid := 1; gid <= 3; gid++ {
+		contextCreateGroup(t, &models.Group{Id: gid})
+		select {
+		case <-t.history.notify:
+		default:
+			assert.Must(false)
+		}
+		_, err := t.RecordHistory()
+		assert.MustNoError(err)
+		epochs, err := t.History()
+		assert.MustNoError(err)
+		assert.Must(len(epochs) == gid+1)
+	}
+}
+
+func TestHistoryPruneMigration(x *testing.T) {
+	t := openTopom()
+	defer t.Close()
+
+	config := *t.config
+	config.HistoryMaxVersions = 3
+	t.config = &config
+
+	for sid := 0; sid < 16; sid++ {
+		contextUpdateSlotMapping(t, &models.SlotMapping{Id: sid, GroupId: 1})
+		_, err := t.RecordHistory()
+		assert.MustNoError(err)
+	}
+	before, err := t.RecordHistory()
+	assert.MustNoError(err)
+	assert.Must(before.Epoch == 16)
+
+	var batch = t.store.NewBatch()
+	for sid := 0; sid < 16; sid++ {
+		m := &models.SlotMapping{Id: sid, GroupId: 1}
+		m.Action.State = models.ActionPending
+		m.Action.Index = sid + 1
+		m.Action.TargetId = 2
+		t.dirtySlotsCache(sid)
+		t.batchUpdateSlotMapping(batch, m)
+	}
+	assert.MustNoError(t.storeCommit(batch))
+
+	for sid := 0; sid < 16; sid++ {
+		m := &models.SlotMapping{Id: sid, GroupId: 1}
+		m.Action.State = models.ActionMigrating
+		m.Action.Index = sid + 1
+		m.Action.TargetId = 2
+		contextUpdateSlotMapping(t, m)
+		contextUpdateSlotMapping(t, &models.SlotMapping{Id: sid, GroupId: 2})
+
+		r, err := t.RecordHistory()
+		assert.MustNoError(err)
+		if sid != 15 {
+			assert.Must(r.Epoch == before.Epoch)
+		} else {
+			assert.Must(r.Epoch == before.Epoch+1)
+		}
+	}
+
+	epochs, err := t.History()
+	assert.MustNoError(err)
+	assert.Must(len(epochs) == 3)
+	assert.Must(epochs[1] == before.Epoch && epochs[2] == before.Epoch+1)
+
+	d, err := t.HistoryDiff(epochs[1], epochs[2])
+	assert.MustNoError(err)
+	assert.Must(len(d.Slots) == 16)
+}
+
+func TestHistoryRollback(x *testing.T) {
+	t := openTopom()
+	defer t.Close()
+
+	for gid := 1; gid <= 3; gid++ {
+		g := &models.Group{Id: gid, Servers: []*models.GroupServer{
+			&models.GroupServer{Addr: "server"},
+		}}
+		contextCreateGroup(t, g)
+	}
+	for sid := 0; sid < 4; sid++ {
+		contextUpdateSlotMapping(t, &models.SlotMapping{Id: sid, GroupId: 1})
+	}
+	r, err := t.RecordHistory()
+	assert.MustNoError(err)
+
+	contextUpdateSlotMapping(t, &models.SlotMapping{Id: 0, GroupId: 2})
+	contextUpdateSlotMapping(t, &models.SlotMapping{Id: 1, GroupId: 2})
+	contextUpdateSlotMapping(t, &models.SlotMapping{Id: 2, GroupId: 3})
+	m := &models.SlotMapping{Id: 3, GroupId: 1}
+	m.Action.State = models.ActionPending
+	m.Action.Index = 1
+	m.Action.TargetId = 2
+	contextUpdateSlotMapping(t, m)
+	contextUpdateSlotMapping(t, &models.SlotMapping{Id: 4, GroupId: 2})
+	contextRemoveGroup(t, &models.Group{Id: 3})
+
+	_, err = t.HistoryRollback(0, false)
+	assert.Must(err != nil)
+
+	plan, err := t.HistoryRollback(r.Epoch, false)
+	assert.MustNoError(err)
+	assert.Must(len(plan.Slots) == 3)
+	assert.Must(len(plan.Skipped) == 1)
+	assert.Must(len(plan.Diff.Slots) == 0)
+	assert.Must(len(plan.Diff.Group) == 1 && plan.Diff.Group[0].Action == models.TopologyCreate)
+
+	for _, sid := range []int{0, 1, 2, 3, 4} {
+		m := getSlotMapping(t, sid)
+		assert.Must(m.Action.State == models.ActionNothing || sid == 3)
+	}
+
+	plan, err = t.HistoryRollback(r.Epoch, true)
+	assert.MustNoError(err)
+
+	for _, d := range plan.Slots {
+		m := getSlotMapping(t, d.Id)
+		assert.Must(m.Action.State == models.ActionPending)
+		assert.Must(m.Action.TargetId == d.To)
+	}
+	assert.Must(getSlotMapping(t, 4).Action.State == models.ActionNothing)
+}
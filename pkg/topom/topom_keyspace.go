@@ -0,0 +1,258 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package topom
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/models"
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/CodisLabs/codis/pkg/utils/redis"
+	"github.com/CodisLabs/codis/pkg/utils/sync2"
+)
+
+const keyspaceOtherPrefix = "*"
+
+func keyspacePrefix(key string, delimiters string, depth int) string {
+	if delimiters == "" || depth == 0 {
+		return ""
+	}
+	var n = 0
+	for i := 0; i < len(key); i++ {
+		if strings.IndexByte(delimiters, key[i]) < 0 {
+			continue
+		}
+		if n++; n == depth {
+			return key[:i+1]
+		}
+	}
+	return ""
+}
+
+func keyspaceExpire(ttl int64) string {
+	switch {
+	case ttl < 0:
+		return "persist"
+	case ttl < 60:
+		return "<1m"
+	case ttl < 3600:
+		return "<1h"
+	case ttl < 86400:
+		return "<1d"
+	case ttl < 86400*7:
+		return "<7d"
+	default:
+		return ">=7d"
+	}
+}
+
+type keyspaceStats struct {
+	group *models.KeyspaceGroup
+
+	types   map[string]int64
+	expires map[string]int64
+	prefix  map[string]*models.KeyspacePrefix
+	memory  bool
+}
+
+func (s *Topom) newKeyspaceStats(x *keyScanTarget) *keyspaceStats {
+	return &keyspaceStats{
+		group:   &models.KeyspaceGroup{GroupId: x.GroupId, Server: x.Server},
+		types:   make(map[string]int64),
+		expires: make(map[string]int64),
+		prefix:  make(map[string]*models.KeyspacePrefix),
+	}
+}
+
+func (p *keyspaceStats) add(prefix string, info *redis.KeyInfo, maxPrefixes int) {
+	p.group.Sampled++
+	p.types[info.Type]++
+	p.expires[keyspaceExpire(info.TTL)]++
+
+	x := p.prefix[prefix]
+	if x == nil {
+		if len(p.prefix) >= maxPrefixes {
+			prefix = keyspaceOtherPrefix
+			x = p.prefix[prefix]
+		}
+		if x == nil {
+			x = &models.KeyspacePrefix{Prefix: prefix, Types: make(map[string]int64)}
+			p.prefix[prefix] = x
+		}
+	}
+	x.Keys++
+	x.Bytes += info.Bytes
+	x.Types[info.Type]++
+}
+
+func (s *Topom) sampleKeyspace(x *keyScanTarget) *keyspaceStats {
+	p := s.newKeyspaceStats(x)
+	err := func() error {
+		c, err := s.newKeyScanClient(x)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+
+		infos, err := c.SlotsInfo()
+		if err != nil {
+			return err
+		}
+		for _, sid := range x.Slots {
+			p.group.Keys += int64(infos[sid])
+		}
+		p.memory = supportMemoryUsage(c)
+
+		var (
+			delimiters  = s.config.KeyspacePrefixDelimiters
+			depth       = s.config.KeyspacePrefixDepth
+			maxPrefixes = s.config.KeyspaceMaxPrefixes
+		)
+		limit := s.config.KeyspaceSamplePerSlot
+		return s.scanKeys(c, x.Slots, limit, limit, p.memory, func(slot int, infos []*redis.KeyInfo) {
+			for _, info := range infos {
+				p.add(keyspacePrefix(info.Key, delimiters, depth), info, maxPrefixes)
+			}
+		})
+	}()
+	if err != nil {
+		log.WarnErrorf(err, "sample keyspace of group-[%d] on %s failed", x.GroupId, x.Server)
+		p.group.Error = err.Error()
+	}
+	return p
+}
+
+func (s *Topom) mergeKeyspaceStats(stats []*keyspaceStats) *models.KeyspaceReport {
+	r := &models.KeyspaceReport{
+		Types:   make(map[string]int64),
+		Expires: make(map[string]int64),
+		Memory:  len(stats) != 0,
+	}
+	var prefix = make(map[string]*models.KeyspacePrefix)
+	for _, p := range stats {
+		r.Groups = append(r.Groups, p.group)
+		r.Keys += p.group.Keys
+		r.Sampled += p.group.Sampled
+		r.Memory = r.Memory && p.memory
+		for k, v := range p.types {
+			r.Types[k] += v
+		}
+		for k, v := range p.expires {
+			r.Expires[k] += v
+		}
+		for _, v := range sortKeyspacePrefixes(p.prefix) {
+			k := v.Prefix
+			x := prefix[k]
+			if x == nil {
+				if len(prefix) >= s.config.KeyspaceMaxPrefixes {
+					k = keyspaceOtherPrefix
+					x = prefix[k]
+				}
+				if x == nil {
+					x = &models.KeyspacePrefix{Prefix: k, Types: make(map[string]int64)}
+					prefix[k] = x
+				}
+			}
+			x.Keys += v.Keys
+			x.Bytes += v.Bytes
+			for t, n := range v.Types {
+				x.Types[t] += n
+			}
+		}
+	}
+	sort.Slice(r.Groups, func(i, j int) bool {
+		return r.Groups[i].GroupId < r.Groups[j].GroupId
+	})
+	r.Prefixes = sortKeyspacePrefixes(prefix)
+	return r
+}
+
+func sortKeyspacePrefixes(prefix map[string]*models.KeyspacePrefix) []*models.KeyspacePrefix {
+	var list = make([]*models.KeyspacePrefix, 0, len(prefix))
+	for _, x := range prefix {
+		list = append(list, x)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		switch {
+		case a.Prefix == keyspaceOtherPrefix:
+			return false
+		case b.Prefix == keyspaceOtherPrefix:
+			return true
+		case a.Keys != b.Keys:
+			return a.Keys > b.Keys
+		}
+		return a.Prefix < b.Prefix
+	})
+	return list
+}
+
+var ErrKeyspaceScanRunning = errors.New("keyspace analysis is running")
+
+func (s *Topom) AnalyzeKeyspace() (*models.KeyspaceReport, error) {
+	s.mu.Lock()
+	ctx, err := s.newContext()
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if s.keyspace.running {
+		s.mu.Unlock()
+		return nil, errors.Trace(ErrKeyspaceScanRunning)
+	}
+	s.keyspace.running = true
+	targets := ctx.getKeyScanTargets()
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.keyspace.running = false
+		s.mu.Unlock()
+	}()
+
+	var start = time.Now()
+
+	var fut sync2.Future
+	for _, x := range targets {
+		fut.Add()
+		go func(x *keyScanTarget) {
+			fut.Done(strconv.Itoa(x.GroupId), s.sampleKeyspace(x))
+		}(x)
+	}
+	var stats []*keyspaceStats
+	for _, v := range fut.Wait() {
+		stats = append(stats, v.(*keyspaceStats))
+	}
+	r := s.mergeKeyspaceStats(stats)
+	r.UnixTime = time.Now().Unix()
+	r.Duration = int64(time.Since(start) / time.Millisecond)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrClosedTopom
+	}
+	if err := s.storeUpdateKeyspaceReport(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *Topom) KeyspaceReport() (*models.KeyspaceReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.newContext(); err != nil {
+		return nil, err
+	}
+	r, err := s.store.LoadKeyspaceReport(false)
+	if err != nil {
+		log.ErrorErrorf(err, "store: load keyspace report failed")
+		return nil, errors.Errorf("store: load keyspace report failed")
+	}
+	return r, nil
+}
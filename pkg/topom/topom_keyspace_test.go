@@ -0,0 +1,57 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package topom
+
+import (
+	"testing"
+
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+	"github.com/CodisLabs/codis/pkg/utils/redis"
+)
+
+func TestKeyspacePrefix(x *testing.T) {
+	assert.Must(keyspacePrefix("user:1:name", ":", 1) == "user:")
+	assert.Must(keyspacePrefix("user:1:name", ":", 2) == "user:1:")
+	assert.Must(keyspacePrefix("user:1:name", ":", 3) == "")
+	assert.Must(keyspacePrefix("item.1|a", ":.|", 1) == "item.")
+	assert.Must(keyspacePrefix("item.1|a", ":.|", 2) == "item.1|")
+	assert.Must(keyspacePrefix("plainkey", ":", 1) == "")
+	assert.Must(keyspacePrefix("user:1", "", 1) == "")
+	assert.Must(keyspacePrefix("user:1", ":", 0) == "")
+}
+
+func TestKeyspaceExpire(x *testing.T) {
+	assert.Must(keyspaceExpire(-1) == "persist")
+	assert.Must(keyspaceExpire(10) == "<1m")
+	assert.Must(keyspaceExpire(600) == "<1h")
+	assert.Must(keyspaceExpire(7200) == "<1d")
+	assert.Must(keyspaceExpire(86400*3) == "<7d")
+	assert.Must(keyspaceExpire(86400*30) == ">=7d")
+}
+
+func TestKeyspaceMerge(x *testing.T) {
+	config := NewDefaultConfig()
+	config.KeyspaceMaxPrefixes = 2
+	t := &Topom{config: config}
+
+	p1 := t.newKeyspaceStats(&keyScanTarget{GroupId: 2, Server: "server2"})
+	p1.memory = true
+	p1.add("user:", &redis.KeyInfo{Type: "string", Bytes: 10, TTL: -1}, 2)
+	p1.add("user:", &redis.KeyInfo{Type: "hash", Bytes: 20, TTL: 30}, 2)
+	p1.add("item:", &redis.KeyInfo{Type: "string", Bytes: 5, TTL: -1}, 2)
+	p1.add("feed:", &redis.KeyInfo{Type: "list", Bytes: 1, TTL: -1}, 2)
+	assert.Must(len(p1.prefix) == 3 && p1.prefix[keyspaceOtherPrefix].Keys == 1)
+
+	p2 := t.newKeyspaceStats(&keyScanTarget{GroupId: 1, Server: "server1"})
+	p2.add("order:", &redis.KeyInfo{Type: "zset", Bytes: 0, TTL: 100000}, 2)
+	p2.group.Keys = 10
+
+	r := t.mergeKeyspaceStats([]*keyspaceStats{p1, p2})
+	assert.Must(r.Sampled == 5 && r.Keys == 10 && !r.Memory)
+	assert.Must(len(r.Groups) == 2 && r.Groups[0].GroupId == 1)
+	assert.Must(r.Types["string"] == 2 && r.Types["zset"] == 1)
+	assert.Must(r.Expires["persist"] == 3 && r.Expires["<1m"] == 1 && r.Expires["<7d"] == 1)
+	assert.Must(len(r.Prefixes) == 3)
+	assert.Must(r.Prefixes[0].Prefix == "user:" && r.Prefixes[0].Keys == 2 && r.Prefixes[0].Bytes == 30)
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package topom
+
+import (
+	"github.com/CodisLabs/codis/pkg/models"
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/CodisLabs/codis/pkg/utils/sync2"
+)
+
+func (s *Topom) CommandPolicy() (*models.CommandPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return nil, err
+	}
+	return ctx.policy, nil
+}
+
+func (s *Topom) SetCommandPolicy(p *models.CommandPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return err
+	}
+
+	p.Normalize()
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	defer s.dirtyPolicyCache()
+
+	if err := s.storeUpdateCommandPolicy(p); err != nil {
+		return err
+	}
+
+	var fut sync2.Future
+	for _, x := range ctx.proxy {
+		fut.Add()
+		go func(x *models.Proxy) {
+			err := s.newProxyClient(x).SetCommandPolicy(p)
+			if err != nil {
+				log.ErrorErrorf(err, "proxy-[%s] resync policy failed", x.Token)
+			}
+			fut.Done(x.Token, err)
+		}(x)
+	}
+	for t, v := range fut.Wait() {
+		switch err := v.(type) {
+		case error:
+			if err != nil {
+				return errors.Errorf("proxy-[%s] resync policy failed", t)
+			}
+		}
+	}
+	return nil
+}
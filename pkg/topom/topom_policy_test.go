@@ -0,0 +1,48 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package topom
+
+import (
+	"testing"
+
+	"github.com/CodisLabs/codis/pkg/models"
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+)
+
+func TestCommandPolicy(x *testing.T) {
+	t := openTopom()
+	defer t.Close()
+
+	p1, c1 := openProxy()
+	defer c1.Shutdown()
+
+	assert.MustNoError(t.CreateProxy(p1.AdminAddr))
+
+	policy := &models.CommandPolicy{
+		Deny: []string{"keys"},
+		Limits: []*models.CommandLimit{
+			{Command: "lrange", MaxRange: 1000},
+		},
+	}
+	assert.MustNoError(t.SetCommandPolicy(policy))
+
+	p, err := c1.CommandPolicy()
+	assert.MustNoError(err)
+	assert.Must(len(p.Deny) == 1 && p.Deny[0] == "KEYS")
+	assert.Must(len(p.Limits) == 1 && p.Limits[0].Command == "LRANGE")
+
+	ctx, err := t.newContext()
+	assert.MustNoError(err)
+	assert.Must(string(ctx.policy.Encode()) == string(policy.Encode()))
+
+	p2, c2 := openProxy()
+	defer c2.Shutdown()
+
+	assert.MustNoError(t.CreateProxy(p2.AdminAddr))
+	p, err = c2.CommandPolicy()
+	assert.MustNoError(err)
+	assert.Must(len(p.Deny) == 1 && p.Deny[0] == "KEYS")
+
+	assert.Must(t.SetCommandPolicy(&models.CommandPolicy{Deny: []string{"quit"}}) != nil)
+}
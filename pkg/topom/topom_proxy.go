@@ -4,6 +4,8 @@
 package topom
 
 import (
+	"time"
+
 	"github.com/CodisLabs/codis/pkg/models"
 	"github.com/CodisLabs/codis/pkg/proxy"
 	"github.com/CodisLabs/codis/pkg/utils/errors"
@@ -100,6 +102,31 @@ func (s *Topom) RemoveProxy(token string, force bool) error {
 	return s.storeRemoveProxy(p)
 }
 
+func (s *Topom) DrainProxy(token string, timeout time.Duration, force bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ctx, err := s.newContext()
+	if err != nil {
+		return err
+	}
+
+	p, err := ctx.getProxy(token)
+	if err != nil {
+		return err
+	}
+	c := s.newProxyClient(p)
+
+	if err := c.Drain(timeout); err != nil {
+		log.WarnErrorf(err, "proxy-[%s] drain failed, force remove = %t", token, force)
+		if !force {
+			return errors.Errorf("proxy-[%s] drain failed", p.Token)
+		}
+	}
+	defer s.dirtyProxyCache(p.Token)
+
+	return s.storeRemoveProxy(p)
+}
+
 func (s *Topom) ReinitProxy(token string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -123,8 +150,54 @@ func (s *Topom) newProxyClient(p *models.Proxy) *proxy.ApiClient {
 	return c
 }
 
+// epochReserved epochs are reserved in coordinator at a time. The limit is
+// stored before any of them is issued, so a new leader always starts from an
+// epoch above all the issued ones.
+const epochReserved = 1024
+
+func (s *Topom) nextEpoch() (int64, error) {
+	if s.epoch.limit == 0 {
+		limit, err := s.store.LoadEpoch()
+		if err != nil {
+			log.ErrorErrorf(err, "store: load epoch failed")
+			return 0, errors.Errorf("store: load epoch failed")
+		}
+		if s.epoch.value < limit {
+			s.epoch.value = limit
+		}
+		s.epoch.limit = s.epoch.value
+	}
+	if s.epoch.value >= s.epoch.limit {
+		limit := s.epoch.value + epochReserved
+		if err := s.storeUpdateEpoch(limit); err != nil {
+			s.epoch.limit = 0
+			return 0, err
+		}
+		s.epoch.limit = limit
+	}
+	s.epoch.value++
+	return s.epoch.value, nil
+}
+
+// advanceEpoch makes sure that the following epochs are above the given one,
+// e.g. proxies have seen an epoch above the stored limit.
+func (s *Topom) advanceEpoch(epoch int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.epoch.value < epoch {
+		log.Warnf("advance epoch from %d to %d", s.epoch.value, epoch)
+		s.epoch.value = epoch
+	}
+}
+
 func (s *Topom) reinitProxy(ctx *context, p *models.Proxy, c *proxy.ApiClient) error {
 	log.Warnf("proxy-[%s] reinit:\n%s", p.Token, p.Encode())
+	epoch, err := s.nextEpoch()
+	if err != nil {
+		return err
+	}
+	ctx.epoch, ctx.prev = epoch, epoch
+
 	if err := c.FillSlots(ctx.toSlotSlice(ctx.slots, p)...); err != nil {
 		log.ErrorErrorf(err, "proxy-[%s] fillslots failed", p.Token)
 		return errors.Errorf("proxy-[%s] fillslots failed", p.Token)
@@ -137,6 +210,10 @@ func (s *Topom) reinitProxy(ctx *context, p *models.Proxy, c *proxy.ApiClient) e
 		log.ErrorErrorf(err, "proxy-[%s] set sentinels failed", p.Token)
 		return errors.Errorf("proxy-[%s] set sentinels failed", p.Token)
 	}
+	if err := c.SetCommandPolicy(ctx.policy); err != nil {
+		log.ErrorErrorf(err, "proxy-[%s] set command policy failed", p.Token)
+		return errors.Errorf("proxy-[%s] set command policy failed", p.Token)
+	}
 	return nil
 }
 
@@ -148,6 +225,23 @@ func (s *Topom) resyncSlotMappings(ctx *context, slots ...*models.SlotMapping) e
 	if len(slots) == 0 {
 		return nil
 	}
+	epoch, err := s.nextEpoch()
+	if err != nil {
+		return err
+	}
+	ctx.epoch, ctx.prev = epoch, s.epoch.synced
+	if s.epoch.synced == 0 {
+		// fills sent before are unknown after a restart or takeover, send
+		// all the slots once so that proxies are synced without reinit
+		var all = make([]*models.SlotMapping, len(ctx.slots))
+		copy(all, ctx.slots)
+		for _, m := range slots {
+			all[m.Id] = m
+		}
+		slots, ctx.prev = all, epoch
+	}
+	s.epoch.synced = epoch
+
 	var fut sync2.Future
 	for _, p := range ctx.proxy {
 		fut.Add()
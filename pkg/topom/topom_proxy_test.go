@@ -5,7 +5,10 @@ package topom
 
 import (
 	"testing"
+	"time"
 
+	"github.com/CodisLabs/codis/pkg/models"
+	"github.com/CodisLabs/codis/pkg/proxy"
 	"github.com/CodisLabs/codis/pkg/utils/assert"
 )
 
@@ -78,3 +81,153 @@ func TestRemoveProxy(x *testing.T) {
 	assert.MustNoError(t.RemoveProxy(p2.Token, true))
 	check([]string{})
 }
+
+func TestProxyEpoch(x *testing.T) {
+	t := openTopom()
+	defer t.Close()
+
+	p, c := openProxy()
+	defer c.Shutdown()
+
+	epoch := func() int64 {
+		stats, err := c.StatsSimple()
+		assert.MustNoError(err)
+		return stats.Epoch
+	}
+
+	assert.MustNoError(t.CreateProxy(p.AdminAddr))
+	assert.Must(epoch() == 1)
+
+	limit, err := t.store.LoadEpoch()
+	assert.MustNoError(err)
+	assert.Must(limit == epochReserved)
+
+	assert.MustNoError(c.FillSlots(&models.Slot{Id: 0, Epoch: 1}))
+	assert.MustNoError(c.FillSlots(&models.Slot{Id: 0, Epoch: 0}))
+
+	t.mu.Lock()
+	assert.Must(t.epoch.value == 1)
+	t.epoch.synced, _ = t.nextEpoch()
+	t.mu.Unlock()
+
+	w, err := t.RefreshProxyStats(time.Second)
+	assert.MustNoError(err)
+	w.Wait()
+
+	for i := 0; i < 100 && epoch() <= 2; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Must(epoch() == 3)
+
+	t.mu.Lock()
+	t.epoch.value, t.epoch.limit = 0, 0
+	t.mu.Unlock()
+	assert.MustNoError(t.ReinitProxy(p.Token))
+	assert.Must(epoch() == epochReserved+1)
+}
+
+func TestProxyMissedFill(x *testing.T) {
+	t := openTopom()
+	defer t.Close()
+
+	p1, c1 := openProxy()
+	defer c1.Shutdown()
+	p2, c2 := openProxy()
+	defer c2.Shutdown()
+
+	assert.MustNoError(t.CreateProxy(p1.AdminAddr))
+	assert.MustNoError(t.CreateProxy(p2.AdminAddr))
+
+	epoch := func(c *proxy.ApiClient) (int64, int64) {
+		stats, err := c.StatsSimple()
+		assert.MustNoError(err)
+		return stats.Epoch, stats.SyncedEpoch
+	}
+	resync := func(sid int, tokens ...string) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		ctx, err := t.newContext()
+		assert.MustNoError(err)
+		proxies := ctx.proxy
+		ctx.proxy = make(map[string]*models.Proxy)
+		for _, token := range tokens {
+			ctx.proxy[token] = proxies[token]
+		}
+		assert.MustNoError(t.resyncSlotMappings(ctx, ctx.slots[sid]))
+	}
+
+	e2, s2 := epoch(c2)
+	assert.Must(e2 == 2 && s2 == 2)
+
+	// p2 misses the fill of slot-0 and then receives the fill of slot-1
+	resync(0, p1.Token)
+	resync(1, p1.Token, p2.Token)
+
+	e1, s1 := epoch(c1)
+	assert.Must(e1 == 4 && s1 == 4)
+	e2, s2 = epoch(c2)
+	assert.Must(e2 == 4 && s2 == 2)
+
+	w, err := t.RefreshProxyStats(time.Second)
+	assert.MustNoError(err)
+	w.Wait()
+
+	for i := 0; i < 100; i++ {
+		if e2, _ = epoch(c2); e2 != 4 {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	e2, s2 = epoch(c2)
+	assert.Must(e2 == 5 && s2 == 5)
+	e1, s1 = epoch(c1)
+	assert.Must(e1 == 4 && s1 == 4)
+}
+
+func TestProxyResyncAfterTakeover(x *testing.T) {
+	t := openTopom()
+	defer t.Close()
+
+	p1, c1 := openProxy()
+	defer c1.Shutdown()
+	p2, c2 := openProxy()
+	defer c2.Shutdown()
+
+	assert.MustNoError(t.CreateProxy(p1.AdminAddr))
+	assert.MustNoError(t.CreateProxy(p2.AdminAddr))
+
+	epoch := func(c *proxy.ApiClient) (int64, int64) {
+		stats, err := c.StatsSimple()
+		assert.MustNoError(err)
+		return stats.Epoch, stats.SyncedEpoch
+	}
+	resync := func(sid int) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		ctx, err := t.newContext()
+		assert.MustNoError(err)
+		assert.MustNoError(t.resyncSlotMappings(ctx, ctx.slots[sid]))
+	}
+
+	resync(0)
+	for _, c := range []*proxy.ApiClient{c1, c2} {
+		e, s := epoch(c)
+		assert.Must(e == 3 && s == 3)
+	}
+
+	// synced epoch is unknown after takeover, the first resync is a full fill
+	t.mu.Lock()
+	t.epoch.synced = 0
+	t.mu.Unlock()
+	resync(1)
+
+	w, err := t.RefreshProxyStats(time.Second)
+	assert.MustNoError(err)
+	w.Wait()
+
+	time.Sleep(time.Millisecond * 100)
+	for _, c := range []*proxy.ApiClient{c1, c2} {
+		e, s := epoch(c)
+		assert.Must(e == 4 && s == 4)
+	}
+}
@@ -83,6 +83,7 @@ func (s *Topom) SlotCreateActionSome(groupFrom, groupTo int, numSlots int) error
 		pending = append(pending, m.Id)
 	}
 
+	var batch = s.store.NewBatch()
 	for _, sid := range pending {
 		m, err := ctx.getSlotMapping(sid)
 		if err != nil {
@@ -93,11 +94,9 @@ func (s *Topom) SlotCreateActionSome(groupFrom, groupTo int, numSlots int) error
 		m.Action.State = models.ActionPending
 		m.Action.Index = ctx.maxSlotActionIndex() + 1
 		m.Action.TargetId = g.Id
-		if err := s.storeUpdateSlotMapping(m); err != nil {
-			return err
-		}
+		s.batchUpdateSlotMapping(batch, m)
 	}
-	return nil
+	return s.storeCommit(batch)
 }
 
 func (s *Topom) SlotCreateActionRange(beg, end int, gid int, must bool) error {
@@ -141,6 +140,7 @@ func (s *Topom) SlotCreateActionRange(beg, end int, gid int, must bool) error {
 		pending = append(pending, m.Id)
 	}
 
+	var batch = s.store.NewBatch()
 	for _, sid := range pending {
 		m, err := ctx.getSlotMapping(sid)
 		if err != nil {
@@ -151,11 +151,9 @@ func (s *Topom) SlotCreateActionRange(beg, end int, gid int, must bool) error {
 		m.Action.State = models.ActionPending
 		m.Action.Index = ctx.maxSlotActionIndex() + 1
 		m.Action.TargetId = g.Id
-		if err := s.storeUpdateSlotMapping(m); err != nil {
-			return err
-		}
+		s.batchUpdateSlotMapping(batch, m)
 	}
-	return nil
+	return s.storeCommit(batch)
 }
 
 func (s *Topom) SlotRemoveAction(sid int) error {
@@ -483,13 +481,12 @@ func (s *Topom) SlotsAssignGroup(slots []*models.SlotMapping) error {
 		}
 	}
 
+	var batch = s.store.NewBatch()
 	for i, m := range slots {
 		if g := ctx.group[m.GroupId]; !g.OutOfSync {
 			defer s.dirtyGroupCache(g.Id)
 			g.OutOfSync = true
-			if err := s.storeUpdateGroup(g); err != nil {
-				return err
-			}
+			s.batchUpdateGroup(batch, g)
 		}
 		slots[i] = &models.SlotMapping{
 			Id: m.Id, GroupId: m.GroupId,
@@ -501,9 +498,10 @@ func (s *Topom) SlotsAssignGroup(slots []*models.SlotMapping) error {
 
 		log.Warnf("slot-[%d] will be mapped to group-[%d]", m.Id, m.GroupId)
 
-		if err := s.storeUpdateSlotMapping(m); err != nil {
-			return err
-		}
+		s.batchUpdateSlotMapping(batch, m)
+	}
+	if err := s.storeCommit(batch); err != nil {
+		return err
 	}
 	return s.resyncSlotMappings(ctx, slots...)
 }
@@ -532,14 +530,16 @@ func (s *Topom) SlotsAssignOffline(slots []*models.SlotMapping) error {
 		}
 	}
 
+	var batch = s.store.NewBatch()
 	for _, m := range slots {
 		defer s.dirtySlotsCache(m.Id)
 
 		log.Warnf("slot-[%d] will be mapped to group-[%d] (offline)", m.Id, m.GroupId)
 
-		if err := s.storeUpdateSlotMapping(m); err != nil {
-			return err
-		}
+		s.batchUpdateSlotMapping(batch, m)
+	}
+	if err := s.storeCommit(batch); err != nil {
+		return err
 	}
 	return s.resyncSlotMappings(ctx, slots...)
 }
@@ -697,6 +697,7 @@ func (s *Topom) SlotsRebalance(confirm bool) (map[int]int, error) {
 	}
 	sort.Ints(slotIds)
 
+	var batch = s.store.NewBatch()
 	for _, sid := range slotIds {
 		m, err := ctx.getSlotMapping(sid)
 		if err != nil {
@@ -707,9 +708,10 @@ func (s *Topom) SlotsRebalance(confirm bool) (map[int]int, error) {
 		m.Action.State = models.ActionPending
 		m.Action.Index = ctx.maxSlotActionIndex() + 1
 		m.Action.TargetId = plans[sid]
-		if err := s.storeUpdateSlotMapping(m); err != nil {
-			return nil, err
-		}
+		s.batchUpdateSlotMapping(batch, m)
+	}
+	if err := s.storeCommit(batch); err != nil {
+		return nil, err
 	}
 	return plans, nil
 }
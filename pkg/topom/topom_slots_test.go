@@ -443,6 +443,51 @@ func TestSlotsAssignGroup(x *testing.T) {
 	assert.MustNoError(t.SlotsAssignGroup([]*models.SlotMapping{m}))
 }
 
+func TestSlotsAssignGroupAtomic(x *testing.T) {
+	client := newDiskClient()
+
+	t, err := New(newForkClient(client), config)
+	assert.MustNoError(err)
+	defer t.Close()
+	assert.MustNoError(t.Start(false))
+
+	g := &models.Group{Id: 200, Servers: []*models.GroupServer{
+		&models.GroupServer{Addr: "server"},
+	}}
+	contextCreateGroup(t, g)
+	getSlotMapping(t, 0)
+
+	store := models.NewStore(newForkClient(client), config.ProductName)
+	defer store.Close()
+
+	m, err := store.LoadSlotMapping(5, false)
+	assert.MustNoError(err)
+	assert.Must(m == nil)
+	assert.MustNoError(store.UpdateSlotMapping(&models.SlotMapping{Id: 5}))
+
+	var slots []*models.SlotMapping
+	for i := 0; i < 10; i++ {
+		slots = append(slots, &models.SlotMapping{Id: i, GroupId: g.Id})
+	}
+	assert.Must(t.SlotsAssignGroup(slots) != nil)
+
+	for i := 0; i < 10; i++ {
+		m, err := store.LoadSlotMapping(i, false)
+		assert.MustNoError(err)
+		assert.Must(m == nil || m.GroupId == 0)
+	}
+	g, err = store.LoadGroup(g.Id, true)
+	assert.MustNoError(err)
+	assert.Must(!g.OutOfSync)
+
+	assert.MustNoError(t.SlotsAssignGroup(slots))
+	for i := 0; i < 10; i++ {
+		m, err := store.LoadSlotMapping(i, true)
+		assert.MustNoError(err)
+		assert.Must(m.GroupId == g.Id)
+	}
+}
+
 func TestSlotsRebalance(x *testing.T) {
 	t := openTopom()
 	defer t.Close()
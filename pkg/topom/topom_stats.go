@@ -141,6 +141,8 @@ func (s *Topom) RefreshProxyStats(timeout time.Duration) (*sync2.Future, error)
 	if err != nil {
 		return nil, err
 	}
+	var epoch, synced = s.epoch.value, s.epoch.synced
+
 	var fut sync2.Future
 	for _, p := range ctx.proxy {
 		fut.Add()
@@ -151,11 +153,18 @@ func (s *Topom) RefreshProxyStats(timeout time.Duration) (*sync2.Future, error)
 
 			switch x := stats.Stats; {
 			case x == nil:
-			case x.Closed || x.Online:
-			default:
+			case x.Closed:
+			case !x.Online:
 				if err := s.OnlineProxy(p.AdminAddr); err != nil {
 					log.WarnErrorf(err, "auto online proxy-[%s] failed", p.Token)
 				}
+			case x.Epoch > epoch:
+				s.advanceEpoch(x.Epoch)
+			case x.Epoch != 0 && x.SyncedEpoch < synced:
+				log.Warnf("proxy-[%s] synced epoch = %d is behind %d, resync", p.Token, x.SyncedEpoch, synced)
+				if err := s.ReinitProxy(p.Token); err != nil {
+					log.WarnErrorf(err, "auto resync proxy-[%s] failed", p.Token)
+				}
 			}
 		}(p)
 	}
@@ -64,6 +64,10 @@ func (b *Reader) buffered() int {
 	return b.wpos - b.rpos
 }
 
+func (b *Reader) Buffered() int {
+	return b.buffered()
+}
+
 func (b *Reader) Read(p []byte) (int, error) {
 	if b.err != nil || len(p) == 0 {
 		return 0, b.err
@@ -304,6 +304,160 @@ func (c *Client) Role() (string, error) {
 	}
 }
 
+func (c *Client) SlotsScan(slot int, cursor int, count int) (int, []string, error) {
+	if reply, err := c.Do("SLOTSSCAN", slot, cursor, "COUNT", count); err != nil {
+		return 0, nil, errors.Trace(err)
+	} else {
+		values, err := redigo.Values(reply, nil)
+		if err != nil || len(values) != 2 {
+			return 0, nil, errors.Errorf("invalid response = %v", reply)
+		}
+		next, err := redigo.Int(values[0], nil)
+		if err != nil {
+			return 0, nil, errors.Errorf("invalid response[0] = %v", values[0])
+		}
+		keys, err := redigo.Strings(values[1], nil)
+		if err != nil {
+			return 0, nil, errors.Errorf("invalid response[1] = %v", values[1])
+		}
+		return next, keys, nil
+	}
+}
+
+type KeyInfo struct {
+	Key    string `json:"key"`
+	Type   string `json:"type"`
+	Length int64  `json:"length"`
+	Bytes  int64  `json:"bytes,omitempty"`
+	TTL    int64  `json:"ttl"`
+}
+
+var keyLengthCommands = map[string]string{
+	"string": "STRLEN",
+	"list":   "LLEN",
+	"hash":   "HLEN",
+	"set":    "SCARD",
+	"zset":   "ZCARD",
+}
+
+func (c *Client) MemoryUsage(key string) (int64, error) {
+	n, err := redigo.Int64(c.Do("MEMORY", "USAGE", key))
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return n, nil
+}
+
+func (c *Client) KeysInfo(keys []string, memory bool) ([]*KeyInfo, error) {
+	for _, key := range keys {
+		if err := c.Send("TYPE", key); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	var infos = make([]*KeyInfo, 0, len(keys))
+	for _, key := range keys {
+		r, err := c.receiveKeyReply()
+		if err != nil {
+			return nil, err
+		}
+		if typ, _ := redigo.String(r, nil); keyLengthCommands[typ] != "" {
+			infos = append(infos, &KeyInfo{Key: key, Type: typ})
+		}
+	}
+	for _, x := range infos {
+		if err := c.Send(keyLengthCommands[x.Type], x.Key); err != nil {
+			return nil, err
+		}
+		if err := c.Send("TTL", x.Key); err != nil {
+			return nil, err
+		}
+		if memory {
+			if err := c.Send("MEMORY", "USAGE", x.Key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	var valid = infos[:0]
+	for _, x := range infos {
+		var ok = true
+		n, err := c.receiveKeyInt64(&ok)
+		if err != nil {
+			return nil, err
+		}
+		x.Length = n
+		ttl, err := c.receiveKeyInt64(&ok)
+		if err != nil {
+			return nil, err
+		}
+		x.TTL = ttl
+		if memory {
+			b, err := c.receiveKeyInt64(&ok)
+			if err != nil {
+				return nil, err
+			}
+			x.Bytes = b
+		} else if x.Type == "string" {
+			x.Bytes = n
+		}
+		// skip keys that expired or changed since TYPE
+		if ok && ttl != -2 {
+			valid = append(valid, x)
+		}
+	}
+	return valid, nil
+}
+
+// ReceiveReply is like Receive, but error replies are returned as replies
+// of type error and the connection is kept, only failures of the connection
+// are returned as errors.
+func (c *Client) ReceiveReply() (interface{}, error) {
+	r, err := c.conn.Receive()
+	if err != nil {
+		if _, ok := err.(redigo.Error); !ok {
+			c.Close()
+			return nil, errors.Trace(err)
+		}
+		r = err
+	}
+	c.Pipeline.Recv++
+
+	c.LastUse = time.Now()
+	return r, nil
+}
+
+// receiveKeyReply returns error replies of a key as nil, e.g. the key has
+// changed its type.
+func (c *Client) receiveKeyReply() (interface{}, error) {
+	r, err := c.ReceiveReply()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := r.(error); ok {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// receiveKeyInt64 clears ok if the reply is nil or an error reply.
+func (c *Client) receiveKeyInt64(ok *bool) (int64, error) {
+	r, err := c.receiveKeyReply()
+	if err != nil {
+		return 0, err
+	}
+	n, err := redigo.Int64(r, nil)
+	if err != nil {
+		*ok = false
+		return 0, nil
+	}
+	return n, nil
+}
+
 var ErrClosedPool = errors.New("use of closed redis pool")
 
 type Pool struct {
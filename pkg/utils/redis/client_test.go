@@ -0,0 +1,119 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+)
+
+func newFakeServer(t *testing.T, handle func(args []string) string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.MustNoError(err)
+	go func() {
+		defer l.Close()
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+		for {
+			var n int
+			if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+				return
+			}
+			var args []string
+			for i := 0; i < n; i++ {
+				var size int
+				if _, err := fmt.Fscanf(r, "$%d\r\n", &size); err != nil {
+					return
+				}
+				b := make([]byte, size+2)
+				if _, err := r.Read(b); err != nil {
+					return
+				}
+				args = append(args, string(b[:size]))
+			}
+			c.Write([]byte(handle(args)))
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestKeysInfo(t *testing.T) {
+	var types = map[string]string{
+		"a": "string", "b": "string", "c": "hash", "d": "string", "e": "none",
+	}
+	addr := newFakeServer(t, func(args []string) string {
+		cmd, key := strings.ToUpper(args[0]), args[len(args)-1]
+		switch {
+		case cmd == "TYPE" && key == "f":
+			return "-ERR unknown\r\n"
+		case cmd == "TYPE":
+			return fmt.Sprintf("+%s\r\n", types[key])
+		case cmd == "HLEN":
+			return "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+		case cmd == "TTL" && key == "b":
+			return ":-2\r\n"
+		case cmd == "TTL":
+			return ":-1\r\n"
+		case cmd == "MEMORY" && key == "d":
+			return "$-1\r\n"
+		case cmd == "MEMORY":
+			return ":100\r\n"
+		}
+		return ":5\r\n"
+	})
+
+	c, err := NewClientNoAuth(addr, time.Second)
+	assert.MustNoError(err)
+	defer c.Close()
+
+	infos, err := c.KeysInfo([]string{"a", "b", "c", "d", "e", "f"}, true)
+	assert.MustNoError(err)
+	assert.Must(len(infos) == 1)
+	assert.Must(infos[0].Key == "a" && infos[0].Length == 5 && infos[0].Bytes == 100 && infos[0].TTL == -1)
+
+	infos, err = c.KeysInfo([]string{"a", "d"}, false)
+	assert.MustNoError(err)
+	assert.Must(len(infos) == 2 && infos[1].Bytes == 5)
+}
+
+func TestReceiveReply(t *testing.T) {
+	addr := newFakeServer(t, func(args []string) string {
+		if args[1] == "b" {
+			return "-BUSYKEY Target key name already exists.\r\n"
+		}
+		return "+OK\r\n"
+	})
+
+	c, err := NewClientNoAuth(addr, time.Second)
+	assert.MustNoError(err)
+	defer c.Close()
+
+	for _, key := range []string{"a", "b", "c"} {
+		assert.MustNoError(c.Send("RESTORE", key, 0, "x"))
+	}
+	assert.MustNoError(c.Flush())
+
+	var replies []interface{}
+	for i := 0; i < 3; i++ {
+		r, err := c.ReceiveReply()
+		assert.MustNoError(err)
+		replies = append(replies, r)
+	}
+	_, ok := replies[1].(error)
+	assert.Must(ok && replies[0] == "OK" && replies[2] == "OK")
+	assert.Must(c.isRecyclable())
+
+	_, err = c.Do("RESTORE", "d", 0, "x")
+	assert.MustNoError(err)
+}
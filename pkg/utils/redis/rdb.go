@@ -0,0 +1,503 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/errors"
+)
+
+const (
+	rdbTypeString = 0
+	rdbTypeList   = 1
+	rdbTypeSet    = 2
+	rdbTypeZSet   = 3
+	rdbTypeHash   = 4
+	rdbTypeZSet2  = 5
+
+	rdbTypeHashZipmap  = 9
+	rdbTypeListZiplist = 10
+	rdbTypeSetIntset   = 11
+	rdbTypeZSetZiplist = 12
+	rdbTypeHashZiplist = 13
+	rdbTypeListQuick   = 14
+
+	rdbOpcodeIdle       = 0xf8
+	rdbOpcodeFreq       = 0xf9
+	rdbOpcodeAux        = 0xfa
+	rdbOpcodeResizeDB   = 0xfb
+	rdbOpcodeExpireMsec = 0xfc
+	rdbOpcodeExpireSec  = 0xfd
+	rdbOpcodeSelectDB   = 0xfe
+	rdbOpcodeEOF        = 0xff
+
+	rdbEncodeInt8  = 0
+	rdbEncodeInt16 = 1
+	rdbEncodeInt32 = 2
+	rdbEncodeLZF   = 3
+)
+
+// crc64 of redis, jones polynomial in reversed form, without inversion.
+var rdbCrc64Table = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+func rdbCrc64(crc uint64, p []byte) uint64 {
+	return ^crc64.Update(^crc, rdbCrc64Table, p)
+}
+
+// RdbEntry is a key of RDB, Value is kept in the raw encoding of RDB.
+type RdbEntry struct {
+	DB       int
+	Key      []byte
+	ExpireAt int64
+	Type     byte
+	Value    []byte
+	Version  int
+}
+
+// DumpPayload returns the serialized value that is accepted by RESTORE.
+func (e *RdbEntry) DumpPayload() []byte {
+	b := make([]byte, 0, len(e.Value)+11)
+	b = append(b, e.Type)
+	b = append(b, e.Value...)
+	b = append(b, byte(e.Version), byte(e.Version>>8))
+	var crc [8]byte
+	binary.LittleEndian.PutUint64(crc[:], rdbCrc64(0, b))
+	return append(b, crc[:]...)
+}
+
+// RdbLoader iterates keys of a RDB file, modules & streams are not supported.
+type RdbLoader struct {
+	r *bufio.Reader
+
+	version int
+	db      int
+	crc     uint64
+
+	raw *bytes.Buffer
+}
+
+func NewRdbLoader(r io.Reader) *RdbLoader {
+	return &RdbLoader{r: bufio.NewReaderSize(r, 1024*64)}
+}
+
+func (l *RdbLoader) Version() int {
+	return l.version
+}
+
+func (l *RdbLoader) read(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(l.r, b); err != nil {
+		return nil, errors.Trace(err)
+	}
+	l.crc = rdbCrc64(l.crc, b)
+	if l.raw != nil {
+		l.raw.Write(b)
+	}
+	return b, nil
+}
+
+func (l *RdbLoader) readByte() (byte, error) {
+	b, err := l.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (l *RdbLoader) readLength() (uint64, bool, error) {
+	c, err := l.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch c >> 6 {
+	case 0:
+		return uint64(c & 0x3f), false, nil
+	case 1:
+		b, err := l.readByte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(c&0x3f)<<8 | uint64(b), false, nil
+	case 3:
+		return uint64(c & 0x3f), true, nil
+	}
+	switch c {
+	case 0x80:
+		b, err := l.read(4)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(binary.BigEndian.Uint32(b)), false, nil
+	case 0x81:
+		b, err := l.read(8)
+		if err != nil {
+			return 0, false, err
+		}
+		return binary.BigEndian.Uint64(b), false, nil
+	}
+	return 0, false, errors.Errorf("invalid rdb length 0x%02x", c)
+}
+
+func (l *RdbLoader) readCount() (int, error) {
+	n, encoded, err := l.readLength()
+	if err != nil {
+		return 0, err
+	}
+	if encoded {
+		return 0, errors.Errorf("invalid rdb length, unexpected encoding")
+	}
+	return int(n), nil
+}
+
+func (l *RdbLoader) readString() ([]byte, error) {
+	n, encoded, err := l.readLength()
+	if err != nil {
+		return nil, err
+	}
+	if !encoded {
+		return l.read(int(n))
+	}
+	switch n {
+	case rdbEncodeInt8:
+		b, err := l.read(1)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.Itoa(int(int8(b[0])))), nil
+	case rdbEncodeInt16:
+		b, err := l.read(2)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.Itoa(int(int16(binary.LittleEndian.Uint16(b))))), nil
+	case rdbEncodeInt32:
+		b, err := l.read(4)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.Itoa(int(int32(binary.LittleEndian.Uint32(b))))), nil
+	case rdbEncodeLZF:
+		clen, err := l.readCount()
+		if err != nil {
+			return nil, err
+		}
+		ulen, err := l.readCount()
+		if err != nil {
+			return nil, err
+		}
+		b, err := l.read(clen)
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(b, ulen)
+	}
+	return nil, errors.Errorf("invalid rdb string encoding %d", n)
+}
+
+func (l *RdbLoader) skipStrings(n int) error {
+	for i := 0; i < n; i++ {
+		if _, err := l.readString(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *RdbLoader) skipValue(t byte) error {
+	switch t {
+	case rdbTypeString, rdbTypeHashZipmap, rdbTypeListZiplist, rdbTypeSetIntset, rdbTypeZSetZiplist, rdbTypeHashZiplist:
+		return l.skipStrings(1)
+	case rdbTypeList, rdbTypeSet, rdbTypeListQuick:
+		n, err := l.readCount()
+		if err != nil {
+			return err
+		}
+		return l.skipStrings(n)
+	case rdbTypeHash:
+		n, err := l.readCount()
+		if err != nil {
+			return err
+		}
+		return l.skipStrings(n * 2)
+	case rdbTypeZSet, rdbTypeZSet2:
+		n, err := l.readCount()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := l.skipStrings(1); err != nil {
+				return err
+			}
+			if t == rdbTypeZSet2 {
+				if _, err := l.read(8); err != nil {
+					return err
+				}
+				continue
+			}
+			c, err := l.readByte()
+			if err != nil {
+				return err
+			}
+			if c < 253 {
+				if _, err := l.read(int(c)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return errors.Errorf("unsupported rdb type %d", t)
+}
+
+func (l *RdbLoader) readHeader() error {
+	b, err := l.read(9)
+	if err != nil {
+		return err
+	}
+	if string(b[:5]) != "REDIS" {
+		return errors.Errorf("invalid rdb header %q", b)
+	}
+	v, err := strconv.Atoi(string(b[5:]))
+	if err != nil {
+		return errors.Errorf("invalid rdb version %q", b[5:])
+	}
+	l.version = v
+	return nil
+}
+
+// Next returns the next key, or io.EOF at the end of the RDB file.
+func (l *RdbLoader) Next() (*RdbEntry, error) {
+	if l.version == 0 {
+		if err := l.readHeader(); err != nil {
+			return nil, err
+		}
+	}
+	var expireAt int64
+	for {
+		t, err := l.readByte()
+		if err != nil {
+			return nil, err
+		}
+		switch t {
+		case rdbOpcodeAux:
+			if err := l.skipStrings(2); err != nil {
+				return nil, err
+			}
+		case rdbOpcodeResizeDB:
+			for i := 0; i < 2; i++ {
+				if _, err := l.readCount(); err != nil {
+					return nil, err
+				}
+			}
+		case rdbOpcodeSelectDB:
+			n, err := l.readCount()
+			if err != nil {
+				return nil, err
+			}
+			l.db = n
+		case rdbOpcodeExpireSec:
+			b, err := l.read(4)
+			if err != nil {
+				return nil, err
+			}
+			expireAt = int64(binary.LittleEndian.Uint32(b)) * 1000
+		case rdbOpcodeExpireMsec:
+			b, err := l.read(8)
+			if err != nil {
+				return nil, err
+			}
+			expireAt = int64(binary.LittleEndian.Uint64(b))
+		case rdbOpcodeFreq:
+			if _, err := l.read(1); err != nil {
+				return nil, err
+			}
+		case rdbOpcodeIdle:
+			if _, err := l.readCount(); err != nil {
+				return nil, err
+			}
+		case rdbOpcodeEOF:
+			if l.version >= 5 {
+				expect := l.crc
+				b, err := l.read(8)
+				if err != nil {
+					return nil, err
+				}
+				if crc := binary.LittleEndian.Uint64(b); crc != 0 && crc != expect {
+					return nil, errors.Errorf("rdb checksum mismatch, 0x%016x != 0x%016x", crc, expect)
+				}
+			}
+			return nil, io.EOF
+		default:
+			key, err := l.readString()
+			if err != nil {
+				return nil, err
+			}
+			l.raw = &bytes.Buffer{}
+			err = l.skipValue(t)
+			value := l.raw.Bytes()
+			l.raw = nil
+			if err != nil {
+				return nil, err
+			}
+			return &RdbEntry{
+				DB: l.db, Key: key, ExpireAt: expireAt,
+				Type: t, Value: value, Version: l.version,
+			}, nil
+		}
+	}
+}
+
+func lzfDecompress(in []byte, n int) ([]byte, error) {
+	out := make([]byte, 0, n)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 {
+			ctrl++
+			if i+ctrl > len(in) {
+				return nil, errors.Errorf("invalid lzf data")
+			}
+			out = append(out, in[i:i+ctrl]...)
+			i += ctrl
+			continue
+		}
+		length := ctrl >> 5
+		if length == 7 {
+			if i >= len(in) {
+				return nil, errors.Errorf("invalid lzf data")
+			}
+			length += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errors.Errorf("invalid lzf data")
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 {
+			return nil, errors.Errorf("invalid lzf data")
+		}
+		for j := 0; j < length+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != n {
+		return nil, errors.Errorf("invalid lzf data, length = %d, expect = %d", len(out), n)
+	}
+	return out, nil
+}
+
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	return c.Conn.Read(b)
+}
+
+// SyncRdb fetches the RDB of addr as a pseudo replica and copies it into w,
+// SYNC makes the server BGSAVE & send the RDB once it's done. The timeout
+// applies to every read, servers keep sending newlines during BGSAVE.
+func SyncRdb(addr string, auth string, w io.Writer, timeout time.Duration) (int64, error) {
+	conn, err := net.DialTimeout("tcp", addr, time.Second*5)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer conn.Close()
+
+	var r = bufio.NewReaderSize(&deadlineConn{conn, timeout}, 1024*64)
+
+	var request = func(args ...string) error {
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "*%d\r\n", len(args))
+		for _, s := range args {
+			fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(s), s)
+		}
+		conn.SetWriteDeadline(time.Now().Add(timeout))
+		_, err := conn.Write(b.Bytes())
+		return errors.Trace(err)
+	}
+	var response = func() (string, error) {
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return "", errors.Trace(err)
+			}
+			line = strings.TrimRight(line, "\r\n")
+			switch {
+			case line == "":
+				continue
+			case line[0] == '-':
+				return "", errors.Errorf("redis error: %s", line[1:])
+			}
+			return line, nil
+		}
+	}
+
+	if auth != "" {
+		if err := request("AUTH", auth); err != nil {
+			return 0, err
+		}
+		if _, err := response(); err != nil {
+			return 0, err
+		}
+	}
+	if err := request("SYNC"); err != nil {
+		return 0, err
+	}
+	line, err := response()
+	if err != nil {
+		return 0, err
+	}
+	if line[0] != '$' {
+		return 0, errors.Errorf("invalid sync response %q", line)
+	}
+
+	// diskless replication, the payload is terminated by the 40 bytes mark
+	if mark := line[1:]; strings.HasPrefix(mark, "EOF:") {
+		mark = mark[4:]
+		var size int64
+		var held []byte
+		var buf = make([]byte, 1024*64)
+		for {
+			n, err := r.Read(buf)
+			if err != nil {
+				return size, errors.Trace(err)
+			}
+			held = append(held, buf[:n]...)
+			if bytes.HasSuffix(held, []byte(mark)) {
+				held = held[:len(held)-len(mark)]
+				_, err := w.Write(held)
+				return size + int64(len(held)), errors.Trace(err)
+			}
+			if len(held) > len(mark) {
+				flush := held[:len(held)-len(mark)]
+				if _, err := w.Write(flush); err != nil {
+					return size, errors.Trace(err)
+				}
+				size += int64(len(flush))
+				held = append(held[:0], held[len(flush):]...)
+			}
+		}
+	}
+
+	n, err := strconv.ParseInt(line[1:], 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("invalid sync response %q", line)
+	}
+	size, err := io.CopyN(w, r, n)
+	return size, errors.Trace(err)
+}
@@ -0,0 +1,89 @@
+// Copyright 2016 CodisLabs. All Rights Reserved.
+// Licensed under the MIT (MIT-LICENSE.txt) license.
+
+package redis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/CodisLabs/codis/pkg/utils/assert"
+)
+
+func TestRdbCrc64(t *testing.T) {
+	assert.Must(rdbCrc64(0, []byte("123456789")) == 0xe9c6d914c4b8d9ca)
+
+	e := &RdbEntry{Type: rdbTypeString, Value: []byte{0xc0, 0x0a}, Version: 6}
+	assert.Must(bytes.Equal(e.DumpPayload(), []byte("\x00\xc0\x0a\x06\x00\xf8\x72\x3f\xc5\xfb\xfb\x5f\x28")))
+}
+
+func TestRdbLoader(t *testing.T) {
+	var b bytes.Buffer
+	b.WriteString("REDIS0007")
+	b.WriteString("\xfa\x09redis-ver\x053.2.0")
+	b.WriteString("\xfe\x00\xfb\x04\x01")
+	b.WriteString("\x00\x03foo\x03bar")
+	b.WriteString("\xfc\xe8\x03\x00\x00\x00\x00\x00\x00\x00\x03baz\xc0\x0a")
+	b.WriteString("\x01\x04list\x02\x01a\x01b")
+	b.WriteString("\x03\x01z\x01\x01m\x011")
+	b.WriteString("\xfe\x02")
+	b.WriteString("\x00\xc1\x39\x30\xc3\x04\x08\x00\x61\xa0\x00")
+	b.WriteString("\xff")
+	var crc [8]byte
+	binary.LittleEndian.PutUint64(crc[:], rdbCrc64(0, b.Bytes()))
+	b.Write(crc[:])
+
+	l := NewRdbLoader(bytes.NewReader(b.Bytes()))
+
+	var entries []*RdbEntry
+	for {
+		e, err := l.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.MustNoError(err)
+		entries = append(entries, e)
+	}
+	assert.Must(l.Version() == 7)
+	assert.Must(len(entries) == 5)
+
+	e0 := entries[0]
+	assert.Must(string(e0.Key) == "foo" && e0.ExpireAt == 0)
+	assert.Must(e0.Type == rdbTypeString && string(e0.Value) == "\x03bar")
+
+	e1 := entries[1]
+	assert.Must(string(e1.Key) == "baz" && e1.ExpireAt == 1000)
+	assert.Must(string(e1.Value) == "\xc0\x0a")
+
+	e2 := entries[2]
+	assert.Must(string(e2.Key) == "list" && e2.Type == rdbTypeList)
+	assert.Must(string(e2.Value) == "\x02\x01a\x01b")
+
+	e3 := entries[3]
+	assert.Must(string(e3.Key) == "z" && string(e3.Value) == "\x01\x01m\x011")
+
+	e4 := entries[4]
+	assert.Must(string(e4.Key) == "12345" && e4.DB == 2)
+	assert.Must(string(e4.Value) == "\xc3\x04\x08\x00\x61\xa0\x00")
+
+	b.Bytes()[b.Len()-1] ^= 0xff
+	l = NewRdbLoader(bytes.NewReader(b.Bytes()))
+	for {
+		_, err := l.Next()
+		if err != nil {
+			assert.Must(err != io.EOF)
+			break
+		}
+	}
+}
+
+func TestLzfDecompress(t *testing.T) {
+	b, err := lzfDecompress([]byte("\x00\x61\xa0\x00"), 8)
+	assert.MustNoError(err)
+	assert.Must(string(b) == "aaaaaaaa")
+
+	_, err = lzfDecompress([]byte("\x00\x61\xa0\x05"), 8)
+	assert.Must(err != nil)
+}